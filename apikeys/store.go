@@ -0,0 +1,391 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dcrypto"
+	"github.com/exograd/go-daemon/derr"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/ksuid"
+	"github.com/exograd/go-daemon/pg"
+	"github.com/jackc/pgx/v4"
+)
+
+// TableSQL is the definition of the table used by the store; it must be
+// created by a schema migration.
+const TableSQL = `
+CREATE TABLE api_keys (
+  id VARCHAR NOT NULL PRIMARY KEY,
+  name VARCHAR NOT NULL,
+  secret_hash VARCHAR NOT NULL,
+  scopes VARCHAR[] NOT NULL DEFAULT '{}',
+  creation_time TIMESTAMP NOT NULL,
+  expiration_time TIMESTAMP,
+  revocation_time TIMESTAMP,
+  last_use_time TIMESTAMP
+);
+`
+
+const (
+	keyPrefix = "dk_"
+
+	lastUseUpdateInterval = time.Minute
+)
+
+var (
+	ErrKeyNotFound = derr.New(derr.CodeNotFound, "api key not found")
+	ErrInvalidKey  = derr.New(derr.CodeUnauthorized, "invalid api key")
+	ErrKeyRevoked  = derr.New(derr.CodeUnauthorized, "api key revoked")
+	ErrKeyExpired  = derr.New(derr.CodeUnauthorized, "api key expired")
+)
+
+type StoreCfg struct {
+	Log *dlog.Logger `json:"-"`
+	Pg  *pg.Client   `json:"-"`
+
+	Table string `json:"table,omitempty"`
+
+	// The names of the http servers whose requests are authenticated using
+	// api keys.
+	Servers []string `json:"servers,omitempty"`
+
+	// The header containing api keys; keys are also accepted as bearer
+	// tokens in the Authorization header.
+	Header string `json:"header,omitempty"`
+}
+
+func (cfg *StoreCfg) Check(c *check.Checker) {
+	c.WithChild("servers", func() {
+		for i, name := range cfg.Servers {
+			c.CheckStringNotEmpty(i, name)
+		}
+	})
+}
+
+type Key struct {
+	Id             string     `json:"id"`
+	Name           string     `json:"name"`
+	Scopes         []string   `json:"scopes"`
+	CreationTime   time.Time  `json:"creation_time"`
+	ExpirationTime *time.Time `json:"expiration_time,omitempty"`
+	RevocationTime *time.Time `json:"revocation_time,omitempty"`
+	LastUseTime    *time.Time `json:"last_use_time,omitempty"`
+
+	secretHash string
+}
+
+func (k *Key) FromRow(row pgx.Row) error {
+	return row.Scan(&k.Id, &k.Name, &k.secretHash, &k.Scopes,
+		&k.CreationTime, &k.ExpirationTime, &k.RevocationTime,
+		&k.LastUseTime)
+}
+
+type Keys []*Key
+
+func (ks *Keys) AddFromRow(row pgx.Row) error {
+	var k Key
+	if err := k.FromRow(row); err != nil {
+		return err
+	}
+
+	*ks = append(*ks, &k)
+	return nil
+}
+
+// Store manages api keys. Only a hash of the secret part of each key is
+// stored; the full key is returned once when the key is created.
+type Store struct {
+	Cfg StoreCfg
+	Log *dlog.Logger
+	Pg  *pg.Client
+
+	lastUses     map[string]time.Time
+	lastUseMutex sync.Mutex
+}
+
+func NewStore(cfg StoreCfg) (*Store, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("api-keys")
+	}
+
+	if cfg.Pg == nil {
+		return nil, fmt.Errorf("missing pg client")
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "api_keys"
+	}
+
+	if cfg.Header == "" {
+		cfg.Header = "X-API-Key"
+	}
+
+	s := &Store{
+		Cfg: cfg,
+		Log: cfg.Log,
+		Pg:  cfg.Pg,
+
+		lastUses: make(map[string]time.Time),
+	}
+
+	return s, nil
+}
+
+func (s *Store) columns() string {
+	return `id, name, secret_hash, scopes, creation_time, expiration_time,
+  revocation_time, last_use_time`
+}
+
+// Create creates a new key and returns it with the full key string, which
+// cannot be obtained later.
+func (s *Store) Create(ctx context.Context, name string, scopes []string, expirationTime *time.Time) (*Key, string, error) {
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	id := ksuid.Generate().String()
+	secret := dcrypto.RandomHexString(32)
+
+	key := Key{
+		Id:             id,
+		Name:           name,
+		Scopes:         scopes,
+		CreationTime:   time.Now().UTC(),
+		ExpirationTime: expirationTime,
+
+		secretHash: hashSecret(secret),
+	}
+
+	query := fmt.Sprintf(`
+INSERT INTO %s (%s)
+  VALUES ($1, $2, $3, $4, $5, $6, NULL, NULL)
+`, s.Cfg.Table, s.columns())
+
+	err := s.Pg.WithConn(func(conn pg.Conn) error {
+		return pg.ExecContext(ctx, conn, query, key.Id, key.Name,
+			key.secretHash, key.Scopes, key.CreationTime, key.ExpirationTime)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot insert key: %w", err)
+	}
+
+	s.Log.Info("api key %q (%s) created", name, id)
+
+	return &key, formatKey(id, secret), nil
+}
+
+func (s *Store) Revoke(ctx context.Context, id string) error {
+	query := fmt.Sprintf(`
+UPDATE %s
+  SET revocation_time = $2
+  WHERE id = $1 AND revocation_time IS NULL
+`, s.Cfg.Table)
+
+	var n int64
+
+	err := s.Pg.WithConn(func(conn pg.Conn) (err error) {
+		n, err = pg.Exec2Context(ctx, conn, query, id, time.Now().UTC())
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("cannot update key: %w", err)
+	}
+
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+
+	s.Log.Info("api key %s revoked", id)
+
+	return nil
+}
+
+func (s *Store) Key(ctx context.Context, id string) (*Key, error) {
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM %s
+  WHERE id = $1
+`, s.columns(), s.Cfg.Table)
+
+	var key Key
+
+	err := s.Pg.WithConn(func(conn pg.Conn) error {
+		return pg.QueryObjectContext(ctx, conn, &key, query, id)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrKeyNotFound
+		}
+
+		return nil, fmt.Errorf("cannot load key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (s *Store) Keys(ctx context.Context) (Keys, error) {
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM %s
+  ORDER BY creation_time
+`, s.columns(), s.Cfg.Table)
+
+	var keys Keys
+
+	err := s.Pg.WithConn(func(conn pg.Conn) error {
+		return pg.QueryObjectsContext(ctx, conn, &keys, query)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot load keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Verify returns the key identified by a key string if it is valid.
+func (s *Store) Verify(ctx context.Context, keyString string) (*Key, error) {
+	id, secret, err := parseKey(keyString)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.Key(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, ErrInvalidKey
+		}
+
+		return nil, err
+	}
+
+	hash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.secretHash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+
+	if key.RevocationTime != nil {
+		return nil, ErrKeyRevoked
+	}
+
+	if key.ExpirationTime != nil && time.Now().After(*key.ExpirationTime) {
+		return nil, ErrKeyExpired
+	}
+
+	s.updateLastUse(ctx, key)
+
+	return key, nil
+}
+
+// Authenticate implements dhttp.Authenticator.
+func (s *Store) Authenticate(h *dhttp.Handler) (*dhttp.Principal, error) {
+	keyString := h.Request.Header.Get(s.Cfg.Header)
+	if keyString == "" {
+		token := h.BearerToken()
+		if !strings.HasPrefix(token, keyPrefix) {
+			return nil, nil
+		}
+
+		keyString = token
+	}
+
+	key, err := s.Verify(h.Context(), keyString)
+	if err != nil {
+		if errors.Is(err, ErrInvalidKey) || errors.Is(err, ErrKeyRevoked) ||
+			errors.Is(err, ErrKeyExpired) {
+			return nil, fmt.Errorf("%w: %v", dhttp.ErrInvalidCredentials, err)
+		}
+
+		return nil, err
+	}
+
+	principal := dhttp.Principal{
+		Id:     key.Id,
+		Type:   "api_key",
+		Scopes: key.Scopes,
+		Data: map[string]interface{}{
+			"name": key.Name,
+		},
+	}
+
+	return &principal, nil
+}
+
+// updateLastUse updates the last use time of a key, at most once per minute
+// for each key to avoid writing to the database for every request.
+func (s *Store) updateLastUse(ctx context.Context, key *Key) {
+	now := time.Now().UTC()
+
+	s.lastUseMutex.Lock()
+	lastUse, found := s.lastUses[key.Id]
+	if found && now.Sub(lastUse) < lastUseUpdateInterval {
+		s.lastUseMutex.Unlock()
+		return
+	}
+	s.lastUses[key.Id] = now
+	s.lastUseMutex.Unlock()
+
+	query := fmt.Sprintf(`
+UPDATE %s SET last_use_time = $2 WHERE id = $1
+`, s.Cfg.Table)
+
+	err := s.Pg.WithConn(func(conn pg.Conn) error {
+		return pg.ExecContext(ctx, conn, query, key.Id, now)
+	})
+	if err != nil {
+		s.Log.Error("cannot update last use time of api key %s: %v",
+			key.Id, err)
+		return
+	}
+
+	s.Log.Debug(1, "api key %q (%s) used", key.Name, key.Id)
+}
+
+func formatKey(id, secret string) string {
+	return keyPrefix + id + "_" + secret
+}
+
+func parseKey(s string) (string, string, error) {
+	if !strings.HasPrefix(s, keyPrefix) {
+		return "", "", ErrInvalidKey
+	}
+
+	parts := strings.SplitN(s[len(keyPrefix):], "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrInvalidKey
+	}
+
+	if err := ksuid.Validate(parts[0]); err != nil {
+		return "", "", ErrInvalidKey
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package apikeys
+
+import (
+	"testing"
+
+	"github.com/exograd/go-daemon/ksuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKey(t *testing.T) {
+	assert := assert.New(t)
+
+	id := ksuid.Generate().String()
+
+	parsedId, secret, err := parseKey(formatKey(id, "abcdef"))
+	if assert.NoError(err) {
+		assert.Equal(id, parsedId)
+		assert.Equal("abcdef", secret)
+	}
+
+	invalidKeys := []string{
+		"",
+		"foo",
+		"dk_",
+		"dk_" + id,
+		"dk_" + id + "_",
+		"dk_foo_abcdef",
+		"xx_" + id + "_abcdef",
+	}
+
+	for _, s := range invalidKeys {
+		_, _, err := parseKey(s)
+		assert.ErrorIs(err, ErrInvalidKey, s)
+	}
+}
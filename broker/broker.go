@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package broker
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+type Header map[string]string
+
+type Message struct {
+	Subject string
+	Data    []byte
+	Header  Header
+
+	// The number of times the message was delivered, starting at 1
+	NbDeliveries int
+}
+
+// Handler processes a message. The message is acknowledged if the handler
+// returns nil; otherwise it is redelivered after a delay until the maximum
+// number of deliveries is reached.
+type Handler func(context.Context, *Message) error
+
+type Broker interface {
+	Publish(ctx context.Context, subject string, data []byte, header Header) error
+
+	// Subscriptions must be created before the broker is started.
+	Subscribe(cfg SubscriptionCfg, handler Handler) error
+
+	Start() error
+	Stop()
+}
+
+type SubscriptionCfg struct {
+	Subject string `json:"subject"`
+
+	// Subscriptions sharing the same group receive each message once
+	Group string `json:"group"`
+
+	Concurrency   int         `json:"concurrency,omitempty"`
+	MaxDeliveries int         `json:"max_deliveries,omitempty"`
+	Backoff       *BackoffCfg `json:"backoff,omitempty"`
+}
+
+type BackoffCfg struct {
+	InitialDelay dtime.Duration `json:"initial_delay"`
+	MaxDelay     dtime.Duration `json:"max_delay"`
+	Multiplier   float64        `json:"multiplier"`
+}
+
+func (cfg *SubscriptionCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("subject", cfg.Subject)
+	c.CheckStringNotEmpty("group", cfg.Group)
+	c.CheckIntMin("concurrency", cfg.Concurrency, 0)
+	c.CheckIntMin("max_deliveries", cfg.MaxDeliveries, 0)
+	c.CheckOptionalObject("backoff", cfg.Backoff)
+}
+
+func (cfg *BackoffCfg) Check(c *check.Checker) {
+	c.CheckDurationMin("initial_delay", cfg.InitialDelay.Duration(), 0)
+	c.CheckDurationMin("max_delay", cfg.MaxDelay.Duration(), 0)
+
+	if cfg.Multiplier != 0 {
+		c.CheckFloatMin("multiplier", cfg.Multiplier, 1.0)
+	}
+}
+
+func (cfg *SubscriptionCfg) setDefaults() {
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 1
+	}
+
+	if cfg.MaxDeliveries == 0 {
+		cfg.MaxDeliveries = 10
+	}
+
+	if cfg.Backoff == nil {
+		cfg.Backoff = &BackoffCfg{}
+	}
+
+	if cfg.Backoff.InitialDelay == 0 {
+		cfg.Backoff.InitialDelay = dtime.Duration(time.Second)
+	}
+
+	if cfg.Backoff.MaxDelay == 0 {
+		cfg.Backoff.MaxDelay = dtime.Duration(5 * time.Minute)
+	}
+
+	if cfg.Backoff.Multiplier == 0 {
+		cfg.Backoff.Multiplier = 2.0
+	}
+}
+
+// SubjectMatch returns true if a subject matches a pattern, where "*"
+// matches a single token and ">" matches one or more trailing tokens.
+func SubjectMatch(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+
+		if i >= len(subjectTokens) {
+			return false
+		}
+
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+
+	return len(subjectTokens) == len(patternTokens)
+}
+
+// Delay returns the delay before the next delivery of a message which was
+// delivered a number of times.
+func (cfg *BackoffCfg) Delay(nbDeliveries int) time.Duration {
+	initialDelay := float64(cfg.InitialDelay.Duration())
+	maxDelay := float64(cfg.MaxDelay.Duration())
+
+	delay := initialDelay * math.Pow(cfg.Multiplier, float64(nbDeliveries-1))
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return time.Duration(delay)
+}
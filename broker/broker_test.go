@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(SubjectMatch("a.b", "a.b"))
+	assert.False(SubjectMatch("a.b", "a.c"))
+	assert.False(SubjectMatch("a.b", "a.b.c"))
+	assert.True(SubjectMatch("a.*", "a.b"))
+	assert.False(SubjectMatch("a.*", "a.b.c"))
+	assert.True(SubjectMatch("a.>", "a.b.c"))
+	assert.False(SubjectMatch("a.>", "a"))
+	assert.True(SubjectMatch("*.b.>", "a.b.c"))
+}
+
+func TestBackoffDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := BackoffCfg{
+		InitialDelay: dtime.Duration(time.Second),
+		MaxDelay:     dtime.Duration(10 * time.Second),
+		Multiplier:   2.0,
+	}
+
+	assert.Equal(time.Second, cfg.Delay(1))
+	assert.Equal(2*time.Second, cfg.Delay(2))
+	assert.Equal(8*time.Second, cfg.Delay(4))
+	assert.Equal(10*time.Second, cfg.Delay(5))
+}
+
+func TestMemoryBroker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := NewMemoryBroker(nil)
+
+	msgs := make(chan *Message, 10)
+
+	cfg := SubscriptionCfg{
+		Subject: "events.*",
+		Group:   "test",
+		Backoff: &BackoffCfg{InitialDelay: dtime.Duration(time.Millisecond)},
+	}
+
+	err := b.Subscribe(cfg, func(ctx context.Context, msg *Message) error {
+		if msg.NbDeliveries == 1 {
+			return errors.New("first delivery")
+		}
+
+		msgs <- msg
+		return nil
+	})
+	require.NoError(err)
+
+	require.NoError(b.Start())
+	defer b.Stop()
+
+	err = b.Publish(context.Background(), "events.foo", []byte("hello"), nil)
+	require.NoError(err)
+
+	select {
+	case msg := <-msgs:
+		assert.Equal("events.foo", msg.Subject)
+		assert.Equal("hello", string(msg.Data))
+		assert.Equal(2, msg.NbDeliveries)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/dlog"
+)
+
+// MemoryBroker is a broker running in the current process, mostly useful
+// for tests and for services running as a single instance.
+type MemoryBroker struct {
+	Log *dlog.Logger
+
+	groups        map[string]*memoryGroup
+	subscriptions []*memorySubscription
+	groupsLock    sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type memoryGroup struct {
+	subject    string
+	deliveries chan *Message
+}
+
+type memorySubscription struct {
+	cfg     SubscriptionCfg
+	handler Handler
+	group   *memoryGroup
+}
+
+var _ Broker = (*MemoryBroker)(nil)
+
+func NewMemoryBroker(log *dlog.Logger) *MemoryBroker {
+	if log == nil {
+		log = dlog.DefaultLogger("broker")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &MemoryBroker{
+		Log: log,
+
+		groups: make(map[string]*memoryGroup),
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, subject string, data []byte, header Header) error {
+	b.groupsLock.Lock()
+	var groups []*memoryGroup
+	for _, g := range b.groups {
+		if SubjectMatch(g.subject, subject) {
+			groups = append(groups, g)
+		}
+	}
+	b.groupsLock.Unlock()
+
+	for _, g := range groups {
+		msg := Message{
+			Subject: subject,
+			Data:    data,
+			Header:  header,
+		}
+
+		select {
+		case g.deliveries <- &msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.ctx.Done():
+			return fmt.Errorf("broker stopped")
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(cfg SubscriptionCfg, handler Handler) error {
+	cfg.setDefaults()
+
+	key := cfg.Subject + " " + cfg.Group
+
+	b.groupsLock.Lock()
+	g, found := b.groups[key]
+	if !found {
+		g = &memoryGroup{
+			subject:    cfg.Subject,
+			deliveries: make(chan *Message, 1000),
+		}
+
+		b.groups[key] = g
+	}
+
+	b.subscriptions = append(b.subscriptions, &memorySubscription{
+		cfg:     cfg,
+		handler: handler,
+		group:   g,
+	})
+	b.groupsLock.Unlock()
+
+	return nil
+}
+
+func (b *MemoryBroker) Start() error {
+	b.groupsLock.Lock()
+	defer b.groupsLock.Unlock()
+
+	for _, s := range b.subscriptions {
+		for i := 0; i < s.cfg.Concurrency; i++ {
+			b.wg.Add(1)
+			go b.consume(s)
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Stop() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+func (b *MemoryBroker) consume(s *memorySubscription) {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+
+		case msg := <-s.group.deliveries:
+			b.deliver(s, msg)
+		}
+	}
+}
+
+func (b *MemoryBroker) deliver(s *memorySubscription, msg *Message) {
+	msg.NbDeliveries++
+
+	err := s.handler(b.ctx, msg)
+	if err == nil {
+		return
+	}
+
+	if msg.NbDeliveries >= s.cfg.MaxDeliveries {
+		b.Log.Error("dropping message on %q after %d deliveries: %v",
+			msg.Subject, msg.NbDeliveries, err)
+		return
+	}
+
+	delay := s.cfg.Backoff.Delay(msg.NbDeliveries)
+
+	b.Log.Error("cannot process message on %q, retrying in %v: %v",
+		msg.Subject, delay, err)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-b.ctx.Done():
+		case <-timer.C:
+			select {
+			case s.group.deliveries <- msg:
+			case <-b.ctx.Done():
+			}
+		}
+	}()
+}
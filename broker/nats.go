@@ -0,0 +1,310 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/nats-io/nats.go"
+)
+
+type NATSCfg struct {
+	Log *dlog.Logger `json:"-"`
+
+	URL  string `json:"url"`
+	Name string `json:"name,omitempty"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+
+	CACertificates []string `json:"ca_certificates,omitempty"`
+
+	// The JetStream stream used by subscriptions; it is created with the
+	// configured subjects if it does not exist.
+	Stream   string   `json:"stream"`
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+type NATSBroker struct {
+	Cfg NATSCfg
+	Log *dlog.Logger
+
+	Conn      *nats.Conn
+	JetStream nats.JetStreamContext
+
+	subscriptions []*natsSubscription
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type natsSubscription struct {
+	cfg     SubscriptionCfg
+	handler Handler
+	sub     *nats.Subscription
+}
+
+var _ Broker = (*NATSBroker)(nil)
+
+func (cfg *NATSCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("stream", cfg.Stream)
+
+	c.WithChild("subjects", func() {
+		for i, subject := range cfg.Subjects {
+			c.CheckStringNotEmpty(i, subject)
+		}
+	})
+
+	c.WithChild("ca_certificates", func() {
+		for i, cert := range cfg.CACertificates {
+			c.CheckStringNotEmpty(i, cert)
+		}
+	})
+}
+
+func NewNATSBroker(cfg NATSCfg) (*NATSBroker, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("nats")
+	}
+
+	if cfg.URL == "" {
+		cfg.URL = nats.DefaultURL
+	}
+
+	if cfg.Stream == "" {
+		return nil, fmt.Errorf("missing or empty stream")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &NATSBroker{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	options := []nats.Option{
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			if err != nil {
+				b.Log.Error("disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			b.Log.Info("reconnected to %q", conn.ConnectedUrl())
+		}),
+	}
+
+	if cfg.Name != "" {
+		options = append(options, nats.Name(cfg.Name))
+	}
+
+	if cfg.Username != "" {
+		options = append(options, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+
+	if cfg.Token != "" {
+		options = append(options, nats.Token(cfg.Token))
+	}
+
+	if len(cfg.CACertificates) > 0 {
+		options = append(options, nats.RootCAs(cfg.CACertificates...))
+	}
+
+	cfg.Log.Info("connecting to %q", cfg.URL)
+
+	conn, err := nats.Connect(cfg.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %q: %w", cfg.URL, err)
+	}
+
+	b.Conn = conn
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot create jetstream context: %w", err)
+	}
+
+	b.JetStream = js
+
+	if err := b.createStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *NATSBroker) createStream() error {
+	_, err := b.JetStream.StreamInfo(b.Cfg.Stream)
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, nats.ErrStreamNotFound) {
+		return fmt.Errorf("cannot fetch stream %q: %w", b.Cfg.Stream, err)
+	}
+
+	b.Log.Info("creating stream %q", b.Cfg.Stream)
+
+	streamCfg := nats.StreamConfig{
+		Name:     b.Cfg.Stream,
+		Subjects: b.Cfg.Subjects,
+	}
+
+	if _, err := b.JetStream.AddStream(&streamCfg); err != nil {
+		return fmt.Errorf("cannot create stream %q: %w", b.Cfg.Stream, err)
+	}
+
+	return nil
+}
+
+func (b *NATSBroker) Publish(ctx context.Context, subject string, data []byte, header Header) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+
+	for name, value := range header {
+		msg.Header.Set(name, value)
+	}
+
+	_, err := b.JetStream.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+func (b *NATSBroker) Subscribe(cfg SubscriptionCfg, handler Handler) error {
+	cfg.setDefaults()
+
+	sub, err := b.JetStream.PullSubscribe(cfg.Subject, cfg.Group,
+		nats.BindStream(b.Cfg.Stream), nats.MaxDeliver(cfg.MaxDeliveries))
+	if err != nil {
+		return fmt.Errorf("cannot subscribe to %q: %w", cfg.Subject, err)
+	}
+
+	b.subscriptions = append(b.subscriptions, &natsSubscription{
+		cfg:     cfg,
+		handler: handler,
+		sub:     sub,
+	})
+
+	return nil
+}
+
+func (b *NATSBroker) Start() error {
+	for _, s := range b.subscriptions {
+		for i := 0; i < s.cfg.Concurrency; i++ {
+			b.wg.Add(1)
+			go b.consume(s)
+		}
+	}
+
+	return nil
+}
+
+func (b *NATSBroker) Stop() {
+	b.cancel()
+	b.wg.Wait()
+
+	if err := b.Conn.Drain(); err != nil {
+		b.Log.Error("cannot drain connection: %v", err)
+		b.Conn.Close()
+	}
+}
+
+func (b *NATSBroker) consume(s *natsSubscription) {
+	defer b.wg.Done()
+
+	for {
+		msgs, err := s.sub.Fetch(1, nats.Context(b.ctx))
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			if !errors.Is(err, nats.ErrTimeout) &&
+				!errors.Is(err, context.DeadlineExceeded) {
+				b.Log.Error("cannot fetch messages on %q: %v",
+					s.cfg.Subject, err)
+
+				select {
+				case <-b.ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+
+			continue
+		}
+
+		for _, msg := range msgs {
+			b.deliver(s, msg)
+		}
+	}
+}
+
+func (b *NATSBroker) deliver(s *natsSubscription, natsMsg *nats.Msg) {
+	msg := Message{
+		Subject: natsMsg.Subject,
+		Data:    natsMsg.Data,
+		Header:  make(Header),
+
+		NbDeliveries: 1,
+	}
+
+	for name := range natsMsg.Header {
+		msg.Header[name] = natsMsg.Header.Get(name)
+	}
+
+	if metadata, err := natsMsg.Metadata(); err == nil {
+		msg.NbDeliveries = int(metadata.NumDelivered)
+	}
+
+	err := s.handler(b.ctx, &msg)
+	if err == nil {
+		if err := natsMsg.Ack(); err != nil {
+			b.Log.Error("cannot acknowledge message: %v", err)
+		}
+
+		return
+	}
+
+	if msg.NbDeliveries >= s.cfg.MaxDeliveries {
+		b.Log.Error("dropping message on %q after %d deliveries: %v",
+			msg.Subject, msg.NbDeliveries, err)
+
+		if err := natsMsg.Term(); err != nil {
+			b.Log.Error("cannot terminate message: %v", err)
+		}
+
+		return
+	}
+
+	delay := s.cfg.Backoff.Delay(msg.NbDeliveries)
+
+	b.Log.Error("cannot process message on %q, retrying in %v: %v",
+		msg.Subject, delay, err)
+
+	if err := natsMsg.NakWithDelay(delay); err != nil {
+		b.Log.Error("cannot reject message: %v", err)
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/exograd/go-daemon/djson"
+	"github.com/exograd/go-daemon/ksuid"
 )
 
 type Checker struct {
@@ -140,6 +142,24 @@ func (c *Checker) CheckFloatMinMax(token interface{}, i, min, max float64) bool
 	return c.CheckFloatMax(token, i, max)
 }
 
+func (c *Checker) CheckDurationMin(token interface{}, d, min time.Duration) bool {
+	return c.Check(token, d >= min, "duration_too_small",
+		"duration %v must be greater or equal to %v", d, min)
+}
+
+func (c *Checker) CheckDurationMax(token interface{}, d, max time.Duration) bool {
+	return c.Check(token, d <= max, "duration_too_large",
+		"duration %v must be lower or equal to %v", d, max)
+}
+
+func (c *Checker) CheckDurationMinMax(token interface{}, d, min, max time.Duration) bool {
+	if !c.CheckDurationMin(token, d, min) {
+		return false
+	}
+
+	return c.CheckDurationMax(token, d, max)
+}
+
 func (c *Checker) CheckStringLengthMin(token interface{}, s string, min int) bool {
 	return c.Check(token, len(s) >= min, "string_too_small",
 		"string length must be greater or equal to %d", min)
@@ -274,6 +294,15 @@ func (c *Checker) CheckStringHTTPURI(token interface{}, s string) bool {
 	return true
 }
 
+func (c *Checker) CheckStringKSUID(token interface{}, s string) bool {
+	if err := ksuid.Validate(s); err != nil {
+		c.AddError(token, "invalid_ksuid", "string must be a valid ksuid")
+		return false
+	}
+
+	return true
+}
+
 func (c *Checker) CheckArrayLengthMin(token interface{}, value interface{}, min int) bool {
 	var length int
 
@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/exograd/go-daemon/djson"
 	"github.com/stretchr/testify/assert"
@@ -51,6 +52,15 @@ func TestCheckTest(t *testing.T) {
 		assert.Equal(djson.Pointer{"t"}, c.Errors[0].Pointer)
 	}
 
+	// Durations
+	c = NewChecker()
+	assert.True(c.CheckDurationMin("t", time.Second, time.Second))
+	assert.True(c.CheckDurationMax("t", time.Second, time.Minute))
+	assert.False(c.CheckDurationMinMax("t", time.Hour, time.Second, time.Minute))
+	if assert.Equal(1, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"t"}, c.Errors[0].Pointer)
+	}
+
 	// Strings
 	c = NewChecker()
 	assert.True(c.CheckStringLengthMin("t", "foo", 1))
@@ -83,6 +93,13 @@ func TestCheckTest(t *testing.T) {
 		assert.Equal(djson.Pointer{"t"}, c.Errors[0].Pointer)
 	}
 
+	c = NewChecker()
+	assert.True(c.CheckStringKSUID("t", "1l12i5euax5i7oGDn5DFULPYdCM"))
+	assert.False(c.CheckStringKSUID("t", "foo"))
+	if assert.Equal(1, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"t"}, c.Errors[0].Pointer)
+	}
+
 	// String types
 	c = NewChecker()
 	assert.True(c.CheckStringValue("t", testEnumFoo, testEnumValues))
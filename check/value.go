@@ -0,0 +1,252 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package check
+
+import (
+	"math"
+	"strings"
+
+	"github.com/exograd/go-daemon/djson"
+)
+
+// The following functions validate untyped JSON documents, i.e. values
+// produced by decoding JSON data into a djson.Value or an interface{}. The
+// value checked is located in the document with a JSON pointer, and errors
+// are reported at this pointer relative to the current pointer of the
+// checker.
+
+type ValueType string
+
+const (
+	ValueTypeNull    ValueType = "null"
+	ValueTypeBoolean ValueType = "boolean"
+	ValueTypeNumber  ValueType = "number"
+	ValueTypeString  ValueType = "string"
+	ValueTypeArray   ValueType = "array"
+	ValueTypeObject  ValueType = "object"
+)
+
+func valueType(v djson.Value) ValueType {
+	switch v.(type) {
+	case nil:
+		return ValueTypeNull
+	case bool:
+		return ValueTypeBoolean
+	case float64:
+		return ValueTypeNumber
+	case string:
+		return ValueTypeString
+	case []interface{}:
+		return ValueTypeArray
+	case map[string]interface{}:
+		return ValueTypeObject
+	}
+
+	panicf("value %#v (%T) is not a valid json value", v, v)
+	return "" // the Go compiler cannot infer that panic() never returns...
+}
+
+// CheckValueType checks that the value at pointer exists and has one of the
+// types listed. It returns the value and a boolean indicating whether it is
+// valid.
+func (c *Checker) CheckValueType(doc djson.Value, pointer djson.Pointer, types ...ValueType) (djson.Value, bool) {
+	value, found := pointer.Find2(doc)
+	if !found {
+		c.AddError(pointer, "missing_value", "missing value")
+		return nil, false
+	}
+
+	vt := valueType(value)
+	for _, t := range types {
+		if vt == t {
+			return value, true
+		}
+	}
+
+	typeStrings := make([]string, len(types))
+	for i, t := range types {
+		typeStrings[i] = string(t)
+	}
+
+	c.AddError(pointer, "invalid_value_type",
+		"value must be of type %s", strings.Join(typeStrings, " or "))
+
+	return nil, false
+}
+
+func (c *Checker) CheckValueBoolean(doc djson.Value, pointer djson.Pointer) (bool, bool) {
+	value, ok := c.CheckValueType(doc, pointer, ValueTypeBoolean)
+	if !ok {
+		return false, false
+	}
+
+	return value.(bool), true
+}
+
+func (c *Checker) CheckValueNumber(doc djson.Value, pointer djson.Pointer) (float64, bool) {
+	value, ok := c.CheckValueType(doc, pointer, ValueTypeNumber)
+	if !ok {
+		return 0.0, false
+	}
+
+	return value.(float64), true
+}
+
+func (c *Checker) CheckValueInt(doc djson.Value, pointer djson.Pointer) (int, bool) {
+	f, ok := c.CheckValueNumber(doc, pointer)
+	if !ok {
+		return 0, false
+	}
+
+	if f != math.Trunc(f) || f < math.MinInt || f > math.MaxInt {
+		c.AddError(pointer, "invalid_integer", "number must be an integer")
+		return 0, false
+	}
+
+	return int(f), true
+}
+
+func (c *Checker) CheckValueIntMin(doc djson.Value, pointer djson.Pointer, min int) bool {
+	i, ok := c.CheckValueInt(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	return c.CheckIntMin(pointer, i, min)
+}
+
+func (c *Checker) CheckValueIntMax(doc djson.Value, pointer djson.Pointer, max int) bool {
+	i, ok := c.CheckValueInt(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	return c.CheckIntMax(pointer, i, max)
+}
+
+func (c *Checker) CheckValueIntMinMax(doc djson.Value, pointer djson.Pointer, min, max int) bool {
+	i, ok := c.CheckValueInt(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	return c.CheckIntMinMax(pointer, i, min, max)
+}
+
+func (c *Checker) CheckValueString(doc djson.Value, pointer djson.Pointer) (string, bool) {
+	value, ok := c.CheckValueType(doc, pointer, ValueTypeString)
+	if !ok {
+		return "", false
+	}
+
+	return value.(string), true
+}
+
+func (c *Checker) CheckValueStringNotEmpty(doc djson.Value, pointer djson.Pointer) bool {
+	s, ok := c.CheckValueString(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	return c.CheckStringNotEmpty(pointer, s)
+}
+
+func (c *Checker) CheckValueStringValue(doc djson.Value, pointer djson.Pointer, values interface{}) bool {
+	s, ok := c.CheckValueString(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	return c.CheckStringValue(pointer, s, values)
+}
+
+func (c *Checker) CheckValueArray(doc djson.Value, pointer djson.Pointer) ([]interface{}, bool) {
+	value, ok := c.CheckValueType(doc, pointer, ValueTypeArray)
+	if !ok {
+		return nil, false
+	}
+
+	return value.([]interface{}), true
+}
+
+func (c *Checker) CheckValueObject(doc djson.Value, pointer djson.Pointer) (map[string]interface{}, bool) {
+	value, ok := c.CheckValueType(doc, pointer, ValueTypeObject)
+	if !ok {
+		return nil, false
+	}
+
+	return value.(map[string]interface{}), true
+}
+
+// CheckValueRequiredKeys checks that the value at pointer is an object
+// containing all the keys listed.
+func (c *Checker) CheckValueRequiredKeys(doc djson.Value, pointer djson.Pointer, keys ...string) bool {
+	obj, ok := c.CheckValueObject(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	for _, key := range keys {
+		if _, found := obj[key]; !found {
+			c.AddError(pointer.Child(key), "missing_value", "missing value")
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// CheckValueForbiddenKeys checks that the value at pointer is an object
+// containing none of the keys listed.
+func (c *Checker) CheckValueForbiddenKeys(doc djson.Value, pointer djson.Pointer, keys ...string) bool {
+	obj, ok := c.CheckValueObject(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	for _, key := range keys {
+		if _, found := obj[key]; found {
+			c.AddError(pointer.Child(key), "forbidden_value",
+				"value is not allowed")
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// CheckValueAllowedKeys checks that the value at pointer is an object only
+// containing keys from the list.
+func (c *Checker) CheckValueAllowedKeys(doc djson.Value, pointer djson.Pointer, keys ...string) bool {
+	obj, ok := c.CheckValueObject(doc, pointer)
+	if !ok {
+		return false
+	}
+
+	allowed := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		allowed[key] = struct{}{}
+	}
+
+	for key := range obj {
+		if _, found := allowed[key]; !found {
+			c.AddError(pointer.Child(key), "unknown_value",
+				"unknown value")
+			ok = false
+		}
+	}
+
+	return ok
+}
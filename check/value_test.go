@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package check
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/exograd/go-daemon/djson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckValue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := `{"name": "foo", "count": 3, "ratio": 0.5, "tags": ["a"],
+"options": {"color": "red", "internal": true}, "nothing": null}`
+
+	var doc djson.Value
+	require.NoError(json.Unmarshal([]byte(data), &doc))
+
+	var c *Checker
+
+	p := func(s string) djson.Pointer {
+		var pointer djson.Pointer
+		pointer.MustParse(s)
+		return pointer
+	}
+
+	c = NewChecker()
+	s, ok := c.CheckValueString(doc, p("/name"))
+	assert.True(ok)
+	assert.Equal("foo", s)
+	assert.True(c.CheckValueIntMinMax(doc, p("/count"), 1, 10))
+	_, ok = c.CheckValueArray(doc, p("/tags"))
+	assert.True(ok)
+	_, ok = c.CheckValueType(doc, p("/nothing"), ValueTypeNull)
+	assert.True(ok)
+	assert.True(c.CheckValueRequiredKeys(doc, p("/options"), "color"))
+	assert.True(c.CheckValueAllowedKeys(doc, p("/options"),
+		"color", "internal"))
+	assert.NoError(c.Error())
+
+	c = NewChecker()
+	c.Push("template")
+	_, ok = c.CheckValueString(doc, p("/count"))
+	assert.False(ok)
+	assert.False(c.CheckValueIntMin(doc, p("/ratio"), 0))
+	assert.False(c.CheckValueIntMin(doc, p("/count"), 5))
+	assert.False(c.CheckValueStringNotEmpty(doc, p("/missing")))
+	assert.False(c.CheckValueForbiddenKeys(doc, p("/options"), "internal"))
+	if assert.Equal(5, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"template", "count"}, c.Errors[0].Pointer)
+		assert.Equal("invalid_value_type", c.Errors[0].Code)
+		assert.Equal(djson.Pointer{"template", "ratio"}, c.Errors[1].Pointer)
+		assert.Equal("invalid_integer", c.Errors[1].Code)
+		assert.Equal("integer_too_small", c.Errors[2].Code)
+		assert.Equal(djson.Pointer{"template", "missing"}, c.Errors[3].Pointer)
+		assert.Equal("missing_value", c.Errors[3].Code)
+		assert.Equal(djson.Pointer{"template", "options", "internal"},
+			c.Errors[4].Pointer)
+		assert.Equal("forbidden_value", c.Errors[4].Code)
+	}
+}
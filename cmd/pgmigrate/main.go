@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/pg"
+	"github.com/exograd/go-program"
+)
+
+func main() {
+	p := program.NewProgram("pgmigrate", "manage pg schema migrations")
+
+	p.AddOption("u", "uri", "uri", os.Getenv("PGMIGRATE_URI"),
+		"the uri of the database")
+	p.AddOption("d", "schema-directory", "path", "pg",
+		"the directory containing the migrations of each schema")
+
+	c := p.AddCommand("up", "apply all pending migrations", cmdUp)
+	c.AddArgument("schema", "the name of the schema")
+
+	c = p.AddCommand("status", "print the status of all migrations",
+		cmdStatus)
+	c.AddArgument("schema", "the name of the schema")
+
+	c = p.AddCommand("rollback", "revert the last applied migration",
+		cmdRollback)
+	c.AddArgument("schema", "the name of the schema")
+
+	c = p.AddCommand("create", "create a new empty migration file",
+		cmdCreate)
+	c.AddArgument("schema", "the name of the schema")
+
+	p.ParseCommandLine()
+	p.Run()
+}
+
+func cmdUp(p *program.Program) {
+	schema := p.ArgumentValue("schema")
+
+	client := newClient(p)
+	defer client.Close()
+
+	if err := client.UpdateSchema(schema, schemaDirectory(p)); err != nil {
+		p.Fatal("cannot update schema: %v", err)
+	}
+}
+
+func cmdStatus(p *program.Program) {
+	schema := p.ArgumentValue("schema")
+
+	client := newClient(p)
+	defer client.Close()
+
+	statuses, err := client.SchemaStatus(schema, schemaDirectory(p))
+	if err != nil {
+		p.Fatal("cannot load schema status: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.Applied {
+			fmt.Printf("%s  applied   %s\n", status.Version,
+				status.MigrationDate.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Printf("%s  pending\n", status.Version)
+		}
+	}
+}
+
+func cmdRollback(p *program.Program) {
+	schema := p.ArgumentValue("schema")
+
+	client := newClient(p)
+	defer client.Close()
+
+	m, err := client.RollbackSchema(schema, schemaDirectory(p))
+	if err != nil {
+		p.Fatal("cannot rollback schema: %v", err)
+	}
+
+	if m == nil {
+		p.Info("no migration to revert")
+	}
+}
+
+func cmdCreate(p *program.Program) {
+	dirPath := schemaDirectory(p)
+
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		p.Fatal("cannot create %q: %v", dirPath, err)
+	}
+
+	filePath, err := pg.CreateMigrationFile(dirPath)
+	if err != nil {
+		p.Fatal("%v", err)
+	}
+
+	fmt.Println(filePath)
+}
+
+func schemaDirectory(p *program.Program) string {
+	return path.Join(p.OptionValue("schema-directory"),
+		p.ArgumentValue("schema"))
+}
+
+func newClient(p *program.Program) *pg.Client {
+	uri := p.OptionValue("uri")
+	if uri == "" {
+		p.Fatal("missing database uri")
+	}
+
+	cfg := pg.ClientCfg{
+		Log: dlog.DefaultLogger("pgmigrate"),
+
+		URI:             uri,
+		ApplicationName: "pgmigrate",
+	}
+
+	client, err := pg.NewClient(cfg)
+	if err != nil {
+		p.Fatal("%v", err)
+	}
+
+	return client
+}
@@ -15,7 +15,16 @@
 package daemon
 
 import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/exograd/go-daemon/apikeys"
 	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dflag"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
@@ -25,6 +34,17 @@ const (
 
 type APICfg struct {
 	Address string `json:"address"`
+
+	// The directory profiles captured with /profiles are written to; if it
+	// is not set, profiles can only be streamed in the response.
+	ProfileDirectory string `json:"profile_directory,omitempty"`
+
+	// The api does not authenticate clients. Routes which change the state
+	// of the daemon (log levels, flags, maintenance mode) and routes used
+	// to manage api keys are only available if AdminRoutes is set; it must
+	// only be enabled if the api address cannot be reached by untrusted
+	// clients.
+	AdminRoutes bool `json:"admin_routes,omitempty"`
 }
 
 func (cfg *APICfg) Check(c *check.Checker) {
@@ -41,5 +61,445 @@ func (d *Daemon) initAPI() error {
 
 	server.Router.Mount("/debug", middleware.Profiler())
 
+	server.Route("/profiles/{type}", "POST", d.hAPIProfilesPOST).
+		SetSummary("Capture a profile or an execution trace").
+		AddQueryParameter("seconds",
+			"the duration of cpu profiles and traces", "").
+		AddQueryParameter("output",
+			"either \"file\" or \"stream\"", "").
+		AddResponse(200, "the profile file", &APIProfile{})
+
+	server.Route("/ready", "GET", d.hAPIReadyGET).
+		SetSummary("Return whether the daemon is ready to serve requests").
+		AddResponse(200, "daemon ready", &APIReadiness{}).
+		AddResponse(503, "daemon not ready", &APIReadiness{})
+
+	server.Route("/status", "GET", d.hAPIStatusGET).
+		SetSummary("Return the state of the daemon").
+		AddResponse(200, "daemon status", &APIStatus{})
+
+	server.Route("/openapi.json", "GET", d.hAPIOpenAPIGET).
+		SetSummary("Return the OpenAPI document of http servers").
+		AddQueryParameter("server", "the name of the server", "")
+
+	server.Route("/routes", "GET", d.hAPIRoutesGET).
+		SetSummary("Return the routes of http servers").
+		AddQueryParameter("server", "the name of the server", "").
+		AddResponse(200, "routes", []APIRoute{})
+
+	server.Route("/log/levels", "GET", d.hAPILogLevelsGET).
+		SetSummary("Return the current log levels").
+		AddResponse(200, "log levels", &dlog.LevelState{})
+	server.Route("/log/domain_levels", "GET", d.hAPILogDomainLevelsGET).
+		SetSummary("Return the minimal log level of each domain").
+		AddResponse(200, "log levels", map[string]dlog.Level{})
+
+	server.Route("/flags", "GET", d.hAPIFlagsGET).
+		SetSummary("Return the state of all flags").
+		AddResponse(200, "flags", []dflag.FlagState{})
+
+	server.Route("/maintenance", "GET", d.hAPIMaintenanceGET).
+		SetSummary("Return the maintenance state of each http server").
+		AddResponse(200, "maintenance states", map[string]bool{})
+
+	if d.Cfg.API.AdminRoutes {
+		d.initAPIAdminRoutes(server)
+	}
+
 	return nil
 }
+
+func (d *Daemon) initAPIAdminRoutes(server *dhttp.Server) {
+	server.Route("/log/level", "PUT", d.hAPILogLevelPUT).
+		SetSummary("Set the minimal log level of all domains").
+		SetRequestBody(&APILogLevel{}).
+		AddResponse(204, "level set", nil)
+	server.Route("/log/level", "DELETE", d.hAPILogLevelDELETE).
+		SetSummary("Remove the minimal log level of all domains").
+		AddResponse(204, "level removed", nil)
+	server.Route("/log/debug_level", "PUT", d.hAPILogDebugLevelPUT).
+		SetSummary("Override the debug level of all loggers").
+		SetRequestBody(&APILogDebugLevel{}).
+		AddResponse(204, "debug level set", nil)
+	server.Route("/log/debug_level", "DELETE", d.hAPILogDebugLevelDELETE).
+		SetSummary("Remove the debug level override").
+		AddResponse(204, "debug level removed", nil)
+
+	server.Route("/log/domain_levels/{domain}", "PUT",
+		d.hAPILogDomainLevelsPUT).
+		SetSummary("Set the minimal log level of a domain").
+		SetRequestBody(&APIDomainLevel{}).
+		AddResponse(204, "level set", nil)
+	server.Route("/log/domain_levels/{domain}", "DELETE",
+		d.hAPILogDomainLevelsDELETE).
+		SetSummary("Remove the minimal log level of a domain").
+		AddResponse(204, "level removed", nil)
+
+	server.Route("/flags/{name}", "PUT", d.hAPIFlagsPUT).
+		SetSummary("Override the value of a flag").
+		SetRequestBody(&APIFlagOverride{}).
+		AddResponse(204, "override set", nil)
+	server.Route("/flags/{name}", "DELETE", d.hAPIFlagsDELETE).
+		SetSummary("Remove the override of a flag").
+		AddResponse(204, "override removed", nil)
+
+	server.Route("/maintenance", "PUT", d.hAPIMaintenancePUT).
+		SetSummary("Enable or disable maintenance mode").
+		SetRequestBody(&APIMaintenance{}).
+		AddResponse(204, "maintenance mode updated", nil)
+
+	if d.APIKeys != nil {
+		server.Route("/api_keys", "GET", d.hAPIAPIKeysGET).
+			SetSummary("Return all api keys").
+			AddResponse(200, "api keys", apikeys.Keys{})
+		server.Route("/api_keys", "POST", d.hAPIAPIKeysPOST).
+			SetSummary("Create a new api key").
+			SetRequestBody(&APINewAPIKey{}).
+			AddResponse(201, "the key", &APICreatedAPIKey{})
+		server.Route("/api_keys/{id}", "DELETE", d.hAPIAPIKeysDELETE).
+			SetSummary("Revoke an api key").
+			AddResponse(204, "key revoked", nil)
+	}
+}
+
+type APIStatus struct {
+	Build      BuildInfo       `json:"build"`
+	Uptime     float64         `json:"uptime"`
+	NbPanics   int64           `json:"nb_panics"`
+	Components map[string]bool `json:"components"`
+}
+
+func (d *Daemon) hAPIStatusGET(h *dhttp.Handler) {
+	status := APIStatus{
+		Build:      GetBuildInfo(),
+		Uptime:     d.Uptime().Seconds(),
+		NbPanics:   d.NbPanics(),
+		Components: d.ComponentStates(),
+	}
+
+	h.ReplyJSON(200, status)
+}
+
+func (d *Daemon) hAPIOpenAPIGET(h *dhttp.Handler) {
+	version := d.Cfg.Version
+	if version == "" {
+		version = "unknown"
+	}
+
+	doc := dhttp.NewOpenAPIDocument(dhttp.OpenAPIInfo{
+		Title:   d.Cfg.name,
+		Version: version,
+	})
+
+	if h.HasQueryParameter("server") {
+		name := h.QueryParameter("server")
+
+		server, found := d.HTTPServers[name]
+		if !found {
+			h.ReplyError(404, "unknown_server", "unknown http server %q", name)
+			return
+		}
+
+		doc.AddRoutes(server.Routes())
+	} else {
+		for name, server := range d.HTTPServers {
+			doc.AddRoutes(server.Routes(), name)
+		}
+	}
+
+	h.ReplyJSON(200, doc)
+}
+
+type APIRoute struct {
+	Server       string   `json:"server"`
+	Host         string   `json:"host,omitempty"`
+	Method       string   `json:"method"`
+	Pattern      string   `json:"pattern"`
+	Summary      string   `json:"summary,omitempty"`
+	Deprecated   bool     `json:"deprecated,omitempty"`
+	AuthRequired bool     `json:"auth_required,omitempty"`
+	AuthScopes   []string `json:"auth_scopes,omitempty"`
+}
+
+func (d *Daemon) hAPIRoutesGET(h *dhttp.Handler) {
+	var names []string
+
+	if h.HasQueryParameter("server") {
+		name := h.QueryParameter("server")
+
+		if _, found := d.HTTPServers[name]; !found {
+			h.ReplyError(404, "unknown_server", "unknown http server %q", name)
+			return
+		}
+
+		names = []string{name}
+	} else {
+		for name := range d.HTTPServers {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+	}
+
+	routes := []APIRoute{}
+
+	for _, name := range names {
+		for _, r := range d.HTTPServers[name].Routes() {
+			routes = append(routes, APIRoute{
+				Server:       name,
+				Host:         r.Host,
+				Method:       r.Method,
+				Pattern:      r.Pattern,
+				Summary:      r.Summary,
+				Deprecated:   r.Deprecated,
+				AuthRequired: r.AuthRequired,
+				AuthScopes:   r.AuthScopes,
+			})
+		}
+	}
+
+	h.ReplyJSON(200, routes)
+}
+
+// Levels set with a non-zero duration are reverted automatically once the
+// duration has elapsed.
+type APILogLevel struct {
+	Level    dlog.Level     `json:"level"`
+	Duration dtime.Duration `json:"duration,omitempty"`
+}
+
+func (l *APILogLevel) Check(c *check.Checker) {
+	c.CheckStringValue("level", l.Level, dlog.LevelValues)
+	c.CheckDurationMin("duration", time.Duration(l.Duration), 0)
+}
+
+type APILogDebugLevel struct {
+	DebugLevel int            `json:"debug_level"`
+	Duration   dtime.Duration `json:"duration,omitempty"`
+}
+
+func (l *APILogDebugLevel) Check(c *check.Checker) {
+	c.CheckIntMin("debug_level", l.DebugLevel, 0)
+	c.CheckDurationMin("duration", time.Duration(l.Duration), 0)
+}
+
+type APIDomainLevel struct {
+	Level    dlog.Level     `json:"level"`
+	Duration dtime.Duration `json:"duration,omitempty"`
+}
+
+func (l *APIDomainLevel) Check(c *check.Checker) {
+	c.CheckStringValue("level", l.Level, dlog.LevelValues)
+	c.CheckDurationMin("duration", time.Duration(l.Duration), 0)
+}
+
+func (d *Daemon) hAPILogLevelsGET(h *dhttp.Handler) {
+	h.ReplyJSON(200, d.Log.LevelState())
+}
+
+func (d *Daemon) hAPILogLevelPUT(h *dhttp.Handler) {
+	var level APILogLevel
+	if err := h.JSONRequestObject(&level); err != nil {
+		return
+	}
+
+	d.Log.SetLevelFor(level.Level, time.Duration(level.Duration))
+
+	h.ReplyEmpty(204)
+}
+
+func (d *Daemon) hAPILogLevelDELETE(h *dhttp.Handler) {
+	d.Log.SetLevel("")
+
+	h.ReplyEmpty(204)
+}
+
+func (d *Daemon) hAPILogDebugLevelPUT(h *dhttp.Handler) {
+	var level APILogDebugLevel
+	if err := h.JSONRequestObject(&level); err != nil {
+		return
+	}
+
+	d.Log.SetDebugLevelFor(level.DebugLevel, time.Duration(level.Duration))
+
+	h.ReplyEmpty(204)
+}
+
+func (d *Daemon) hAPILogDebugLevelDELETE(h *dhttp.Handler) {
+	d.Log.UnsetDebugLevel()
+
+	h.ReplyEmpty(204)
+}
+
+func (d *Daemon) hAPILogDomainLevelsGET(h *dhttp.Handler) {
+	h.ReplyJSON(200, d.Log.DomainLevels())
+}
+
+func (d *Daemon) hAPILogDomainLevelsPUT(h *dhttp.Handler) {
+	domain := h.RouteVariable("domain")
+
+	var level APIDomainLevel
+	if err := h.JSONRequestObject(&level); err != nil {
+		return
+	}
+
+	d.Log.SetDomainLevelFor(domain, level.Level, time.Duration(level.Duration))
+
+	h.ReplyEmpty(204)
+}
+
+func (d *Daemon) hAPILogDomainLevelsDELETE(h *dhttp.Handler) {
+	domain := h.RouteVariable("domain")
+
+	d.Log.UnsetDomainLevel(domain)
+
+	h.ReplyEmpty(204)
+}
+
+type APIFlagOverride struct {
+	Value interface{} `json:"value"`
+}
+
+func (o *APIFlagOverride) Check(c *check.Checker) {
+	c.Check("value", o.Value != nil, "missing_value", "missing value")
+}
+
+func (d *Daemon) hAPIFlagsGET(h *dhttp.Handler) {
+	h.ReplyJSON(200, d.Flags.States())
+}
+
+func (d *Daemon) hAPIFlagsPUT(h *dhttp.Handler) {
+	name := h.RouteVariable("name")
+
+	if d.Flags.Flag(name) == nil {
+		h.ReplyError(404, "unknown_flag", "unknown flag %q", name)
+		return
+	}
+
+	var override APIFlagOverride
+	if err := h.JSONRequestObject(&override); err != nil {
+		return
+	}
+
+	if err := d.Flags.SetOverride(name, override.Value); err != nil {
+		h.ReplyError(400, "invalid_flag_value", "%v", err)
+		return
+	}
+
+	h.ReplyEmpty(204)
+}
+
+func (d *Daemon) hAPIFlagsDELETE(h *dhttp.Handler) {
+	name := h.RouteVariable("name")
+
+	if d.Flags.Flag(name) == nil {
+		h.ReplyError(404, "unknown_flag", "unknown flag %q", name)
+		return
+	}
+
+	d.Flags.UnsetOverride(name)
+
+	h.ReplyEmpty(204)
+}
+
+type APIMaintenance struct {
+	Enabled bool     `json:"enabled"`
+	Servers []string `json:"servers,omitempty"`
+}
+
+func (m *APIMaintenance) Check(c *check.Checker) {
+}
+
+func (d *Daemon) hAPIMaintenanceGET(h *dhttp.Handler) {
+	states := make(map[string]bool)
+	for name, server := range d.HTTPServers {
+		if name != "daemon-api" {
+			states[name] = server.InMaintenance()
+		}
+	}
+
+	h.ReplyJSON(200, states)
+}
+
+func (d *Daemon) hAPIMaintenancePUT(h *dhttp.Handler) {
+	var m APIMaintenance
+	if err := h.JSONRequestObject(&m); err != nil {
+		return
+	}
+
+	if err := d.SetMaintenance(m.Enabled, m.Servers...); err != nil {
+		h.ReplyError(404, "unknown_server", "%v", err)
+		return
+	}
+
+	h.ReplyEmpty(204)
+}
+
+type APINewAPIKey struct {
+	Name           string     `json:"name"`
+	Scopes         []string   `json:"scopes,omitempty"`
+	ExpirationTime *time.Time `json:"expiration_time,omitempty"`
+}
+
+func (k *APINewAPIKey) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("name", k.Name)
+
+	c.WithChild("scopes", func() {
+		for i, scope := range k.Scopes {
+			c.CheckStringNotEmpty(i, scope)
+		}
+	})
+}
+
+type APICreatedAPIKey struct {
+	*apikeys.Key
+
+	// The full key, which is only returned once
+	KeyString string `json:"key"`
+}
+
+func (d *Daemon) hAPIAPIKeysGET(h *dhttp.Handler) {
+	keys, err := d.APIKeys.Keys(h.Context())
+	if err != nil {
+		h.ReplyCodedError(err)
+		return
+	}
+
+	if keys == nil {
+		keys = apikeys.Keys{}
+	}
+
+	h.ReplyJSON(200, keys)
+}
+
+func (d *Daemon) hAPIAPIKeysPOST(h *dhttp.Handler) {
+	var newKey APINewAPIKey
+	if err := h.JSONRequestObject(&newKey); err != nil {
+		return
+	}
+
+	key, keyString, err := d.APIKeys.Create(h.Context(), newKey.Name,
+		newKey.Scopes, newKey.ExpirationTime)
+	if err != nil {
+		h.ReplyCodedError(err)
+		return
+	}
+
+	h.ReplyJSON(201, APICreatedAPIKey{Key: key, KeyString: keyString})
+}
+
+func (d *Daemon) hAPIAPIKeysDELETE(h *dhttp.Handler) {
+	id := h.RouteVariable("id")
+
+	if err := d.APIKeys.Revoke(h.Context(), id); err != nil {
+		if errors.Is(err, apikeys.ErrKeyNotFound) {
+			h.ReplyError(404, "unknown_api_key", "unknown api key")
+			return
+		}
+
+		h.ReplyCodedError(err)
+		return
+	}
+
+	h.ReplyEmpty(204)
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+
+	"github.com/exograd/go-daemon/daudit"
+	"github.com/exograd/go-daemon/dhttp"
+)
+
+// ProfileTypes contains the profiles which can be captured with the daemon
+// API. CPU profiles and execution traces are recorded for a period of time;
+// other profiles are snapshots.
+var ProfileTypes = []string{
+	"cpu", "trace",
+	"heap", "allocs", "goroutine", "block", "mutex", "threadcreate",
+}
+
+const maxProfileDuration = 5 * time.Minute
+
+type APIProfile struct {
+	Type     string  `json:"type"`
+	File     string  `json:"file"`
+	Size     int64   `json:"size"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+func (d *Daemon) hAPIProfilesPOST(h *dhttp.Handler) {
+	profileType := h.RouteVariable("type")
+
+	if !isProfileType(profileType) {
+		h.ReplyError(404, "unknown_profile_type", "unknown profile type %q",
+			profileType)
+		return
+	}
+
+	var duration time.Duration
+
+	if profileType == "cpu" || profileType == "trace" {
+		duration = 30 * time.Second
+
+		if h.HasQueryParameter("seconds") {
+			seconds, err := strconv.Atoi(h.QueryParameter("seconds"))
+			duration = time.Duration(seconds) * time.Second
+
+			if err != nil || duration <= 0 || duration > maxProfileDuration {
+				h.ReplyError(400, "invalid_seconds", "seconds must be an "+
+					"integer between 1 and %d",
+					int(maxProfileDuration.Seconds()))
+				return
+			}
+		}
+	}
+
+	dirPath := d.Cfg.API.ProfileDirectory
+
+	output := "stream"
+	if dirPath != "" {
+		output = "file"
+	}
+
+	if h.HasQueryParameter("output") {
+		output = h.QueryParameter("output")
+	}
+
+	switch output {
+	case "stream":
+	case "file":
+		if dirPath == "" {
+			h.ReplyError(400, "missing_profile_directory",
+				"no profile directory configured")
+			return
+		}
+	default:
+		h.ReplyError(400, "invalid_output",
+			"output must be either \"file\" or \"stream\"")
+		return
+	}
+
+	fileName := fmt.Sprintf("%s-%s-%s.pprof", d.Cfg.name, profileType,
+		time.Now().UTC().Format("20060102T150405Z"))
+	if profileType == "trace" {
+		fileName = fmt.Sprintf("%s-trace-%s.out", d.Cfg.name,
+			time.Now().UTC().Format("20060102T150405Z"))
+	}
+
+	d.recordProfileCapture(h, profileType, duration, output)
+
+	if output == "stream" {
+		header := h.ResponseWriter.Header()
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%q", fileName))
+
+		if err := captureProfile(h.Context(), h.ResponseWriter, profileType, duration); err != nil {
+			header.Del("Content-Disposition")
+			replyProfileError(h, err)
+		}
+
+		return
+	}
+
+	filePath := filepath.Join(dirPath, fileName)
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		h.ReplyInternalError(500, "cannot create %q: %v", filePath, err)
+		return
+	}
+
+	err = captureProfile(h.Context(), file, profileType, duration)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(filePath)
+		replyProfileError(h, err)
+		return
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		h.ReplyInternalError(500, "cannot stat %q: %v", filePath, err)
+		return
+	}
+
+	h.ReplyJSON(200, APIProfile{
+		Type:     profileType,
+		File:     filePath,
+		Size:     info.Size(),
+		Duration: duration.Seconds(),
+	})
+}
+
+type profileInProgressError struct {
+	err error
+}
+
+func (err profileInProgressError) Error() string {
+	return err.err.Error()
+}
+
+func replyProfileError(h *dhttp.Handler, err error) {
+	if _, ok := err.(profileInProgressError); ok {
+		h.ReplyError(409, "profile_in_progress", "%v", err)
+		return
+	}
+
+	h.ReplyInternalError(500, "cannot capture profile: %v", err)
+}
+
+func (d *Daemon) recordProfileCapture(h *dhttp.Handler, profileType string, duration time.Duration, output string) {
+	actor := h.ClientAddress
+	if principal := h.Principal(); principal != nil {
+		actor = principal.Id
+	}
+
+	d.Log.Info("capture of %s profile requested by %s", profileType, actor)
+
+	if d.Audit == nil {
+		return
+	}
+
+	target := daudit.Target{
+		Type: "profile",
+		Id:   profileType,
+	}
+
+	data := map[string]interface{}{
+		"output": output,
+	}
+
+	if duration > 0 {
+		data["duration"] = duration.Seconds()
+	}
+
+	if err := d.Audit.RecordRequest(h, "daemon.capture_profile", &target, data); err != nil {
+		d.Log.Error("cannot record audit event: %v", err)
+	}
+}
+
+func captureProfile(ctx context.Context, w io.Writer, profileType string, duration time.Duration) error {
+	wait := func() {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+
+	switch profileType {
+	case "cpu":
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return profileInProgressError{err}
+		}
+
+		wait()
+		pprof.StopCPUProfile()
+
+	case "trace":
+		if err := trace.Start(w); err != nil {
+			return profileInProgressError{err}
+		}
+
+		wait()
+		trace.Stop()
+
+	default:
+		profile := pprof.Lookup(profileType)
+		if profile == nil {
+			return fmt.Errorf("unknown profile %q", profileType)
+		}
+
+		if err := profile.WriteTo(w, 0); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+func isProfileType(s string) bool {
+	for _, t := range ProfileTypes {
+		if s == t {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertTestAPIError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	if !assert.Equal(t, status, w.Code) {
+		return
+	}
+
+	var apiErr dhttp.APIError
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr)) {
+		assert.Equal(t, code, apiErr.Code)
+	}
+}
+
+func TestAPIProfilesErrors(t *testing.T) {
+	d := newTestAPIDaemon(t, NewDaemonCfg())
+
+	w := sendTestAPIRequest(d, "POST", "/profiles/foo")
+	assertTestAPIError(t, w, 404, "unknown_profile_type")
+
+	for _, seconds := range []string{"foo", "0", "-1", "301"} {
+		w = sendTestAPIRequest(d, "POST", "/profiles/cpu?seconds="+seconds)
+		assertTestAPIError(t, w, 400, "invalid_seconds")
+	}
+
+	w = sendTestAPIRequest(d, "POST", "/profiles/heap?output=foo")
+	assertTestAPIError(t, w, 400, "invalid_output")
+
+	w = sendTestAPIRequest(d, "POST", "/profiles/heap?output=file")
+	assertTestAPIError(t, w, 400, "missing_profile_directory")
+
+	// Only one cpu profile can be recorded at the same time
+	require.NoError(t, pprof.StartCPUProfile(io.Discard))
+	defer pprof.StopCPUProfile()
+
+	w = sendTestAPIRequest(d, "POST", "/profiles/cpu?seconds=1")
+	assertTestAPIError(t, w, 409, "profile_in_progress")
+}
+
+func TestAPIProfilesStream(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestAPIDaemon(t, NewDaemonCfg())
+
+	w := sendTestAPIRequest(d, "POST", "/profiles/heap")
+	if assert.Equal(200, w.Code) {
+		assert.Equal("application/octet-stream",
+			w.Header().Get("Content-Type"))
+		assert.True(strings.HasPrefix(
+			w.Header().Get("Content-Disposition"),
+			`attachment; filename="test-heap-`))
+		assert.NotZero(w.Body.Len())
+	}
+}
+
+func TestAPIProfilesFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dirPath := t.TempDir()
+
+	cfg := NewDaemonCfg()
+	cfg.API = &APICfg{ProfileDirectory: dirPath}
+
+	d := newTestAPIDaemon(t, cfg)
+
+	w := sendTestAPIRequest(d, "POST", "/profiles/goroutine")
+	require.Equal(200, w.Code)
+
+	var profile APIProfile
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &profile))
+
+	assert.Equal("goroutine", profile.Type)
+	assert.Equal(dirPath, filepath.Dir(profile.File))
+
+	info, err := os.Stat(profile.File)
+	require.NoError(err)
+	assert.Equal(info.Size(), profile.Size)
+	assert.NotZero(profile.Size)
+
+	// Profiles can still be streamed when a directory is configured
+	w = sendTestAPIRequest(d, "POST", "/profiles/goroutine?output=stream")
+	assert.Equal(200, w.Code)
+	assert.NotEmpty(w.Header().Get("Content-Disposition"))
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create and initialize a daemon with the daemon API enabled; http servers
+// are not started, requests are sent directly to their handler.
+func newTestAPIDaemon(t *testing.T, cfg DaemonCfg) *Daemon {
+	cfg.name = "test"
+
+	if cfg.API == nil {
+		cfg.API = &APICfg{}
+	}
+
+	d := newDaemon(cfg, &testService{})
+	t.Cleanup(d.cancel)
+
+	require.NoError(t, d.init())
+
+	return d
+}
+
+func sendTestAPIRequest(d *Daemon, method, uri string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, uri, nil)
+
+	d.HTTPServers["daemon-api"].ServeHTTP(w, req)
+
+	return w
+}
+
+func TestBuildInfoString(t *testing.T) {
+	assert := assert.New(t)
+
+	info := BuildInfo{GoVersion: "go1.18"}
+	assert.Equal("unknown version with go1.18", info.String())
+
+	info = BuildInfo{
+		Version:   "1.2.3",
+		Commit:    "abcdef",
+		BuildDate: "2022-05-01T12:00:00Z",
+		GoVersion: "go1.18",
+	}
+	assert.Equal("1.2.3 (commit abcdef) built on 2022-05-01T12:00:00Z "+
+		"with go1.18", info.String())
+}
+
+func TestAPIStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	setTestBuildInfo(t, BuildInfo{Version: "1.2.3", Commit: "abcdef"})
+
+	d := newTestAPIDaemon(t, NewDaemonCfg())
+
+	w := sendTestAPIRequest(d, "GET", "/status")
+	require.Equal(200, w.Code)
+
+	var status APIStatus
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &status))
+
+	assert.Equal("1.2.3", status.Build.Version)
+	assert.Equal("abcdef", status.Build.Commit)
+	assert.NotEmpty(status.Build.GoVersion)
+	assert.Equal(int64(0), status.NbPanics)
+}
+
+func TestVersionHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	setTestBuildInfo(t, BuildInfo{Version: "1.2.3"})
+
+	// The version set with SetBuildInfo is used by default
+	cfg := NewDaemonCfg()
+	cfg.VersionHeader = "X-Version"
+
+	d := newTestAPIDaemon(t, cfg)
+
+	w := sendTestAPIRequest(d, "GET", "/status")
+	assert.Equal("1.2.3", w.Header().Get("X-Version"))
+
+	cfg = NewDaemonCfg()
+	cfg.Version = "2.0.0"
+	cfg.VersionHeader = "X-Version"
+
+	d = newTestAPIDaemon(t, cfg)
+
+	w = sendTestAPIRequest(d, "GET", "/status")
+	assert.Equal("2.0.0", w.Header().Get("X-Version"))
+
+	d = newTestAPIDaemon(t, NewDaemonCfg())
+
+	w = sendTestAPIRequest(d, "GET", "/status")
+	assert.Empty(w.Header().Get("X-Version"))
+}
+
+func TestAPIAdminRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestAPIDaemon(t, NewDaemonCfg())
+
+	w := sendTestAPIRequest(d, "GET", "/log/levels")
+	assert.Equal(200, w.Code)
+
+	w = sendTestAPIRequest(d, "DELETE", "/log/level")
+	assert.Equal(404, w.Code)
+
+	w = sendTestAPIRequest(d, "PUT", "/maintenance")
+	assert.Equal(405, w.Code)
+
+	w = sendTestAPIRequest(d, "DELETE", "/flags/foo")
+	assert.Equal(404, w.Code)
+
+	cfg := NewDaemonCfg()
+	cfg.API = &APICfg{AdminRoutes: true}
+
+	d = newTestAPIDaemon(t, cfg)
+
+	w = sendTestAPIRequest(d, "DELETE", "/log/level")
+	assert.Equal(204, w.Code)
+}
@@ -38,9 +38,17 @@ func LoadCfg(filePath string, dest interface{}) error {
 		return fmt.Errorf("cannot read %q: %w", filePath, err)
 	}
 
+	if err := LoadCfgData(data, dest); err != nil {
+		return fmt.Errorf("cannot load %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+func LoadCfgData(data []byte, dest interface{}) error {
 	data2, err := RenderCfg(data)
 	if err != nil {
-		return fmt.Errorf("cannot render %q: %w", filePath, err)
+		return fmt.Errorf("cannot render configuration: %w", err)
 	}
 
 	yamlDecoder := yaml.NewDecoder(bytes.NewReader(data2))
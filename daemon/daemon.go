@@ -15,37 +15,104 @@
 package daemon
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/exograd/go-daemon/apikeys"
+	"github.com/exograd/go-daemon/broker"
+	"github.com/exograd/go-daemon/daudit"
+	"github.com/exograd/go-daemon/dflag"
+	"github.com/exograd/go-daemon/dgrpc"
 	"github.com/exograd/go-daemon/dhttp"
 	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/doutbox"
+	"github.com/exograd/go-daemon/dredis"
+	"github.com/exograd/go-daemon/dstore"
 	"github.com/exograd/go-daemon/influx"
 	"github.com/exograd/go-daemon/pg"
+	"github.com/exograd/go-daemon/sentry"
 	"github.com/exograd/go-program"
 )
 
 type DaemonCfg struct {
 	name string
 
+	// The version of the service, used to document http servers; the
+	// version set with SetBuildInfo is used if it is empty.
+	Version string
+
+	// If set, the name of a response header containing the version of the
+	// service added by all http servers.
+	VersionHeader string
+
 	Logger *dlog.LoggerCfg
 
+	RuntimeTuning *RuntimeTuningCfg
+	Watchdog      *WatchdogCfg
+	Shutdown      *ShutdownCfg
+
+	Dependencies *DependenciesCfg
+
+	// Components whose initialization or start failure is not fatal; see
+	// OptionalComponentValues.
+	OptionalComponents []string
+
 	API *APICfg
 
 	HTTPServers map[string]dhttp.ServerCfg
 	HTTPClients map[string]dhttp.ClientCfg
 
+	GRPCServers map[string]dgrpc.ServerCfg
+
 	Influx *influx.ClientCfg
 
+	// Additional clients writing to other servers or organizations; points
+	// can also be routed to another bucket of the main client with
+	// Point.Bucket.
+	InfluxClients map[string]influx.ClientCfg
+
 	Pg *pg.ClientCfg
+
+	// Additional clients for daemons using several databases; each client
+	// applies the migrations of its own schema directory.
+	PgClients map[string]pg.ClientCfg
+
+	APIKeys *apikeys.StoreCfg
+
+	Audit *daudit.AuditorCfg
+
+	Redis *dredis.ClientCfg
+
+	Store *dstore.ClientCfg
+
+	Flags dflag.Cfg
+
+	// Either a NATS configuration or a custom broker
+	NATS   *broker.NATSCfg
+	Broker broker.Broker
+
+	// Events are published with the broker unless a custom publisher is set
+	Outbox *doutbox.OutboxCfg
+
+	Sentry          *sentry.ClientCfg
+	ErrorReporter   ErrorReporter
+	ReportLogErrors bool
 }
 
 func NewDaemonCfg() DaemonCfg {
 	return DaemonCfg{
 		HTTPServers: make(map[string]dhttp.ServerCfg),
 		HTTPClients: make(map[string]dhttp.ClientCfg),
+		GRPCServers: make(map[string]dgrpc.ServerCfg),
+		PgClients:   make(map[string]pg.ClientCfg),
+
+		InfluxClients: make(map[string]influx.ClientCfg),
 	}
 }
 
@@ -65,6 +132,30 @@ func (cfg DaemonCfg) AddHTTPClient(name string, clientCfg dhttp.ClientCfg) {
 	cfg.HTTPClients[name] = clientCfg
 }
 
+func (cfg DaemonCfg) AddInfluxClient(name string, clientCfg influx.ClientCfg) {
+	if _, found := cfg.InfluxClients[name]; found {
+		panic(fmt.Sprintf("duplicate influx client %q", name))
+	}
+
+	cfg.InfluxClients[name] = clientCfg
+}
+
+func (cfg DaemonCfg) AddPgClient(name string, clientCfg pg.ClientCfg) {
+	if _, found := cfg.PgClients[name]; found {
+		panic(fmt.Sprintf("duplicate pg client %q", name))
+	}
+
+	cfg.PgClients[name] = clientCfg
+}
+
+func (cfg DaemonCfg) AddGRPCServer(name string, serverCfg dgrpc.ServerCfg) {
+	if _, found := cfg.GRPCServers[name]; found {
+		panic(fmt.Sprintf("duplicate grpc server %q", name))
+	}
+
+	cfg.GRPCServers[name] = serverCfg
+}
+
 type Daemon struct {
 	Cfg DaemonCfg
 
@@ -75,24 +166,76 @@ type Daemon struct {
 	HTTPServers map[string]*dhttp.Server
 	HTTPClients map[string]*dhttp.Client
 
-	Influx *influx.Client
+	GRPCServers map[string]*dgrpc.Server
+
+	Influx        *influx.Client
+	InfluxClients map[string]*influx.Client
+
+	Pg        *pg.Client
+	PgClients map[string]*pg.Client
+
+	APIKeys *apikeys.Store
+
+	Audit *daudit.Auditor
+
+	Redis *dredis.Client
+
+	Store *dstore.Client
+
+	Flags *dflag.Flags
+
+	Broker broker.Broker
 
-	Pg *pg.Client
+	Outbox *doutbox.Outbox
+
+	Sentry        *sentry.Client
+	ErrorReporter ErrorReporter
+
+	Resources *Resources
 
 	Hostname string
 
+	startTime           time.Time
+	nbGoroutinePanics   int64
+	nbGoroutineRestarts int64
+	unstoppedComponents map[string]bool
+	degradedComponents  map[string]error
+	ready               int32
+	serviceInitialized  bool
+	serviceStarted      bool
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
 	stopChan  chan struct{}
 	errorChan chan error
+	doneChan  chan struct{}
+	err       error
 }
 
 func newDaemon(cfg DaemonCfg, service Service) *Daemon {
+	if cfg.Version == "" {
+		cfg.Version = buildInfo.Version
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
 	d := &Daemon{
 		Cfg: cfg,
 
 		service: service,
 
+		HTTPClients: make(map[string]*dhttp.Client),
+
+		Resources: NewResources(),
+
+		degradedComponents: make(map[string]error),
+
+		ctx:       ctx,
+		cancel:    cancel,
 		stopChan:  make(chan struct{}, 1),
-		errorChan: make(chan error),
+		errorChan: make(chan error, 1),
+		doneChan:  make(chan struct{}),
 	}
 
 	return d
@@ -101,26 +244,65 @@ func newDaemon(cfg DaemonCfg, service Service) *Daemon {
 func (d *Daemon) init() error {
 	d.initDefaultLogger()
 
-	initFuncs := []func() error{
-		d.initHostname,
-		d.initLogger,
-		d.initHTTPServers,
-		d.initHTTPClients,
-		d.initInflux,
-		d.initPg,
-		d.initAPI,
+	if err := d.checkOptionalComponents(); err != nil {
+		return &LifecycleError{
+			Component: "daemon",
+			Phase:     LifecyclePhaseInit,
+			Err:       err,
+		}
+	}
+
+	initFuncs := []struct {
+		component string
+		fn        func() error
+	}{
+		{"hostname", d.initHostname},
+		{"logger", d.initLogger},
+		{"runtime_tuning", d.initRuntimeTuning},
+		{"watchdog", d.initWatchdog},
+		{"error_reporter", d.initErrorReporter},
+		{"flags", d.initFlags},
+		{"http_servers", d.initHTTPServers},
+		{"http_clients", d.initHTTPClients},
+		{"influx", d.initInflux},
+		{"grpc_servers", d.initGRPCServers},
+		{"pg", d.initPg},
+		{"api_keys", d.initAPIKeys},
+		{"audit", d.initAudit},
+		{"redis", d.initRedis},
+		{"store", d.initStore},
+		{"broker", d.initBroker},
+		{"outbox", d.initOutbox},
+		{"api", d.initAPI},
+		{"resources", d.initResources},
+		{"shutdown", d.initShutdown},
+		{"dependencies", d.initDependencies},
 	}
 
-	for _, initFunc := range initFuncs {
-		if err := initFunc(); err != nil {
+	for _, f := range initFuncs {
+		err := d.runLifecycleStep(LifecyclePhaseInit, f.component, f.fn)
+		if err != nil {
 			return err
 		}
 	}
 
-	if err := d.service.Init(d); err != nil {
+	err := d.runLifecycleStep(LifecyclePhaseInit, "service", func() error {
+		return d.service.Init(d)
+	})
+	if err != nil {
 		return err
 	}
 
+	d.serviceInitialized = true
+
+	if err := d.Flags.Validate(); err != nil {
+		return &LifecycleError{
+			Component: "flags",
+			Phase:     LifecyclePhaseInit,
+			Err:       fmt.Errorf("invalid flag configuration: %w", err),
+		}
+	}
+
 	return nil
 }
 
@@ -172,6 +354,21 @@ func (d *Daemon) initHTTPServers() error {
 		cfg.Log = d.Log.Child("http-server", dlog.Data{"server": name})
 		cfg.ErrorChan = d.errorChan
 
+		if header := d.Cfg.VersionHeader; header != "" && d.Cfg.Version != "" {
+			headers := map[string]string{header: d.Cfg.Version}
+			for name, value := range cfg.DefaultHeaders {
+				headers[name] = value
+			}
+
+			cfg.DefaultHeaders = headers
+		}
+
+		// If error messages are already reported, panics will be reported
+		// since they are logged.
+		if !d.Cfg.ReportLogErrors && d.ErrorReporter != nil {
+			cfg.ErrorReporter = d.ErrorReporter
+		}
+
 		server, err := dhttp.NewServer(cfg)
 		if err != nil {
 			return fmt.Errorf("cannot create http server %q: %w", name, err)
@@ -184,8 +381,6 @@ func (d *Daemon) initHTTPServers() error {
 }
 
 func (d *Daemon) initHTTPClients() error {
-	d.HTTPClients = make(map[string]*dhttp.Client)
-
 	if d.Cfg.Influx != nil {
 		cfg := influx.HTTPClientCfg(d.Cfg.Influx)
 
@@ -194,6 +389,30 @@ func (d *Daemon) initHTTPClients() error {
 		}
 	}
 
+	for name, influxCfg := range d.Cfg.InfluxClients {
+		cfg := influx.HTTPClientCfg(&influxCfg)
+
+		if err := d.initHTTPClient("influx-"+name, cfg); err != nil {
+			return err
+		}
+	}
+
+	if d.Cfg.Store != nil {
+		cfg := dstore.HTTPClientCfg(d.Cfg.Store)
+
+		if err := d.initHTTPClient("dstore", cfg); err != nil {
+			return err
+		}
+	}
+
+	if d.Cfg.Audit != nil && d.Cfg.Audit.Webhook != nil {
+		cfg := d.Cfg.Audit.Webhook.Client
+
+		if err := d.initHTTPClient("daudit", cfg); err != nil {
+			return err
+		}
+	}
+
 	for name, cfg := range d.Cfg.HTTPClients {
 		if err := d.initHTTPClient(name, cfg); err != nil {
 			return err
@@ -220,61 +439,341 @@ func (d *Daemon) initHTTPClient(name string, cfg dhttp.ClientCfg) error {
 	return nil
 }
 
+func (d *Daemon) initGRPCServers() error {
+	d.GRPCServers = make(map[string]*dgrpc.Server)
+
+	for name, cfg := range d.Cfg.GRPCServers {
+		cfg.Log = d.Log.Child("grpc-server", dlog.Data{"server": name})
+		cfg.ErrorChan = d.errorChan
+		cfg.Influx = d.Influx
+
+		if !d.Cfg.ReportLogErrors && d.ErrorReporter != nil {
+			cfg.ErrorReporter = d.ErrorReporter
+		}
+
+		server, err := dgrpc.NewServer(cfg)
+		if err != nil {
+			return fmt.Errorf("cannot create grpc server %q: %w", name, err)
+		}
+
+		d.GRPCServers[name] = server
+	}
+
+	return nil
+}
+
 func (d *Daemon) initInflux() error {
-	if d.Cfg.Influx == nil {
+	if d.Cfg.Influx != nil {
+		cfg := *d.Cfg.Influx
+
+		cfg.Log = d.Log.Child("influx", dlog.Data{})
+		cfg.HTTPClient = d.HTTPClients["influx"]
+		cfg.Hostname = d.Hostname
+
+		client, err := influx.NewClient(cfg)
+		if err != nil {
+			return fmt.Errorf("cannot create influx client: %w", err)
+		}
+
+		d.Influx = client
+	}
+
+	d.InfluxClients = make(map[string]*influx.Client)
+
+	for name, cfg := range d.Cfg.InfluxClients {
+		cfg.Log = d.Log.Child("influx", dlog.Data{"client": name})
+		cfg.HTTPClient = d.HTTPClients["influx-"+name]
+		cfg.Hostname = d.Hostname
+
+		client, err := influx.NewClient(cfg)
+		if err != nil {
+			return fmt.Errorf("cannot create influx client %q: %w", name, err)
+		}
+
+		d.InfluxClients[name] = client
+	}
+
+	return nil
+}
+
+func (d *Daemon) initPg() error {
+	if d.Cfg.Pg != nil {
+		cfg := *d.Cfg.Pg
+
+		cfg.Log = d.Log.Child("pg", dlog.Data{})
+
+		client, err := pg.NewClient(cfg)
+		if err != nil {
+			return fmt.Errorf("cannot create pg client: %w", err)
+		}
+
+		d.Pg = client
+	}
+
+	d.PgClients = make(map[string]*pg.Client)
+
+	for name, cfg := range d.Cfg.PgClients {
+		cfg.Log = d.Log.Child("pg", dlog.Data{"client": name})
+
+		client, err := pg.NewClient(cfg)
+		if err != nil {
+			return fmt.Errorf("cannot create pg client %q: %w", name, err)
+		}
+
+		d.PgClients[name] = client
+	}
+
+	return nil
+}
+
+func (d *Daemon) initAPIKeys() error {
+	if d.Cfg.APIKeys == nil {
 		return nil
 	}
 
-	cfg := *d.Cfg.Influx
+	if d.Pg == nil {
+		return fmt.Errorf("api keys require a pg client")
+	}
+
+	cfg := *d.Cfg.APIKeys
 
-	cfg.Log = d.Log.Child("influx", dlog.Data{})
-	cfg.HTTPClient = d.HTTPClients["influx"]
-	cfg.Hostname = d.Hostname
+	cfg.Log = d.Log.Child("api-keys", dlog.Data{})
+	cfg.Pg = d.Pg
 
-	client, err := influx.NewClient(cfg)
+	store, err := apikeys.NewStore(cfg)
 	if err != nil {
-		return fmt.Errorf("cannot create influx client: %w", err)
+		return fmt.Errorf("cannot create api key store: %w", err)
+	}
+
+	for _, name := range cfg.Servers {
+		server, found := d.HTTPServers[name]
+		if !found {
+			return fmt.Errorf("unknown http server %q", name)
+		}
+
+		server.Cfg.Authenticators = append(server.Cfg.Authenticators, store)
 	}
 
-	d.Influx = client
+	d.APIKeys = store
 
 	return nil
 }
 
-func (d *Daemon) initPg() error {
-	if d.Cfg.Pg == nil {
+func (d *Daemon) initAudit() error {
+	if d.Cfg.Audit == nil {
+		return nil
+	}
+
+	cfg := *d.Cfg.Audit
+
+	cfg.Log = d.Log.Child("audit", dlog.Data{})
+
+	if cfg.Pg != nil {
+		if d.Pg == nil {
+			return fmt.Errorf("the audit pg sink requires a pg client")
+		}
+
+		pgCfg := *cfg.Pg
+		pgCfg.Pg = d.Pg
+		cfg.Pg = &pgCfg
+	}
+
+	if cfg.Webhook != nil {
+		webhookCfg := *cfg.Webhook
+		webhookCfg.HTTPClient = d.HTTPClients["daudit"]
+		cfg.Webhook = &webhookCfg
+	}
+
+	auditor, err := daudit.NewAuditor(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot create auditor: %w", err)
+	}
+
+	for _, name := range cfg.Servers {
+		server, found := d.HTTPServers[name]
+		if !found {
+			return fmt.Errorf("unknown http server %q", name)
+		}
+
+		server.Cfg.Observers = append(server.Cfg.Observers, auditor)
+	}
+
+	d.Audit = auditor
+
+	return nil
+}
+
+func (d *Daemon) initRedis() error {
+	if d.Cfg.Redis == nil {
 		return nil
 	}
 
-	cfg := *d.Cfg.Pg
+	cfg := *d.Cfg.Redis
 
-	cfg.Log = d.Log.Child("pg", dlog.Data{})
+	cfg.Log = d.Log.Child("redis", dlog.Data{})
+	cfg.Influx = d.Influx
 
-	client, err := pg.NewClient(cfg)
+	client, err := dredis.NewClient(cfg)
 	if err != nil {
-		return fmt.Errorf("cannot create pg client: %w", err)
+		return fmt.Errorf("cannot create redis client: %w", err)
 	}
 
-	d.Pg = client
+	d.Redis = client
+
+	return nil
+}
 
+func (d *Daemon) initFlags() error {
+	d.Flags = dflag.NewFlags(d.Cfg.Flags)
 	return nil
 }
 
-func (d *Daemon) wait() {
+func (d *Daemon) initStore() error {
+	if d.Cfg.Store == nil {
+		return nil
+	}
+
+	cfg := *d.Cfg.Store
+
+	cfg.Log = d.Log.Child("dstore", dlog.Data{})
+	cfg.HTTPClient = d.HTTPClients["dstore"]
+
+	client, err := dstore.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot create store client: %w", err)
+	}
+
+	d.Store = client
+
+	return nil
+}
+
+func (d *Daemon) initBroker() error {
+	if d.Cfg.Broker != nil {
+		d.Broker = d.Cfg.Broker
+		return nil
+	}
+
+	if d.Cfg.NATS == nil {
+		return nil
+	}
+
+	cfg := *d.Cfg.NATS
+
+	cfg.Log = d.Log.Child("nats", dlog.Data{})
+
+	if cfg.Name == "" {
+		cfg.Name = d.Cfg.name
+	}
+
+	b, err := broker.NewNATSBroker(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot create nats broker: %w", err)
+	}
+
+	d.Broker = b
+
+	return nil
+}
+
+func (d *Daemon) wait() error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	diagnosticsChan := make(chan os.Signal, 1)
+	if len(diagnosticsSignals) > 0 {
+		signal.Notify(diagnosticsChan, diagnosticsSignals...)
+		defer signal.Stop(diagnosticsChan)
+	}
+
+	for {
+		select {
+		case signo := <-sigChan:
+			fmt.Println()
+			d.Log.Info("received signal %d (%v)", signo, signo)
+			d.drain(sigChan)
+			return nil
+
+		case <-diagnosticsChan:
+			d.dumpDiagnostics()
+
+		case <-d.stopChan:
+			d.drain(sigChan)
+			return nil
+
+		case err := <-d.errorChan:
+			d.Log.Error("daemon error: %v", err)
+			return err
+		}
+	}
+}
+
+// Stop asks the daemon to stop as if it had received a termination signal.
+// It does not wait for the daemon to be stopped; use Done for that.
+func (d *Daemon) Stop() {
 	select {
-	case signo := <-sigChan:
-		fmt.Println()
-		d.Log.Info("received signal %d (%v)", signo, signo)
+	case d.stopChan <- struct{}{}:
+	default:
+	}
+}
+
+// Fatal signals an unrecoverable error. When the daemon was started with
+// Run, the program exits with status 1.
+func (d *Daemon) Fatal(err error) {
+	select {
+	case d.errorChan <- err:
+	default:
+	}
+}
 
-	case <-d.stopChan:
+// Done returns a channel closed once the daemon has been stopped and
+// terminated.
+func (d *Daemon) Done() <-chan struct{} {
+	return d.doneChan
+}
+
+// Err returns the error which caused the daemon to stop, if any. It must
+// only be called once Done has been closed.
+func (d *Daemon) Err() error {
+	return d.err
+}
+
+func (d *Daemon) initOutbox() error {
+	if d.Cfg.Outbox == nil {
+		return nil
+	}
+
+	if d.Pg == nil {
+		return fmt.Errorf("the outbox requires a pg client")
+	}
+
+	cfg := *d.Cfg.Outbox
 
-	case err := <-d.errorChan:
-		d.Log.Error("daemon error: %v", err)
-		os.Exit(1)
+	cfg.Log = d.Log.Child("outbox", dlog.Data{})
+	cfg.Pg = d.Pg
+
+	if cfg.Publisher == nil {
+		if err, found := d.degradedComponents["broker"]; found {
+			d.Log.Error("broker unavailable, running without outbox")
+			d.degradedComponents["outbox"] = err
+			return nil
+		}
+
+		if d.Broker == nil {
+			return fmt.Errorf("the outbox requires a publisher or a broker")
+		}
+
+		cfg.Publisher = &doutbox.BrokerPublisher{Broker: d.Broker}
 	}
+
+	outbox, err := doutbox.NewOutbox(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot create outbox: %w", err)
+	}
+
+	d.Outbox = outbox
+
+	return nil
 }
 
 func (d *Daemon) start() error {
@@ -282,7 +781,11 @@ func (d *Daemon) start() error {
 
 	for name, s := range d.HTTPServers {
 		if err := s.Start(); err != nil {
-			return fmt.Errorf("cannot start http server %q: %w", name, err)
+			return &LifecycleError{
+				Component: "http/" + name,
+				Phase:     LifecyclePhaseStart,
+				Err:       err,
+			}
 		}
 	}
 
@@ -290,52 +793,114 @@ func (d *Daemon) start() error {
 		d.Influx.Start()
 	}
 
-	if err := d.service.Start(d); err != nil {
-		return err
+	for _, c := range d.InfluxClients {
+		c.Start()
 	}
 
-	d.Log.Info("started")
+	d.startTime = time.Now()
 
-	return nil
-}
+	d.startDaemonMetrics()
+	d.startHTTPServerMetrics()
+	d.startPgMetrics()
+	d.startWatchdog()
 
-func (d *Daemon) stop() {
-	d.Log.Info("stopping")
+	if d.Redis != nil {
+		d.Redis.Start()
+	}
 
-	d.service.Stop(d)
+	for name, s := range d.GRPCServers {
+		if err := s.Start(); err != nil {
+			return &LifecycleError{
+				Component: "grpc/" + name,
+				Phase:     LifecyclePhaseStart,
+				Err:       err,
+			}
+		}
+	}
 
-	if d.Pg != nil {
-		d.Pg.Close()
+	err := d.runLifecycleStep(LifecyclePhaseStart, "dependencies",
+		d.waitForDependencies)
+	if err != nil {
+		return err
 	}
 
-	if d.Influx != nil {
-		d.Influx.Stop()
+	if err := d.service.Start(d); err != nil {
+		return &LifecycleError{
+			Component: "service",
+			Phase:     LifecyclePhaseStart,
+			Err:       err,
+		}
 	}
 
-	for _, s := range d.HTTPServers {
-		s.Stop()
+	d.serviceStarted = true
+
+	// Consumers are started last since they call service code
+	if d.Broker != nil {
+		err := d.runLifecycleStep(LifecyclePhaseStart, "broker", func() error {
+			if err := d.Broker.Start(); err != nil {
+				return fmt.Errorf("cannot start broker: %w", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Outbox != nil {
+		d.Outbox.Start()
 	}
 
-	d.Log.Info("stopped")
+	atomic.StoreInt32(&d.ready, 1)
+
+	d.Log.Info("started")
+
+	return nil
 }
 
 func (d *Daemon) terminate() {
-	d.service.Terminate(d)
+	// Components which could not be stopped are not terminated either since
+	// termination usually waits for them to be stopped.
+	stopped := func(name string) bool {
+		return !d.unstoppedComponents[name]
+	}
 
-	if d.Influx != nil {
+	if d.serviceInitialized && stopped("service") {
+		d.service.Terminate(d)
+	}
+
+	if d.Influx != nil && stopped("influx") {
 		d.Influx.Terminate()
 	}
 
+	for name, c := range d.InfluxClients {
+		if stopped("influx/" + name) {
+			c.Terminate()
+		}
+	}
+
+	if d.Sentry != nil {
+		d.Sentry.Stop()
+	}
+
 	for _, c := range d.HTTPClients {
 		c.Terminate()
 	}
 
-	for _, s := range d.HTTPServers {
-		s.Terminate()
+	for name, s := range d.GRPCServers {
+		if stopped("grpc/" + name) {
+			s.Terminate()
+		}
+	}
+
+	for name, s := range d.HTTPServers {
+		if stopped("http/" + name) {
+			s.Terminate()
+		}
 	}
 
-	close(d.stopChan)
-	close(d.errorChan)
+	close(d.doneChan)
 }
 
 func Run(name, description string, service Service) {
@@ -346,9 +911,15 @@ func Run(name, description string, service Service) {
 		"the path of the configuration file")
 	p.AddFlag("", "validate-cfg",
 		"validate the configuration and exit")
+	p.AddFlag("", "version", "print version information and exit")
 
 	p.ParseCommandLine()
 
+	if p.IsOptionSet("version") {
+		fmt.Println(buildInfo.String())
+		return
+	}
+
 	// Configuration
 	serviceCfg := service.DefaultServiceCfg()
 
@@ -382,60 +953,122 @@ func Run(name, description string, service Service) {
 	d := newDaemon(daemonCfg, service)
 
 	if err := d.init(); err != nil {
-		p.Fatal("cannot initialize daemon: %v", err)
+		p.Error("cannot initialize daemon: %v", err)
+		os.Exit(ExitCode(err))
 	}
 
 	if err := d.start(); err != nil {
-		p.Fatal("cannot start daemon: %v", err)
+		d.reportFatalError(fmt.Errorf("cannot start daemon: %w", err))
+		p.Error("cannot start daemon: %v", err)
+		os.Exit(ExitCode(err))
+	}
+
+	if err := d.wait(); err != nil {
+		d.reportFatalError(fmt.Errorf("daemon error: %w", err))
+		os.Exit(ExitCode(err))
 	}
 
-	d.wait()
 	d.stop()
 
 	d.terminate()
 }
 
-func RunTest(name string, service Service, cfgPath string, readyChan chan<- struct{}) {
-	abort := func(format string, args ...interface{}) {
-		fmt.Fprintf(os.Stderr, format+"\n", args...)
-		os.Exit(1)
-	}
+type TestCfg struct {
+	CfgPath string
+	CfgData []byte
 
+	// Called on the daemon configuration built by the service before the
+	// daemon is initialized.
+	UpdateDaemonCfg func(*DaemonCfg) error
+}
+
+func RunTest(name string, service Service, cfgPath string) (*Daemon, error) {
+	return RunTestCfg(name, service, TestCfg{CfgPath: cfgPath})
+}
+
+func RunTestCfg(name string, service Service, testCfg TestCfg) (*Daemon, error) {
 	// Configuration
 	serviceCfg := service.DefaultServiceCfg()
 
-	if cfgPath != "" {
-		if err := LoadCfg(cfgPath, serviceCfg); err != nil {
-			abort("cannot load configuration: %v", err)
+	if testCfg.CfgPath != "" || testCfg.CfgData != nil {
+		var err error
+
+		if testCfg.CfgPath != "" {
+			err = LoadCfg(testCfg.CfgPath, serviceCfg)
+		} else {
+			err = LoadCfgData(testCfg.CfgData, serviceCfg)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot load configuration: %w", err)
 		}
 
 		if err := service.ValidateServiceCfg(); err != nil {
-			abort("invalid configuration: %v", err)
+			return nil, fmt.Errorf("invalid configuration: %w", err)
 		}
 	}
 
 	daemonCfg, err := service.DaemonCfg()
 	if err != nil {
-		abort("invalid configuration: %v", err)
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	daemonCfg.name = name
 
+	if testCfg.UpdateDaemonCfg != nil {
+		if err := testCfg.UpdateDaemonCfg(&daemonCfg); err != nil {
+			return nil, fmt.Errorf("cannot update configuration: %w", err)
+		}
+	}
+
 	// Daemon
 	d := newDaemon(daemonCfg, service)
 
+	// Contrary to Run, the process does not exit on failure: components
+	// initialized or started so far must be stopped and terminated.
 	if err := d.init(); err != nil {
-		abort("cannot initialize daemon: %v", err)
+		d.stop()
+		d.terminate()
+		return nil, fmt.Errorf("cannot initialize daemon: %w", err)
 	}
 
 	if err := d.start(); err != nil {
-		abort("cannot start daemon: %v", err)
+		d.stop()
+		d.terminate()
+		return nil, fmt.Errorf("cannot start daemon: %w", err)
 	}
 
-	close(readyChan)
+	go func() {
+		d.err = d.wait()
 
-	d.wait()
-	d.stop()
+		d.stop()
+		d.terminate()
+	}()
 
-	d.terminate()
+	return d, nil
+}
+
+// SetMaintenance enables or disables maintenance mode on a set of http
+// servers, or on all servers except the daemon API server if no name is
+// provided.
+func (d *Daemon) SetMaintenance(enabled bool, names ...string) error {
+	if len(names) == 0 {
+		for name := range d.HTTPServers {
+			if name != "daemon-api" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if _, found := d.HTTPServers[name]; !found {
+			return fmt.Errorf("unknown http server %q", name)
+		}
+	}
+
+	for _, name := range names {
+		d.HTTPServers[name].SetMaintenance(enabled)
+	}
+
+	return nil
 }
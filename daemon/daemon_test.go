@@ -0,0 +1,259 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/exograd/go-daemon/pg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testService struct {
+	Cfg DaemonCfg
+
+	// If set, Stop blocks until the channel is closed
+	StopChan chan struct{}
+
+	calls      []string
+	callsMutex sync.Mutex
+}
+
+func (s *testService) DefaultServiceCfg() interface{} {
+	return &struct{}{}
+}
+
+func (s *testService) ValidateServiceCfg() error {
+	return nil
+}
+
+func (s *testService) DaemonCfg() (DaemonCfg, error) {
+	return s.Cfg, nil
+}
+
+func (s *testService) Init(d *Daemon) error {
+	s.addCall("init")
+	return nil
+}
+
+func (s *testService) Start(d *Daemon) error {
+	s.addCall("start")
+	return nil
+}
+
+func (s *testService) PreStop(d *Daemon) {
+	s.addCall("pre_stop")
+}
+
+func (s *testService) Stop(d *Daemon) {
+	if s.StopChan != nil {
+		<-s.StopChan
+	}
+
+	s.addCall("stop")
+}
+
+func (s *testService) Terminate(d *Daemon) {
+	s.addCall("terminate")
+}
+
+func (s *testService) addCall(name string) {
+	s.callsMutex.Lock()
+	s.calls = append(s.calls, name)
+	s.callsMutex.Unlock()
+}
+
+func (s *testService) Calls() []string {
+	s.callsMutex.Lock()
+	defer s.callsMutex.Unlock()
+
+	return append([]string(nil), s.calls...)
+}
+
+func newTestDaemon(t *testing.T, cfg DaemonCfg) *Daemon {
+	cfg.name = "test"
+
+	d := newDaemon(cfg, nil)
+	d.Log = dlog.DefaultLogger("test")
+
+	t.Cleanup(d.cancel)
+
+	return d
+}
+
+func waitForTestDaemon(t *testing.T, d *Daemon) {
+	select {
+	case <-d.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout while waiting for the daemon to stop")
+	}
+}
+
+func TestDaemonStop(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := &testService{}
+
+	d, err := RunTest("test", s, "")
+	require.NoError(err)
+
+	assert.True(d.Ready())
+	assert.Equal([]string{"init", "start"}, s.Calls())
+
+	d.Stop()
+	d.Stop()
+
+	waitForTestDaemon(t, d)
+
+	assert.NoError(d.Err())
+	assert.False(d.Ready())
+	assert.Equal([]string{"init", "start", "pre_stop", "stop", "terminate"},
+		s.Calls())
+}
+
+func TestDaemonFatal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := &testService{}
+
+	d, err := RunTest("test", s, "")
+	require.NoError(err)
+
+	fatalErr := errors.New("foo")
+
+	d.Fatal(fatalErr)
+	d.Fatal(errors.New("bar"))
+
+	waitForTestDaemon(t, d)
+
+	assert.Equal(fatalErr, d.Err())
+	assert.Equal([]string{"init", "start", "stop", "terminate"}, s.Calls())
+}
+
+func TestRunTestCfg(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := &testService{}
+
+	d, err := RunTestCfg("test", s, TestCfg{
+		UpdateDaemonCfg: func(cfg *DaemonCfg) error {
+			cfg.Version = "1.2.3"
+			return nil
+		},
+	})
+	require.NoError(err)
+
+	assert.Equal("1.2.3", d.Cfg.Version)
+
+	d.Stop()
+	waitForTestDaemon(t, d)
+
+	_, err = RunTestCfg("test", s, TestCfg{
+		UpdateDaemonCfg: func(cfg *DaemonCfg) error {
+			return errors.New("foo")
+		},
+	})
+	assert.Error(err)
+}
+
+func TestRunTestCfgFailure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Initialization failure
+	s := &testService{Cfg: NewDaemonCfg()}
+	s.Cfg.Shutdown = &ShutdownCfg{Order: []string{"foo"}}
+
+	_, err := RunTestCfg("test", s, TestCfg{})
+	require.Error(err)
+	assert.Empty(s.Calls())
+
+	// Start failure
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+
+	s = &testService{Cfg: NewDaemonCfg()}
+	s.Cfg.AddHTTPServer("main", dhttp.ServerCfg{
+		Address: listener.Addr().String(),
+	})
+
+	_, err = RunTestCfg("test", s, TestCfg{})
+	require.Error(err)
+	assert.Equal([]string{"init", "terminate"}, s.Calls())
+}
+
+func TestDaemonPgClients(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pgCfg := pg.ClientCfg{
+		URI: "postgres://localhost:1/test?connect_timeout=1",
+
+		Startup: &pg.StartupCfg{
+			MaxAttempts:   1,
+			InitialDelay:  dtime.Duration(10 * time.Millisecond),
+			StartDegraded: true,
+		},
+	}
+
+	cfg := NewDaemonCfg()
+	cfg.name = "test"
+	cfg.AddPgClient("analytics", pgCfg)
+
+	assert.Panics(func() {
+		cfg.AddPgClient("analytics", pgCfg)
+	})
+
+	d := newDaemon(cfg, &testService{})
+	t.Cleanup(d.cancel)
+
+	require.NoError(d.init())
+
+	client := d.PgClients["analytics"]
+	require.NotNil(client)
+	t.Cleanup(client.Close)
+
+	assert.Nil(d.Pg)
+	assert.Equal(client,
+		MustGetResource[*pg.Client](d.Resources, "pg_clients/analytics"))
+	assert.Equal(map[string]bool{"pg/analytics": false}, d.ComponentStates())
+
+	// Clients which cannot connect without starting degraded cause the
+	// initialization of the daemon to fail.
+	pgCfg.Startup.StartDegraded = false
+
+	cfg = NewDaemonCfg()
+	cfg.name = "test"
+	cfg.AddPgClient("analytics", pgCfg)
+
+	d = newDaemon(cfg, &testService{})
+	t.Cleanup(d.cancel)
+
+	err := d.init()
+	require.Error(err)
+	assert.Contains(err.Error(), `"analytics"`)
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/exograd/go-daemon/pg"
+)
+
+type DependencyType string
+
+const (
+	// A pg client able to reach its database
+	DependencyTypePg DependencyType = "pg"
+
+	// A pg client whose schemas have all their migrations applied by
+	// another program in charge of migrations; the client must be
+	// configured with SkipSchemaUpdates.
+	DependencyTypePgSchemas DependencyType = "pg_schemas"
+
+	// An http url returning a 200 status
+	DependencyTypeHTTP DependencyType = "http"
+)
+
+var DependencyTypeValues = []DependencyType{
+	DependencyTypePg,
+	DependencyTypePgSchemas,
+	DependencyTypeHTTP,
+}
+
+type DependencyCfg struct {
+	Type DependencyType
+
+	// The name used in log messages; a name is derived from the type and
+	// the target of the dependency by default.
+	Name string
+
+	// For pg dependencies, the name of the pg client; the main client is
+	// used if it is empty.
+	PgClient string
+
+	// For http dependencies, the url to request and optionally the name of
+	// the http client used to send requests.
+	URL        string
+	HTTPClient string
+}
+
+// Declared dependencies are checked after all components have been started
+// and before the service is started. Each dependency is checked until it
+// is available; the daemon fails to start if the timeout is reached.
+type DependenciesCfg struct {
+	Dependencies []DependencyCfg
+
+	InitialDelay dtime.Duration // 500ms by default
+	MaxDelay     dtime.Duration // 10s by default
+	Timeout      dtime.Duration // 5m by default
+}
+
+type dependencyCheck struct {
+	name  string
+	check func(context.Context) error
+}
+
+func (d *Daemon) initDependencies() error {
+	cfg := d.Cfg.Dependencies
+	if cfg == nil {
+		return nil
+	}
+
+	_, err := d.dependencyChecks(cfg)
+	return err
+}
+
+func (d *Daemon) waitForDependencies() error {
+	if d.Cfg.Dependencies == nil {
+		return nil
+	}
+
+	cfg := *d.Cfg.Dependencies
+
+	if cfg.InitialDelay == 0 {
+		cfg.InitialDelay = dtime.Duration(500 * time.Millisecond)
+	}
+
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = dtime.Duration(10 * time.Second)
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = dtime.Duration(5 * time.Minute)
+	}
+
+	checks, err := d.dependencyChecks(&cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, cfg.Timeout.Duration())
+	defer cancel()
+
+	for _, check := range checks {
+		if err := d.waitForDependency(ctx, &cfg, check); err != nil {
+			return fmt.Errorf("dependency %q unavailable: %w", check.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Daemon) waitForDependency(ctx context.Context, cfg *DependenciesCfg, check dependencyCheck) error {
+	delay := cfg.InitialDelay.Duration()
+
+	for attempt := 1; ; attempt++ {
+		err := check.check(ctx)
+		if err == nil {
+			if attempt > 1 {
+				d.Log.Info("dependency %q available", check.name)
+			}
+
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		d.Log.Error("dependency %q unavailable (attempt %d), retrying in "+
+			"%v: %v", check.name, attempt, delay, err)
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		delay *= 2
+		if max := cfg.MaxDelay.Duration(); delay > max {
+			delay = max
+		}
+	}
+}
+
+func (d *Daemon) dependencyChecks(cfg *DependenciesCfg) ([]dependencyCheck, error) {
+	checks := make([]dependencyCheck, len(cfg.Dependencies))
+
+	for i, depCfg := range cfg.Dependencies {
+		check, err := d.dependencyCheck(depCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dependency %d: %w", i, err)
+		}
+
+		if depCfg.Name != "" {
+			check.name = depCfg.Name
+		}
+
+		checks[i] = check
+	}
+
+	return checks, nil
+}
+
+func (d *Daemon) dependencyCheck(cfg DependencyCfg) (dependencyCheck, error) {
+	var check dependencyCheck
+
+	switch cfg.Type {
+	case DependencyTypePg, DependencyTypePgSchemas:
+		client := d.Pg
+		check.name = string(cfg.Type)
+
+		if cfg.PgClient != "" {
+			client = d.PgClients[cfg.PgClient]
+			check.name += "/" + cfg.PgClient
+		}
+
+		if client == nil {
+			if cfg.PgClient == "" {
+				return check, fmt.Errorf("missing pg client")
+			}
+
+			return check, fmt.Errorf("unknown pg client %q", cfg.PgClient)
+		}
+
+		if cfg.Type == DependencyTypePg {
+			check.check = client.Pool.Ping
+		} else {
+			// Otherwise the client applies migrations itself and the
+			// check would always succeed.
+			if !client.Cfg.SkipSchemaUpdates {
+				return check, fmt.Errorf("schema updates must be " +
+					"disabled on pg clients used for pg_schemas dependencies")
+			}
+
+			check.check = func(ctx context.Context) error {
+				return checkPgSchemas(ctx, client)
+			}
+		}
+
+	case DependencyTypeHTTP:
+		uri, err := url.Parse(cfg.URL)
+		if err != nil || uri.Scheme == "" || uri.Host == "" {
+			return check, fmt.Errorf("invalid url %q", cfg.URL)
+		}
+
+		var client *dhttp.Client
+		if cfg.HTTPClient != "" {
+			client = d.HTTPClients[cfg.HTTPClient]
+			if client == nil {
+				return check, fmt.Errorf("unknown http client %q",
+					cfg.HTTPClient)
+			}
+		}
+
+		check.name = "http " + uri.String()
+		check.check = func(ctx context.Context) error {
+			return checkHTTPURL(ctx, client, uri)
+		}
+
+	default:
+		return check, fmt.Errorf("invalid dependency type %q", cfg.Type)
+	}
+
+	return check, nil
+}
+
+func checkPgSchemas(ctx context.Context, client *pg.Client) error {
+	for _, name := range client.Cfg.SchemaNames {
+		dirPath := path.Join(client.Cfg.SchemaDirectory, name)
+
+		statuses, err := client.SchemaStatusContext(ctx, name, dirPath)
+		if err != nil {
+			return fmt.Errorf("cannot load status of schema %q: %w",
+				name, err)
+		}
+
+		for _, status := range statuses {
+			if !status.Applied {
+				return fmt.Errorf("migration %s of schema %q not applied",
+					status.Version, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkHTTPURL(ctx context.Context, client *dhttp.Client, uri *url.URL) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var res *http.Response
+	var err error
+
+	if client == nil {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
+		if err != nil {
+			return fmt.Errorf("cannot create request: %w", err)
+		}
+
+		res, err = http.DefaultClient.Do(req)
+	} else {
+		res, err = client.SendRequestContext(ctx, "GET", uri, nil, nil)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
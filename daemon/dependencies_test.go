@@ -0,0 +1,164 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/exograd/go-daemon/pg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	var nbRequests int64
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt64(&nbRequests, 1) < 3 {
+				w.WriteHeader(503)
+			}
+		}))
+	defer server.Close()
+
+	d := newTestDaemon(t, DaemonCfg{
+		Dependencies: &DependenciesCfg{
+			Dependencies: []DependencyCfg{
+				{Type: DependencyTypeHTTP, URL: server.URL},
+			},
+
+			InitialDelay: dtime.Duration(time.Millisecond),
+			MaxDelay:     dtime.Duration(5 * time.Millisecond),
+			Timeout:      dtime.Duration(5 * time.Second),
+		},
+	})
+
+	assert.NoError(d.waitForDependencies())
+	assert.Equal(int64(3), atomic.LoadInt64(&nbRequests))
+}
+
+func TestWaitForDependenciesTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(503)
+		}))
+	defer server.Close()
+
+	d := newTestDaemon(t, DaemonCfg{
+		Dependencies: &DependenciesCfg{
+			Dependencies: []DependencyCfg{
+				{Type: DependencyTypeHTTP, URL: server.URL, Name: "api"},
+			},
+
+			InitialDelay: dtime.Duration(time.Millisecond),
+			MaxDelay:     dtime.Duration(5 * time.Millisecond),
+			Timeout:      dtime.Duration(50 * time.Millisecond),
+		},
+	})
+
+	start := time.Now()
+
+	err := d.waitForDependencies()
+	if assert.Error(err) {
+		assert.Contains(err.Error(), `dependency "api" unavailable`)
+	}
+
+	assert.Less(time.Since(start), 5*time.Second)
+}
+
+func TestDependencyChecksInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{})
+
+	tests := []DependencyCfg{
+		{Type: "foo"},
+		{Type: DependencyTypePg},
+		{Type: DependencyTypePgSchemas, PgClient: "foo"},
+		{Type: DependencyTypeHTTP, URL: "/health"},
+		{Type: DependencyTypeHTTP, URL: "http://localhost", HTTPClient: "foo"},
+	}
+
+	for _, test := range tests {
+		cfg := DependenciesCfg{Dependencies: []DependencyCfg{test}}
+
+		_, err := d.dependencyChecks(&cfg)
+		assert.Error(err, "%#v", test)
+	}
+}
+
+func TestDependencyChecksPgSchemas(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pgCfg := pg.ClientCfg{
+		URI:             "postgres://localhost:1/test?connect_timeout=1",
+		SchemaDirectory: t.TempDir(),
+		SchemaNames:     []string{"main"},
+
+		Startup: &pg.StartupCfg{
+			MaxAttempts:   1,
+			InitialDelay:  dtime.Duration(10 * time.Millisecond),
+			StartDegraded: true,
+		},
+	}
+
+	cfg := NewDaemonCfg()
+	cfg.name = "test"
+	cfg.AddPgClient("migrated", pgCfg)
+
+	pgCfg.SkipSchemaUpdates = true
+	cfg.AddPgClient("external", pgCfg)
+
+	d := newDaemon(cfg, &testService{})
+	t.Cleanup(d.cancel)
+
+	require.NoError(d.init())
+
+	for _, client := range d.PgClients {
+		t.Cleanup(client.Close)
+	}
+
+	// The schemas of clients applying migrations are always up-to-date
+	_, err := d.dependencyChecks(&DependenciesCfg{
+		Dependencies: []DependencyCfg{
+			{Type: DependencyTypePgSchemas, PgClient: "migrated"},
+		},
+	})
+	assert.Error(err)
+
+	checks, err := d.dependencyChecks(&DependenciesCfg{
+		Dependencies: []DependencyCfg{
+			{Type: DependencyTypePgSchemas, PgClient: "external"},
+		},
+	})
+	require.NoError(err)
+	require.Len(checks, 1)
+	assert.Equal("pg_schemas/external", checks[0].name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.Error(checks[0].check(ctx))
+}
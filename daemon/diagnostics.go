@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/exograd/go-daemon/dlog"
+)
+
+// dumpDiagnostics logs a snapshot of the state of the daemon. It is called
+// when the daemon receives a diagnostics signal (SIGUSR1 on Unix systems) so
+// that operators can inspect a daemon whose API is unreachable.
+func (d *Daemon) dumpDiagnostics() {
+	log := d.Log.Child("diagnostics", dlog.Data{})
+
+	log.Info("dumping diagnostics")
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	log.Info("goroutines: %d", runtime.NumGoroutine())
+	log.Info("memory: heap_alloc %d, heap_in_use %d, heap_objects %d, "+
+		"stack_in_use %d, sys %d", stats.HeapAlloc, stats.HeapInuse,
+		stats.HeapObjects, stats.StackInuse, stats.Sys)
+	log.Info("gc: %d cycles, total pause %v, last run %v ago", stats.NumGC,
+		time.Duration(stats.PauseTotalNs),
+		time.Since(time.Unix(0, int64(stats.LastGC))).Truncate(time.Millisecond))
+
+	for _, name := range sortedKeys(d.HTTPServers) {
+		counts := d.HTTPServers[name].ConnectionCounts()
+
+		log.Info("http server %q: %d open connections (%d active, %d idle)",
+			name, counts.Open, counts.Active, counts.Idle)
+	}
+
+	if d.Pg != nil {
+		stat := d.Pg.Pool.Stat()
+
+		log.Info("pg pool: %d connections (%d acquired, %d idle, "+
+			"max %d), %d empty acquisitions", stat.TotalConns(),
+			stat.AcquiredConns(), stat.IdleConns(), stat.MaxConns(),
+			stat.EmptyAcquireCount())
+	}
+
+	for _, name := range sortedKeys(d.PgClients) {
+		stat := d.PgClients[name].Pool.Stat()
+
+		log.Info("pg pool %q: %d connections (%d acquired, %d idle, "+
+			"max %d), %d empty acquisitions", name, stat.TotalConns(),
+			stat.AcquiredConns(), stat.IdleConns(), stat.MaxConns(),
+			stat.EmptyAcquireCount())
+	}
+
+	log.Info("goroutine stacks:\n%s", goroutineStacks())
+}
+
+func goroutineStacks() []byte {
+	buf := make([]byte, 64*1024)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/dhttp"
+)
+
+// PreStopService can be implemented by services which need to be notified
+// as soon as the daemon is asked to stop, before the drain delay and before
+// any component is stopped, e.g. to deregister from a service registry.
+type PreStopService interface {
+	PreStop(*Daemon)
+}
+
+// Ready returns true if the daemon has been started and is not stopping.
+// It reports false during the drain delay so that load balancers stop
+// sending new traffic while existing requests are still served.
+func (d *Daemon) Ready() bool {
+	return atomic.LoadInt32(&d.ready) == 1
+}
+
+// Called once the daemon has been asked to stop and before components are
+// stopped. A second termination signal interrupts the drain delay.
+func (d *Daemon) drain(sigChan <-chan os.Signal) {
+	atomic.StoreInt32(&d.ready, 0)
+
+	if s, ok := d.service.(PreStopService); ok {
+		s.PreStop(d)
+	}
+
+	var delay time.Duration
+	if cfg := d.Cfg.Shutdown; cfg != nil {
+		delay = cfg.DrainDelay.Duration()
+	}
+
+	if delay <= 0 {
+		return
+	}
+
+	d.Log.Info("draining for %v", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+
+	case signo := <-sigChan:
+		d.Log.Info("received signal %d (%v), interrupting drain",
+			signo, signo)
+	}
+}
+
+type APIReadiness struct {
+	Ready bool `json:"ready"`
+}
+
+func (d *Daemon) hAPIReadyGET(h *dhttp.Handler) {
+	ready := d.Ready()
+
+	status := 200
+	if !ready {
+		status = 503
+	}
+
+	h.ReplyJSON(status, APIReadiness{Ready: ready})
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDrainDaemon(t *testing.T, drainDelay time.Duration) *Daemon {
+	cfg := NewDaemonCfg()
+	cfg.Shutdown = &ShutdownCfg{DrainDelay: dtime.Duration(drainDelay)}
+
+	d := newTestAPIDaemon(t, cfg)
+	atomic.StoreInt32(&d.ready, 1)
+
+	return d
+}
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDrainDaemon(t, 50*time.Millisecond)
+
+	w := sendTestAPIRequest(d, "GET", "/ready")
+	assert.Equal(200, w.Code)
+	assert.JSONEq(`{"ready": true}`, w.Body.String())
+
+	doneChan := make(chan struct{})
+
+	start := time.Now()
+
+	go func() {
+		defer close(doneChan)
+		d.drain(make(chan os.Signal))
+	}()
+
+	// During the drain delay, the daemon reports that it is not ready but
+	// keeps serving requests.
+	assert.Eventually(func() bool {
+		return !d.Ready()
+	}, time.Second, time.Millisecond)
+
+	w = sendTestAPIRequest(d, "GET", "/ready")
+	assert.Equal(503, w.Code)
+	assert.JSONEq(`{"ready": false}`, w.Body.String())
+
+	w = sendTestAPIRequest(d, "GET", "/status")
+	assert.Equal(200, w.Code)
+
+	<-doneChan
+
+	assert.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+
+	s := d.service.(*testService)
+	assert.Equal([]string{"init", "pre_stop"}, s.Calls())
+}
+
+func TestDrainInterruption(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDrainDaemon(t, time.Hour)
+
+	sigChan := make(chan os.Signal, 1)
+	doneChan := make(chan struct{})
+
+	go func() {
+		defer close(doneChan)
+		d.drain(sigChan)
+	}()
+
+	// A second termination signal interrupts the drain delay
+	sigChan <- syscall.SIGTERM
+
+	select {
+	case <-doneChan:
+	case <-time.After(5 * time.Second):
+		assert.FailNow("drain delay not interrupted")
+	}
+
+	assert.False(d.Ready())
+}
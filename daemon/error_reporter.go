@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/sentry"
+)
+
+type ErrorReporter interface {
+	ReportError(string, dlog.Data)
+}
+
+type errorReportingBackend struct {
+	reporter ErrorReporter
+}
+
+func (b *errorReportingBackend) Log(msg dlog.Message) {
+	if msg.Level == dlog.LevelError {
+		b.reporter.ReportError(msg.Message, msg.Data)
+	}
+}
+
+func (d *Daemon) initErrorReporter() error {
+	if cfg := d.Cfg.Sentry; cfg != nil {
+		if err := d.initHTTPClient("sentry", sentry.HTTPClientCfg(cfg)); err != nil {
+			return err
+		}
+
+		sentryCfg := *cfg
+
+		sentryCfg.Log = d.Log.Child("sentry", dlog.Data{})
+		sentryCfg.HTTPClient = d.HTTPClients["sentry"]
+		sentryCfg.Hostname = d.Hostname
+
+		client, err := sentry.NewClient(sentryCfg)
+		if err != nil {
+			return fmt.Errorf("cannot create sentry client: %w", err)
+		}
+
+		client.Start()
+
+		d.Sentry = client
+		d.ErrorReporter = client
+	}
+
+	if d.Cfg.ErrorReporter != nil {
+		d.ErrorReporter = d.Cfg.ErrorReporter
+	}
+
+	if d.ErrorReporter != nil && d.Cfg.ReportLogErrors {
+		// Loggers created before this point, including the ones used by the
+		// sentry client, keep the original backend so that a failure to
+		// report an error cannot cause the report of another error.
+		log := *d.Log
+		log.Backend = dlog.NewMultiBackend(d.Log.Backend,
+			&errorReportingBackend{reporter: d.ErrorReporter})
+
+		d.Log = &log
+	}
+
+	return nil
+}
+
+func (d *Daemon) reportFatalError(err error) {
+	if d.ErrorReporter == nil {
+		return
+	}
+
+	d.ErrorReporter.ReportError(err.Error(), dlog.Data{"fatal": true})
+
+	// Make sure the error is sent before the program exits
+	if d.Sentry != nil {
+		d.Sentry.Stop()
+		d.Sentry = nil
+	}
+}
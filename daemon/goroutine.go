@@ -0,0 +1,165 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/dlog"
+)
+
+type RestartPolicy string
+
+const (
+	RestartPolicyNever   RestartPolicy = "never"
+	RestartPolicyOnPanic RestartPolicy = "on_panic"
+	RestartPolicyAlways  RestartPolicy = "always"
+)
+
+type GoroutineCfg struct {
+	Name          string
+	RestartPolicy RestartPolicy
+	RestartDelay  time.Duration
+	MaxRestarts   int
+
+	// Called after a panic was recovered and logged
+	OnPanic func(name string, value interface{})
+}
+
+// Go runs a function in a new goroutine tracked by the daemon. The context
+// passed to the function is canceled when the daemon stops, and the daemon
+// waits for the function to return before stopping other components.
+func (d *Daemon) Go(fn func(context.Context)) {
+	d.GoCfg(GoroutineCfg{}, fn)
+}
+
+func (d *Daemon) GoNamed(name string, fn func(context.Context)) {
+	d.GoCfg(GoroutineCfg{Name: name}, fn)
+}
+
+func (d *Daemon) GoCfg(cfg GoroutineCfg, fn func(context.Context)) {
+	if cfg.Name == "" {
+		cfg.Name = "anonymous"
+	}
+
+	if cfg.RestartPolicy == "" {
+		cfg.RestartPolicy = RestartPolicyNever
+	}
+
+	if cfg.RestartDelay == 0 {
+		cfg.RestartDelay = time.Second
+	}
+
+	log := d.Log.Child("goroutine", dlog.Data{"goroutine": cfg.Name})
+
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		nbRestarts := 0
+
+		for {
+			panicked := d.runGoroutine(cfg, log, fn)
+
+			if d.ctx.Err() != nil {
+				return
+			}
+
+			switch cfg.RestartPolicy {
+			case RestartPolicyNever:
+				return
+			case RestartPolicyOnPanic:
+				if !panicked {
+					return
+				}
+			}
+
+			if cfg.MaxRestarts > 0 && nbRestarts >= cfg.MaxRestarts {
+				log.Error("goroutine %q restarted too many times", cfg.Name)
+				return
+			}
+
+			nbRestarts++
+			atomic.AddInt64(&d.nbGoroutineRestarts, 1)
+
+			log.Info("restarting goroutine %q in %v", cfg.Name, cfg.RestartDelay)
+
+			timer := time.NewTimer(cfg.RestartDelay)
+
+			select {
+			case <-d.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+func (d *Daemon) runGoroutine(cfg GoroutineCfg, log *dlog.Logger, fn func(context.Context)) (panicked bool) {
+	defer func() {
+		if value := recover(); value != nil {
+			panicked = true
+			d.handleGoroutinePanic(cfg, log, value)
+		}
+	}()
+
+	fn(d.ctx)
+
+	return
+}
+
+func (d *Daemon) handleGoroutinePanic(cfg GoroutineCfg, log *dlog.Logger, value interface{}) {
+	var msg string
+
+	switch v := value.(type) {
+	case error:
+		msg = v.Error()
+	case string:
+		msg = v
+	default:
+		msg = fmt.Sprintf("%#v", v)
+	}
+
+	buf := make([]byte, 4096)
+	n := runtime.Stack(buf, false)
+	buf = buf[0 : n-1]
+
+	log.Error("panic in goroutine %q: %s\n%s", cfg.Name, msg, string(buf))
+
+	atomic.AddInt64(&d.nbGoroutinePanics, 1)
+
+	if d.ErrorReporter != nil && !d.Cfg.ReportLogErrors {
+		data := dlog.MergeData(log.Data, dlog.Data{
+			"stack": string(buf),
+		})
+
+		d.ErrorReporter.ReportError("panic: "+msg, data)
+	}
+
+	if cfg.OnPanic != nil {
+		cfg.OnPanic(cfg.Name, value)
+	}
+}
+
+// Context returns a context canceled when the daemon stops.
+func (d *Daemon) Context() context.Context {
+	return d.ctx
+}
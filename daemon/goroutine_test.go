@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoroutinePanic(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{})
+
+	var panicName string
+	var panicValue interface{}
+
+	d.GoCfg(GoroutineCfg{
+		Name: "foo",
+		OnPanic: func(name string, value interface{}) {
+			panicName = name
+			panicValue = value
+		},
+	}, func(ctx context.Context) {
+		panic("bar")
+	})
+
+	d.wg.Wait()
+
+	assert.Equal("foo", panicName)
+	assert.Equal("bar", panicValue)
+	assert.Equal(int64(1), atomic.LoadInt64(&d.nbGoroutinePanics))
+	assert.Equal(int64(0), atomic.LoadInt64(&d.nbGoroutineRestarts))
+}
+
+func TestGoroutineRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{})
+
+	var nbRuns int64
+
+	// Restarted on panic, up to the maximum number of restarts
+	d.GoCfg(GoroutineCfg{
+		RestartPolicy: RestartPolicyOnPanic,
+		RestartDelay:  time.Millisecond,
+		MaxRestarts:   2,
+	}, func(ctx context.Context) {
+		atomic.AddInt64(&nbRuns, 1)
+		panic("foo")
+	})
+
+	d.wg.Wait()
+
+	assert.Equal(int64(3), atomic.LoadInt64(&nbRuns))
+	assert.Equal(int64(3), atomic.LoadInt64(&d.nbGoroutinePanics))
+	assert.Equal(int64(2), atomic.LoadInt64(&d.nbGoroutineRestarts))
+
+	// Not restarted when returning normally
+	atomic.StoreInt64(&nbRuns, 0)
+
+	d.GoCfg(GoroutineCfg{
+		RestartPolicy: RestartPolicyOnPanic,
+		RestartDelay:  time.Millisecond,
+	}, func(ctx context.Context) {
+		atomic.AddInt64(&nbRuns, 1)
+	})
+
+	d.wg.Wait()
+
+	assert.Equal(int64(1), atomic.LoadInt64(&nbRuns))
+}
+
+func TestGoroutineStop(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{})
+
+	var nbRuns int64
+
+	d.GoCfg(GoroutineCfg{
+		RestartPolicy: RestartPolicyAlways,
+		RestartDelay:  time.Millisecond,
+	}, func(ctx context.Context) {
+		atomic.AddInt64(&nbRuns, 1)
+		<-ctx.Done()
+	})
+
+	d.cancel()
+	d.wg.Wait()
+
+	// Goroutines are never restarted once the daemon is stopping
+	assert.Equal(int64(1), atomic.LoadInt64(&nbRuns))
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/exograd/go-daemon/influx"
+)
+
+func (d *Daemon) startHTTPServerMetrics() {
+	if d.Influx == nil {
+		return
+	}
+
+	d.GoNamed("http-server-metrics", func(ctx context.Context) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				var points influx.Points
+
+				points = append(points, d.httpServerConcurrencyPoints()...)
+				points = append(points, d.httpServerProxyPoints()...)
+
+				if len(points) > 0 {
+					d.Influx.EnqueuePoints(points)
+				}
+			}
+		}
+	})
+}
+
+func (d *Daemon) httpServerConcurrencyPoints() influx.Points {
+	var points influx.Points
+
+	for name, server := range d.HTTPServers {
+		if server.Cfg.MaxConcurrentRequests == 0 {
+			continue
+		}
+
+		stats := server.ConcurrencyStats()
+
+		tags := influx.Tags{
+			"server": name,
+		}
+
+		fields := influx.Fields{
+			"max_requests":      stats.MaxRequests,
+			"active_requests":   stats.ActiveRequests,
+			"queued_requests":   stats.QueuedRequests,
+			"rejected_requests": stats.RejectedRequests,
+		}
+
+		points = append(points,
+			influx.NewPoint("http_server_concurrency", tags, fields))
+	}
+
+	return points
+}
+
+func (d *Daemon) httpServerProxyPoints() influx.Points {
+	var points influx.Points
+
+	for name, server := range d.HTTPServers {
+		for upstream, stats := range server.ProxyStats() {
+			tags := influx.Tags{
+				"server":   name,
+				"upstream": upstream,
+			}
+
+			fields := influx.Fields{
+				"nb_requests": stats.NbRequests,
+				"nb_errors":   stats.NbErrors,
+				"total_time":  stats.TotalTime.Microseconds(),
+			}
+
+			points = append(points,
+				influx.NewPoint("http_proxy_upstreams", tags, fields))
+		}
+	}
+
+	return points
+}
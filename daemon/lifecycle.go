@@ -0,0 +1,146 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type LifecyclePhase string
+
+const (
+	LifecyclePhaseInit  LifecyclePhase = "init"
+	LifecyclePhaseStart LifecyclePhase = "start"
+)
+
+// Exit codes used by Run. Configuration errors and errors signaled while the
+// daemon is running use the generic code 1.
+const (
+	ExitCodeError             = 1
+	ExitCodeInitFailure       = 2
+	ExitCodeStartFailure      = 3
+	ExitCodeDependencyFailure = 4
+)
+
+// OptionalComponentValues contains the components which can be listed in
+// DaemonCfg.OptionalComponents. If one of them fails to initialize or
+// start, the daemon logs the error and runs in degraded mode without it.
+var OptionalComponentValues = []string{
+	"influx",
+	"redis",
+	"store",
+	"broker",
+	"dependencies",
+}
+
+// LifecycleError is returned when the initialization or the start of a
+// component fails.
+type LifecycleError struct {
+	Component string
+	Phase     LifecyclePhase
+	Err       error
+}
+
+func (err *LifecycleError) Error() string {
+	return fmt.Sprintf("%s (%s phase): %v", err.Component, err.Phase, err.Err)
+}
+
+func (err *LifecycleError) Unwrap() error {
+	return err.Err
+}
+
+// ExitCode returns the exit code matching an error returned while
+// initializing, starting or running a daemon.
+func ExitCode(err error) int {
+	var lerr *LifecycleError
+	if !errors.As(err, &lerr) {
+		return ExitCodeError
+	}
+
+	switch {
+	case lerr.Component == "dependencies":
+		return ExitCodeDependencyFailure
+	case lerr.Phase == LifecyclePhaseInit:
+		return ExitCodeInitFailure
+	case lerr.Phase == LifecyclePhaseStart:
+		return ExitCodeStartFailure
+	}
+
+	return ExitCodeError
+}
+
+func (d *Daemon) checkOptionalComponents() error {
+	for _, name := range d.Cfg.OptionalComponents {
+		found := false
+		for _, value := range OptionalComponentValues {
+			if name == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("component %q cannot be optional", name)
+		}
+	}
+
+	return nil
+}
+
+func (d *Daemon) isOptionalComponent(name string) bool {
+	for _, optionalName := range d.Cfg.OptionalComponents {
+		if name == optionalName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run a lifecycle function and wrap its error. Errors of optional components
+// are logged and the component is marked as degraded.
+func (d *Daemon) runLifecycleStep(phase LifecyclePhase, component string, fn func() error) error {
+	err := fn()
+	if err == nil {
+		return nil
+	}
+
+	lerr := &LifecycleError{Component: component, Phase: phase, Err: err}
+
+	if !d.isOptionalComponent(component) {
+		return lerr
+	}
+
+	d.Log.Error("%v; continuing in degraded mode", lerr)
+
+	d.degradedComponents[component] = lerr
+
+	return nil
+}
+
+// DegradedComponents returns the optional components which failed to
+// initialize or start.
+func (d *Daemon) DegradedComponents() []string {
+	names := make([]string, 0, len(d.degradedComponents))
+	for name := range d.degradedComponents {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/influx"
+)
+
+type BuildInfo struct {
+	Version   string `json:"version,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+var buildInfo = defaultBuildInfo()
+
+func defaultBuildInfo() BuildInfo {
+	info := BuildInfo{
+		GoVersion: runtime.Version(),
+	}
+
+	// Use version control information embedded by the go tool if it is
+	// available.
+	if goInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range goInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+
+	return info
+}
+
+// SetBuildInfo sets the version, source commit and build date of the
+// program, usually injected at build time with -ldflags. It must be called
+// before Run. Empty fields are ignored.
+func SetBuildInfo(info BuildInfo) {
+	if info.Version != "" {
+		buildInfo.Version = info.Version
+	}
+
+	if info.Commit != "" {
+		buildInfo.Commit = info.Commit
+	}
+
+	if info.BuildDate != "" {
+		buildInfo.BuildDate = info.BuildDate
+	}
+}
+
+func GetBuildInfo() BuildInfo {
+	return buildInfo
+}
+
+func (info BuildInfo) String() string {
+	var buf bytes.Buffer
+
+	version := info.Version
+	if version == "" {
+		version = "unknown version"
+	}
+
+	buf.WriteString(version)
+
+	if info.Commit != "" {
+		fmt.Fprintf(&buf, " (commit %s)", info.Commit)
+	}
+
+	if info.BuildDate != "" {
+		fmt.Fprintf(&buf, " built on %s", info.BuildDate)
+	}
+
+	fmt.Fprintf(&buf, " with %s", info.GoVersion)
+
+	return buf.String()
+}
+
+// Uptime returns the time elapsed since the daemon was started.
+func (d *Daemon) Uptime() time.Duration {
+	if d.startTime.IsZero() {
+		return 0
+	}
+
+	return time.Since(d.startTime)
+}
+
+// ComponentStates returns whether each component with a health status is
+// currently available.
+func (d *Daemon) ComponentStates() map[string]bool {
+	states := make(map[string]bool)
+
+	if d.Pg != nil {
+		states["pg"] = d.Pg.Connected()
+	}
+
+	for name, client := range d.PgClients {
+		states["pg/"+name] = client.Connected()
+	}
+
+	if d.Redis != nil {
+		states["redis"] = d.Redis.Healthy()
+	}
+
+	for name := range d.degradedComponents {
+		states[name] = false
+	}
+
+	return states
+}
+
+// NbPanics returns the number of panics recovered in http servers, grpc
+// servers and daemon goroutines.
+func (d *Daemon) NbPanics() int64 {
+	n := atomic.LoadInt64(&d.nbGoroutinePanics)
+
+	for _, s := range d.HTTPServers {
+		n += s.NbPanics()
+	}
+
+	for _, s := range d.GRPCServers {
+		n += s.NbPanics()
+	}
+
+	return n
+}
+
+func (d *Daemon) startDaemonMetrics() {
+	if d.Influx == nil {
+		return
+	}
+
+	d.GoNamed("daemon-metrics", func(ctx context.Context) {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				d.Influx.EnqueuePoints(d.daemonPoints())
+				d.Influx.EnqueuePoints(d.httpRoutePoints())
+				d.Influx.EnqueuePoints(d.httpClientPoints())
+			}
+		}
+	})
+}
+
+func (d *Daemon) daemonPoints() influx.Points {
+	var points influx.Points
+
+	tags := influx.Tags{
+		"version":    buildInfo.Version,
+		"commit":     buildInfo.Commit,
+		"go_version": buildInfo.GoVersion,
+	}
+
+	fields := influx.Fields{
+		"uptime":                d.Uptime().Seconds(),
+		"nb_panics":             d.NbPanics(),
+		"nb_goroutine_restarts": atomic.LoadInt64(&d.nbGoroutineRestarts),
+	}
+
+	points = append(points, influx.NewPoint("daemon", tags, fields))
+
+	for name, up := range d.ComponentStates() {
+		tags := influx.Tags{
+			"component": name,
+		}
+
+		fields := influx.Fields{
+			"up": up,
+		}
+
+		points = append(points,
+			influx.NewPoint("daemon_components", tags, fields))
+	}
+
+	for name, s := range d.HTTPServers {
+		tags := influx.Tags{
+			"server": name,
+		}
+
+		fields := influx.Fields{
+			"nb_panics":        s.NbPanics(),
+			"nb_server_errors": s.NbServerErrors(),
+			"nb_client_aborts": s.NbClientAborts(),
+		}
+
+		points = append(points,
+			influx.NewPoint("daemon_http_servers", tags, fields))
+	}
+
+	return points
+}
+
+// httpRoutePoints returns the response time statistics of each route of
+// each http server since the last call.
+func (d *Daemon) httpRoutePoints() influx.Points {
+	var points influx.Points
+
+	for name, s := range d.HTTPServers {
+		for _, m := range s.FlushRouteMetrics() {
+			tags := influx.Tags{
+				"server":  name,
+				"method":  m.Route.Method,
+				"pattern": m.Route.Pattern,
+			}
+
+			if m.Route.Host != "" {
+				tags["host"] = m.Route.Host
+			}
+
+			fields := influx.Fields{
+				"nb_requests":      m.NbRequests,
+				"nb_server_errors": m.NbServerErrors,
+				"time_min":         m.TimeMin,
+				"time_max":         m.TimeMax,
+				"time_mean":        m.TimeMean,
+				"time_p50":         m.TimeP50,
+				"time_p95":         m.TimeP95,
+				"time_p99":         m.TimeP99,
+			}
+
+			points = append(points,
+				influx.NewPoint("http_requests", tags, fields))
+		}
+	}
+
+	return points
+}
+
+// httpClientPoints returns the statistics of the requests sent by each http
+// client to each host since the last call.
+func (d *Daemon) httpClientPoints() influx.Points {
+	var points influx.Points
+
+	for name, c := range d.HTTPClients {
+		for _, m := range c.FlushMetrics() {
+			tags := influx.Tags{
+				"client": name,
+				"host":   m.Host,
+			}
+
+			fields := influx.Fields{
+				"nb_requests":             m.NbRequests,
+				"nb_errors":               m.NbErrors,
+				"nb_in_flight":            m.NbInFlight,
+				"time_min":                m.TimeMin,
+				"time_max":                m.TimeMax,
+				"time_mean":               m.TimeMean,
+				"nb_dns_lookups":          m.NbDNSLookups,
+				"dns_time_mean":           m.DNSTimeMean,
+				"nb_connections":          m.NbConnections,
+				"connect_time_mean":       m.ConnectTimeMean,
+				"nb_tls_handshakes":       m.NbTLSHandshakes,
+				"tls_handshake_time_mean": m.TLSHandshakeTimeMean,
+			}
+
+			for i, n := range m.NbResponses {
+				fields[fmt.Sprintf("nb_%dxx", i+1)] = n
+			}
+
+			points = append(points,
+				influx.NewPoint("http_client_requests", tags, fields))
+		}
+	}
+
+	return points
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/influx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setTestBuildInfo(t *testing.T, info BuildInfo) {
+	previousBuildInfo := buildInfo
+	t.Cleanup(func() { buildInfo = previousBuildInfo })
+
+	SetBuildInfo(info)
+}
+
+func TestSetBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	setTestBuildInfo(t, BuildInfo{Version: "1.2.3", Commit: "abcdef"})
+	SetBuildInfo(BuildInfo{Version: "1.2.4"})
+
+	info := GetBuildInfo()
+	assert.Equal("1.2.4", info.Version)
+	assert.Equal("abcdef", info.Commit)
+	assert.NotEmpty(info.GoVersion)
+}
+
+func TestDaemonPoints(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	setTestBuildInfo(t, BuildInfo{Version: "1.2.3", Commit: "abcdef"})
+
+	d := newTestDaemon(t, DaemonCfg{})
+
+	assert.Equal(time.Duration(0), d.Uptime())
+
+	d.startTime = time.Now().Add(-time.Minute)
+	d.nbGoroutinePanics = 2
+	d.nbGoroutineRestarts = 1
+	d.degradedComponents["influx"] = errors.New("foo")
+
+	points := d.daemonPoints()
+
+	findPoint := func(measurement string) *influx.Point {
+		for _, p := range points {
+			if p.Measurement == measurement {
+				return p
+			}
+		}
+
+		return nil
+	}
+
+	p := findPoint("daemon")
+	require.NotNil(p)
+
+	assert.Equal("1.2.3", p.Tags["version"])
+	assert.Equal("abcdef", p.Tags["commit"])
+	assert.GreaterOrEqual(p.Fields["uptime"], 60.0)
+	assert.Equal(int64(2), p.Fields["nb_panics"])
+	assert.Equal(int64(1), p.Fields["nb_goroutine_restarts"])
+
+	p = findPoint("daemon_components")
+	require.NotNil(p)
+
+	assert.Equal("influx", p.Tags["component"])
+	assert.Equal(false, p.Fields["up"])
+}
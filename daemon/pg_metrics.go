@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/exograd/go-daemon/influx"
+	"github.com/exograd/go-daemon/pg"
+)
+
+func (d *Daemon) startPgMetrics() {
+	if d.Influx == nil || (d.Pg == nil && len(d.PgClients) == 0) {
+		return
+	}
+
+	d.GoNamed("pg-metrics", func(ctx context.Context) {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				if points := d.pgLockPoints(); len(points) > 0 {
+					d.Influx.EnqueuePoints(points)
+				}
+			}
+		}
+	})
+}
+
+func (d *Daemon) pgLockPoints() influx.Points {
+	var points influx.Points
+
+	if d.Pg != nil {
+		points = append(points, pgClientLockPoints(d.Pg, influx.Tags{})...)
+	}
+
+	for name, client := range d.PgClients {
+		tags := influx.Tags{"client": name}
+		points = append(points, pgClientLockPoints(client, tags)...)
+	}
+
+	return points
+}
+
+func pgClientLockPoints(client *pg.Client, clientTags influx.Tags) influx.Points {
+	var points influx.Points
+
+	for name, stats := range client.LockStats() {
+		tags := influx.Tags{
+			"lock": name,
+		}
+
+		for key, value := range clientTags {
+			tags[key] = value
+		}
+
+		fields := influx.Fields{
+			"nb_acquisitions": stats.NbAcquisitions,
+			"nb_failures":     stats.NbFailures,
+			"total_wait_time": stats.TotalWaitTime.Microseconds(),
+			"max_wait_time":   stats.MaxWaitTime.Microseconds(),
+		}
+
+		points = append(points, influx.NewPoint("pg_locks", tags, fields))
+	}
+
+	return points
+}
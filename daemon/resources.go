@@ -0,0 +1,160 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Resources is a registry of named values shared between the components of
+// a daemon. Built-in clients are registered by the daemon before the
+// service is initialized: "pg", "influx", "redis", "store", "broker",
+// "outbox", "api_keys", "audit", "flags", "influx_clients/<name>",
+// "pg_clients/<name>", "http_servers/<name>", "http_clients/<name>" and
+// "grpc_servers/<name>".
+type Resources struct {
+	values map[string]interface{}
+	lock   sync.RWMutex
+}
+
+func NewResources() *Resources {
+	return &Resources{
+		values: make(map[string]interface{}),
+	}
+}
+
+// RegisterResource adds a value to the registry. It panics if a resource
+// with the same name already exists.
+func RegisterResource[T any](r *Resources, name string, value T) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.values[name]; found {
+		panic(fmt.Sprintf("duplicate resource %q", name))
+	}
+
+	r.values[name] = value
+}
+
+// GetResource returns a resource, failing if it does not exist or if it does
+// not have the expected type.
+func GetResource[T any](r *Resources, name string) (T, error) {
+	var zero T
+
+	r.lock.RLock()
+	value, found := r.values[name]
+	r.lock.RUnlock()
+
+	if !found {
+		return zero, fmt.Errorf("unknown resource %q", name)
+	}
+
+	typedValue, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("resource %q has type %T instead of %T",
+			name, value, zero)
+	}
+
+	return typedValue, nil
+}
+
+// MustGetResource is similar to GetResource but panics on error; it is meant
+// to be used during initialization.
+func MustGetResource[T any](r *Resources, name string) T {
+	value, err := GetResource[T](r, name)
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+func (r *Resources) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := make([]string, 0, len(r.values))
+	for name := range r.values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (d *Daemon) initResources() error {
+	r := d.Resources
+
+	for name, s := range d.HTTPServers {
+		RegisterResource(r, "http_servers/"+name, s)
+	}
+
+	for name, c := range d.HTTPClients {
+		RegisterResource(r, "http_clients/"+name, c)
+	}
+
+	for name, s := range d.GRPCServers {
+		RegisterResource(r, "grpc_servers/"+name, s)
+	}
+
+	if d.Influx != nil {
+		RegisterResource(r, "influx", d.Influx)
+	}
+
+	for name, c := range d.InfluxClients {
+		RegisterResource(r, "influx_clients/"+name, c)
+	}
+
+	if d.Pg != nil {
+		RegisterResource(r, "pg", d.Pg)
+	}
+
+	for name, c := range d.PgClients {
+		RegisterResource(r, "pg_clients/"+name, c)
+	}
+
+	if d.APIKeys != nil {
+		RegisterResource(r, "api_keys", d.APIKeys)
+	}
+
+	if d.Audit != nil {
+		RegisterResource(r, "audit", d.Audit)
+	}
+
+	if d.Redis != nil {
+		RegisterResource(r, "redis", d.Redis)
+	}
+
+	if d.Store != nil {
+		RegisterResource(r, "store", d.Store)
+	}
+
+	if d.Flags != nil {
+		RegisterResource(r, "flags", d.Flags)
+	}
+
+	if d.Broker != nil {
+		RegisterResource(r, "broker", d.Broker)
+	}
+
+	if d.Outbox != nil {
+		RegisterResource(r, "outbox", d.Outbox)
+	}
+
+	return nil
+}
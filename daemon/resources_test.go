@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"testing"
+
+	"github.com/exograd/go-daemon/dflag"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testResource struct {
+	Name string
+}
+
+func TestResources(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := NewResources()
+
+	RegisterResource(r, "foo", &testResource{Name: "foo"})
+	RegisterResource(r, "bar", 42)
+
+	foo, err := GetResource[*testResource](r, "foo")
+	require.NoError(err)
+	assert.Equal("foo", foo.Name)
+
+	assert.Equal(42, MustGetResource[int](r, "bar"))
+
+	_, err = GetResource[*testResource](r, "baz")
+	assert.Error(err)
+
+	_, err = GetResource[string](r, "bar")
+	assert.Error(err)
+
+	assert.Panics(func() {
+		MustGetResource[string](r, "bar")
+	})
+
+	assert.Panics(func() {
+		RegisterResource(r, "foo", &testResource{Name: "foo2"})
+	})
+
+	assert.Equal([]string{"bar", "foo"}, r.Names())
+}
+
+func TestDaemonResources(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := newTestAPIDaemon(t, NewDaemonCfg())
+
+	server, err := GetResource[*dhttp.Server](d.Resources,
+		"http_servers/daemon-api")
+	require.NoError(err)
+	assert.Equal(d.HTTPServers["daemon-api"], server)
+
+	flags, err := GetResource[*dflag.Flags](d.Resources, "flags")
+	require.NoError(err)
+	assert.Equal(d.Flags, flags)
+
+	_, err = GetResource[interface{}](d.Resources, "pg")
+	assert.Error(err)
+}
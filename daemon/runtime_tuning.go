@@ -0,0 +1,187 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// RuntimeTuningCfg enables the adjustment of GOMAXPROCS and of the soft
+// memory limit of the runtime to the CPU and memory limits of the cgroup of
+// the process, as found in containers. Settings explicitly defined with the
+// GOMAXPROCS and GOMEMLIMIT environment variables are left untouched.
+type RuntimeTuningCfg struct {
+	// The fraction of the cgroup memory limit used as soft memory limit, so
+	// that the garbage collector runs before the process is killed; the
+	// default value is 0.9.
+	MemoryLimitRatio float64
+}
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+func (d *Daemon) initRuntimeTuning() error {
+	cfg := d.Cfg.RuntimeTuning
+	if cfg == nil {
+		return nil
+	}
+
+	ratio := cfg.MemoryLimitRatio
+	if ratio == 0 {
+		ratio = 0.9
+	}
+
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid memory limit ratio %v", ratio)
+	}
+
+	if os.Getenv("GOMAXPROCS") == "" {
+		cpus, err := cgroupCPULimit(cgroupRoot)
+		if err != nil {
+			d.Log.Error("cannot read cgroup cpu limit: %v", err)
+		} else if cpus > 0 {
+			procs := int(math.Ceil(cpus))
+			if procs > runtime.NumCPU() {
+				procs = runtime.NumCPU()
+			}
+
+			runtime.GOMAXPROCS(procs)
+
+			d.Log.Info("cgroup cpu limit: %g, using GOMAXPROCS=%d", cpus, procs)
+		}
+	}
+
+	if os.Getenv("GOMEMLIMIT") == "" {
+		limit, err := cgroupMemoryLimit(cgroupRoot)
+		if err != nil {
+			d.Log.Error("cannot read cgroup memory limit: %v", err)
+		} else if limit > 0 {
+			memLimit := int64(float64(limit) * ratio)
+
+			if setMemoryLimit(memLimit) {
+				d.Log.Info("cgroup memory limit: %d bytes, using "+
+					"GOMEMLIMIT=%d", limit, memLimit)
+			} else {
+				d.Log.Info("cgroup memory limit: %d bytes, memory limits "+
+					"are not supported by %s", limit, runtime.Version())
+			}
+		}
+	}
+
+	return nil
+}
+
+// cgroupCPULimit returns the number of CPUs the cgroup of the process can
+// use, or 0 if it is not limited. Only the cgroup mounted at the root of
+// the cgroup filesystem is considered, which is the cgroup of the process
+// in containers using cgroup namespaces.
+func cgroupCPULimit(root string) (float64, error) {
+	// cgroup v2
+	data, err := os.ReadFile(root + "/cpu.max")
+	if err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("invalid cpu.max content %q", data)
+		}
+
+		if fields[0] == "max" {
+			return 0, nil
+		}
+
+		return cpuQuota(fields[0], fields[1])
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	// cgroup v1
+	quota, err := os.ReadFile(root + "/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	period, err := os.ReadFile(root + "/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, err
+	}
+
+	return cpuQuota(strings.TrimSpace(string(quota)),
+		strings.TrimSpace(string(period)))
+}
+
+func cpuQuota(quotaString, periodString string) (float64, error) {
+	quota, err := strconv.ParseInt(quotaString, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cpu quota %q", quotaString)
+	}
+
+	period, err := strconv.ParseInt(periodString, 10, 64)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("invalid cpu period %q", periodString)
+	}
+
+	if quota <= 0 {
+		return 0, nil
+	}
+
+	return float64(quota) / float64(period), nil
+}
+
+// cgroupMemoryLimit returns the memory limit of the cgroup of the process in
+// bytes, or 0 if it is not limited.
+func cgroupMemoryLimit(root string) (int64, error) {
+	// cgroup v2
+	data, err := os.ReadFile(root + "/memory.max")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return 0, err
+		}
+
+		// cgroup v1
+		data, err = os.ReadFile(root + "/memory/memory.limit_in_bytes")
+		if err != nil {
+			if os.IsNotExist(err) {
+				return 0, nil
+			}
+
+			return 0, err
+		}
+	}
+
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, nil
+	}
+
+	limit, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q", s)
+	}
+
+	// cgroup v1 reports an unlimited cgroup with a very large value rounded
+	// to the page size.
+	if limit <= 0 || limit >= math.MaxInt64/2 {
+		return 0, nil
+	}
+
+	return limit, nil
+}
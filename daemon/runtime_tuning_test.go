@@ -0,0 +1,131 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCgroupRoot(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, content := range files {
+		filePath := path.Join(root, name)
+
+		require.NoError(t, os.MkdirAll(path.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+
+	return root
+}
+
+func TestCgroupCPULimit(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		files map[string]string
+		limit float64
+		valid bool
+	}{
+		// cgroup v2
+		{map[string]string{"cpu.max": "max 100000\n"}, 0, true},
+		{map[string]string{"cpu.max": "150000 100000\n"}, 1.5, true},
+		{map[string]string{"cpu.max": "50000 100000\n"}, 0.5, true},
+		{map[string]string{"cpu.max": "150000\n"}, 0, false},
+		{map[string]string{"cpu.max": "foo 100000\n"}, 0, false},
+		{map[string]string{"cpu.max": "100000 0\n"}, 0, false},
+
+		// cgroup v1
+		{map[string]string{
+			"cpu/cpu.cfs_quota_us":  "-1\n",
+			"cpu/cpu.cfs_period_us": "100000\n",
+		}, 0, true},
+		{map[string]string{
+			"cpu/cpu.cfs_quota_us":  "200000\n",
+			"cpu/cpu.cfs_period_us": "100000\n",
+		}, 2, true},
+		{map[string]string{
+			"cpu/cpu.cfs_quota_us": "200000\n",
+		}, 0, false},
+
+		// No cgroup
+		{map[string]string{}, 0, true},
+	}
+
+	for _, test := range tests {
+		limit, err := cgroupCPULimit(newTestCgroupRoot(t, test.files))
+
+		if test.valid {
+			if assert.NoError(err, "%v", test.files) {
+				assert.Equal(test.limit, limit, "%v", test.files)
+			}
+		} else {
+			assert.Error(err, "%v", test.files)
+		}
+	}
+}
+
+func TestCgroupMemoryLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		files map[string]string
+		limit int64
+		valid bool
+	}{
+		// cgroup v2
+		{map[string]string{"memory.max": "max\n"}, 0, true},
+		{map[string]string{"memory.max": "536870912\n"}, 536870912, true},
+		{map[string]string{"memory.max": "foo\n"}, 0, false},
+
+		// cgroup v1
+		{map[string]string{
+			"memory/memory.limit_in_bytes": "9223372036854771712\n",
+		}, 0, true},
+		{map[string]string{
+			"memory/memory.limit_in_bytes": "1073741824\n",
+		}, 1073741824, true},
+
+		// No cgroup
+		{map[string]string{}, 0, true},
+	}
+
+	for _, test := range tests {
+		limit, err := cgroupMemoryLimit(newTestCgroupRoot(t, test.files))
+
+		if test.valid {
+			if assert.NoError(err, "%v", test.files) {
+				assert.Equal(test.limit, limit, "%v", test.files)
+			}
+		} else {
+			assert.Error(err, "%v", test.files)
+		}
+	}
+}
+
+func TestRuntimeTuningCfg(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{
+		RuntimeTuning: &RuntimeTuningCfg{MemoryLimitRatio: 1.5},
+	})
+
+	assert.Error(d.initRuntimeTuning())
+}
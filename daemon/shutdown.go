@@ -0,0 +1,259 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+)
+
+// Components are identified by the following names: "outbox", "broker",
+// "service", "goroutines", "audit", "pg", "pg/<name>", "redis", "influx",
+// "influx/<name>", "grpc/<name>" and "http/<name>".
+type ShutdownCfg struct {
+	// The delay between the reception of a termination signal and the
+	// beginning of the stop sequence. During this delay, the daemon reports
+	// that it is not ready but keeps serving requests, giving load balancers
+	// time to stop routing traffic to it.
+	DrainDelay dtime.Duration
+
+	// The maximum duration of the whole stop sequence. Once it has elapsed,
+	// components which have not been stopped yet are abandoned.
+	Timeout dtime.Duration
+
+	// The maximum duration of the stop function of each component. A
+	// component whose stop function times out is abandoned and the
+	// sequence carries on with the next component.
+	ComponentTimeouts map[string]dtime.Duration
+
+	// Components stopped before all others, in this order; remaining
+	// components are stopped in the default order.
+	Order []string
+}
+
+type shutdownStep struct {
+	name string
+	stop func()
+}
+
+func (d *Daemon) initShutdown() error {
+	cfg := d.Cfg.Shutdown
+	if cfg == nil {
+		return nil
+	}
+
+	names := make(map[string]struct{})
+	for _, step := range d.shutdownSteps() {
+		names[step.name] = struct{}{}
+	}
+
+	for name, timeout := range cfg.ComponentTimeouts {
+		if _, found := names[name]; !found {
+			return fmt.Errorf("unknown shutdown component %q", name)
+		}
+
+		if timeout < 0 {
+			return fmt.Errorf("invalid negative timeout for shutdown "+
+				"component %q", name)
+		}
+	}
+
+	for _, name := range cfg.Order {
+		if _, found := names[name]; !found {
+			return fmt.Errorf("unknown shutdown component %q", name)
+		}
+	}
+
+	return nil
+}
+
+func (d *Daemon) shutdownSteps() []shutdownStep {
+	var steps []shutdownStep
+
+	add := func(name string, stop func()) {
+		steps = append(steps, shutdownStep{name: name, stop: stop})
+	}
+
+	if d.Outbox != nil {
+		add("outbox", d.Outbox.Stop)
+	}
+
+	if d.Broker != nil {
+		add("broker", d.Broker.Stop)
+	}
+
+	add("service", func() {
+		if d.serviceStarted {
+			d.service.Stop(d)
+		}
+	})
+
+	add("goroutines", func() {
+		d.cancel()
+		d.wg.Wait()
+	})
+
+	if d.Audit != nil {
+		add("audit", d.Audit.Close)
+	}
+
+	if d.Pg != nil {
+		add("pg", d.Pg.Close)
+	}
+
+	for _, name := range sortedKeys(d.PgClients) {
+		add("pg/"+name, d.PgClients[name].Close)
+	}
+
+	if d.Redis != nil {
+		add("redis", d.Redis.Stop)
+	}
+
+	if d.Influx != nil {
+		add("influx", d.Influx.Stop)
+	}
+
+	for _, name := range sortedKeys(d.InfluxClients) {
+		add("influx/"+name, d.InfluxClients[name].Stop)
+	}
+
+	for _, name := range sortedKeys(d.GRPCServers) {
+		add("grpc/"+name, d.GRPCServers[name].Stop)
+	}
+
+	for _, name := range sortedKeys(d.HTTPServers) {
+		add("http/"+name, d.HTTPServers[name].Stop)
+	}
+
+	if cfg := d.Cfg.Shutdown; cfg != nil && len(cfg.Order) > 0 {
+		steps = orderShutdownSteps(steps, cfg.Order)
+	}
+
+	return steps
+}
+
+func orderShutdownSteps(steps []shutdownStep, order []string) []shutdownStep {
+	ordered := make([]shutdownStep, 0, len(steps))
+	done := make(map[string]bool)
+
+	for _, name := range order {
+		for _, step := range steps {
+			if step.name == name && !done[name] {
+				ordered = append(ordered, step)
+				done[name] = true
+			}
+		}
+	}
+
+	for _, step := range steps {
+		if !done[step.name] {
+			ordered = append(ordered, step)
+		}
+	}
+
+	return ordered
+}
+
+func (d *Daemon) stop() {
+	d.Log.Info("stopping")
+
+	var cfg ShutdownCfg
+	if d.Cfg.Shutdown != nil {
+		cfg = *d.Cfg.Shutdown
+	}
+
+	var deadline time.Time
+	if cfg.Timeout > 0 {
+		deadline = time.Now().Add(cfg.Timeout.Duration())
+	}
+
+	steps := d.shutdownSteps()
+
+	var timedOut, abandoned []string
+
+	for i, step := range steps {
+		timeout := cfg.ComponentTimeouts[step.name].Duration()
+
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				for _, step := range steps[i:] {
+					abandoned = append(abandoned, step.name)
+				}
+
+				break
+			}
+
+			if timeout == 0 || remaining < timeout {
+				timeout = remaining
+			}
+		}
+
+		if !d.runShutdownStep(step, timeout) {
+			timedOut = append(timedOut, step.name)
+		}
+	}
+
+	d.unstoppedComponents = make(map[string]bool)
+	for _, name := range append(timedOut, abandoned...) {
+		d.unstoppedComponents[name] = true
+	}
+
+	if len(timedOut) > 0 || len(abandoned) > 0 {
+		var parts []string
+
+		if len(timedOut) > 0 {
+			parts = append(parts, "timed out: "+strings.Join(timedOut, ", "))
+		}
+
+		if len(abandoned) > 0 {
+			parts = append(parts, "abandoned after the shutdown "+
+				"deadline: "+strings.Join(abandoned, ", "))
+		}
+
+		d.Log.Error("shutdown incomplete; %s", strings.Join(parts, "; "))
+	}
+
+	d.Log.Info("stopped")
+}
+
+func (d *Daemon) runShutdownStep(step shutdownStep, timeout time.Duration) bool {
+	if timeout == 0 {
+		step.stop()
+		return true
+	}
+
+	doneChan := make(chan struct{})
+
+	go func() {
+		defer close(doneChan)
+		step.stop()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-doneChan:
+		return true
+
+	case <-timer.C:
+		d.Log.Error("cannot stop %s: timeout after %v", step.name, timeout)
+		return false
+	}
+}
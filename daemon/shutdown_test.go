@@ -0,0 +1,150 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestShutdownDaemon(t *testing.T, cfg ShutdownCfg, s *testService) (*Daemon, error) {
+	daemonCfg := NewDaemonCfg()
+	daemonCfg.name = "test"
+	daemonCfg.Shutdown = &cfg
+
+	d := newDaemon(daemonCfg, s)
+	t.Cleanup(d.cancel)
+
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+
+	// The daemon is not started, but the service must be stopped as if it
+	// had been.
+	d.serviceStarted = true
+
+	// A goroutine used to identify the moment the "goroutines" component
+	// is stopped.
+	d.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		s.addCall("goroutines")
+	})
+
+	return d, nil
+}
+
+func TestShutdownCfg(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newTestShutdownDaemon(t, ShutdownCfg{
+		ComponentTimeouts: map[string]dtime.Duration{"foo": dtime.Duration(time.Second)},
+	}, &testService{})
+	assert.Error(err)
+
+	_, err = newTestShutdownDaemon(t, ShutdownCfg{
+		ComponentTimeouts: map[string]dtime.Duration{"service": dtime.Duration(-time.Second)},
+	}, &testService{})
+	assert.Error(err)
+
+	_, err = newTestShutdownDaemon(t, ShutdownCfg{
+		Order: []string{"goroutines", "foo"},
+	}, &testService{})
+	assert.Error(err)
+
+	_, err = newTestShutdownDaemon(t, ShutdownCfg{
+		ComponentTimeouts: map[string]dtime.Duration{"service": dtime.Duration(time.Second)},
+		Order:             []string{"goroutines"},
+	}, &testService{})
+	assert.NoError(err)
+}
+
+func TestShutdownOrder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := &testService{}
+
+	d, err := newTestShutdownDaemon(t, ShutdownCfg{}, s)
+	require.NoError(err)
+
+	d.stop()
+	d.terminate()
+
+	assert.Equal([]string{"init", "stop", "goroutines", "terminate"},
+		s.Calls())
+
+	s = &testService{}
+
+	d, err = newTestShutdownDaemon(t, ShutdownCfg{
+		Order: []string{"goroutines"},
+	}, s)
+	require.NoError(err)
+
+	d.stop()
+	d.terminate()
+
+	assert.Equal([]string{"init", "goroutines", "stop", "terminate"},
+		s.Calls())
+}
+
+func TestShutdownComponentTimeout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := &testService{StopChan: make(chan struct{})}
+	defer close(s.StopChan)
+
+	d, err := newTestShutdownDaemon(t, ShutdownCfg{
+		ComponentTimeouts: map[string]dtime.Duration{
+			"service": dtime.Duration(10 * time.Millisecond),
+		},
+	}, s)
+	require.NoError(err)
+
+	d.stop()
+	d.terminate()
+
+	// The service could not be stopped, it is not terminated; the sequence
+	// carries on with the next component.
+	assert.Equal([]string{"init", "goroutines"}, s.Calls())
+	assert.Equal(map[string]bool{"service": true}, d.unstoppedComponents)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := &testService{StopChan: make(chan struct{})}
+	defer close(s.StopChan)
+
+	d, err := newTestShutdownDaemon(t, ShutdownCfg{
+		Timeout: dtime.Duration(10 * time.Millisecond),
+	}, s)
+	require.NoError(err)
+
+	d.stop()
+	d.terminate()
+
+	// Once the deadline has been reached, remaining components are
+	// abandoned.
+	assert.Equal([]string{"init"}, s.Calls())
+	assert.Equal(map[string]bool{"service": true, "goroutines": true},
+		d.unstoppedComponents)
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/exograd/go-daemon/influx"
+)
+
+type WatchdogAction string
+
+const (
+	// Log the breach of the threshold
+	WatchdogActionLog WatchdogAction = "log"
+
+	// Send a daemon_watchdog_breaches point to Influx
+	WatchdogActionMetrics WatchdogAction = "metrics"
+
+	// Write a goroutine or heap profile to the profile directory
+	WatchdogActionProfile WatchdogAction = "profile"
+
+	// Stop the daemon with an error so that it can be restarted by its
+	// supervisor
+	WatchdogActionExit WatchdogAction = "exit"
+)
+
+var WatchdogActionValues = []WatchdogAction{
+	WatchdogActionLog,
+	WatchdogActionMetrics,
+	WatchdogActionProfile,
+	WatchdogActionExit,
+}
+
+// WatchdogCfg configures the periodic monitoring of the resources used by
+// the daemon. Each threshold is disabled if it is zero. The latency is the
+// time it takes for a new goroutine to be scheduled, which increases when
+// the process is starved of CPU.
+type WatchdogCfg struct {
+	Interval time.Duration // 10s by default
+
+	MaxGoroutines int
+	MaxHeapSize   int64 // bytes
+	MaxLatency    time.Duration
+
+	Actions []WatchdogAction // log by default
+
+	// The directory profiles are written to; the temporary directory of the
+	// system by default.
+	ProfileDirectory string
+
+	// The minimum delay between two executions of the actions of the same
+	// check; 5 minutes by default.
+	Cooldown time.Duration
+}
+
+type watchdogCheck struct {
+	name      string
+	value     int64
+	threshold int64
+	profile   string
+}
+
+func (d *Daemon) initWatchdog() error {
+	cfg := d.Cfg.Watchdog
+	if cfg == nil {
+		return nil
+	}
+
+	for _, action := range cfg.Actions {
+		found := false
+		for _, value := range WatchdogActionValues {
+			if action == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("invalid watchdog action %q", action)
+		}
+	}
+
+	return nil
+}
+
+func (d *Daemon) startWatchdog() {
+	if d.Cfg.Watchdog == nil {
+		return
+	}
+
+	cfg := *d.Cfg.Watchdog
+
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+
+	if len(cfg.Actions) == 0 {
+		cfg.Actions = []WatchdogAction{WatchdogActionLog}
+	}
+
+	if cfg.ProfileDirectory == "" {
+		cfg.ProfileDirectory = os.TempDir()
+	}
+
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = 5 * time.Minute
+	}
+
+	lastActions := make(map[string]time.Time)
+
+	d.GoNamed("watchdog", func(ctx context.Context) {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				for _, check := range d.watchdogChecks(&cfg) {
+					if check.value <= check.threshold {
+						continue
+					}
+
+					now := time.Now()
+					if now.Sub(lastActions[check.name]) < cfg.Cooldown {
+						continue
+					}
+
+					lastActions[check.name] = now
+
+					d.runWatchdogActions(&cfg, check)
+				}
+			}
+		}
+	})
+}
+
+func (d *Daemon) watchdogChecks(cfg *WatchdogCfg) []watchdogCheck {
+	var checks []watchdogCheck
+
+	if cfg.MaxGoroutines > 0 {
+		checks = append(checks, watchdogCheck{
+			name:      "goroutines",
+			value:     int64(runtime.NumGoroutine()),
+			threshold: int64(cfg.MaxGoroutines),
+			profile:   "goroutine",
+		})
+	}
+
+	if cfg.MaxHeapSize > 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+
+		checks = append(checks, watchdogCheck{
+			name:      "heap_size",
+			value:     int64(stats.HeapAlloc),
+			threshold: cfg.MaxHeapSize,
+			profile:   "heap",
+		})
+	}
+
+	if cfg.MaxLatency > 0 {
+		checks = append(checks, watchdogCheck{
+			name:      "latency",
+			value:     schedulingLatency().Microseconds(),
+			threshold: cfg.MaxLatency.Microseconds(),
+			profile:   "goroutine",
+		})
+	}
+
+	return checks
+}
+
+func schedulingLatency() time.Duration {
+	start := time.Now()
+
+	done := make(chan struct{})
+	go close(done)
+	<-done
+
+	return time.Since(start)
+}
+
+func (d *Daemon) runWatchdogActions(cfg *WatchdogCfg, check watchdogCheck) {
+	message := fmt.Sprintf("watchdog threshold exceeded for %s: %d > %d",
+		check.name, check.value, check.threshold)
+
+	for _, action := range cfg.Actions {
+		switch action {
+		case WatchdogActionLog:
+			d.Log.Error("%s", message)
+
+		case WatchdogActionMetrics:
+			if d.Influx == nil {
+				continue
+			}
+
+			tags := influx.Tags{
+				"check": check.name,
+			}
+
+			fields := influx.Fields{
+				"value":     check.value,
+				"threshold": check.threshold,
+			}
+
+			d.Influx.EnqueuePoint(
+				influx.NewPoint("daemon_watchdog_breaches", tags, fields))
+
+		case WatchdogActionProfile:
+			filePath, err := d.writeWatchdogProfile(cfg, check)
+			if err != nil {
+				d.Log.Error("cannot write %s profile: %v", check.profile, err)
+				continue
+			}
+
+			d.Log.Info("%s profile written to %s", check.profile, filePath)
+
+		case WatchdogActionExit:
+			d.Fatal(fmt.Errorf("%s", message))
+		}
+	}
+}
+
+func (d *Daemon) writeWatchdogProfile(cfg *WatchdogCfg, check watchdogCheck) (string, error) {
+	profile := pprof.Lookup(check.profile)
+	if profile == nil {
+		return "", fmt.Errorf("unknown profile %q", check.profile)
+	}
+
+	fileName := fmt.Sprintf("%s-%s-%s.pprof", d.Cfg.name, check.name,
+		time.Now().UTC().Format("20060102T150405Z"))
+	filePath := filepath.Join(cfg.ProfileDirectory, fileName)
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := profile.WriteTo(file, 0); err != nil {
+		file.Close()
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
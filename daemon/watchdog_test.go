@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemon
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdogCfg(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{
+		Watchdog: &WatchdogCfg{
+			Actions: []WatchdogAction{WatchdogActionLog, "foo"},
+		},
+	})
+
+	assert.Error(d.initWatchdog())
+
+	d = newTestDaemon(t, DaemonCfg{
+		Watchdog: &WatchdogCfg{
+			Actions: []WatchdogAction{WatchdogActionLog, WatchdogActionExit},
+		},
+	})
+
+	assert.NoError(d.initWatchdog())
+}
+
+func TestWatchdogChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDaemon(t, DaemonCfg{})
+
+	// Thresholds set to zero are disabled
+	assert.Empty(d.watchdogChecks(&WatchdogCfg{}))
+
+	checks := d.watchdogChecks(&WatchdogCfg{
+		MaxGoroutines: 1,
+		MaxHeapSize:   1,
+		MaxLatency:    time.Hour,
+	})
+
+	if assert.Len(checks, 3) {
+		assert.Equal("goroutines", checks[0].name)
+		assert.Greater(checks[0].value, checks[0].threshold)
+
+		assert.Equal("heap_size", checks[1].name)
+		assert.Greater(checks[1].value, checks[1].threshold)
+
+		assert.Equal("latency", checks[2].name)
+		assert.Less(checks[2].value, checks[2].threshold)
+	}
+}
+
+func TestWatchdogActions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	profileDirectory := t.TempDir()
+
+	d := newTestDaemon(t, DaemonCfg{
+		Watchdog: &WatchdogCfg{
+			Interval:      time.Millisecond,
+			MaxGoroutines: 1,
+			Actions: []WatchdogAction{
+				WatchdogActionProfile,
+				WatchdogActionExit,
+			},
+			ProfileDirectory: profileDirectory,
+			Cooldown:         time.Hour,
+		},
+	})
+
+	d.startWatchdog()
+
+	select {
+	case err := <-d.errorChan:
+		assert.Contains(err.Error(), "goroutines")
+	case <-time.After(5 * time.Second):
+		require.FailNow("timeout while waiting for the watchdog")
+	}
+
+	// Actions are not executed again before the end of the cooldown delay
+	time.Sleep(20 * time.Millisecond)
+
+	d.cancel()
+	d.wg.Wait()
+
+	entries, err := os.ReadDir(profileDirectory)
+	require.NoError(err)
+	require.Len(entries, 1)
+
+	assert.True(strings.HasPrefix(entries[0].Name(), "test-goroutines-"))
+	assert.Empty(d.errorChan)
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/daemon"
+)
+
+type Cfg struct {
+	Name string
+
+	// The service configuration, in the same format as configuration files
+	CfgData string
+
+	// If true, the pg client uses a temporary schema which is dropped when
+	// the daemon is stopped.
+	TemporaryPgSchema bool
+
+	UpdateDaemonCfg func(*daemon.DaemonCfg) error
+}
+
+type Daemon struct {
+	*daemon.Daemon
+
+	Influx   *InfluxStub
+	PgSchema string
+
+	t          testing.TB
+	httpClient *http.Client
+	pgURI      string
+}
+
+// Start initializes and starts a daemon for a service. HTTP servers listen
+// on random local ports, and the influx client, if any, sends points to a
+// local stub. The daemon is stopped when the test ends.
+func Start(t testing.TB, service daemon.Service, cfg Cfg) *Daemon {
+	t.Helper()
+
+	if cfg.Name == "" {
+		cfg.Name = "test"
+	}
+
+	d := &Daemon{
+		t: t,
+
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	testCfg := daemon.TestCfg{
+		UpdateDaemonCfg: func(daemonCfg *daemon.DaemonCfg) error {
+			return d.updateDaemonCfg(daemonCfg, cfg)
+		},
+	}
+
+	if cfg.CfgData != "" {
+		testCfg.CfgData = []byte(cfg.CfgData)
+	}
+
+	dd, err := daemon.RunTestCfg(cfg.Name, service, testCfg)
+	if err != nil {
+		d.cleanup()
+		t.Fatalf("cannot start daemon: %v", err)
+	}
+
+	d.Daemon = dd
+
+	t.Cleanup(d.Stop)
+
+	return d
+}
+
+func (d *Daemon) updateDaemonCfg(daemonCfg *daemon.DaemonCfg, cfg Cfg) error {
+	if daemonCfg.API != nil {
+		apiCfg := *daemonCfg.API
+		apiCfg.Address = "localhost:0"
+		daemonCfg.API = &apiCfg
+	}
+
+	for name, serverCfg := range daemonCfg.HTTPServers {
+		serverCfg.Address = "localhost:0"
+		daemonCfg.HTTPServers[name] = serverCfg
+	}
+
+	for name, serverCfg := range daemonCfg.GRPCServers {
+		serverCfg.Address = "localhost:0"
+		daemonCfg.GRPCServers[name] = serverCfg
+	}
+
+	if daemonCfg.Influx != nil {
+		d.Influx = NewInfluxStub()
+
+		influxCfg := *daemonCfg.Influx
+		influxCfg.URI = d.Influx.URI()
+		daemonCfg.Influx = &influxCfg
+	}
+
+	if daemonCfg.Pg != nil && cfg.TemporaryPgSchema {
+		pgCfg := *daemonCfg.Pg
+
+		schema, uri, err := createPgSchema(pgCfg.URI)
+		if err != nil {
+			return err
+		}
+
+		d.PgSchema = schema
+		d.pgURI = pgCfg.URI
+
+		pgCfg.URI = uri
+		daemonCfg.Pg = &pgCfg
+	}
+
+	if cfg.UpdateDaemonCfg != nil {
+		return cfg.UpdateDaemonCfg(daemonCfg)
+	}
+
+	return nil
+}
+
+// Stop stops the daemon and waits for its termination. It is called
+// automatically at the end of the test.
+func (d *Daemon) Stop() {
+	if d.Daemon != nil {
+		d.Daemon.Stop()
+		<-d.Daemon.Done()
+
+		if err := d.Daemon.Err(); err != nil {
+			d.t.Errorf("daemon error: %v", err)
+		}
+
+		d.Daemon = nil
+	}
+
+	d.cleanup()
+}
+
+func (d *Daemon) cleanup() {
+	if d.Influx != nil {
+		d.Influx.Close()
+		d.Influx = nil
+	}
+
+	if d.PgSchema != "" {
+		if err := dropPgSchema(d.pgURI, d.PgSchema); err != nil {
+			d.t.Errorf("cannot drop pg schema %q: %v", d.PgSchema, err)
+		}
+
+		d.PgSchema = ""
+	}
+}
+
+func (d *Daemon) ServerURI(name string) string {
+	d.t.Helper()
+
+	server, found := d.HTTPServers[name]
+	if !found {
+		d.t.Fatalf("unknown http server %q", name)
+	}
+
+	scheme := "http"
+	if server.Cfg.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + server.Address()
+}
+
+// Request sends a request to one of the HTTP servers of the daemon and
+// returns the response with its body, fully read.
+func (d *Daemon) Request(server, method, path string, body io.Reader, header http.Header) (*http.Response, []byte) {
+	d.t.Helper()
+
+	uri := d.ServerURI(server) + path
+
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		d.t.Fatalf("cannot create request: %v", err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	res, err := d.httpClient.Do(req)
+	if err != nil {
+		d.t.Fatalf("cannot send request: %v", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.t.Fatalf("cannot read response body: %v", err)
+	}
+
+	return res, resBody
+}
+
+// RequestJSON sends a request with an optional JSON body and decodes the
+// response body in dest if it is not nil and if the request succeeded.
+func (d *Daemon) RequestJSON(server, method, path string, value, dest interface{}) *http.Response {
+	d.t.Helper()
+
+	var body io.Reader
+	header := make(http.Header)
+
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			d.t.Fatalf("cannot encode request body: %v", err)
+		}
+
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	res, resBody := d.Request(server, method, path, body, header)
+
+	if dest != nil && res.StatusCode >= 200 && res.StatusCode < 300 {
+		if err := json.Unmarshal(resBody, dest); err != nil {
+			d.t.Fatalf("cannot decode response body: %v", err)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemontest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/exograd/go-daemon/broker"
+	"github.com/exograd/go-daemon/daemon"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+type testServiceCfg struct {
+	Message string `json:"message"`
+}
+
+type testService struct {
+	Cfg testServiceCfg
+}
+
+func (s *testService) DefaultServiceCfg() interface{} {
+	return &s.Cfg
+}
+
+func (s *testService) ValidateServiceCfg() error {
+	return nil
+}
+
+func (s *testService) DaemonCfg() (daemon.DaemonCfg, error) {
+	cfg := daemon.NewDaemonCfg()
+	cfg.AddHTTPServer("main", dhttp.ServerCfg{Address: "localhost:8080"})
+
+	return cfg, nil
+}
+
+func (s *testService) Init(d *daemon.Daemon) error {
+	d.HTTPServers["main"].Route("/message", "GET", func(h *dhttp.Handler) {
+		h.ReplyJSON(200, map[string]string{"message": s.Cfg.Message})
+	})
+
+	return nil
+}
+
+func (s *testService) Start(d *daemon.Daemon) error { return nil }
+func (s *testService) Stop(d *daemon.Daemon)        {}
+func (s *testService) Terminate(d *daemon.Daemon)   {}
+
+func TestStart(t *testing.T) {
+	assert := assert.New(t)
+
+	d := Start(t, &testService{}, Cfg{CfgData: "message: hello"})
+
+	var body map[string]string
+	res := d.RequestJSON("main", "GET", "/message", nil, &body)
+
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("hello", body["message"])
+}
+
+type failingBroker struct{}
+
+func (b *failingBroker) Publish(ctx context.Context, subject string, data []byte, header broker.Header) error {
+	return errors.New("broker unavailable")
+}
+
+func (b *failingBroker) Subscribe(cfg broker.SubscriptionCfg, handler broker.Handler) error {
+	return nil
+}
+
+func (b *failingBroker) Start() error {
+	return errors.New("broker unavailable")
+}
+
+func (b *failingBroker) Stop() {}
+
+func TestOptionalBrokerStartFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	d := Start(t, &testService{}, Cfg{
+		CfgData: "message: hello",
+		UpdateDaemonCfg: func(cfg *daemon.DaemonCfg) error {
+			cfg.Broker = &failingBroker{}
+			cfg.OptionalComponents = []string{"broker"}
+			return nil
+		},
+	})
+
+	assert.Equal([]string{"broker"}, d.DegradedComponents())
+	assert.Equal(false, d.ComponentStates()["broker"])
+	assert.True(d.Ready())
+
+	var body map[string]string
+	res := d.RequestJSON("main", "GET", "/message", nil, &body)
+
+	assert.Equal(http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemontest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// InfluxStub is a minimal HTTP server accepting influx write requests and
+// storing the points it receives in line protocol format.
+type InfluxStub struct {
+	server *httptest.Server
+
+	lines     []string
+	linesLock sync.Mutex
+}
+
+func NewInfluxStub() *InfluxStub {
+	s := &InfluxStub{}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *InfluxStub) URI() string {
+	return s.server.URL
+}
+
+func (s *InfluxStub) Close() {
+	s.server.Close()
+}
+
+func (s *InfluxStub) Lines() []string {
+	s.linesLock.Lock()
+	defer s.linesLock.Unlock()
+
+	lines := make([]string, len(s.lines))
+	copy(lines, s.lines)
+
+	return lines
+}
+
+func (s *InfluxStub) Reset() {
+	s.linesLock.Lock()
+	s.lines = nil
+	s.linesLock.Unlock()
+}
+
+func (s *InfluxStub) handle(w http.ResponseWriter, req *http.Request) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.linesLock.Lock()
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			s.lines = append(s.lines, line)
+		}
+	}
+	s.linesLock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daemontest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/exograd/go-daemon/dcrypto"
+	"github.com/jackc/pgx/v4"
+)
+
+func createPgSchema(uri string) (string, string, error) {
+	schema := "test_" + dcrypto.RandomHexString(8)
+
+	query := fmt.Sprintf("CREATE SCHEMA %s", pgx.Identifier{schema}.Sanitize())
+	if err := execPgQuery(uri, query); err != nil {
+		return "", "", fmt.Errorf("cannot create pg schema: %w", err)
+	}
+
+	schemaURI, err := pgURIWithSearchPath(uri, schema)
+	if err != nil {
+		return "", "", err
+	}
+
+	return schema, schemaURI, nil
+}
+
+func dropPgSchema(uri, schema string) error {
+	query := fmt.Sprintf("DROP SCHEMA %s CASCADE",
+		pgx.Identifier{schema}.Sanitize())
+
+	return execPgQuery(uri, query)
+}
+
+func execPgQuery(uri, query string) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, uri)
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, query)
+	return err
+}
+
+func pgURIWithSearchPath(uri, schema string) (string, error) {
+	if !strings.Contains(uri, "://") {
+		return uri + " search_path=" + schema, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid pg uri: %w", err)
+	}
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
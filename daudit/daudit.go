@@ -0,0 +1,225 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daudit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/ksuid"
+)
+
+type Actor struct {
+	Id   string `json:"id"`
+	Type string `json:"type,omitempty"`
+}
+
+type Target struct {
+	Type string `json:"type"`
+	Id   string `json:"id,omitempty"`
+}
+
+type Event struct {
+	Id     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Actor  *Actor    `json:"actor,omitempty"`
+	Target *Target   `json:"target,omitempty"`
+
+	RequestId     string `json:"request_id,omitempty"`
+	ClientAddress string `json:"client_address,omitempty"`
+	Method        string `json:"method,omitempty"`
+	Path          string `json:"path,omitempty"`
+	RouteId       string `json:"route_id,omitempty"`
+	Status        int    `json:"status,omitempty"`
+
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+type Sink interface {
+	WriteEvent(context.Context, *Event) error
+}
+
+type AuditorCfg struct {
+	Log *dlog.Logger `json:"-"`
+
+	Pg      *PgSinkCfg      `json:"pg,omitempty"`
+	File    *FileSinkCfg    `json:"file,omitempty"`
+	Webhook *WebhookSinkCfg `json:"webhook,omitempty"`
+
+	// Custom sinks, used in addition to configured ones
+	Sinks []Sink `json:"-"`
+
+	// The names of the http servers for which an event is recorded for each
+	// successful POST, PUT, PATCH or DELETE request.
+	Servers []string `json:"servers,omitempty"`
+}
+
+func (cfg *AuditorCfg) Check(c *check.Checker) {
+	c.CheckOptionalObject("pg", cfg.Pg)
+	c.CheckOptionalObject("file", cfg.File)
+	c.CheckOptionalObject("webhook", cfg.Webhook)
+
+	c.WithChild("servers", func() {
+		for i, name := range cfg.Servers {
+			c.CheckStringNotEmpty(i, name)
+		}
+	})
+}
+
+type Auditor struct {
+	Cfg AuditorCfg
+	Log *dlog.Logger
+
+	sinks []Sink
+}
+
+func NewAuditor(cfg AuditorCfg) (*Auditor, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("audit")
+	}
+
+	a := &Auditor{
+		Cfg: cfg,
+		Log: cfg.Log,
+	}
+
+	if cfg.Pg != nil {
+		sink, err := NewPgSink(*cfg.Pg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create pg sink: %w", err)
+		}
+
+		a.sinks = append(a.sinks, sink)
+	}
+
+	if cfg.File != nil {
+		sink, err := NewFileSink(*cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create file sink: %w", err)
+		}
+
+		a.sinks = append(a.sinks, sink)
+	}
+
+	if cfg.Webhook != nil {
+		sink, err := NewWebhookSink(*cfg.Webhook)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create webhook sink: %w", err)
+		}
+
+		a.sinks = append(a.sinks, sink)
+	}
+
+	a.sinks = append(a.sinks, cfg.Sinks...)
+
+	return a, nil
+}
+
+func (a *Auditor) Close() {
+	for _, sink := range a.sinks {
+		if closer, ok := sink.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				a.Log.Error("cannot close sink: %v", err)
+			}
+		}
+	}
+}
+
+// Record writes an event to all sinks. The identifier and time of the event
+// are set if they are empty.
+func (a *Auditor) Record(ctx context.Context, event *Event) error {
+	if event.Id == "" {
+		event.Id = ksuid.Generate().String()
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	var firstErr error
+
+	for _, sink := range a.sinks {
+		if err := sink.WriteEvent(ctx, event); err != nil {
+			a.Log.Error("cannot write audit event %s (%s): %v",
+				event.Id, event.Action, err)
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// RecordRequest records an event associated with an http request; the actor
+// is the principal of the request if it was authenticated.
+func (a *Auditor) RecordRequest(h *dhttp.Handler, action string, target *Target, data map[string]interface{}) error {
+	event := requestEvent(h)
+	event.Action = action
+	event.Target = target
+	event.Data = data
+
+	return a.Record(h.Context(), event)
+}
+
+// ObserveRequest implements dhttp.RequestObserver.
+func (a *Auditor) ObserveRequest(h *dhttp.Handler) {
+	switch h.Method {
+	case "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return
+	}
+
+	status := h.Status()
+	if status < 200 || status >= 300 {
+		return
+	}
+
+	event := requestEvent(h)
+
+	if h.Route != nil && h.Route.AuditAction != "" {
+		event.Action = h.Route.AuditAction
+	} else {
+		event.Action = h.RouteId
+	}
+
+	a.Record(h.Context(), event)
+}
+
+func requestEvent(h *dhttp.Handler) *Event {
+	event := Event{
+		RequestId:     h.RequestId,
+		ClientAddress: h.ClientAddress,
+		Method:        h.Request.Method,
+		Path:          h.Request.URL.Path,
+		RouteId:       h.RouteId,
+		Status:        h.Status(),
+	}
+
+	if principal := h.Principal(); principal != nil {
+		event.Actor = &Actor{
+			Id:   principal.Id,
+			Type: principal.Type,
+		}
+	}
+
+	return &event
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daudit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditorObserveRequest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	filePath := path.Join(t.TempDir(), "audit.log")
+
+	auditor, err := NewAuditor(AuditorCfg{
+		File: &FileSinkCfg{Path: filePath},
+	})
+	require.NoError(err)
+
+	h := dhttp.NewTestHandler("GET", "/foo", nil)
+	h.ReplyEmpty(200)
+	auditor.ObserveRequest(h.Handler)
+
+	h = dhttp.NewTestHandler("DELETE", "/foo", nil)
+	h.ReplyEmpty(404)
+	auditor.ObserveRequest(h.Handler)
+
+	h = dhttp.NewTestHandler("POST", "/foo", nil)
+	h.ReplyEmpty(204)
+	auditor.ObserveRequest(h.Handler)
+
+	err = auditor.RecordRequest(h.Handler, "foo.create",
+		&Target{Type: "foo", Id: "42"}, nil)
+	require.NoError(err)
+
+	auditor.Close()
+
+	file, err := os.Open(filePath)
+	require.NoError(err)
+	defer file.Close()
+
+	var events []Event
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(scanner.Err())
+
+	require.Len(events, 2)
+
+	assert.Equal("/foo POST", events[0].Action)
+	assert.Equal("POST", events[0].Method)
+	assert.Equal(204, events[0].Status)
+	assert.NotEmpty(events[0].Id)
+	assert.False(events[0].Time.IsZero())
+
+	assert.Equal("foo.create", events[1].Action)
+	if assert.NotNil(events[1].Target) {
+		assert.Equal("42", events[1].Target.Id)
+	}
+}
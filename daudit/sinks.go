@@ -0,0 +1,228 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package daudit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/pg"
+)
+
+// PgSinkTableSQL is the definition of the table used by PgSink; it must be
+// created by a schema migration.
+const PgSinkTableSQL = `
+CREATE TABLE audit_events (
+  id VARCHAR NOT NULL PRIMARY KEY,
+  time TIMESTAMP NOT NULL,
+  action VARCHAR NOT NULL,
+  actor_id VARCHAR,
+  actor_type VARCHAR,
+  target_type VARCHAR,
+  target_id VARCHAR,
+  request_id VARCHAR,
+  event JSONB NOT NULL
+);
+
+CREATE INDEX audit_events_time_idx ON audit_events (time);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id);
+`
+
+type PgSinkCfg struct {
+	Pg *pg.Client `json:"-"`
+
+	Table string `json:"table,omitempty"`
+}
+
+func (cfg *PgSinkCfg) Check(c *check.Checker) {
+}
+
+type PgSink struct {
+	Cfg PgSinkCfg
+}
+
+func NewPgSink(cfg PgSinkCfg) (*PgSink, error) {
+	if cfg.Pg == nil {
+		return nil, fmt.Errorf("missing pg client")
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "audit_events"
+	}
+
+	return &PgSink{Cfg: cfg}, nil
+}
+
+func (s *PgSink) WriteEvent(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot encode event: %w", err)
+	}
+
+	var actorId, actorType, targetType, targetId *string
+
+	if event.Actor != nil {
+		actorId, actorType = &event.Actor.Id, &event.Actor.Type
+	}
+
+	if event.Target != nil {
+		targetType, targetId = &event.Target.Type, &event.Target.Id
+	}
+
+	query := fmt.Sprintf(`
+INSERT INTO %s
+    (id, time, action, actor_id, actor_type, target_type, target_id,
+     request_id, event)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`, s.Cfg.Table)
+
+	return s.Cfg.Pg.WithConn(func(conn pg.Conn) error {
+		return pg.ExecContext(ctx, conn, query, event.Id, event.Time,
+			event.Action, actorId, actorType, targetType, targetId,
+			event.RequestId, data)
+	})
+}
+
+// FileSink appends events to a file, one JSON object per line.
+type FileSinkCfg struct {
+	Path string `json:"path"`
+}
+
+func (cfg *FileSinkCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("path", cfg.Path)
+}
+
+type FileSink struct {
+	Cfg FileSinkCfg
+
+	file  *os.File
+	mutex sync.Mutex
+}
+
+func NewFileSink(cfg FileSinkCfg) (*FileSink, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+
+	file, err := os.OpenFile(cfg.Path, flags, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q: %w", cfg.Path, err)
+	}
+
+	s := &FileSink{
+		Cfg: cfg,
+
+		file: file,
+	}
+
+	return s, nil
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+func (s *FileSink) WriteEvent(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot encode event: %w", err)
+	}
+
+	data = append(data, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("cannot write %q: %w", s.Cfg.Path, err)
+	}
+
+	return nil
+}
+
+// WebhookSink sends each event in a POST request. The http client can be
+// configured to sign requests, e.g. with dhttp.HMACSigner.
+type WebhookSinkCfg struct {
+	HTTPClient *dhttp.Client `json:"-"`
+
+	URI    string          `json:"uri"`
+	Client dhttp.ClientCfg `json:"client"`
+}
+
+func (cfg *WebhookSinkCfg) Check(c *check.Checker) {
+	c.CheckStringURI("uri", cfg.URI)
+	c.CheckObject("client", &cfg.Client)
+}
+
+type WebhookSink struct {
+	Cfg WebhookSinkCfg
+
+	httpClient *dhttp.Client
+}
+
+func NewWebhookSink(cfg WebhookSinkCfg) (*WebhookSink, error) {
+	httpClient := cfg.HTTPClient
+
+	if httpClient == nil {
+		var err error
+		httpClient, err = dhttp.NewClient(cfg.Client)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create http client: %w", err)
+		}
+	}
+
+	s := &WebhookSink{
+		Cfg: cfg,
+
+		httpClient: httpClient,
+	}
+
+	return s, nil
+}
+
+func (s *WebhookSink) WriteEvent(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.Cfg.URI,
+		bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	ioutil.ReadAll(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/exograd/go-daemon/influx"
+)
+
+type CacheCfg struct {
+	Log    *dlog.Logger   `json:"-"`
+	Influx *influx.Client `json:"-"`
+
+	// Used to identify the cache in metrics
+	Name string `json:"-"`
+
+	MaxEntries int `json:"max_entries"`
+
+	// The default time to live of entries; zero means entries do not
+	// expire.
+	TTL dtime.Duration `json:"ttl,omitempty"`
+
+	MetricsInterval dtime.Duration `json:"metrics_interval,omitempty"`
+}
+
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+type Cache struct {
+	Cfg CacheCfg
+	Log *dlog.Logger
+
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   Stats
+	lock    sync.Mutex
+
+	loads     map[string]*load
+	loadsLock sync.Mutex
+
+	now func() time.Time
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+type entry struct {
+	key            string
+	value          interface{}
+	expirationTime time.Time
+}
+
+type load struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+func (cfg *CacheCfg) Check(c *check.Checker) {
+	c.CheckIntMin("max_entries", cfg.MaxEntries, 0)
+}
+
+func NewCache(cfg CacheCfg) *Cache {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("cache")
+	}
+
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = 10_000
+	}
+
+	if cfg.MetricsInterval == 0 {
+		cfg.MetricsInterval = dtime.Duration(10 * time.Second)
+	}
+
+	c := &Cache{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+
+		loads: make(map[string]*load),
+
+		now: time.Now,
+
+		stopChan: make(chan struct{}),
+	}
+
+	return c
+}
+
+// Start runs a goroutine which periodically removes expired entries and
+// sends metrics. Caches can be used without being started.
+func (c *Cache) Start() {
+	c.wg.Add(1)
+	go c.main()
+}
+
+func (c *Cache) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *Cache) main() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.Cfg.MetricsInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+
+		case <-ticker.C:
+			c.RemoveExpired()
+
+			if c.Cfg.Influx != nil {
+				c.Cfg.Influx.EnqueuePoint(c.statsPoint())
+			}
+		}
+	}
+}
+
+func (c *Cache) statsPoint() *influx.Point {
+	stats := c.Stats()
+
+	tags := influx.Tags{
+		"cache": c.Cfg.Name,
+	}
+
+	fields := influx.Fields{
+		"hits":      stats.Hits,
+		"misses":    stats.Misses,
+		"evictions": stats.Evictions,
+		"entries":   stats.Entries,
+	}
+
+	return influx.NewPoint("cache", tags, fields)
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elt, found := c.entries[key]
+	if !found {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	e := elt.Value.(*entry)
+
+	if !e.expirationTime.IsZero() && !c.now().Before(e.expirationTime) {
+		c.removeElement(elt)
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elt)
+	c.stats.Hits++
+
+	return e.value, true
+}
+
+func (c *Cache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.Cfg.TTL.Duration())
+}
+
+func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	var expirationTime time.Time
+	if ttl > 0 {
+		expirationTime = c.now().Add(ttl)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elt, found := c.entries[key]; found {
+		e := elt.Value.(*entry)
+		e.value = value
+		e.expirationTime = expirationTime
+
+		c.lru.MoveToFront(elt)
+		return
+	}
+
+	e := &entry{
+		key:            key,
+		value:          value,
+		expirationTime: expirationTime,
+	}
+
+	c.entries[key] = c.lru.PushFront(e)
+
+	for c.lru.Len() > c.Cfg.MaxEntries {
+		c.removeElement(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) Delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elt, found := c.entries[key]; found {
+		c.removeElement(elt)
+	}
+}
+
+func (c *Cache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *Cache) RemoveExpired() {
+	now := c.now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, elt := range c.entries {
+		e := elt.Value.(*entry)
+
+		if !e.expirationTime.IsZero() && !now.Before(e.expirationTime) {
+			c.removeElement(elt)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *Cache) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+
+	return stats
+}
+
+func (c *Cache) removeElement(elt *list.Element) {
+	e := elt.Value.(*entry)
+
+	delete(c.entries, e.key)
+	c.lru.Remove(elt)
+}
+
+// GetOrLoad returns the value associated with a key, calling a loading
+// function if there is none. Concurrent calls for the same key share a
+// single call to the loading function. Errors are not cached.
+func (c *Cache) GetOrLoad(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	if value, found := c.Get(key); found {
+		return value, nil
+	}
+
+	c.loadsLock.Lock()
+
+	if l, found := c.loads[key]; found {
+		c.loadsLock.Unlock()
+		l.wg.Wait()
+		return l.value, l.err
+	}
+
+	l := &load{}
+	l.wg.Add(1)
+	c.loads[key] = l
+
+	c.loadsLock.Unlock()
+
+	defer func() {
+		c.loadsLock.Lock()
+		delete(c.loads, key)
+		c.loadsLock.Unlock()
+
+		l.wg.Done()
+	}()
+
+	l.value, l.err = fn(ctx)
+	if l.err == nil {
+		c.Set(key, l.value)
+	}
+
+	return l.value, l.err
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLRU(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewCache(CacheCfg{MaxEntries: 2})
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	_, found := c.Get("a")
+	assert.True(found)
+
+	c.Set("c", 3)
+
+	_, found = c.Get("b")
+	assert.False(found)
+
+	value, found := c.Get("a")
+	assert.True(found)
+	assert.Equal(1, value)
+
+	stats := c.Stats()
+	assert.Equal(int64(2), stats.Hits)
+	assert.Equal(int64(1), stats.Misses)
+	assert.Equal(int64(1), stats.Evictions)
+	assert.Equal(2, stats.Entries)
+}
+
+func TestCacheTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c := NewCache(CacheCfg{})
+	c.now = func() time.Time { return now }
+
+	c.SetWithTTL("a", 1, time.Minute)
+	c.Set("b", 2)
+
+	now = now.Add(time.Minute)
+
+	_, found := c.Get("a")
+	assert.False(found)
+
+	_, found = c.Get("b")
+	assert.True(found)
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewCache(CacheCfg{})
+
+	var nbCalls int32
+	start := make(chan struct{})
+
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&nbCalls, 1)
+		<-start
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			value, err := c.GetOrLoad(context.Background(), "a", loader)
+			assert.NoError(err)
+			assert.Equal(42, value)
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(start)
+	wg.Wait()
+
+	assert.Equal(int32(1), atomic.LoadInt32(&nbCalls))
+
+	_, err := c.GetOrLoad(context.Background(), "b",
+		func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("failure")
+		})
+	assert.Error(err)
+
+	_, found := c.Get("b")
+	assert.False(found)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/pg"
+	"github.com/jackc/pgx/v4"
+)
+
+// PgInvalidator uses pg LISTEN/NOTIFY to remove entries from a cache when
+// they are invalidated by any daemon instance connected to the same
+// database. The payload of each notification is the key to remove; an
+// empty payload clears the cache.
+type PgInvalidator struct {
+	Log     *dlog.Logger
+	Cache   *Cache
+	Pg      *pg.Client
+	Channel string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewPgInvalidator(cache *Cache, client *pg.Client, channel string) *PgInvalidator {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &PgInvalidator{
+		Log:     cache.Log.Child("pg-invalidation", dlog.Data{"channel": channel}),
+		Cache:   cache,
+		Pg:      client,
+		Channel: channel,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (i *PgInvalidator) Start() {
+	i.wg.Add(1)
+	go i.main()
+}
+
+func (i *PgInvalidator) Stop() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+// Invalidate removes a key from the caches of all instances.
+func (i *PgInvalidator) Invalidate(ctx context.Context, key string) error {
+	return i.Pg.WithConn(func(conn pg.Conn) error {
+		query := `SELECT pg_notify($1, $2)`
+		_, err := conn.Exec(ctx, query, i.Channel, key)
+		return err
+	})
+}
+
+func (i *PgInvalidator) InvalidateAll(ctx context.Context) error {
+	return i.Invalidate(ctx, "")
+}
+
+func (i *PgInvalidator) main() {
+	defer i.wg.Done()
+
+	for {
+		err := i.listen()
+		if i.ctx.Err() != nil {
+			return
+		}
+
+		i.Log.Error("%v", err)
+
+		// Notifications may have been lost
+		i.Cache.Clear()
+
+		select {
+		case <-i.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (i *PgInvalidator) listen() error {
+	conn, err := i.Pg.Pool.Acquire(i.ctx)
+	if err != nil {
+		return fmt.Errorf("cannot acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	query := "LISTEN " + pgx.Identifier{i.Channel}.Sanitize()
+	if _, err := conn.Exec(i.ctx, query); err != nil {
+		return fmt.Errorf("cannot listen for notifications: %w", err)
+	}
+
+	defer func() {
+		// The connection goes back to the pool, we do not want it to
+		// keep receiving notifications.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn.Exec(ctx, "UNLISTEN *")
+	}()
+
+	for {
+		n, err := conn.Conn().WaitForNotification(i.ctx)
+		if err != nil {
+			return fmt.Errorf("cannot wait for notifications: %w", err)
+		}
+
+		if n.Payload == "" {
+			i.Cache.Clear()
+		} else {
+			i.Cache.Delete(n.Payload)
+		}
+	}
+}
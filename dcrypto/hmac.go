@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcrypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+func SignHMAC256(data, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func SignHMAC256Hex(data, key []byte) string {
+	return hex.EncodeToString(SignHMAC256(data, key))
+}
+
+func SignHMAC256Base64(data, key []byte) string {
+	return base64.StdEncoding.EncodeToString(SignHMAC256(data, key))
+}
+
+func VerifyHMAC256(data, key, signature []byte) bool {
+	return hmac.Equal(signature, SignHMAC256(data, key))
+}
+
+func VerifyHMAC256Hex(data, key []byte, s string) bool {
+	signature, err := hex.DecodeString(s)
+	if err != nil {
+		return false
+	}
+
+	return VerifyHMAC256(data, key, signature)
+}
+
+func VerifyHMAC256Base64(data, key []byte, s string) bool {
+	signature, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return false
+	}
+
+	return VerifyHMAC256(data, key, signature)
+}
+
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
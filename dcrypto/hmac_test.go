@@ -0,0 +1,39 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHMAC256(t *testing.T) {
+	assert := assert.New(t)
+
+	// RFC 4231 test case 2
+	key := []byte("Jefe")
+	data := []byte("what do ya want for nothing?")
+	signature := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+
+	assert.Equal(signature, SignHMAC256Hex(data, key))
+
+	assert.True(VerifyHMAC256Hex(data, key, signature))
+	assert.False(VerifyHMAC256Hex(data, []byte("foo"), signature))
+	assert.False(VerifyHMAC256Hex(data, key, "foo"))
+
+	assert.True(VerifyHMAC256Base64(data, key, SignHMAC256Base64(data, key)))
+	assert.False(VerifyHMAC256Base64(data, key, "Zm9v"))
+}
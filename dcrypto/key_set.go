@@ -0,0 +1,211 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+var ErrUnknownKeyVersion = errors.New("unknown key version")
+
+const KeySetHeaderSize = 4
+
+// A key set contains multiple versions of a key. Data are always encrypted
+// with the most recent version, i.e. the one with the highest version
+// number, and the version is stored in front of the encrypted data so that
+// they can be decrypted as long as the key set contains the right version.
+//
+// Data are encrypted with AES-256-GCM; the version header is authenticated
+// as additional data so that neither the header nor the encrypted data can
+// be modified.
+type KeySet struct {
+	keys           map[uint32]AES256Key
+	currentVersion uint32
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{
+		keys: make(map[uint32]AES256Key),
+	}
+}
+
+func (ks *KeySet) AddKey(version uint32, key AES256Key) error {
+	if version == 0 {
+		return fmt.Errorf("invalid key version 0")
+	}
+
+	if _, found := ks.keys[version]; found {
+		return fmt.Errorf("duplicate key version %d", version)
+	}
+
+	ks.keys[version] = key
+
+	if version > ks.currentVersion {
+		ks.currentVersion = version
+	}
+
+	return nil
+}
+
+func (ks *KeySet) CurrentVersion() uint32 {
+	return ks.currentVersion
+}
+
+func (ks *KeySet) Versions() []uint32 {
+	versions := make([]uint32, 0, len(ks.keys))
+	for version := range ks.keys {
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	return versions
+}
+
+func (ks *KeySet) Encrypt(data []byte) ([]byte, error) {
+	if ks.currentVersion == 0 {
+		return nil, fmt.Errorf("empty key set")
+	}
+
+	aead, err := newKeySetAEAD(ks.keys[ks.currentVersion])
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+
+	outputData := make([]byte, KeySetHeaderSize+nonceSize,
+		KeySetHeaderSize+nonceSize+len(data)+aead.Overhead())
+
+	header := outputData[:KeySetHeaderSize]
+	binary.BigEndian.PutUint32(header, ks.currentVersion)
+
+	nonce := outputData[KeySetHeaderSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	return aead.Seal(outputData, nonce, data, header), nil
+}
+
+func (ks *KeySet) Decrypt(data []byte) ([]byte, error) {
+	version, err := KeySetDataVersion(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, found := ks.keys[version]
+	if !found {
+		return nil, fmt.Errorf("%w %d", ErrUnknownKeyVersion, version)
+	}
+
+	aead, err := newKeySetAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+
+	if len(data) < KeySetHeaderSize+nonceSize+aead.Overhead() {
+		return nil, fmt.Errorf("truncated data")
+	}
+
+	header := data[:KeySetHeaderSize]
+	nonce := data[KeySetHeaderSize : KeySetHeaderSize+nonceSize]
+	encryptedData := data[KeySetHeaderSize+nonceSize:]
+
+	// Open writes the decrypted data to a new buffer: the data of the caller
+	// are left untouched.
+	outputData, err := aead.Open(nil, nonce, encryptedData, header)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt data: %w", err)
+	}
+
+	return outputData, nil
+}
+
+func (ks *KeySet) NeedsReencryption(data []byte) (bool, error) {
+	version, err := KeySetDataVersion(data)
+	if err != nil {
+		return false, err
+	}
+
+	return version != ks.currentVersion, nil
+}
+
+func newKeySetAEAD(key AES256Key) (cipher.AEAD, error) {
+	blockCipher, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(blockCipher)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gcm cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+func KeySetDataVersion(data []byte) (uint32, error) {
+	if len(data) < KeySetHeaderSize {
+		return 0, fmt.Errorf("truncated data")
+	}
+
+	return binary.BigEndian.Uint32(data), nil
+}
+
+func (ks KeySet) MarshalJSON() ([]byte, error) {
+	keys := make(map[string]AES256Key)
+
+	for version, key := range ks.keys {
+		keys[strconv.FormatUint(uint64(version), 10)] = key
+	}
+
+	return json.Marshal(keys)
+}
+
+func (ks *KeySet) UnmarshalJSON(data []byte) error {
+	var keys map[string]AES256Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	ks2 := NewKeySet()
+
+	for versionString, key := range keys {
+		version, err := strconv.ParseUint(versionString, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid key version %q", versionString)
+		}
+
+		if err := ks2.AddKey(uint32(version), key); err != nil {
+			return err
+		}
+	}
+
+	*ks = *ks2
+	return nil
+}
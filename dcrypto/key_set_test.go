@@ -0,0 +1,131 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcrypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var key1, key2 AES256Key
+	copy(key1[:], RandomBytes(32))
+	copy(key2[:], RandomBytes(32))
+
+	ks := NewKeySet()
+	require.NoError(ks.AddKey(1, key1))
+
+	data := []byte("Hello world!")
+
+	encryptedData1, err := ks.Encrypt(data)
+	require.NoError(err)
+
+	require.NoError(ks.AddKey(2, key2))
+	assert.Error(ks.AddKey(2, key2))
+	assert.Equal(uint32(2), ks.CurrentVersion())
+
+	encryptedData2, err := ks.Encrypt(data)
+	require.NoError(err)
+
+	version, err := KeySetDataVersion(encryptedData2)
+	require.NoError(err)
+	assert.Equal(uint32(2), version)
+
+	for _, encryptedData := range [][]byte{encryptedData1, encryptedData2} {
+		decryptedData, err := ks.Decrypt(encryptedData)
+		require.NoError(err)
+		assert.Equal(data, decryptedData)
+	}
+
+	reencrypt, err := ks.NeedsReencryption(encryptedData1)
+	require.NoError(err)
+	assert.True(reencrypt)
+
+	ks2 := NewKeySet()
+	require.NoError(ks2.AddKey(2, key2))
+
+	_, err = ks2.Decrypt(encryptedData1)
+	assert.ErrorIs(err, ErrUnknownKeyVersion)
+}
+
+func TestKeySetTampering(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var key AES256Key
+	copy(key[:], RandomBytes(32))
+
+	ks := NewKeySet()
+	require.NoError(ks.AddKey(1, key))
+	require.NoError(ks.AddKey(2, key))
+
+	data := []byte("Hello world!")
+
+	encryptedData, err := ks.Encrypt(data)
+	require.NoError(err)
+
+	inputData := append([]byte(nil), encryptedData...)
+
+	decryptedData, err := ks.Decrypt(inputData)
+	require.NoError(err)
+	assert.Equal(data, decryptedData)
+	assert.Equal(encryptedData, inputData)
+
+	// The version header is authenticated, even when the key is the same
+	tamperedData := append([]byte(nil), encryptedData...)
+	tamperedData[KeySetHeaderSize-1] = 1
+
+	_, err = ks.Decrypt(tamperedData)
+	assert.Error(err)
+
+	tamperedData = append([]byte(nil), encryptedData...)
+	tamperedData[len(tamperedData)-1] ^= 0x01
+
+	_, err = ks.Decrypt(tamperedData)
+	assert.Error(err)
+
+	_, err = ks.Decrypt(encryptedData[:KeySetHeaderSize+4])
+	assert.Error(err)
+}
+
+func TestKeySetJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var key1, key2 AES256Key
+	copy(key1[:], RandomBytes(32))
+	copy(key2[:], RandomBytes(32))
+
+	ks := NewKeySet()
+	require.NoError(ks.AddKey(1, key1))
+	require.NoError(ks.AddKey(3, key2))
+
+	data, err := json.Marshal(ks)
+	require.NoError(err)
+
+	var ks2 KeySet
+	require.NoError(json.Unmarshal(data, &ks2))
+
+	assert.Equal([]uint32{1, 3}, ks2.Versions())
+	assert.Equal(uint32(3), ks2.CurrentVersion())
+
+	assert.Error(json.Unmarshal([]byte(`{"foo": ""}`), &ks2))
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcrypto
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+type Argon2idParams struct {
+	Time       uint32
+	Memory     uint32 // kilobytes
+	Threads    uint8
+	KeyLength  uint32 // at most 64 bytes
+	SaltLength int
+}
+
+// Upper bounds of the parameters accepted when verifying argon2id hashes.
+const (
+	maxArgon2idMemory = 4 * 1024 * 1024 // kilobytes
+	maxArgon2idTime   = 100
+)
+
+var DefaultArgon2idParams = Argon2idParams{
+	Time:       1,
+	Memory:     64 * 1024,
+	Threads:    4,
+	KeyLength:  32,
+	SaltLength: 16,
+}
+
+type ScryptParams struct {
+	N          int
+	R          int
+	P          int
+	KeyLength  int // at most 64 bytes
+	SaltLength int
+}
+
+// Upper bounds of the parameters accepted when verifying scrypt hashes.
+const (
+	maxScryptN      = 1 << 20
+	maxScryptRP     = 64
+	maxScryptMemory = 4 * 1024 * 1024 * 1024 // bytes
+)
+
+var DefaultScryptParams = ScryptParams{
+	N:          32768,
+	R:          8,
+	P:          1,
+	KeyLength:  32,
+	SaltLength: 16,
+}
+
+const DefaultBcryptCost = 12
+
+var b64 = base64.RawStdEncoding
+
+// The maximum length of the key of a password hash. The key length is read
+// from stored hashes and determines the amount of data derived when
+// verifying a password.
+const maxPasswordKeyLength = 64 // bytes
+
+func HashPassword(password string) (string, error) {
+	return HashPasswordArgon2id(password, DefaultArgon2idParams)
+}
+
+func HashPasswordArgon2id(password string, params Argon2idParams) (string, error) {
+	salt := RandomBytes(params.SaltLength)
+
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory,
+		params.Threads, params.KeyLength)
+
+	hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		b64.EncodeToString(salt), b64.EncodeToString(key))
+
+	return hash, nil
+}
+
+func HashPasswordScrypt(password string, params ScryptParams) (string, error) {
+	salt := RandomBytes(params.SaltLength)
+
+	key, err := scrypt.Key([]byte(password), salt, params.N, params.R,
+		params.P, params.KeyLength)
+	if err != nil {
+		return "", fmt.Errorf("cannot derive key: %w", err)
+	}
+
+	hash := fmt.Sprintf("$scrypt$n=%d,r=%d,p=%d$%s$%s",
+		params.N, params.R, params.P,
+		b64.EncodeToString(salt), b64.EncodeToString(key))
+
+	return hash, nil
+}
+
+func HashPasswordBcrypt(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+func VerifyPassword(password, hash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyPasswordArgon2id(password, hash)
+
+	case strings.HasPrefix(hash, "$scrypt$"):
+		return verifyPasswordScrypt(password, hash)
+
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"),
+		strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrInvalidPasswordHash, err)
+		}
+
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w: unknown algorithm", ErrInvalidPasswordHash)
+}
+
+func verifyPasswordArgon2id(password, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	if version != argon2.Version {
+		return false, fmt.Errorf("%w: unsupported argon2 version %d",
+			ErrInvalidPasswordHash, version)
+	}
+
+	// Parameters come from stored data and must be validated: argon2
+	// panics with a null time or parallelism, and allocates the memory
+	// requested.
+	var memory, time, threads uint64
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	if memory < 1 || memory > maxArgon2idMemory {
+		return false, fmt.Errorf("%w: invalid argon2 memory %d",
+			ErrInvalidPasswordHash, memory)
+	}
+
+	if time < 1 || time > maxArgon2idTime {
+		return false, fmt.Errorf("%w: invalid argon2 time %d",
+			ErrInvalidPasswordHash, time)
+	}
+
+	if threads < 1 || threads > math.MaxUint8 {
+		return false, fmt.Errorf("%w: invalid argon2 parallelism %d",
+			ErrInvalidPasswordHash, threads)
+	}
+
+	params := Argon2idParams{
+		Memory:  uint32(memory),
+		Time:    uint32(time),
+		Threads: uint8(threads),
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[4], parts[5])
+	if err != nil {
+		return false, err
+	}
+
+	key2 := argon2.IDKey([]byte(password), salt, params.Time, params.Memory,
+		params.Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, key2) == 1, nil
+}
+
+func verifyPasswordScrypt(password, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	var params ScryptParams
+	_, err := fmt.Sscanf(parts[2], "n=%d,r=%d,p=%d",
+		&params.N, &params.R, &params.P)
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	// Parameters come from stored data and must be validated: scrypt
+	// allocates about 128*N*r bytes and its cost grows with N*r*p.
+	if params.N <= 1 || params.N > maxScryptN || params.N&(params.N-1) != 0 {
+		return false, fmt.Errorf("%w: invalid scrypt cost %d",
+			ErrInvalidPasswordHash, params.N)
+	}
+
+	if params.R < 1 || params.P < 1 ||
+		params.R > maxScryptRP || params.P > maxScryptRP ||
+		params.R*params.P > maxScryptRP {
+		return false, fmt.Errorf("%w: invalid scrypt block size %d and "+
+			"parallelism %d", ErrInvalidPasswordHash, params.R, params.P)
+	}
+
+	if 128*int64(params.N)*int64(params.R) > maxScryptMemory {
+		return false, fmt.Errorf("%w: invalid scrypt memory usage",
+			ErrInvalidPasswordHash)
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return false, err
+	}
+
+	key2, err := scrypt.Key([]byte(password), salt, params.N, params.R,
+		params.P, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidPasswordHash, err)
+	}
+
+	return subtle.ConstantTimeCompare(key, key2) == 1, nil
+}
+
+func decodeSaltAndKey(saltString, keyString string) ([]byte, []byte, error) {
+	salt, err := b64.DecodeString(saltString)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid salt", ErrInvalidPasswordHash)
+	}
+
+	key, err := b64.DecodeString(keyString)
+	if err != nil || len(key) == 0 {
+		return nil, nil, fmt.Errorf("%w: invalid key", ErrInvalidPasswordHash)
+	}
+
+	if len(key) > maxPasswordKeyLength {
+		return nil, nil, fmt.Errorf("%w: key too long",
+			ErrInvalidPasswordHash)
+	}
+
+	return salt, key, nil
+}
+
+func DeriveKey(password string, salt []byte, params Argon2idParams) AES256Key {
+	data := argon2.IDKey([]byte(password), salt, params.Time, params.Memory,
+		params.Threads, 32)
+
+	var key AES256Key
+	copy(key[:], data)
+
+	return key
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dcrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Time:       1,
+	Memory:     1024,
+	Threads:    1,
+	KeyLength:  32,
+	SaltLength: 16,
+}
+
+var testScryptParams = ScryptParams{
+	N:          1024,
+	R:          8,
+	P:          1,
+	KeyLength:  32,
+	SaltLength: 16,
+}
+
+func TestPasswordHash(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hashFuncs := map[string]func(string) (string, error){
+		"argon2id": func(password string) (string, error) {
+			return HashPasswordArgon2id(password, testArgon2idParams)
+		},
+		"scrypt": func(password string) (string, error) {
+			return HashPasswordScrypt(password, testScryptParams)
+		},
+		"bcrypt": func(password string) (string, error) {
+			return HashPasswordBcrypt(password, 4)
+		},
+	}
+
+	for name, hashFunc := range hashFuncs {
+		hash, err := hashFunc("foo")
+		require.NoError(err, name)
+
+		valid, err := VerifyPassword("foo", hash)
+		require.NoError(err, name)
+		assert.True(valid, name)
+
+		valid, err = VerifyPassword("bar", hash)
+		require.NoError(err, name)
+		assert.False(valid, name)
+	}
+}
+
+func TestPasswordHashInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	hashes := []string{
+		"",
+		"foo",
+		"$argon2id$v=19$m=1024,t=1,p=1$",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=256$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1000000,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=99999999999,t=1,p=1$c2FsdA$a2V5",
+		"$scrypt$n=1024,r=8$c2FsdA$a2V5",
+		"$scrypt$n=1024,r=8,p=1$c2FsdA$",
+		"$scrypt$n=1,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$n=1000,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$n=1024,r=0,p=1$c2FsdA$a2V5",
+		"$scrypt$n=1024,r=8,p=0$c2FsdA$a2V5",
+		"$scrypt$n=1024,r=64,p=64$c2FsdA$a2V5",
+		"$scrypt$n=1073741824,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$n=4611686018427387904,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$n=1048576,r=64,p=1$c2FsdA$a2V5",
+	}
+
+	// Keys longer than 64 bytes
+	longKey := b64.EncodeToString(make([]byte, 65))
+	hashes = append(hashes,
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$"+longKey,
+		"$scrypt$n=1024,r=8,p=1$c2FsdA$"+longKey)
+
+	for _, hash := range hashes {
+		_, err := VerifyPassword("foo", hash)
+		assert.ErrorIs(err, ErrInvalidPasswordHash, hash)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	assert := assert.New(t)
+
+	salt := []byte("0123456789abcdef")
+
+	key1 := DeriveKey("foo", salt, testArgon2idParams)
+	key2 := DeriveKey("foo", salt, testArgon2idParams)
+	key3 := DeriveKey("bar", salt, testArgon2idParams)
+
+	assert.False(key1.IsZero())
+	assert.Equal(key1, key2)
+	assert.NotEqual(key1, key3)
+}
@@ -2,6 +2,7 @@ package dcrypto
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -14,3 +15,7 @@ func RandomBytes(n int) []byte {
 
 	return data
 }
+
+func RandomHexString(n int) string {
+	return hex.EncodeToString(RandomBytes(n))
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package derr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Codes shared by all packages. Packages can define their own codes for
+// more specific failures.
+const (
+	CodeInternal     = "internal"
+	CodeInvalidInput = "invalid_input"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeUnavailable  = "unavailable"
+	CodeTimeout      = "timeout"
+)
+
+// Error is an error associated with a code which can be used to identify
+// classes of failures.
+type Error struct {
+	Code      string
+	Message   string
+	Data      map[string]interface{}
+	Retryable bool
+
+	Err error
+}
+
+func New(code, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Wrap creates an error wrapping another error. The message of the wrapped
+// error is appended to the message.
+func Wrap(err error, code, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Err:     err,
+	}
+}
+
+func (err *Error) Error() string {
+	if err.Err == nil {
+		return err.Message
+	}
+
+	if err.Message == "" {
+		return err.Err.Error()
+	}
+
+	return err.Message + ": " + err.Err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// WithData returns a copy of the error with an additional data entry.
+func (err *Error) WithData(key string, value interface{}) *Error {
+	err2 := *err
+
+	err2.Data = make(map[string]interface{}, len(err.Data)+1)
+	for k, v := range err.Data {
+		err2.Data[k] = v
+	}
+
+	err2.Data[key] = value
+
+	return &err2
+}
+
+// WithRetryable returns a copy of the error with the retryable flag set.
+func (err *Error) WithRetryable(retryable bool) *Error {
+	err2 := *err
+	err2.Retryable = retryable
+	return &err2
+}
+
+// As returns the first error of the chain which is an *Error.
+func As(err error) (*Error, bool) {
+	var derr *Error
+	ok := errors.As(err, &derr)
+	return derr, ok
+}
+
+// Code returns the code of the first *Error in the chain, or an empty
+// string if there is none.
+func Code(err error) string {
+	if derr, ok := As(err); ok {
+		return derr.Code
+	}
+
+	return ""
+}
+
+// HasCode returns true if any error of the chain is an *Error with a
+// specific code.
+func HasCode(err error, code string) bool {
+	for err != nil {
+		if derr, ok := err.(*Error); ok && derr.Code == code {
+			return true
+		}
+
+		err = errors.Unwrap(err)
+	}
+
+	return false
+}
+
+// IsRetryable returns true if any error of the chain is a retryable *Error.
+func IsRetryable(err error) bool {
+	for err != nil {
+		if derr, ok := err.(*Error); ok && derr.Retryable {
+			return true
+		}
+
+		err = errors.Unwrap(err)
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package derr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	assert := assert.New(t)
+
+	baseErr := errors.New("connection refused")
+
+	err := Wrap(baseErr, CodeUnavailable, "cannot connect to %s", "db").
+		WithRetryable(true).
+		WithData("host", "db")
+
+	assert.Equal("cannot connect to db: connection refused", err.Error())
+	assert.True(errors.Is(err, baseErr))
+
+	wrappedErr := fmt.Errorf("cannot load users: %w", err)
+
+	assert.Equal(CodeUnavailable, Code(wrappedErr))
+	assert.True(HasCode(wrappedErr, CodeUnavailable))
+	assert.False(HasCode(wrappedErr, CodeNotFound))
+	assert.True(IsRetryable(wrappedErr))
+
+	if derr, ok := As(wrappedErr); assert.True(ok) {
+		assert.Equal("db", derr.Data["host"])
+	}
+
+	assert.Equal("", Code(baseErr))
+	assert.False(IsRetryable(baseErr))
+
+	notFoundErr := New(CodeNotFound, "user not found")
+	assert.False(notFoundErr.Retryable)
+	assert.True(errors.Is(fmt.Errorf("%w", notFoundErr), notFoundErr))
+}
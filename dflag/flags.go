@@ -0,0 +1,333 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dflag
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+type Type string
+
+const (
+	TypeBool       Type = "bool"
+	TypeInt        Type = "int"
+	TypeString     Type = "string"
+	TypePercentage Type = "percentage"
+)
+
+// Cfg contains flag values indexed by flag name. Percentage values are
+// numbers between 0 and 100.
+type Cfg map[string]interface{}
+
+type Flag struct {
+	Name        string      `json:"name"`
+	Type        Type        `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default"`
+
+	flags *Flags
+}
+
+type FlagState struct {
+	*Flag
+
+	CfgValue      interface{} `json:"cfg_value,omitempty"`
+	OverrideValue interface{} `json:"override_value,omitempty"`
+	Value         interface{} `json:"value"`
+}
+
+type Flags struct {
+	Cfg Cfg
+
+	flags     map[string]*Flag
+	overrides map[string]interface{}
+	mutex     sync.RWMutex
+}
+
+func NewFlags(cfg Cfg) *Flags {
+	return &Flags{
+		Cfg: cfg,
+
+		flags:     make(map[string]*Flag),
+		overrides: make(map[string]interface{}),
+	}
+}
+
+func (fs *Flags) declare(name string, flagType Type, defaultValue interface{}, description string) *Flag {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, found := fs.flags[name]; found {
+		panic(fmt.Sprintf("duplicate flag %q", name))
+	}
+
+	f := Flag{
+		Name:        name,
+		Type:        flagType,
+		Description: description,
+		Default:     defaultValue,
+
+		flags: fs,
+	}
+
+	fs.flags[name] = &f
+
+	return &f
+}
+
+func (fs *Flags) Bool(name string, defaultValue bool, description string) *BoolFlag {
+	return &BoolFlag{fs.declare(name, TypeBool, defaultValue, description)}
+}
+
+func (fs *Flags) Int(name string, defaultValue int, description string) *IntFlag {
+	return &IntFlag{fs.declare(name, TypeInt, defaultValue, description)}
+}
+
+func (fs *Flags) String(name string, defaultValue string, description string) *StringFlag {
+	return &StringFlag{fs.declare(name, TypeString, defaultValue, description)}
+}
+
+func (fs *Flags) Percentage(name string, defaultValue float64, description string) *PercentageFlag {
+	if _, err := convertValue(TypePercentage, defaultValue); err != nil {
+		panic(fmt.Sprintf("invalid default value for flag %q: %v", name, err))
+	}
+
+	return &PercentageFlag{
+		fs.declare(name, TypePercentage, defaultValue, description),
+	}
+}
+
+// Validate checks that all configuration values refer to declared flags and
+// have the right type. It must be called once all flags have been declared.
+func (fs *Flags) Validate() error {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	for name, value := range fs.Cfg {
+		f, found := fs.flags[name]
+		if !found {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+
+		if _, err := convertValue(f.Type, value); err != nil {
+			return fmt.Errorf("invalid value for flag %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (fs *Flags) Flag(name string) *Flag {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	return fs.flags[name]
+}
+
+func (fs *Flags) States() []FlagState {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	states := make([]FlagState, 0, len(fs.flags))
+
+	for _, f := range fs.flags {
+		state := FlagState{
+			Flag:          f,
+			OverrideValue: fs.overrides[f.Name],
+			Value:         fs.value(f),
+		}
+
+		if value, err := convertValue(f.Type, fs.Cfg[f.Name]); err == nil {
+			state.CfgValue = value
+		}
+
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+
+	return states
+}
+
+// SetOverride sets a value which takes precedence over both the configuration
+// and the default value of a flag.
+func (fs *Flags) SetOverride(name string, value interface{}) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	f, found := fs.flags[name]
+	if !found {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+
+	value, err := convertValue(f.Type, value)
+	if err != nil {
+		return err
+	}
+
+	fs.overrides[name] = value
+
+	return nil
+}
+
+func (fs *Flags) UnsetOverride(name string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	delete(fs.overrides, name)
+}
+
+func (fs *Flags) value(f *Flag) interface{} {
+	if value, found := fs.overrides[f.Name]; found {
+		return value
+	}
+
+	if value, found := fs.Cfg[f.Name]; found {
+		if value, err := convertValue(f.Type, value); err == nil {
+			return value
+		}
+	}
+
+	return f.Default
+}
+
+func (f *Flag) Value() interface{} {
+	f.flags.mutex.RLock()
+	defer f.flags.mutex.RUnlock()
+
+	return f.flags.value(f)
+}
+
+type BoolFlag struct {
+	*Flag
+}
+
+func (f *BoolFlag) Value() bool {
+	return f.Flag.Value().(bool)
+}
+
+type IntFlag struct {
+	*Flag
+}
+
+func (f *IntFlag) Value() int {
+	return f.Flag.Value().(int)
+}
+
+type StringFlag struct {
+	*Flag
+}
+
+func (f *StringFlag) Value() string {
+	return f.Flag.Value().(string)
+}
+
+type PercentageFlag struct {
+	*Flag
+}
+
+func (f *PercentageFlag) Value() float64 {
+	return f.Flag.Value().(float64)
+}
+
+// Enabled returns true if the key falls in the rollout percentage of the
+// flag. A given key is always assigned to the same bucket for a flag, so
+// that increasing the percentage never disables the flag for a key.
+func (f *PercentageFlag) Enabled(key string) bool {
+	return float64(Bucket(f.Name, key)) < f.Value()*100.0
+}
+
+// Bucket returns a number between 0 and 9999 derived from a flag name and a
+// key.
+func Bucket(name, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % 10000)
+}
+
+func convertValue(flagType Type, value interface{}) (interface{}, error) {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %w", err)
+		}
+
+		value = f
+	}
+
+	switch flagType {
+	case TypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+
+		return nil, fmt.Errorf("value is not a boolean")
+
+	case TypeInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("value is not an integer")
+			}
+
+			return int(v), nil
+		}
+
+		return nil, fmt.Errorf("value is not an integer")
+
+	case TypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+
+		return nil, fmt.Errorf("value is not a string")
+
+	case TypePercentage:
+		var p float64
+
+		switch v := value.(type) {
+		case int:
+			p = float64(v)
+		case int64:
+			p = float64(v)
+		case float64:
+			p = v
+		default:
+			return nil, fmt.Errorf("value is not a number")
+		}
+
+		if p < 0.0 || p > 100.0 {
+			return nil, fmt.Errorf("value is not between 0 and 100")
+		}
+
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("unknown flag type %q", flagType)
+}
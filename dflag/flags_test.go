@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dflag
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlags(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	flags := NewFlags(Cfg{
+		"b": true,
+		"i": 42.0,
+	})
+
+	b := flags.Bool("b", false, "")
+	i := flags.Int("i", 1, "")
+	s := flags.String("s", "foo", "")
+
+	require.NoError(flags.Validate())
+
+	assert.Equal(true, b.Value())
+	assert.Equal(42, i.Value())
+	assert.Equal("foo", s.Value())
+
+	require.NoError(flags.SetOverride("i", 3.0))
+	assert.Equal(3, i.Value())
+	assert.Error(flags.SetOverride("i", 3.5))
+	assert.Error(flags.SetOverride("s", 1.0))
+	assert.Error(flags.SetOverride("unknown", 1.0))
+
+	flags.UnsetOverride("i")
+	assert.Equal(42, i.Value())
+}
+
+func TestFlagsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	flags := NewFlags(Cfg{"b": "yes"})
+	flags.Bool("b", false, "")
+	assert.Error(flags.Validate())
+
+	flags = NewFlags(Cfg{"unknown": true})
+	assert.Error(flags.Validate())
+}
+
+func TestPercentageFlag(t *testing.T) {
+	assert := assert.New(t)
+
+	flags := NewFlags(Cfg{"p": 25.0})
+	p := flags.Percentage("p", 0.0, "")
+
+	nbEnabled := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+
+		enabled := p.Enabled(key)
+		assert.Equal(enabled, p.Enabled(key))
+
+		if enabled {
+			nbEnabled++
+		}
+	}
+
+	assert.InDelta(2500, nbEnabled, 200)
+
+	flags.SetOverride("p", 100.0)
+	assert.True(p.Enabled("foo"))
+
+	flags.SetOverride("p", 0.0)
+	assert.False(p.Enabled("foo"))
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dgrpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/influx"
+	"github.com/exograd/go-daemon/ksuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey struct{}
+
+var contextKeyLogger = contextKey{}
+
+// Logger returns the logger associated with a request, or nil if there is
+// none.
+func Logger(ctx context.Context) *dlog.Logger {
+	value := ctx.Value(contextKeyLogger)
+	if value == nil {
+		return nil
+	}
+
+	return value.(*dlog.Logger)
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+	ctx, log := s.requestContext(ctx, info.FullMethod)
+
+	start := time.Now()
+
+	defer func() {
+		if value := recover(); value != nil {
+			err = s.handlePanic(log, value)
+		}
+
+		s.logRequest(log, info.FullMethod, start, err)
+	}()
+
+	return handler(ctx, req)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, log := s.requestContext(ss.Context(), info.FullMethod)
+
+	start := time.Now()
+
+	defer func() {
+		if value := recover(); value != nil {
+			err = s.handlePanic(log, value)
+		}
+
+		s.logRequest(log, info.FullMethod, start, err)
+	}()
+
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *Server) requestContext(ctx context.Context, method string) (context.Context, *dlog.Logger) {
+	log := s.Log.Child("", dlog.Data{"method": method})
+
+	if p, found := peer.FromContext(ctx); found {
+		log.Data["address"] = p.Addr.String()
+	}
+
+	var requestId string
+	if md, found := metadata.FromIncomingContext(ctx); found {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			requestId = values[0]
+		}
+	}
+
+	if requestId == "" {
+		requestId = ksuid.Generate().String()
+	}
+
+	log.Data["request_id"] = requestId
+
+	ctx = dhttp.ContextWithRequestId(ctx, requestId)
+	ctx = context.WithValue(ctx, contextKeyLogger, log)
+
+	return ctx, log
+}
+
+func (s *Server) handlePanic(log *dlog.Logger, value interface{}) error {
+	var msg string
+
+	switch v := value.(type) {
+	case error:
+		msg = v.Error()
+	case string:
+		msg = v
+	default:
+		msg = fmt.Sprintf("%#v", v)
+	}
+
+	buf := make([]byte, 4096)
+	n := runtime.Stack(buf, false)
+	buf = buf[0 : n-1]
+
+	log.Error("panic: %s\n%s", msg, string(buf))
+
+	atomic.AddInt64(&s.nbPanics, 1)
+
+	if reporter := s.Cfg.ErrorReporter; reporter != nil {
+		data := dlog.MergeData(log.Data, dlog.Data{
+			"stack": string(buf),
+		})
+
+		reporter.ReportError("panic: "+msg, data)
+	}
+
+	return status.Errorf(codes.Internal, "internal error")
+}
+
+func (s *Server) logRequest(log *dlog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	duration := time.Since(start)
+
+	if s.Cfg.Influx != nil {
+		tags := influx.Tags{
+			"method": method,
+			"code":   code.String(),
+		}
+
+		fields := influx.Fields{
+			"time": duration.Microseconds(),
+		}
+
+		s.Cfg.Influx.EnqueuePoint(influx.NewPoint("grpc_requests", tags, fields))
+	}
+
+	if code == codes.OK && s.Cfg.HideSuccessfulRequests {
+		return
+	}
+
+	data := dlog.Data{
+		"code": code.String(),
+		"time": duration.Microseconds(),
+	}
+
+	if err != nil {
+		log.InfoData(data, "%s %s %s: %v", method, code, formatRequestTime(duration.Seconds()), err)
+	} else {
+		log.InfoData(data, "%s %s %s", method, code, formatRequestTime(duration.Seconds()))
+	}
+}
+
+func formatRequestTime(seconds float64) string {
+	if seconds < 0.001 {
+		return fmt.Sprintf("%dµs", int(math.Ceil(seconds*1e6)))
+	} else if seconds < 1.0 {
+		return fmt.Sprintf("%dms", int(math.Ceil(seconds*1e3)))
+	}
+
+	return fmt.Sprintf("%.1fs", seconds)
+}
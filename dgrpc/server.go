@@ -0,0 +1,221 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dgrpc
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/influx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+type ErrorReporter interface {
+	ReportError(string, dlog.Data)
+}
+
+type ServerCfg struct {
+	Log           *dlog.Logger   `json:"-"`
+	ErrorChan     chan<- error   `json:"-"`
+	ErrorReporter ErrorReporter  `json:"-"`
+	Influx        *influx.Client `json:"-"`
+
+	// Additional options and interceptors, executed after the default ones
+	ServerOptions      []grpc.ServerOption            `json:"-"`
+	UnaryInterceptors  []grpc.UnaryServerInterceptor  `json:"-"`
+	StreamInterceptors []grpc.StreamServerInterceptor `json:"-"`
+
+	Address string `json:"address"`
+
+	TLS *TLSServerCfg `json:"tls,omitempty"`
+
+	Reflection    bool `json:"reflection"`
+	HealthService bool `json:"health_service"`
+
+	HideSuccessfulRequests bool `json:"hide_successful_requests"`
+}
+
+type TLSServerCfg struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+type Server struct {
+	Cfg ServerCfg
+	Log *dlog.Logger
+
+	Server *grpc.Server
+	Health *health.Server
+
+	listener net.Listener
+
+	errorChan chan<- error
+	wg        sync.WaitGroup
+
+	nbPanics int64
+}
+
+func (cfg *ServerCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("address", cfg.Address)
+	c.CheckOptionalObject("tls", cfg.TLS)
+}
+
+func (cfg *TLSServerCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("certificate", cfg.Certificate)
+	c.CheckStringNotEmpty("private_key", cfg.PrivateKey)
+}
+
+func NewServer(cfg ServerCfg) (*Server, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("grpc-server")
+	}
+
+	if cfg.ErrorChan == nil {
+		return nil, fmt.Errorf("missing error channel")
+	}
+
+	if cfg.Address == "" {
+		cfg.Address = "localhost:9090"
+	}
+
+	s := &Server{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		errorChan: cfg.ErrorChan,
+	}
+
+	unaryInterceptors := append([]grpc.UnaryServerInterceptor{
+		s.unaryInterceptor,
+	}, cfg.UnaryInterceptors...)
+
+	streamInterceptors := append([]grpc.StreamServerInterceptor{
+		s.streamInterceptor,
+	}, cfg.StreamInterceptors...)
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+
+	if cfg.TLS != nil {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLS.Certificate,
+			cfg.TLS.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load tls credentials: %w", err)
+		}
+
+		options = append(options, grpc.Creds(creds))
+	}
+
+	options = append(options, cfg.ServerOptions...)
+
+	s.Server = grpc.NewServer(options...)
+
+	if cfg.Reflection {
+		reflection.Register(s.Server)
+	}
+
+	if cfg.HealthService {
+		s.Health = health.NewServer()
+		s.Health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+		healthpb.RegisterHealthServer(s.Server, s.Health)
+	}
+
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.Cfg.Address)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %q: %w", s.Cfg.Address, err)
+	}
+
+	s.Log.Info("listening on %q", listener.Addr().String())
+
+	s.listener = listener
+
+	if s.Health != nil {
+		s.Health.Resume()
+		s.Health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		if err := s.Server.Serve(listener); err != nil {
+			s.Log.Error("cannot serve: %v", err)
+			err2 := fmt.Errorf("grpc server initialization failed: %w", err)
+			s.errorChan <- err2
+		}
+	}()
+
+	return nil
+}
+
+// Address returns the address the server is listening on, which is only
+// known once the server has been started when the configured port is 0.
+func (s *Server) Address() string {
+	if s.listener == nil {
+		return s.Cfg.Address
+	}
+
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Stop() {
+	if s.Health != nil {
+		s.Health.Shutdown()
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.Log.Error("cannot stop server gracefully, closing connections")
+		s.Server.Stop()
+	}
+
+	s.wg.Wait()
+}
+
+func (s *Server) Terminate() {
+}
+
+// NbPanics returns the number of panics recovered in handlers since the
+// server was created.
+func (s *Server) NbPanics() int64 {
+	return atomic.LoadInt64(&s.nbPanics)
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+type AccessLogFormat string
+
+const (
+	AccessLogFormatDlog     AccessLogFormat = "dlog"
+	AccessLogFormatCommon   AccessLogFormat = "common"
+	AccessLogFormatCombined AccessLogFormat = "combined"
+)
+
+var AccessLogFormatValues = []AccessLogFormat{
+	AccessLogFormatDlog,
+	AccessLogFormatCommon,
+	AccessLogFormatCombined,
+}
+
+type AccessLogCfg struct {
+	Disabled bool `json:"disabled,omitempty"`
+
+	Format AccessLogFormat `json:"format,omitempty"`
+
+	// The logger domain used for the dlog format, relative to the domain of
+	// the server logger.
+	Domain string `json:"domain,omitempty"`
+
+	// The file access logs are appended to for the common and combined
+	// formats. Logs are written to the standard output if it is empty.
+	Path string `json:"path,omitempty"`
+
+	// Requests whose path is in this list are not logged.
+	ExcludedPaths []string `json:"excluded_paths,omitempty"`
+}
+
+func (cfg *AccessLogCfg) Check(c *check.Checker) {
+	if cfg.Format != "" {
+		c.CheckStringValue("format", cfg.Format, AccessLogFormatValues)
+	}
+
+	c.WithChild("excluded_paths", func() {
+		for i, path := range cfg.ExcludedPaths {
+			c.CheckStringNotEmpty(i, path)
+		}
+	})
+}
+
+func (s *Server) initAccessLog() error {
+	cfg := &AccessLogCfg{}
+	if s.Cfg.AccessLog != nil {
+		*cfg = *s.Cfg.AccessLog
+	}
+	s.Cfg.AccessLog = cfg
+
+	if cfg.Format == "" {
+		cfg.Format = AccessLogFormatDlog
+	}
+
+	s.accessLogExcludedPaths = make(map[string]struct{})
+	for _, path := range cfg.ExcludedPaths {
+		s.accessLogExcludedPaths[path] = struct{}{}
+	}
+
+	switch cfg.Format {
+	case AccessLogFormatDlog:
+		s.accessLog = s.Log.Child(cfg.Domain, nil)
+
+	case AccessLogFormatCommon, AccessLogFormatCombined:
+		if cfg.Path == "" {
+			s.accessLogWriter = os.Stdout
+		} else {
+			flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+
+			file, err := os.OpenFile(cfg.Path, flags, 0644)
+			if err != nil {
+				return fmt.Errorf("cannot open %q: %w", cfg.Path, err)
+			}
+
+			s.accessLogWriter = file
+		}
+
+	default:
+		return fmt.Errorf("invalid access log format %q", cfg.Format)
+	}
+
+	return nil
+}
+
+func (s *Server) closeAccessLog() {
+	if file, ok := s.accessLogWriter.(*os.File); ok && file != os.Stdout {
+		if err := file.Close(); err != nil {
+			s.Log.Error("cannot close access log file: %v", err)
+		}
+	}
+}
+
+func (h *Handler) DisableAccessLog() {
+	h.accessLogDisabled = true
+}
+
+func (h *Handler) accessLogEnabled() bool {
+	if h.accessLogDisabled || h.Server.Cfg.AccessLog.Disabled {
+		return false
+	}
+
+	_, excluded := h.Server.accessLogExcludedPaths[h.Request.URL.Path]
+	return !excluded
+}
+
+func (h *Handler) writeAccessLogLine(w io.Writer) {
+	req := h.Request
+	rw := h.ResponseWriter.(*ResponseWriter)
+
+	var buf bytes.Buffer
+
+	username := "-"
+	if name, _, ok := req.BasicAuth(); ok && name != "" {
+		username = name
+	}
+
+	status := "-"
+	if rw.Status != 0 {
+		status = strconv.Itoa(rw.Status)
+	}
+
+	fmt.Fprintf(&buf, "%s - %s [%s] %s %s %d",
+		accessLogString(h.ClientAddress), accessLogString(username),
+		h.StartTime.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(req.Method+" "+req.RequestURI+" "+req.Proto),
+		status, rw.ResponseBodySize)
+
+	if h.Server.Cfg.AccessLog.Format == AccessLogFormatCombined {
+		fmt.Fprintf(&buf, " %s %s",
+			strconv.Quote(accessLogString(req.Referer())),
+			strconv.Quote(accessLogString(req.UserAgent())))
+	}
+
+	buf.WriteByte('\n')
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		h.Server.Log.Error("cannot write access log: %v", err)
+	}
+}
+
+func accessLogString(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return strings.Map(func(c rune) rune {
+		if c == ' ' || c < 0x20 || c == 0x7f {
+			return '_'
+		}
+
+		return c
+	}, s)
+}
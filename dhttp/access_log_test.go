@@ -0,0 +1,127 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogCombined(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	logPath := path.Join(t.TempDir(), "access.log")
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		AccessLog: &AccessLogCfg{
+			Format:        AccessLogFormatCombined,
+			Path:          logPath,
+			ExcludedPaths: []string{"/health"},
+		},
+	})
+	require.NoError(err)
+
+	server.Route("/things", "GET", func(h *Handler) {
+		h.Reply(200, strings.NewReader("things"))
+	})
+
+	server.Route("/health", "GET", func(h *Handler) {
+		h.ReplyEmpty(204)
+	})
+
+	server.Route("/quiet", "GET", func(h *Handler) {
+		h.DisableAccessLog()
+		h.ReplyEmpty(204)
+	})
+
+	for _, uri := range []string{"/health", "/quiet", "/things?a=1"} {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.Header.Set("User-Agent", "test agent")
+		req.SetBasicAuth("bob", "secret")
+
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	server.Terminate()
+
+	data, err := os.ReadFile(logPath)
+	require.NoError(err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Equal(1, len(lines))
+
+	assert.Regexp(regexp.MustCompile(`^192\.0\.2\.1 - bob \[[^\]]+\] `+
+		`"GET /things\?a=1 HTTP/1\.1" 200 6 "-" "test_agent"$`), lines[0])
+}
+
+func TestAccessLogDlog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	log, backend := newTestLogger()
+
+	server, err := NewServer(ServerCfg{
+		Log:       log,
+		ErrorChan: make(chan error, 1),
+		AccessLog: &AccessLogCfg{
+			Domain:        "access",
+			ExcludedPaths: []string{"/health"},
+		},
+	})
+	require.NoError(err)
+
+	server.Route("/things", "GET", func(h *Handler) {
+		h.ReplyEmpty(204)
+	})
+
+	server.Route("/health", "GET", func(h *Handler) {
+		h.ReplyEmpty(204)
+	})
+
+	server.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/health", nil))
+	server.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/things", nil))
+
+	var accessLogs []string
+	for _, msg := range backend.Messages() {
+		if _, found := msg.Data["status"]; found {
+			accessLogs = append(accessLogs, msg.Message)
+		}
+	}
+
+	if assert.Equal(1, len(accessLogs)) {
+		assert.True(strings.HasPrefix(accessLogs[0], "GET /things 204"))
+	}
+}
+
+func TestAccessLogCfgCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		AccessLog: &AccessLogCfg{Format: "foo"},
+	})
+	assert.Error(err)
+}
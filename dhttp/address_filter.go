@@ -0,0 +1,176 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+type addressList []*net.IPNet
+
+func parseAddressList(ss []string) (addressList, error) {
+	list := make(addressList, len(ss))
+
+	for i, s := range ss {
+		ipNet, err := parseAddressRange(s)
+		if err != nil {
+			return nil, err
+		}
+
+		list[i] = ipNet
+	}
+
+	return list, nil
+}
+
+// parseAddressRange parses either a CIDR network or a single IP address.
+func parseAddressRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", s)
+		}
+
+		return ipNet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func (l addressList) contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range l {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkAddressList(c *check.Checker, token string, ss []string) {
+	c.WithChild(token, func() {
+		for i, s := range ss {
+			_, err := parseAddressRange(s)
+			c.Check(i, err == nil, "invalid_address",
+				"string must be an ip address or a cidr network")
+		}
+	})
+}
+
+func (s *Server) initAddressFilters() error {
+	var err error
+
+	s.trustedProxies, err = parseAddressList(s.Cfg.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	s.allowedAddresses, err = parseAddressList(s.Cfg.AllowedAddresses)
+	if err != nil {
+		return fmt.Errorf("invalid allowed addresses: %w", err)
+	}
+
+	s.deniedAddresses, err = parseAddressList(s.Cfg.DeniedAddresses)
+	if err != nil {
+		return fmt.Errorf("invalid denied addresses: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) addressAllowed(address string) bool {
+	if s.deniedAddresses.contains(address) {
+		return false
+	}
+
+	if len(s.allowedAddresses) > 0 {
+		return s.allowedAddresses.contains(address)
+	}
+
+	return true
+}
+
+func (s *Server) handleAddressFilters(h *Handler) bool {
+	if s.addressAllowed(h.ClientAddress) {
+		return false
+	}
+
+	h.ReplyError(403, "forbidden_address", "client address not allowed")
+
+	return true
+}
+
+// requestClientAddress returns the address of the client. Forwarding headers
+// are only used if the request was sent by a trusted proxy; in that case, the
+// client address is the rightmost address of the X-Forwarded-For header which
+// is not itself a trusted proxy. Forwarding headers containing invalid
+// addresses are ignored.
+func (s *Server) requestClientAddress(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+
+	if !s.trustedProxies.contains(host) {
+		return host
+	}
+
+	// Each proxy can either append its address to an existing header field
+	// or add a new field.
+	if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		addresses := strings.Split(strings.Join(values, ","), ",")
+
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+
+			if net.ParseIP(address) == nil {
+				return host
+			}
+
+			if !s.trustedProxies.contains(address) || i == 0 {
+				return address
+			}
+		}
+	}
+
+	if v := strings.TrimSpace(req.Header.Get("X-Real-IP")); v != "" {
+		if net.ParseIP(v) != nil && !s.trustedProxies.contains(v) {
+			return v
+		}
+	}
+
+	return host
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestClientAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	server := &Server{}
+
+	var err error
+	server.trustedProxies, err = parseAddressList([]string{
+		"10.0.0.0/8", "192.168.1.1",
+	})
+	require.NoError(t, err)
+
+	address := func(remoteAddr string, header map[string]string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+
+		return server.requestClientAddress(req)
+	}
+
+	assert.Equal("1.2.3.4", address("1.2.3.4:1234", nil))
+	assert.Equal("1.2.3.4", address("1.2.3.4:1234",
+		map[string]string{"X-Forwarded-For": "5.6.7.8"}))
+	assert.Equal("5.6.7.8", address("10.1.2.3:1234",
+		map[string]string{"X-Forwarded-For": "5.6.7.8"}))
+	assert.Equal("5.6.7.8", address("10.1.2.3:1234",
+		map[string]string{"X-Forwarded-For": "9.9.9.9, 5.6.7.8, 192.168.1.1"}))
+	assert.Equal("5.6.7.8", address("192.168.1.1:1234",
+		map[string]string{"X-Real-IP": "5.6.7.8"}))
+	assert.Equal("192.168.1.1", address("192.168.1.1:1234",
+		map[string]string{"X-Real-IP": "foo"}))
+	assert.Equal("192.168.1.1", address("192.168.1.1:1234",
+		map[string]string{"X-Real-IP": "10.1.2.3"}))
+	assert.Equal("10.1.2.3", address("10.1.2.3:1234",
+		map[string]string{"X-Forwarded-For": "5.6.7.8, foo"}))
+
+	// Multiple header fields
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Add("X-Forwarded-For", "9.9.9.9, 5.6.7.8")
+	req.Header.Add("X-Forwarded-For", "10.4.5.6")
+	assert.Equal("5.6.7.8", server.requestClientAddress(req))
+}
+
+func TestAddressFilters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:        make(chan error, 1),
+		AllowedAddresses: []string{"10.0.0.0/8"},
+		DeniedAddresses:  []string{"10.0.0.1"},
+	})
+	require.NoError(err)
+
+	server.Route("/foo", "GET", func(h *Handler) { h.ReplyEmpty(204) })
+
+	call := func(remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/foo", nil)
+		req.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(204, call("10.0.0.2:1234"))
+	assert.Equal(403, call("10.0.0.1:1234"))
+	assert.Equal(403, call("1.2.3.4:1234"))
+
+	_, err = NewServer(ServerCfg{
+		ErrorChan:       make(chan error, 1),
+		DeniedAddresses: []string{"foo"},
+	})
+	assert.Error(err)
+}
@@ -16,18 +16,25 @@ package dhttp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type APIRequestError struct {
 	Status   int
 	APIError *APIError
 	Message  string
+
+	// The delay indicated by the Retry-After header of the response, if
+	// there is one.
+	RetryAfter time.Duration
 }
 
 func (err APIRequestError) Error() string {
@@ -45,7 +52,12 @@ func NewAPIClient(c *Client) *APIClient {
 }
 
 func (c *APIClient) SendRequest(method string, uri *url.URL, header map[string]string, body io.Reader) (*http.Response, error) {
-	res, err := c.Client.SendRequest(method, uri, header, body)
+	ctx := context.Background()
+	return c.SendRequestContext(ctx, method, uri, header, body)
+}
+
+func (c *APIClient) SendRequestContext(ctx context.Context, method string, uri *url.URL, header map[string]string, body io.Reader) (*http.Response, error) {
+	res, err := c.Client.SendRequestContext(ctx, method, uri, header, body)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +68,7 @@ func (c *APIClient) SendRequest(method string, uri *url.URL, header map[string]s
 			APIError: nil,
 			Message: fmt.Sprintf("request failed with status %d",
 				res.StatusCode),
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
 		}
 
 		resBody, err := ioutil.ReadAll(res.Body)
@@ -84,6 +97,11 @@ func (c *APIClient) SendRequest(method string, uri *url.URL, header map[string]s
 }
 
 func (c *APIClient) SendJSONRequest(method string, uri *url.URL, header map[string]string, value interface{}) (*http.Response, error) {
+	ctx := context.Background()
+	return c.SendJSONRequestContext(ctx, method, uri, header, value)
+}
+
+func (c *APIClient) SendJSONRequestContext(ctx context.Context, method string, uri *url.URL, header map[string]string, value interface{}) (*http.Response, error) {
 	var body io.Reader
 
 	if value != nil {
@@ -105,5 +123,58 @@ func (c *APIClient) SendJSONRequest(method string, uri *url.URL, header map[stri
 		header["Content-Type"] = "application/json"
 	}
 
-	return c.SendRequest(method, uri, header, body)
+	return c.SendRequestContext(ctx, method, uri, header, body)
+}
+
+func (c *APIClient) GetJSON(ctx context.Context, uriPath string, dest interface{}) error {
+	return c.RequestJSON(ctx, "GET", uriPath, nil, dest)
+}
+
+func (c *APIClient) PostJSON(ctx context.Context, uriPath string, value, dest interface{}) error {
+	return c.RequestJSON(ctx, "POST", uriPath, value, dest)
+}
+
+func (c *APIClient) PutJSON(ctx context.Context, uriPath string, value, dest interface{}) error {
+	return c.RequestJSON(ctx, "PUT", uriPath, value, dest)
+}
+
+func (c *APIClient) DeleteJSON(ctx context.Context, uriPath string, dest interface{}) error {
+	return c.RequestJSON(ctx, "DELETE", uriPath, nil, dest)
+}
+
+func (c *APIClient) RequestJSON(ctx context.Context, method, uriPath string, value, dest interface{}) error {
+	uri, err := c.ResolveURI(uriPath)
+	if err != nil {
+		return err
+	}
+
+	header := map[string]string{
+		"Accept": "application/json",
+	}
+
+	res, err := c.SendJSONRequestContext(ctx, method, uri, header, value)
+	if err != nil {
+		if res != nil {
+			res.Body.Close()
+		}
+
+		return err
+	}
+	defer res.Body.Close()
+
+	// Successful responses without body, e.g. 202 responses, leave the
+	// destination unmodified.
+	if dest == nil || res.StatusCode == 204 || res.ContentLength == 0 {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(dest); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		return fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,130 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAPIItem struct {
+	Name string `json:"name"`
+}
+
+func TestAPIClientJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.URL.Path == "/api/items/1" && req.Method == "GET":
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(testAPIItem{Name: "foo"})
+
+			case req.URL.Path == "/api/items" && req.Method == "POST":
+				if req.Header.Get("Content-Type") != "application/json" {
+					w.WriteHeader(415)
+					return
+				}
+
+				var item testAPIItem
+				json.NewDecoder(req.Body).Decode(&item)
+				item.Name += "-created"
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(201)
+				json.NewEncoder(w).Encode(item)
+
+			case req.URL.Path == "/api/items/1" && req.Method == "DELETE":
+				w.WriteHeader(204)
+
+			case req.URL.Path == "/api/items/1/archive":
+				w.WriteHeader(202)
+
+			case req.URL.Path == "/api/items/1/restore":
+				// Chunked response without any data
+				w.WriteHeader(200)
+				w.(http.Flusher).Flush()
+
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(APIError{
+					Message: "item not found",
+					Code:    "not_found",
+				})
+			}
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{BaseURI: server.URL + "/api"})
+	require.NoError(err)
+	defer client.Terminate()
+
+	apiClient := NewAPIClient(client)
+
+	ctx := context.Background()
+
+	var item testAPIItem
+	if assert.NoError(apiClient.GetJSON(ctx, "/items/1", &item)) {
+		assert.Equal("foo", item.Name)
+	}
+
+	var createdItem testAPIItem
+	err = apiClient.PostJSON(ctx, "/items", testAPIItem{Name: "bar"},
+		&createdItem)
+	if assert.NoError(err) {
+		assert.Equal("bar-created", createdItem.Name)
+	}
+
+	assert.NoError(apiClient.DeleteJSON(ctx, "/items/1", &item))
+
+	item = testAPIItem{}
+	assert.NoError(apiClient.PostJSON(ctx, "/items/1/archive", nil, &item))
+	assert.NoError(apiClient.PostJSON(ctx, "/items/1/restore", nil, &item))
+	assert.Equal(testAPIItem{}, item)
+
+	err = apiClient.GetJSON(ctx, "/items/2", &item)
+	var reqErr *APIRequestError
+	if assert.True(errors.As(err, &reqErr)) {
+		assert.Equal(404, reqErr.Status)
+		if assert.NotNil(reqErr.APIError) {
+			assert.Equal("not_found", reqErr.APIError.Code)
+		}
+	}
+}
+
+func TestAPIClientJSONWithoutBaseURI(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client, err := NewClient(ClientCfg{})
+	require.NoError(err)
+	defer client.Terminate()
+
+	apiClient := NewAPIClient(client)
+
+	var item testAPIItem
+	err = apiClient.GetJSON(context.Background(), "/items/1", &item)
+	assert.Error(err)
+}
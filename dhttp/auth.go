@@ -0,0 +1,114 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the identity associated with an authenticated request.
+type Principal struct {
+	Id     string                 `json:"id"`
+	Type   string                 `json:"type,omitempty"`
+	Scopes []string               `json:"scopes,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticator extracts a principal from a request. It returns nil without
+// error if the request does not contain credentials it supports, and an
+// error (usually wrapping ErrInvalidCredentials) if credentials are present
+// but invalid.
+type Authenticator interface {
+	Authenticate(*Handler) (*Principal, error)
+}
+
+type AuthenticatorFunc func(*Handler) (*Principal, error)
+
+func (fn AuthenticatorFunc) Authenticate(h *Handler) (*Principal, error) {
+	return fn(h)
+}
+
+// RequireAuth indicates that requests must be authenticated and that the
+// principal must have all listed scopes.
+func (r *Route) RequireAuth(scopes ...string) *Route {
+	r.AuthRequired = true
+	r.AuthScopes = append(r.AuthScopes, scopes...)
+	return r
+}
+
+func (h *Handler) Principal() *Principal {
+	return h.principal
+}
+
+// BearerToken returns the token contained in the Authorization header if it
+// uses the bearer scheme.
+func (h *Handler) BearerToken() string {
+	value := h.Request.Header.Get("Authorization")
+
+	if len(value) < 7 || !strings.EqualFold(value[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(value[7:])
+}
+
+func (s *Server) authenticate(h *Handler, route *Route) bool {
+	for _, authenticator := range s.Cfg.Authenticators {
+		principal, err := authenticator.Authenticate(h)
+		if err != nil {
+			h.Log.Info("authentication failed: %v", err)
+			h.ReplyError(401, "invalid_credentials", "invalid credentials")
+			return false
+		}
+
+		if principal != nil {
+			h.principal = principal
+			h.Log.Data["principal"] = principal.Id
+			break
+		}
+	}
+
+	if !route.AuthRequired {
+		return true
+	}
+
+	if h.principal == nil {
+		h.ReplyError(401, "missing_credentials", "missing credentials")
+		return false
+	}
+
+	for _, scope := range route.AuthScopes {
+		if !h.principal.HasScope(scope) {
+			h.ReplyError(403, "insufficient_scope",
+				"missing scope %q", scope)
+			return false
+		}
+	}
+
+	return true
+}
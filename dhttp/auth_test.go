@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthentication(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	authenticator := AuthenticatorFunc(func(h *Handler) (*Principal, error) {
+		switch h.BearerToken() {
+		case "":
+			return nil, nil
+		case "reader":
+			return &Principal{Id: "a", Scopes: []string{"read"}}, nil
+		case "writer":
+			return &Principal{Id: "b", Scopes: []string{"read", "write"}}, nil
+		default:
+			return nil, ErrInvalidCredentials
+		}
+	})
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:      make(chan error, 1),
+		Authenticators: []Authenticator{authenticator},
+	})
+	require.NoError(err)
+
+	reply := func(h *Handler) {
+		id := ""
+		if p := h.Principal(); p != nil {
+			id = p.Id
+		}
+
+		h.ReplyJSON(200, id)
+	}
+
+	server.Route("/public", "GET", reply)
+	server.Route("/private", "POST", reply).RequireAuth("write")
+
+	call := func(method, path, token string) (int, string) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		var value string
+		if w.Code == 200 {
+			json.Unmarshal(w.Body.Bytes(), &value)
+		} else {
+			var apiErr APIError
+			json.Unmarshal(w.Body.Bytes(), &apiErr)
+			value = apiErr.Code
+		}
+
+		return w.Code, value
+	}
+
+	status, value := call("GET", "/public", "")
+	assert.Equal(200, status)
+	assert.Equal("", value)
+
+	status, value = call("GET", "/public", "reader")
+	assert.Equal(200, status)
+	assert.Equal("a", value)
+
+	status, value = call("GET", "/public", "foo")
+	assert.Equal(401, status)
+	assert.Equal("invalid_credentials", value)
+
+	status, value = call("POST", "/private", "")
+	assert.Equal(401, status)
+	assert.Equal("missing_credentials", value)
+
+	status, value = call("POST", "/private", "reader")
+	assert.Equal(403, status)
+	assert.Equal("insufficient_scope", value)
+
+	status, value = call("POST", "/private", "writer")
+	assert.Equal(200, status)
+	assert.Equal("b", value)
+}
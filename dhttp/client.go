@@ -25,20 +25,65 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/exograd/go-daemon/check"
 	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
 )
 
 type ClientCfg struct {
 	Log *dlog.Logger `json:"-"`
 
-	LogRequests bool `json:"log_requests"`
+	LogRequests bool           `json:"log_requests"`
+	RequestLog  *RequestLogCfg `json:"request_log,omitempty"`
 
 	TLS *TLSClientCfg `json:"tls"`
 
-	Header http.Header `json:"-"`
+	BaseURI string         `json:"base_uri,omitempty"`
+	Header  http.Header    `json:"header,omitempty"`
+	Query   url.Values     `json:"query,omitempty"`
+	Auth    *ClientAuthCfg `json:"auth,omitempty"`
+
+	Signer RequestSigner `json:"-"`
+
+	// Copy the request id found in the request context, if there is one, to
+	// the X-Request-Id header of outgoing requests.
+	PropagateRequestId bool `json:"propagate_request_id,omitempty"`
+
+	ProxyURI string `json:"proxy_uri,omitempty"`
+
+	DNS *DNSCfg `json:"dns,omitempty"`
+
+	Destinations *DestinationsCfg `json:"destinations,omitempty"`
+
+	Cache       *ClientCacheCfg       `json:"cache,omitempty"`
+	Compression *ClientCompressionCfg `json:"compression,omitempty"`
+
+	GraphQL *GraphQLCfg `json:"graphql,omitempty"`
+
+	MaxIdleConns    int `json:"max_idle_conns,omitempty"`
+	MaxConnsPerHost int `json:"max_conns_per_host,omitempty"`
+
+	Timeout               dtime.Duration `json:"timeout,omitempty"`
+	DialTimeout           dtime.Duration `json:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   dtime.Duration `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout dtime.Duration `json:"response_header_timeout,omitempty"`
+	IdleConnTimeout       dtime.Duration `json:"idle_conn_timeout,omitempty"`
+}
+
+type ClientAuthCfg struct {
+	BearerToken string `json:"bearer_token,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+}
+
+type RequestLogCfg struct {
+	Headers         bool     `json:"headers"`
+	Bodies          bool     `json:"bodies"`
+	MaxBodySize     int      `json:"max_body_size,omitempty"`
+	RedactedHeaders []string `json:"redacted_headers,omitempty"`
 }
 
 type TLSClientCfg struct {
@@ -52,11 +97,69 @@ type Client struct {
 
 	Client *http.Client
 
-	tlsCfg *tls.Config
+	BaseURI *url.URL
+
+	roundTripper *RoundTripper
+
+	tlsCfg            *tls.Config
+	resolver          *dnsResolver
+	destinationPolicy *destinationPolicy
 }
 
 func (cfg *ClientCfg) Check(c *check.Checker) {
+	c.CheckOptionalObject("request_log", cfg.RequestLog)
 	c.CheckOptionalObject("tls", cfg.TLS)
+
+	if cfg.BaseURI != "" {
+		c.CheckStringHTTPURI("base_uri", cfg.BaseURI)
+	}
+
+	c.CheckOptionalObject("auth", cfg.Auth)
+
+	if cfg.ProxyURI != "" {
+		c.CheckStringHTTPURI("proxy_uri", cfg.ProxyURI)
+	}
+
+	c.CheckOptionalObject("dns", cfg.DNS)
+	c.CheckOptionalObject("destinations", cfg.Destinations)
+
+	if cfg.Destinations != nil && cfg.ProxyURI != "" {
+		c.AddError("destinations", "incompatible_proxy",
+			"destinations cannot be restricted when a proxy is used")
+	}
+	c.CheckOptionalObject("cache", cfg.Cache)
+	c.CheckOptionalObject("compression", cfg.Compression)
+	c.CheckOptionalObject("graphql", cfg.GraphQL)
+
+	c.CheckIntMin("max_idle_conns", cfg.MaxIdleConns, 0)
+	c.CheckIntMin("max_conns_per_host", cfg.MaxConnsPerHost, 0)
+
+	c.CheckDurationMin("timeout", cfg.Timeout.Duration(), 0)
+	c.CheckDurationMin("dial_timeout", cfg.DialTimeout.Duration(), 0)
+	c.CheckDurationMin("tls_handshake_timeout",
+		cfg.TLSHandshakeTimeout.Duration(), 0)
+	c.CheckDurationMin("response_header_timeout",
+		cfg.ResponseHeaderTimeout.Duration(), 0)
+	c.CheckDurationMin("idle_conn_timeout", cfg.IdleConnTimeout.Duration(), 0)
+}
+
+func (cfg *ClientAuthCfg) Check(c *check.Checker) {
+	if cfg.BearerToken != "" {
+		c.Check("username", cfg.Username == "", "incompatible_auth",
+			"bearer token and basic authentication are mutually exclusive")
+	} else {
+		c.CheckStringNotEmpty("username", cfg.Username)
+	}
+}
+
+func (cfg *RequestLogCfg) Check(c *check.Checker) {
+	c.CheckIntMin("max_body_size", cfg.MaxBodySize, 0)
+
+	c.WithChild("redacted_headers", func() {
+		for i, name := range cfg.RedactedHeaders {
+			c.CheckStringNotEmpty(i, name)
+		}
+	})
 }
 
 func (cfg *TLSClientCfg) Check(c *check.Checker) {
@@ -78,17 +181,98 @@ func (cfg *TLSClientCfg) Check(c *check.Checker) {
 }
 
 func NewClient(cfg ClientCfg) (*Client, error) {
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("http-client")
+	}
 
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = 100
+	}
 
-		MaxIdleConns: 100,
+	if cfg.Timeout == 0 {
+		cfg.Timeout = dtime.Duration(30 * time.Second)
+	}
+
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = dtime.Duration(30 * time.Second)
+	}
 
-		IdleConnTimeout:       60 * time.Second,
+	if cfg.TLSHandshakeTimeout == 0 {
+		cfg.TLSHandshakeTimeout = dtime.Duration(10 * time.Second)
+	}
+
+	if cfg.IdleConnTimeout == 0 {
+		cfg.IdleConnTimeout = dtime.Duration(60 * time.Second)
+	}
+
+	if cfg.RequestLog != nil && cfg.RequestLog.MaxBodySize == 0 {
+		requestLogCfg := *cfg.RequestLog
+		requestLogCfg.MaxBodySize = 4096
+		cfg.RequestLog = &requestLogCfg
+	}
+
+	var baseURI *url.URL
+	if cfg.BaseURI != "" {
+		uri, err := url.Parse(cfg.BaseURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base uri: %w", err)
+		}
+
+		baseURI = uri
+	}
+
+	proxy := http.ProxyFromEnvironment
+
+	if cfg.ProxyURI != "" {
+		proxyURI, err := url.Parse(cfg.ProxyURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy uri: %w", err)
+		}
+
+		proxy = http.ProxyURL(proxyURI)
+	}
+
+	var resolver *dnsResolver
+
+	if cfg.DNS != nil {
+		r, err := newDNSResolver(cfg.DNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns configuration: %w", err)
+		}
+
+		resolver = r
+	}
+
+	var destinationPolicy *destinationPolicy
+
+	if cfg.Destinations != nil {
+		if cfg.ProxyURI != "" {
+			return nil, fmt.Errorf("destinations cannot be restricted " +
+				"when a proxy is used")
+		}
+
+		p, err := newDestinationPolicy(cfg.Destinations)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destinations: %w", err)
+		}
+
+		destinationPolicy = p
+
+		// Destinations are checked when connecting; with a proxy, the
+		// client would connect to the proxy and the actual destination
+		// would never be checked.
+		proxy = nil
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+
+		MaxIdleConns:    cfg.MaxIdleConns,
+		MaxConnsPerHost: cfg.MaxConnsPerHost,
+
+		IdleConnTimeout:       cfg.IdleConnTimeout.Duration(),
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout.Duration(),
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout.Duration(),
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
@@ -103,9 +287,32 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 		tlsCfg.RootCAs = caCertificatePool
 	}
 
+	var rt http.RoundTripper = transport
+
+	// Requests are signed last so that the signature covers the body and
+	// headers actually sent, e.g. after compression.
+	if cfg.Signer != nil {
+		rt = &signingTransport{signer: cfg.Signer, RoundTripper: rt}
+	}
+
+	if cfg.Compression != nil {
+		rt = newCompressionTransport(rt, cfg.Compression)
+	}
+
+	if cfg.Cache != nil {
+		cacheTransport, err := newCacheTransport(rt, cfg.Cache, cfg.Log)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create cache: %w", err)
+		}
+
+		rt = cacheTransport
+	}
+
+	roundTripper := NewRoundTripper(rt, &cfg)
+
 	client := &http.Client{
-		Timeout:   30 * time.Second,
-		Transport: NewRoundTripper(transport, &cfg),
+		Timeout:   cfg.Timeout.Duration(),
+		Transport: roundTripper,
 	}
 
 	c := &Client{
@@ -114,9 +321,19 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 
 		Client: client,
 
-		tlsCfg: tlsCfg,
+		BaseURI: baseURI,
+
+		roundTripper: roundTripper,
+
+		tlsCfg:            tlsCfg,
+		resolver:          resolver,
+		destinationPolicy: destinationPolicy,
 	}
 
+	tlsCfg.VerifyConnection = c.checkTLSPublicKey
+
+	transport.DialContext = c.DialContext
+	transport.TLSClientConfig = tlsCfg
 	transport.DialTLSContext = c.DialTLSContext
 
 	return c, nil
@@ -127,11 +344,118 @@ func (c *Client) Terminate() {
 }
 
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if !req.URL.IsAbs() {
+		uri, err := c.resolveURL(req.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		req.URL = uri
+		req.Host = uri.Host
+	}
+
+	// Default query parameters and credentials are applied here and not in
+	// the round tripper: the round tripper also runs for redirections, and
+	// credentials must not be sent to other hosts.
+	c.addDefaultQuery(req)
+	c.addAuth(req)
+
 	return c.Client.Do(req)
 }
 
+func (c *Client) addDefaultQuery(req *http.Request) {
+	if len(c.Cfg.Query) == 0 {
+		return
+	}
+
+	query := req.URL.Query()
+
+	missing := url.Values{}
+	for name, values := range c.Cfg.Query {
+		if _, found := query[name]; !found {
+			missing[name] = values
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	// The existing query string is kept as is since callers may rely on the
+	// order or encoding of its parameters.
+	if req.URL.RawQuery == "" {
+		req.URL.RawQuery = missing.Encode()
+	} else {
+		req.URL.RawQuery += "&" + missing.Encode()
+	}
+}
+
+func (c *Client) addAuth(req *http.Request) {
+	auth := c.Cfg.Auth
+	if auth == nil || req.Header.Get("Authorization") != "" {
+		return
+	}
+
+	if auth.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+auth.BearerToken)
+	} else {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+}
+
+func (c *Client) ResolveURI(s string) (*url.URL, error) {
+	ref, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uri %q: %w", s, err)
+	}
+
+	return c.resolveURL(ref)
+}
+
+func (c *Client) resolveURL(ref *url.URL) (*url.URL, error) {
+	if ref.IsAbs() {
+		return ref, nil
+	}
+
+	if c.BaseURI == nil {
+		return nil, fmt.Errorf("cannot resolve relative uri %q without "+
+			"base uri", ref.String())
+	}
+
+	// The reference path is appended as is: trailing slashes and dot
+	// segments are meaningful for some APIs.
+	uri := *c.BaseURI
+	uri.Path = "/" + strings.TrimPrefix(uri.Path, "/")
+	if ref.Path != "" {
+		uri.Path = strings.TrimSuffix(uri.Path, "/") + "/" +
+			strings.TrimPrefix(ref.Path, "/")
+	}
+	uri.RawPath = ""
+	uri.Fragment = ""
+
+	// Query parameters of the base uri (e.g. an API key) are kept unless
+	// the reference overrides them.
+	if uri.RawQuery == "" {
+		uri.RawQuery = ref.RawQuery
+	} else if ref.RawQuery != "" {
+		query := uri.Query()
+		for name, values := range ref.Query() {
+			query[name] = values
+		}
+
+		uri.RawQuery = query.Encode()
+	}
+
+	return &uri, nil
+}
+
 func (c *Client) SendRequest(method string, uri *url.URL, header map[string]string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, uri.String(), body)
+	ctx := context.Background()
+	return c.SendRequestContext(ctx, method, uri, header, body)
+}
+
+func (c *Client) SendRequestContext(ctx context.Context, method string, uri *url.URL, header map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), body)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create request: %w", err)
 	}
@@ -143,35 +467,65 @@ func (c *Client) SendRequest(method string, uri *url.URL, header map[string]stri
 	return c.Do(req)
 }
 
-func (c *Client) DialTLSContext(ctx context.Context, network, address string) (net.Conn, error) {
-	dialer := &tls.Dialer{
-		NetDialer: &net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		},
-		Config: c.tlsCfg,
+func (c *Client) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := newNetDialer(&c.Cfg)
+
+	if c.destinationPolicy != nil {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+
+		dialer.Control = c.destinationPolicy.control(host)
 	}
 
-	conn, err := dialer.DialContext(ctx, network, address)
+	if c.resolver == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return c.resolver.dialContext(ctx, dialer, network, address)
+}
+
+func (c *Client) DialTLSContext(ctx context.Context, network, address string) (net.Conn, error) {
+	rawConn, err := c.DialContext(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := c.checkTLSPublicKey(conn.(*tls.Conn)); err != nil {
-		conn.Close()
+	tlsCfg := c.tlsCfg.Clone()
+
+	if tlsCfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+
+		tlsCfg.ServerName = host
+	}
+
+	conn := tls.Client(rawConn, tlsCfg)
+
+	handshakeTimeout := c.Cfg.TLSHandshakeTimeout.Duration()
+
+	handshakeCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	if err := conn.HandshakeContext(handshakeCtx); err != nil {
+		rawConn.Close()
 		return nil, err
 	}
 
 	return conn, nil
 }
 
-func (c *Client) checkTLSPublicKey(conn *tls.Conn) error {
+// checkTLSPublicKey is called during the handshake of all TLS connections,
+// including connections established through a proxy, which do not use
+// DialTLSContext.
+func (c *Client) checkTLSPublicKey(state tls.ConnectionState) error {
 	if c.Cfg.TLS == nil {
 		return nil
 	}
 
-	state := conn.ConnectionState()
-
 	pins, found := c.Cfg.TLS.PublicKeyPins[state.ServerName]
 	if !found || len(pins) == 0 {
 		return nil
@@ -204,3 +558,10 @@ func (c *Client) checkTLSPublicKey(conn *tls.Conn) error {
 
 	return nil
 }
+
+func newNetDialer(cfg *ClientCfg) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   cfg.DialTimeout.Duration(),
+		KeepAlive: 30 * time.Second,
+	}
+}
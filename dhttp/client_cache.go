@@ -0,0 +1,617 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dlog"
+)
+
+type ClientCacheStorage string
+
+const (
+	ClientCacheStorageMemory ClientCacheStorage = "memory"
+	ClientCacheStorageDisk   ClientCacheStorage = "disk"
+)
+
+var ClientCacheStorageValues = []ClientCacheStorage{
+	ClientCacheStorageMemory,
+	ClientCacheStorageDisk,
+}
+
+// ClientCacheCfg enables a private response cache for GET requests
+// following RFC 7234. Responses are fresh for the duration indicated by
+// their Cache-Control max-age directive or Expires header; stale responses
+// with an ETag or Last-Modified header are revalidated with a conditional
+// request.
+//
+// MaxEntries only applies to memory storage.
+type ClientCacheCfg struct {
+	Storage   ClientCacheStorage `json:"storage,omitempty"`
+	Directory string             `json:"directory,omitempty"`
+
+	MaxEntries  int `json:"max_entries,omitempty"`
+	MaxBodySize int `json:"max_body_size,omitempty"`
+}
+
+func (cfg *ClientCacheCfg) Check(c *check.Checker) {
+	if cfg.Storage != "" {
+		c.CheckStringValue("storage", cfg.Storage, ClientCacheStorageValues)
+	}
+
+	if cfg.Storage == ClientCacheStorageDisk {
+		c.CheckStringNotEmpty("directory", cfg.Directory)
+	}
+
+	c.CheckIntMin("max_entries", cfg.MaxEntries, 0)
+	c.CheckIntMin("max_body_size", cfg.MaxBodySize, 0)
+}
+
+var cacheableStatuses = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 404: true,
+	405: true, 410: true, 414: true, 501: true,
+}
+
+type cachedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+
+	// The hashes of the values of the request header fields the response
+	// varies on, indexed by canonical header name. Values are not stored
+	// since they can contain credentials.
+	RequestHeaderHashes map[string]string `json:"request_header_hashes,omitempty"`
+
+	StoredAt   time.Time `json:"stored_at"`
+	InitialAge int64     `json:"initial_age,omitempty"` // seconds
+}
+
+type clientCacheStorage interface {
+	get(string) (*cachedResponse, error)
+	put(string, *cachedResponse) error
+	delete(string) error
+}
+
+type cacheTransport struct {
+	Cfg *ClientCacheCfg
+	Log *dlog.Logger
+
+	http.RoundTripper
+
+	storage clientCacheStorage
+}
+
+func newCacheTransport(rt http.RoundTripper, cacheCfg *ClientCacheCfg, log *dlog.Logger) (*cacheTransport, error) {
+	cfg := *cacheCfg
+
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = 1000
+	}
+
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1024 * 1024
+	}
+
+	var storage clientCacheStorage
+
+	switch cfg.Storage {
+	case "", ClientCacheStorageMemory:
+		storage = newMemoryCacheStorage(cfg.MaxEntries)
+
+	case ClientCacheStorageDisk:
+		if err := os.MkdirAll(cfg.Directory, 0700); err != nil {
+			return nil, fmt.Errorf("cannot create directory %q: %w",
+				cfg.Directory, err)
+		}
+
+		storage = &diskCacheStorage{directory: cfg.Directory}
+
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+
+	t := cacheTransport{
+		Cfg: &cfg,
+		Log: log,
+
+		RoundTripper: rt,
+
+		storage: storage,
+	}
+
+	return &t, nil
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+
+	if req.Method != "GET" && req.Method != "HEAD" {
+		res, err := t.RoundTripper.RoundTrip(req)
+
+		// Unsafe methods invalidate stored responses (RFC 7234 4.4)
+		if err == nil && res.StatusCode < 400 && req.Method != "OPTIONS" {
+			if err := t.storage.delete(key); err != nil {
+				t.Log.Error("cannot delete cache entry: %v", err)
+			}
+		}
+
+		return res, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+
+	if req.Method != "GET" || reqCC.has("no-store") || isConditionalRequest(req) {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	entry, err := t.storage.get(key)
+	if err != nil {
+		t.Log.Error("cannot read cache entry: %v", err)
+	}
+
+	if entry != nil && !entry.matches(req) {
+		entry = nil
+	}
+
+	if entry != nil && entry.fresh(reqCC) {
+		return entry.response(req), nil
+	}
+
+	condReq := req
+	if entry != nil {
+		condReq = entry.conditionalRequest(req)
+	}
+
+	res, err := t.RoundTripper.RoundTrip(condReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil && res.StatusCode == 304 {
+		res.Body.Close()
+
+		entry.update(res)
+
+		if err := t.storage.put(key, entry); err != nil {
+			t.Log.Error("cannot write cache entry: %v", err)
+		}
+
+		return entry.response(req), nil
+	}
+
+	return t.store(key, req, res)
+}
+
+func (t *cacheTransport) store(key string, req *http.Request, res *http.Response) (*http.Response, error) {
+	if !isStorableResponse(res) {
+		return res, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, int64(t.Cfg.MaxBodySize)+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	if len(data) > t.Cfg.MaxBodySize {
+		res.Body = &prefixedBody{
+			Reader: io.MultiReader(bytes.NewReader(data), res.Body),
+			Closer: res.Body,
+		}
+
+		return res, nil
+	}
+
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(data))
+
+	entry := cachedResponse{
+		StatusCode:          res.StatusCode,
+		Header:              res.Header.Clone(),
+		Body:                data,
+		RequestHeaderHashes: varyingRequestHeaderHashes(req, res),
+		StoredAt:            time.Now(),
+	}
+
+	if age, err := strconv.ParseInt(res.Header.Get("Age"), 10, 64); err == nil {
+		entry.InitialAge = age
+	}
+
+	if err := t.storage.put(key, &entry); err != nil {
+		t.Log.Error("cannot write cache entry: %v", err)
+	}
+
+	return res, nil
+}
+
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func isConditionalRequest(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" ||
+		req.Header.Get("If-Match") != "" ||
+		req.Header.Get("If-Unmodified-Since") != "" ||
+		req.Header.Get("Range") != ""
+}
+
+func isStorableResponse(res *http.Response) bool {
+	if !cacheableStatuses[res.StatusCode] {
+		return false
+	}
+
+	if res.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	cc := parseCacheControl(res.Header)
+	if cc.has("no-store") {
+		return false
+	}
+
+	_, hasLifetime := freshnessLifetime(res.Header, cc)
+
+	return hasLifetime || res.Header.Get("ETag") != "" ||
+		res.Header.Get("Last-Modified") != ""
+}
+
+// varyingRequestHeaderHashes returns the hashes of the values of the
+// request header fields listed in the Vary header of the response.
+// Authorization is always included so that responses are never shared
+// between credentials.
+func varyingRequestHeaderHashes(req *http.Request, res *http.Response) map[string]string {
+	hashes := make(map[string]string)
+
+	for _, name := range varyingHeaderNames(res.Header) {
+		hashes[http.CanonicalHeaderKey(name)] = requestHeaderHash(req, name)
+	}
+
+	return hashes
+}
+
+func requestHeaderHash(req *http.Request, name string) string {
+	hash := sha256.Sum256([]byte(strings.Join(req.Header.Values(name), ", ")))
+	return hex.EncodeToString(hash[:])
+}
+
+func varyingHeaderNames(header http.Header) []string {
+	names := []string{"Authorization"}
+
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+func (r *cachedResponse) matches(req *http.Request) bool {
+	for _, name := range varyingHeaderNames(r.Header) {
+		hash, found := r.RequestHeaderHashes[http.CanonicalHeaderKey(name)]
+		if !found || hash != requestHeaderHash(req, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *cachedResponse) age() time.Duration {
+	return time.Duration(r.InitialAge)*time.Second + time.Since(r.StoredAt)
+}
+
+func (r *cachedResponse) fresh(reqCC cacheControl) bool {
+	if reqCC.has("no-cache") {
+		return false
+	}
+
+	cc := parseCacheControl(r.Header)
+	if cc.has("no-cache") {
+		return false
+	}
+
+	lifetime, _ := freshnessLifetime(r.Header, cc)
+
+	if maxAge, found := reqCC.seconds("max-age"); found && maxAge < lifetime {
+		lifetime = maxAge
+	}
+
+	return r.age() < lifetime
+}
+
+func (r *cachedResponse) conditionalRequest(req *http.Request) *http.Request {
+	etag := r.Header.Get("ETag")
+	lastModified := r.Header.Get("Last-Modified")
+
+	if etag == "" && lastModified == "" {
+		return req
+	}
+
+	req = req.Clone(req.Context())
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return req
+}
+
+// update refreshes a stored response with the header of a 304 response
+// (RFC 7234 4.3.4).
+func (r *cachedResponse) update(res *http.Response) {
+	for name, values := range res.Header {
+		if name == "Content-Length" {
+			continue
+		}
+
+		r.Header[name] = values
+	}
+
+	r.StoredAt = time.Now()
+	r.InitialAge = 0
+
+	if age, err := strconv.ParseInt(res.Header.Get("Age"), 10, 64); err == nil {
+		r.InitialAge = age
+	}
+}
+
+func (r *cachedResponse) response(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(r.age().Seconds()), 10))
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode: r.StatusCode,
+
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+
+		Request: req,
+	}
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, value, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(name)] = strings.Trim(value, "\"")
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, found := cc[name]
+	return found
+}
+
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, found := cc[name]
+	if !found {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+func freshnessLifetime(header http.Header, cc cacheControl) (time.Duration, bool) {
+	if maxAge, found := cc.seconds("max-age"); found {
+		return maxAge, true
+	}
+
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0, true
+		}
+
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+
+		return expires.Sub(date), true
+	}
+
+	return 0, false
+}
+
+type memoryCacheStorage struct {
+	maxEntries int
+
+	entries map[string]*list.Element
+	lru     *list.List
+	lock    sync.Mutex
+}
+
+type memoryCacheEntry struct {
+	key      string
+	response *cachedResponse
+}
+
+func newMemoryCacheStorage(maxEntries int) *memoryCacheStorage {
+	return &memoryCacheStorage{
+		maxEntries: maxEntries,
+
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (s *memoryCacheStorage) get(key string) (*cachedResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	elt, found := s.entries[key]
+	if !found {
+		return nil, nil
+	}
+
+	s.lru.MoveToFront(elt)
+
+	// Entries are updated in place during revalidation
+	r := *elt.Value.(*memoryCacheEntry).response
+	r.Header = r.Header.Clone()
+
+	return &r, nil
+}
+
+func (s *memoryCacheStorage) put(key string, r *cachedResponse) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if elt, found := s.entries[key]; found {
+		elt.Value.(*memoryCacheEntry).response = r
+		s.lru.MoveToFront(elt)
+		return nil
+	}
+
+	s.entries[key] = s.lru.PushFront(&memoryCacheEntry{
+		key:      key,
+		response: r,
+	})
+
+	for s.lru.Len() > s.maxEntries {
+		elt := s.lru.Back()
+		s.lru.Remove(elt)
+		delete(s.entries, elt.Value.(*memoryCacheEntry).key)
+	}
+
+	return nil
+}
+
+func (s *memoryCacheStorage) delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if elt, found := s.entries[key]; found {
+		s.lru.Remove(elt)
+		delete(s.entries, key)
+	}
+
+	return nil
+}
+
+type diskCacheStorage struct {
+	directory string
+}
+
+func (s *diskCacheStorage) filePath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.directory, hex.EncodeToString(hash[:])+".json")
+}
+
+func (s *diskCacheStorage) get(key string) (*cachedResponse, error) {
+	data, err := os.ReadFile(s.filePath(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var r cachedResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %w", s.filePath(key), err)
+	}
+
+	return &r, nil
+}
+
+func (s *diskCacheStorage) put(key string, r *cachedResponse) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("cannot encode response: %w", err)
+	}
+
+	filePath := s.filePath(key)
+
+	tmpFile, err := os.CreateTemp(s.directory, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cannot create file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("cannot write %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+func (s *diskCacheStorage) delete(key string) error {
+	err := os.Remove(s.filePath(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCache(t *testing.T) {
+	for _, storage := range ClientCacheStorageValues {
+		t.Run(string(storage), func(t *testing.T) {
+			testClientCache(t, &ClientCacheCfg{
+				Storage:   storage,
+				Directory: t.TempDir(),
+			})
+		})
+	}
+}
+
+func testClientCache(t *testing.T, cacheCfg *ClientCacheCfg) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	nbRequests := make(map[string]int)
+	nbNotModified := 0
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			nbRequests[req.URL.Path]++
+
+			switch req.URL.Path {
+			case "/fresh":
+				w.Header().Set("Cache-Control", "max-age=60")
+
+			case "/etag":
+				w.Header().Set("Cache-Control", "no-cache")
+				w.Header().Set("ETag", `"v1"`)
+
+				if req.Header.Get("If-None-Match") == `"v1"` {
+					nbNotModified++
+					w.WriteHeader(304)
+					return
+				}
+
+			case "/no-store":
+				w.Header().Set("Cache-Control", "no-store")
+			}
+
+			io.WriteString(w, req.URL.Path)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		Cache:   cacheCfg,
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	send := func(method, path string) string {
+		req, err := http.NewRequest(method, path, nil)
+		require.NoError(err)
+
+		res, err := client.Do(req)
+		require.NoError(err)
+		defer res.Body.Close()
+
+		assert.Equal(200, res.StatusCode)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(err)
+
+		return string(body)
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal("/fresh", send("GET", "/fresh"))
+		assert.Equal("/etag", send("GET", "/etag"))
+		assert.Equal("/no-store", send("GET", "/no-store"))
+	}
+
+	assert.Equal(1, nbRequests["/fresh"])
+	assert.Equal(3, nbRequests["/etag"])
+	assert.Equal(2, nbNotModified)
+	assert.Equal(3, nbRequests["/no-store"])
+
+	send("POST", "/fresh")
+	send("GET", "/fresh")
+	assert.Equal(3, nbRequests["/fresh"])
+}
+
+func TestClientCacheAuthorization(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	nbRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			nbRequests++
+
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, "ok")
+		}))
+	defer server.Close()
+
+	dirPath := t.TempDir()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		Cache: &ClientCacheCfg{
+			Storage:   ClientCacheStorageDisk,
+			Directory: dirPath,
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	send := func(authorization string) {
+		req, err := http.NewRequest("GET", "/", nil)
+		require.NoError(err)
+		req.Header.Set("Authorization", authorization)
+
+		res, err := client.Do(req)
+		require.NoError(err)
+		defer res.Body.Close()
+
+		assert.Equal(200, res.StatusCode)
+	}
+
+	send("Bearer token1")
+	send("Bearer token1")
+	assert.Equal(1, nbRequests)
+
+	send("Bearer token2")
+	assert.Equal(2, nbRequests)
+
+	entries, err := os.ReadDir(dirPath)
+	require.NoError(err)
+	require.NotEmpty(entries)
+
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dirPath, entry.Name()))
+		require.NoError(err)
+
+		assert.NotContains(string(data), "Bearer token")
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/exograd/go-daemon/check"
+	"github.com/klauspost/compress/zstd"
+)
+
+type ContentEncoding string
+
+const (
+	ContentEncodingGzip    ContentEncoding = "gzip"
+	ContentEncodingDeflate ContentEncoding = "deflate"
+	ContentEncodingBrotli  ContentEncoding = "br"
+	ContentEncodingZstd    ContentEncoding = "zstd"
+)
+
+var ContentEncodingValues = []ContentEncoding{
+	ContentEncodingGzip,
+	ContentEncodingDeflate,
+	ContentEncodingBrotli,
+	ContentEncodingZstd,
+}
+
+var DefaultAcceptEncodings = []ContentEncoding{
+	ContentEncodingZstd,
+	ContentEncodingBrotli,
+	ContentEncodingGzip,
+}
+
+// ClientCompressionCfg controls the compression of request bodies and the
+// decompression of response bodies. If RequestEncoding is set, request
+// bodies of at least MinRequestBodySize bytes are compressed; if the server
+// rejects the encoding with a 415 status, the request is sent again without
+// compression.
+type ClientCompressionCfg struct {
+	RequestEncoding    ContentEncoding `json:"request_encoding,omitempty"`
+	MinRequestBodySize int             `json:"min_request_body_size,omitempty"`
+
+	AcceptEncodings []ContentEncoding `json:"accept_encodings,omitempty"`
+}
+
+func (cfg *ClientCompressionCfg) Check(c *check.Checker) {
+	if cfg.RequestEncoding != "" {
+		c.CheckStringValue("request_encoding", cfg.RequestEncoding,
+			ContentEncodingValues)
+	}
+
+	c.CheckIntMin("min_request_body_size", cfg.MinRequestBodySize, 0)
+
+	c.WithChild("accept_encodings", func() {
+		for i, encoding := range cfg.AcceptEncodings {
+			c.CheckStringValue(i, encoding, ContentEncodingValues)
+		}
+	})
+}
+
+type compressionTransport struct {
+	Cfg *ClientCompressionCfg
+
+	http.RoundTripper
+
+	acceptEncoding string
+}
+
+func newCompressionTransport(rt http.RoundTripper, compressionCfg *ClientCompressionCfg) *compressionTransport {
+	cfg := *compressionCfg
+
+	if cfg.MinRequestBodySize == 0 {
+		cfg.MinRequestBodySize = 1024
+	}
+
+	if len(cfg.AcceptEncodings) == 0 {
+		cfg.AcceptEncodings = DefaultAcceptEncodings
+	}
+
+	encodings := make([]string, len(cfg.AcceptEncodings))
+	for i, encoding := range cfg.AcceptEncodings {
+		encodings[i] = string(encoding)
+	}
+
+	t := compressionTransport{
+		Cfg: &cfg,
+
+		RoundTripper: rt,
+
+		acceptEncoding: strings.Join(encodings, ", "),
+	}
+
+	return &t
+}
+
+func (t *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", t.acceptEncoding)
+	}
+
+	var body []byte
+
+	if t.compressRequest(req) {
+		var err error
+
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read request body: %w", err)
+		}
+
+		compressedReq, err := t.compressedRequest(req, body)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := t.RoundTripper.RoundTrip(compressedReq)
+		if err != nil || res.StatusCode != 415 {
+			return t.decodeResponse(res, err)
+		}
+
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		req = bufferedRequest(req, body)
+	}
+
+	return t.decodeResponse(t.RoundTripper.RoundTrip(req))
+}
+
+func (t *compressionTransport) compressRequest(req *http.Request) bool {
+	if t.Cfg.RequestEncoding == "" {
+		return false
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+
+	if req.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	return req.ContentLength < 0 ||
+		req.ContentLength >= int64(t.Cfg.MinRequestBodySize)
+}
+
+func (t *compressionTransport) compressedRequest(req *http.Request, body []byte) (*http.Request, error) {
+	var buf bytes.Buffer
+
+	w, err := newContentEncoder(&buf, t.Cfg.RequestEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	req = bufferedRequest(req, buf.Bytes())
+	req.Header.Set("Content-Encoding", string(t.Cfg.RequestEncoding))
+
+	return req, nil
+}
+
+func bufferedRequest(req *http.Request, body []byte) *http.Request {
+	req = req.Clone(req.Context())
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+
+	return req
+}
+
+func (t *compressionTransport) decodeResponse(res *http.Response, err error) (*http.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := ContentEncoding(strings.ToLower(
+		strings.TrimSpace(res.Header.Get("Content-Encoding"))))
+
+	switch encoding {
+	case "", "identity":
+		return res, nil
+
+	case ContentEncodingGzip, ContentEncodingDeflate, ContentEncodingBrotli,
+		ContentEncodingZstd:
+
+	default:
+		return res, nil
+	}
+
+	res.Body = &decodingBody{body: res.Body, encoding: encoding}
+
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return res, nil
+}
+
+func newContentEncoder(w io.Writer, encoding ContentEncoding) (io.WriteCloser, error) {
+	switch encoding {
+	case ContentEncodingGzip:
+		return gzip.NewWriter(w), nil
+	case ContentEncodingDeflate:
+		// The deflate content encoding is the zlib format (RFC 9110 8.4.1.2)
+		return zlib.NewWriter(w), nil
+	case ContentEncodingBrotli:
+		return brotli.NewWriter(w), nil
+	case ContentEncodingZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// decodingBody decompresses a response body. The decoder is created on the
+// first read since some decoders read data immediately, which would fail
+// for responses without body.
+type decodingBody struct {
+	body     io.ReadCloser
+	encoding ContentEncoding
+
+	r     io.Reader
+	close func()
+	err   error
+}
+
+func (b *decodingBody) Read(data []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.r, b.close, b.err = newContentDecoder(b.body, b.encoding)
+	}
+
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	return b.r.Read(data)
+}
+
+func (b *decodingBody) Close() error {
+	if b.close != nil {
+		b.close()
+	}
+
+	return b.body.Close()
+}
+
+func newContentDecoder(r io.Reader, encoding ContentEncoding) (io.Reader, func(), error) {
+	switch encoding {
+	case ContentEncodingGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decode gzip data: %w", err)
+		}
+
+		return gr, func() { gr.Close() }, nil
+
+	case ContentEncodingDeflate:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decode deflate data: %w", err)
+		}
+
+		return zr, func() { zr.Close() }, nil
+
+	case ContentEncodingBrotli:
+		return brotli.NewReader(r), nil, nil
+
+	case ContentEncodingZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decode zstd data: %w", err)
+		}
+
+		return zr, zr.Close, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported content encoding %q",
+			encoding)
+	}
+}
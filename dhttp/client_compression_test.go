@@ -0,0 +1,225 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-daemon/dcrypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCompression(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := strings.Repeat("hello world ", 1000)
+
+	var requestEncodings []string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			requestEncodings = append(requestEncodings,
+				req.Header.Get("Content-Encoding"))
+
+			if req.URL.Query().Get("reject") != "" &&
+				req.Header.Get("Content-Encoding") != "" {
+				w.Header().Set("Accept-Encoding", "identity")
+				w.WriteHeader(415)
+				return
+			}
+
+			var body io.Reader = req.Body
+
+			if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+				r, _, err := newContentDecoder(req.Body, ContentEncoding(encoding))
+				require.NoError(err)
+				body = r
+			}
+
+			data, err := io.ReadAll(body)
+			require.NoError(err)
+			assert.Equal(content, string(data))
+
+			encoding := ContentEncoding(req.URL.Query().Get("encoding"))
+			w.Header().Set("Content-Encoding", string(encoding))
+
+			encoder, err := newContentEncoder(w, encoding)
+			require.NoError(err)
+			encoder.Write(data)
+			encoder.Close()
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		Compression: &ClientCompressionCfg{
+			RequestEncoding: ContentEncodingGzip,
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	send := func(path string) string {
+		req, err := http.NewRequest("POST", path,
+			bytes.NewReader([]byte(content)))
+		require.NoError(err)
+
+		res, err := client.Do(req)
+		require.NoError(err)
+		defer res.Body.Close()
+
+		require.Equal(200, res.StatusCode)
+		assert.Empty(res.Header.Get("Content-Encoding"))
+
+		data, err := io.ReadAll(res.Body)
+		require.NoError(err)
+
+		return string(data)
+	}
+
+	for _, encoding := range ContentEncodingValues {
+		requestEncodings = nil
+
+		assert.Equal(content, send("/?encoding="+string(encoding)),
+			string(encoding))
+		assert.Equal([]string{"gzip"}, requestEncodings)
+	}
+
+	requestEncodings = nil
+
+	assert.Equal(content, send("/?encoding=gzip&reject=1"))
+	assert.Equal([]string{"gzip", ""}, requestEncodings)
+}
+
+func TestClientCompressionDeflate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := strings.Repeat("hello world ", 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			// Request bodies must be zlib data
+			zr, err := zlib.NewReader(req.Body)
+			require.NoError(err)
+
+			data, err := io.ReadAll(zr)
+			require.NoError(err)
+			assert.Equal(content, string(data))
+
+			w.Header().Set("Content-Encoding", "deflate")
+
+			zw := zlib.NewWriter(w)
+			zw.Write(data)
+			zw.Close()
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		Compression: &ClientCompressionCfg{
+			RequestEncoding: ContentEncodingDeflate,
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	req, err := http.NewRequest("POST", "/", strings.NewReader(content))
+	require.NoError(err)
+
+	res, err := client.Do(req)
+	require.NoError(err)
+	defer res.Body.Close()
+
+	require.Equal(200, res.StatusCode)
+
+	data, err := io.ReadAll(res.Body)
+	require.NoError(err)
+	assert.Equal(content, string(data))
+}
+
+func TestClientCompressionSigning(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := []byte("secret")
+	content := strings.Repeat("hello world ", 1000)
+
+	var requestEncodings []string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			encoding := req.Header.Get("Content-Encoding")
+			requestEncodings = append(requestEncodings, encoding)
+
+			body, err := io.ReadAll(req.Body)
+			require.NoError(err)
+
+			// The signature must cover the bytes received
+			data := hmacSignatureData(req.Method, req.URL.RequestURI(),
+				req.Header.Get("X-Signature-Timestamp"), body)
+			signature := dcrypto.SignHMAC256Hex(data, key)
+
+			if signature != req.Header.Get("X-Signature") {
+				w.WriteHeader(403)
+				return
+			}
+
+			if req.URL.Query().Get("reject") != "" && encoding != "" {
+				w.WriteHeader(415)
+				return
+			}
+
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		Signer:  &HMACSigner{Key: key},
+		Compression: &ClientCompressionCfg{
+			RequestEncoding: ContentEncodingGzip,
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	send := func(path string) int {
+		req, err := http.NewRequest("POST", path, strings.NewReader(content))
+		require.NoError(err)
+
+		res, err := client.Do(req)
+		require.NoError(err)
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	assert.Equal(204, send("/"))
+	assert.Equal([]string{"gzip"}, requestEncodings)
+
+	requestEncodings = nil
+
+	assert.Equal(204, send("/?reject=1"))
+	assert.Equal([]string{"gzip", ""}, requestEncodings)
+}
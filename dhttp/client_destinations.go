@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+// DestinationsCfg restricts the addresses http clients can connect to.
+//
+// If AllowedHosts or AllowedAddresses are set, a connection is only accepted
+// if the host name matches one of the allowed hosts ("*.example.com" matches
+// all subdomains of example.com) or if the address is part of one of the
+// allowed addresses or networks. If DenyInternalAddresses is set, loopback,
+// private, link-local (including cloud metadata services) and unspecified
+// addresses are rejected unless they are explicitly allowed.
+//
+// Checks are applied to the address actually connected to, after name
+// resolution. Since a proxy would connect to the destination on behalf of
+// the client, destinations cannot be restricted when a proxy is configured,
+// and proxy environment variables are ignored.
+type DestinationsCfg struct {
+	AllowedHosts          []string `json:"allowed_hosts,omitempty"`
+	AllowedAddresses      []string `json:"allowed_addresses,omitempty"`
+	DenyInternalAddresses bool     `json:"deny_internal_addresses,omitempty"`
+}
+
+type ForbiddenDestinationError struct {
+	Host    string
+	Address string
+}
+
+func (err *ForbiddenDestinationError) Error() string {
+	if err.Host == err.Address {
+		return fmt.Sprintf("forbidden destination address %s", err.Address)
+	}
+
+	return fmt.Sprintf("forbidden destination %s (address %s)",
+		err.Host, err.Address)
+}
+
+var internalNetworks addressList
+
+func init() {
+	var err error
+
+	// Shared address space (RFC 6598), used by some cloud providers for
+	// metadata services.
+	internalNetworks, err = parseAddressList([]string{"100.64.0.0/10"})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cfg *DestinationsCfg) Check(c *check.Checker) {
+	c.WithChild("allowed_hosts", func() {
+		for i, host := range cfg.AllowedHosts {
+			c.CheckStringNotEmpty(i, strings.TrimPrefix(host, "*."))
+		}
+	})
+
+	checkAddressList(c, "allowed_addresses", cfg.AllowedAddresses)
+}
+
+type destinationPolicy struct {
+	allowedHosts          []string
+	allowedAddresses      addressList
+	denyInternalAddresses bool
+}
+
+func newDestinationPolicy(cfg *DestinationsCfg) (*destinationPolicy, error) {
+	allowedAddresses, err := parseAddressList(cfg.AllowedAddresses)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed addresses: %w", err)
+	}
+
+	allowedHosts := make([]string, len(cfg.AllowedHosts))
+	for i, host := range cfg.AllowedHosts {
+		allowedHosts[i] = strings.ToLower(host)
+	}
+
+	p := destinationPolicy{
+		allowedHosts:          allowedHosts,
+		allowedAddresses:      allowedAddresses,
+		denyInternalAddresses: cfg.DenyInternalAddresses,
+	}
+
+	return &p, nil
+}
+
+func (p *destinationPolicy) hostAllowed(host string) bool {
+	host = strings.ToLower(host)
+
+	for _, pattern := range p.allowedHosts {
+		if suffix := strings.TrimPrefix(pattern, "*"); suffix != pattern {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// control returns a dialer control function validating the address of each
+// connection established to host.
+func (p *destinationPolicy) control(host string) func(string, string, syscall.RawConn) error {
+	restricted := len(p.allowedHosts) > 0 || len(p.allowedAddresses) > 0
+	hostAllowed := p.hostAllowed(host)
+
+	return func(network, address string, _ syscall.RawConn) error {
+		addressHost, _, err := net.SplitHostPort(address)
+		if err != nil {
+			addressHost = address
+		}
+
+		forbiddenErr := &ForbiddenDestinationError{
+			Host:    host,
+			Address: addressHost,
+		}
+
+		if p.allowedAddresses.contains(addressHost) {
+			return nil
+		}
+
+		if restricted && !hostAllowed {
+			return forbiddenErr
+		}
+
+		if p.denyInternalAddresses && isInternalAddress(addressHost) {
+			return forbiddenErr
+		}
+
+		return nil
+	}
+}
+
+func isInternalAddress(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return true
+	}
+
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || internalNetworks.contains(address)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinationPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p, err := newDestinationPolicy(&DestinationsCfg{
+		AllowedHosts:          []string{"api.example.com", "*.example.org"},
+		AllowedAddresses:      []string{"10.1.0.0/16"},
+		DenyInternalAddresses: true,
+	})
+	require.NoError(err)
+
+	control := func(host, address string) error {
+		return p.control(host)("tcp", net.JoinHostPort(address, "443"), nil)
+	}
+
+	assert.NoError(control("api.example.com", "192.0.2.1"))
+	assert.NoError(control("API.example.com", "192.0.2.1"))
+	assert.NoError(control("a.b.example.org", "192.0.2.1"))
+	assert.NoError(control("10.1.2.3", "10.1.2.3"))
+	assert.NoError(control("internal.example.net", "10.1.2.3"))
+
+	assert.Error(control("example.org", "192.0.2.1"))
+	assert.Error(control("example.net", "192.0.2.1"))
+	assert.Error(control("api.example.com", "169.254.169.254"))
+	assert.Error(control("api.example.com", "127.0.0.1"))
+	assert.Error(control("api.example.com", "10.2.0.1"))
+	assert.Error(control("api.example.com", "100.100.100.200"))
+	assert.Error(control("api.example.com", "::1"))
+}
+
+func TestClientDestinations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		Destinations: &DestinationsCfg{DenyInternalAddresses: true},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(err)
+
+	_, err = client.Do(req)
+	var forbiddenErr *ForbiddenDestinationError
+	if assert.True(errors.As(err, &forbiddenErr)) {
+		host, _, _ := net.SplitHostPort(server.Listener.Addr().String())
+		assert.Equal(host, forbiddenErr.Address)
+	}
+}
+
+func TestClientDestinationsProxy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cfg := ClientCfg{
+		ProxyURI:     "http://proxy.example.com:3128",
+		Destinations: &DestinationsCfg{DenyInternalAddresses: true},
+	}
+
+	c := check.NewChecker()
+	cfg.Check(c)
+	if assert.Equal(1, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"destinations"}, c.Errors[0].Pointer)
+	}
+
+	_, err := NewClient(cfg)
+	assert.Error(err)
+
+	client, err := NewClient(ClientCfg{
+		Destinations: &DestinationsCfg{DenyInternalAddresses: true},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	transport, ok := client.roundTripper.RoundTripper.(*http.Transport)
+	require.True(ok)
+	assert.Nil(transport.Proxy)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientMetrics contains the statistics of the requests sent to a host
+// during a period of time. Durations are expressed in microseconds; DNS,
+// connection and TLS handshake times are only measured for requests which
+// required a new connection.
+type ClientMetrics struct {
+	Host string
+
+	NbRequests int64
+	NbErrors   int64 // requests which failed without a response
+	NbInFlight int64
+
+	// The number of responses for each status class, from 1xx to 5xx.
+	NbResponses [5]int64
+
+	TimeMin  int64
+	TimeMax  int64
+	TimeMean int64
+
+	NbDNSLookups         int64
+	DNSTimeMean          int64
+	NbConnections        int64
+	ConnectTimeMean      int64
+	NbTLSHandshakes      int64
+	TLSHandshakeTimeMean int64
+}
+
+type clientHostMetrics struct {
+	nbRequests  int64
+	nbErrors    int64
+	nbInFlight  int64
+	nbResponses [5]int64
+
+	sum int64
+	min int64
+	max int64
+
+	nbDNSLookups    int64
+	dnsTimeSum      int64
+	nbConnections   int64
+	connectTimeSum  int64
+	nbTLSHandshakes int64
+	tlsTimeSum      int64
+}
+
+type clientMetrics struct {
+	hosts map[string]*clientHostMetrics
+	lock  sync.Mutex
+}
+
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{
+		hosts: make(map[string]*clientHostMetrics),
+	}
+}
+
+func (m *clientMetrics) host(host string) *clientHostMetrics {
+	hm, found := m.hosts[host]
+	if !found {
+		hm = &clientHostMetrics{}
+		m.hosts[host] = hm
+	}
+
+	return hm
+}
+
+// requestTrace collects connection timings of a request using
+// httptrace hooks, which can be called from different goroutines.
+type requestTrace struct {
+	dnsStart     time.Time
+	dnsTime      time.Duration
+	connectStart time.Time
+	connectTime  time.Duration
+	tlsStart     time.Time
+	tlsTime      time.Duration
+
+	lock sync.Mutex
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	set := func(fn func()) {
+		t.lock.Lock()
+		fn()
+		t.lock.Unlock()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			set(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			set(func() { t.dnsTime = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			set(func() {
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(string, string, error) {
+			set(func() { t.connectTime = time.Since(t.connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			set(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			set(func() { t.tlsTime = time.Since(t.tlsStart) })
+		},
+	}
+}
+
+func (m *clientMetrics) start(req *http.Request) (*http.Request, *requestTrace) {
+	m.lock.Lock()
+	m.host(req.URL.Host).nbInFlight++
+	m.lock.Unlock()
+
+	var trace requestTrace
+
+	ctx := httptrace.WithClientTrace(req.Context(), trace.clientTrace())
+
+	return req.WithContext(ctx), &trace
+}
+
+func (m *clientMetrics) record(req *http.Request, res *http.Response, trace *requestTrace, d time.Duration) {
+	t := d.Microseconds()
+
+	trace.lock.Lock()
+	defer trace.lock.Unlock()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	hm := m.host(req.URL.Host)
+
+	hm.nbInFlight--
+
+	if hm.nbRequests == 0 || t < hm.min {
+		hm.min = t
+	}
+
+	if t > hm.max {
+		hm.max = t
+	}
+
+	hm.nbRequests++
+	hm.sum += t
+
+	if res == nil {
+		hm.nbErrors++
+	} else if class := res.StatusCode/100 - 1; class >= 0 && class < 5 {
+		hm.nbResponses[class]++
+	}
+
+	if !trace.dnsStart.IsZero() {
+		hm.nbDNSLookups++
+		hm.dnsTimeSum += trace.dnsTime.Microseconds()
+	}
+
+	if !trace.connectStart.IsZero() {
+		hm.nbConnections++
+		hm.connectTimeSum += trace.connectTime.Microseconds()
+	}
+
+	if !trace.tlsStart.IsZero() {
+		hm.nbTLSHandshakes++
+		hm.tlsTimeSum += trace.tlsTime.Microseconds()
+	}
+}
+
+// FlushMetrics returns the metrics of all hosts the client sent requests to
+// since the last call and resets them. Hosts with requests still in flight
+// are always included.
+func (c *Client) FlushMetrics() []ClientMetrics {
+	m := c.roundTripper.metrics
+
+	m.lock.Lock()
+	hosts := m.hosts
+	m.hosts = make(map[string]*clientHostMetrics)
+
+	for host, hm := range hosts {
+		if hm.nbInFlight != 0 {
+			m.hosts[host] = &clientHostMetrics{nbInFlight: hm.nbInFlight}
+		}
+	}
+	m.lock.Unlock()
+
+	mean := func(sum, n int64) int64 {
+		if n == 0 {
+			return 0
+		}
+
+		return sum / n
+	}
+
+	metrics := make([]ClientMetrics, 0, len(hosts))
+
+	for host, hm := range hosts {
+		metrics = append(metrics, ClientMetrics{
+			Host: host,
+
+			NbRequests:  hm.nbRequests,
+			NbErrors:    hm.nbErrors,
+			NbInFlight:  hm.nbInFlight,
+			NbResponses: hm.nbResponses,
+
+			TimeMin:  hm.min,
+			TimeMax:  hm.max,
+			TimeMean: mean(hm.sum, hm.nbRequests),
+
+			NbDNSLookups:         hm.nbDNSLookups,
+			DNSTimeMean:          mean(hm.dnsTimeSum, hm.nbDNSLookups),
+			NbConnections:        hm.nbConnections,
+			ConnectTimeMean:      mean(hm.connectTimeSum, hm.nbConnections),
+			NbTLSHandshakes:      hm.nbTLSHandshakes,
+			TLSHandshakeTimeMean: mean(hm.tlsTimeSum, hm.nbTLSHandshakes),
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Host < metrics[j].Host
+	})
+
+	return metrics
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientMetrics(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/error" {
+				w.WriteHeader(500)
+				return
+			}
+
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{BaseURI: server.URL})
+	require.NoError(err)
+	defer client.Terminate()
+
+	for _, path := range []string{"/a", "/b", "/error"} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(err)
+
+		res, err := client.Do(req)
+		require.NoError(err)
+		res.Body.Close()
+	}
+
+	metrics := client.FlushMetrics()
+	if assert.Len(metrics, 1) {
+		m := metrics[0]
+
+		assert.Equal(server.Listener.Addr().String(), m.Host)
+		assert.Equal(int64(3), m.NbRequests)
+		assert.Equal(int64(0), m.NbErrors)
+		assert.Equal(int64(0), m.NbInFlight)
+		assert.Equal([5]int64{0, 2, 0, 0, 1}, m.NbResponses)
+		assert.Equal(int64(1), m.NbConnections)
+		assert.LessOrEqual(m.TimeMin, m.TimeMean)
+		assert.LessOrEqual(m.TimeMean, m.TimeMax)
+	}
+
+	assert.Empty(client.FlushMetrics())
+}
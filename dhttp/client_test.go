@@ -0,0 +1,236 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCfg(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client, err := NewClient(ClientCfg{})
+	require.NoError(err)
+	defer client.Terminate()
+
+	assert.Equal(100, client.Cfg.MaxIdleConns)
+	assert.Equal(30*time.Second, client.Client.Timeout)
+	assert.Equal(30*time.Second, client.Cfg.DialTimeout.Duration())
+
+	client2, err := NewClient(ClientCfg{
+		MaxIdleConns: 5,
+		Timeout:      dtime.Duration(time.Second),
+	})
+	require.NoError(err)
+	defer client2.Terminate()
+
+	assert.Equal(5, client2.Cfg.MaxIdleConns)
+	assert.Equal(time.Second, client2.Client.Timeout)
+
+	cfg := ClientCfg{
+		MaxIdleConns:          -1,
+		ResponseHeaderTimeout: dtime.Duration(-time.Second),
+		ProxyURI:              "foo",
+	}
+
+	c := check.NewChecker()
+	cfg.Check(c)
+	if assert.Equal(3, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"proxy_uri"}, c.Errors[0].Pointer)
+		assert.Equal(djson.Pointer{"max_idle_conns"}, c.Errors[1].Pointer)
+		assert.Equal(djson.Pointer{"response_header_timeout"},
+			c.Errors[2].Pointer)
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		ResponseHeaderTimeout: dtime.Duration(20 * time.Millisecond),
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	uri, err := url.Parse(server.URL)
+	require.NoError(err)
+
+	_, err = client.SendRequest("GET", uri, nil, nil)
+	assert.Error(err)
+}
+
+func TestClientProxy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var proxiedURI string
+	proxy := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			proxiedURI = req.RequestURI
+		}))
+	defer proxy.Close()
+
+	client, err := NewClient(ClientCfg{ProxyURI: proxy.URL})
+	require.NoError(err)
+	defer client.Terminate()
+
+	uri, err := url.Parse("http://example.com/foo?a=1")
+	require.NoError(err)
+
+	res, err := client.SendRequest("GET", uri, nil, nil)
+	require.NoError(err)
+	res.Body.Close()
+
+	assert.Equal("http://example.com/foo?a=1", proxiedURI)
+}
+
+func TestClientResolveURI(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tests := []struct {
+		baseURI string
+		ref     string
+		uri     string
+	}{
+		{"http://example.com", "/items", "http://example.com/items"},
+		{"http://example.com/api", "items/", "http://example.com/api/items/"},
+		{"http://example.com/api/", "/items/1", "http://example.com/api/items/1"},
+		{"http://example.com/api/", "", "http://example.com/api/"},
+		{"http://example.com/api", "/items?a=1", "http://example.com/api/items?a=1"},
+		{"http://example.com/api?key=k", "/items", "http://example.com/api/items?key=k"},
+		{"http://example.com/api?key=k&v=1", "/items?a=1&v=2",
+			"http://example.com/api/items?a=1&key=k&v=2"},
+		{"http://example.com/api", "https://example.org/x", "https://example.org/x"},
+	}
+
+	for _, test := range tests {
+		client, err := NewClient(ClientCfg{BaseURI: test.baseURI})
+		require.NoError(err)
+
+		uri, err := client.ResolveURI(test.ref)
+		if assert.NoError(err) {
+			assert.Equal(test.uri, uri.String(), "%s %s", test.baseURI, test.ref)
+		}
+
+		client.Terminate()
+	}
+}
+
+func TestClientAuthRedirect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var otherHeader http.Header
+	other := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			otherHeader = req.Header.Clone()
+		}))
+	defer other.Close()
+
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			header = req.Header.Clone()
+
+			// Both servers listen on 127.0.0.1; use another host name so
+			// that the redirection is considered cross-host.
+			uri, _ := url.Parse(other.URL + "/target")
+			uri.Host = "localhost:" + uri.Port()
+
+			http.Redirect(w, req, uri.String(), http.StatusFound)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		Auth:    &ClientAuthCfg{BearerToken: "secret"},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	req, err := http.NewRequest("GET", "/source", nil)
+	require.NoError(err)
+
+	res, err := client.Do(req)
+	require.NoError(err)
+	res.Body.Close()
+
+	require.NotNil(header)
+	assert.Equal("Bearer secret", header.Get("Authorization"))
+
+	require.NotNil(otherHeader)
+	assert.Empty(otherHeader.Get("Authorization"))
+}
+
+func TestClientDefaultQuery(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var rawQuery string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			rawQuery = req.URL.RawQuery
+		}))
+	defer server.Close()
+
+	tests := []struct {
+		query    url.Values
+		rawQuery string
+		expected string
+	}{
+		{nil, "b=2&a=%2f", "b=2&a=%2f"},
+		{url.Values{"a": {"3"}}, "b=2&a=%2f", "b=2&a=%2f"},
+		{url.Values{"c": {"x y"}}, "b=2&a=%2f", "b=2&a=%2f&c=x+y"},
+		{url.Values{"c": {"1"}}, "", "c=1"},
+	}
+
+	for _, test := range tests {
+		client, err := NewClient(ClientCfg{
+			BaseURI: server.URL,
+			Query:   test.query,
+		})
+		require.NoError(err)
+
+		req, err := http.NewRequest("GET", "/items?"+test.rawQuery, nil)
+		require.NoError(err)
+
+		res, err := client.Do(req)
+		require.NoError(err)
+		res.Body.Close()
+
+		assert.Equal(test.expected, rawQuery, test.rawQuery)
+
+		client.Terminate()
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type Codec interface {
+	MediaType() string
+	Encode(interface{}) ([]byte, error)
+	Decode([]byte, interface{}) error
+}
+
+// The first codec is used when the client does not express any preference.
+var DefaultCodecs = []Codec{
+	JSONCodec{},
+	MsgPackCodec{},
+	CBORCodec{},
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) MediaType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Encode(value interface{}) ([]byte, error) {
+	return encodeIndentedJSON(value)
+}
+
+func (JSONCodec) Decode(data []byte, dest interface{}) error {
+	return json.Unmarshal(data, dest)
+}
+
+// MsgPackCodec uses json struct tags so that types do not have to be
+// annotated for each encoding.
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) MediaType() string {
+	return "application/msgpack"
+}
+
+func (MsgPackCodec) Encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.SetOmitEmpty(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (MsgPackCodec) Decode(data []byte, dest interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	decoder.SetMapDecoder(func(d *msgpack.Decoder) (interface{}, error) {
+		return d.DecodeUntypedMap()
+	})
+
+	return decoder.Decode(dest)
+}
+
+// CBORCodec relies on the support of json struct tags by the cbor library.
+type CBORCodec struct{}
+
+func (CBORCodec) MediaType() string {
+	return "application/cbor"
+}
+
+func (CBORCodec) Encode(value interface{}) ([]byte, error) {
+	return cbor.Marshal(value)
+}
+
+func (CBORCodec) Decode(data []byte, dest interface{}) error {
+	return cbor.Unmarshal(data, dest)
+}
+
+func (s *Server) codecs() []Codec {
+	if len(s.Cfg.Codecs) == 0 {
+		return DefaultCodecs
+	}
+
+	return s.Cfg.Codecs
+}
+
+// ReplyNegotiated encodes the response with the codec matching the Accept
+// header of the request.
+func (h *Handler) ReplyNegotiated(status int, value interface{}) {
+	codec := h.responseCodec()
+	if codec == nil {
+		h.ReplyError(406, "not_acceptable", "no acceptable media type")
+		return
+	}
+
+	data, err := codec.Encode(value)
+	if err != nil {
+		h.Log.Error("cannot encode %s response: %v", codec.MediaType(), err)
+		h.ResponseWriter.WriteHeader(500)
+		return
+	}
+
+	header := h.ResponseWriter.Header()
+	header.Set("Content-Type", codec.MediaType())
+	header.Add("Vary", "Accept")
+
+	h.Reply(status, bytes.NewReader(data))
+}
+
+func (h *Handler) responseCodec() Codec {
+	codecs := h.Server.codecs()
+
+	accept := h.Request.Header.Get("Accept")
+	if accept == "" {
+		return codecs[0]
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		for _, codec := range codecs {
+			if mediaRangeMatch(mediaRange, codec.MediaType()) {
+				return codec
+			}
+		}
+	}
+
+	return nil
+}
+
+// RequestValue decodes the request body with the codec matching its
+// Content-Type header; requests without content type are decoded as JSON.
+func (h *Handler) RequestValue(dest interface{}) error {
+	codec := h.requestCodec()
+	if codec == nil {
+		contentType := h.Request.Header.Get("Content-Type")
+
+		h.ReplyError(415, "unsupported_media_type",
+			"unsupported media type %q", contentType)
+		return fmt.Errorf("unsupported media type %q", contentType)
+	}
+
+	data, err := h.RequestData()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := codec.(JSONCodec); ok {
+		return h.decodeJSONRequestBody(data, dest)
+	}
+
+	if err := codec.Decode(data, dest); err != nil {
+		h.ReplyError(400, "invalid_request_body",
+			"invalid request body: %v", err)
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+// RequestObject is similar to JSONRequestObject but supports all the codecs
+// of the server.
+func (h *Handler) RequestObject(obj check.Object) error {
+	return h.RequestObject2(obj, nil)
+}
+
+func (h *Handler) RequestObject2(obj check.Object, fn func(*check.Checker)) error {
+	if err := h.RequestValue(obj); err != nil {
+		return err
+	}
+
+	return h.checkRequestObject(obj, fn)
+}
+
+func (h *Handler) requestCodec() Codec {
+	codecs := h.Server.codecs()
+
+	contentType := h.Request.Header.Get("Content-Type")
+	if contentType == "" {
+		return JSONCodec{}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	for _, codec := range codecs {
+		if codec.MediaType() == mediaType {
+			return codec
+		}
+	}
+
+	return nil
+}
+
+type acceptedMediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns media ranges of an Accept header ordered by decreasing
+// quality, ignoring ranges with a zero quality.
+func parseAccept(header string) []string {
+	var ranges []acceptedMediaRange
+
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := params["q"]; found {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		if quality > 0.0 {
+			ranges = append(ranges, acceptedMediaRange{mediaType, quality})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	mediaTypes := make([]string, len(ranges))
+	for i, r := range ranges {
+		mediaTypes[i] = r.mediaType
+	}
+
+	return mediaTypes
+}
+
+func mediaRangeMatch(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(mediaType, mediaRange[:len(mediaRange)-1])
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecTestUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (u *codecTestUser) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("name", u.Name)
+}
+
+func TestParseAccept(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"application/cbor", "application/json", "*/*"},
+		parseAccept("*/*;q=0.1, application/json;q=0.5, "+
+			"application/cbor, text/html;q=0"))
+}
+
+func TestReplyNegotiated(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	user := codecTestUser{Name: "bob", Age: 42}
+
+	for _, codec := range DefaultCodecs {
+		th := NewTestHandler("GET", "/users/1", nil)
+		th.Request.Header.Set("Accept", codec.MediaType())
+		th.ReplyNegotiated(200, user)
+
+		th.AssertStatus(t, 200)
+		assert.Equal(codec.MediaType(),
+			th.Recorder.Header().Get("Content-Type"))
+
+		var user2 codecTestUser
+		require.NoError(codec.Decode(th.Body(), &user2))
+		assert.Equal(user, user2)
+	}
+
+	th := NewTestHandler("GET", "/users/1", nil)
+	th.ReplyNegotiated(200, user)
+	assert.Equal("application/json", th.Recorder.Header().Get("Content-Type"))
+
+	th = NewTestHandler("GET", "/users/1", nil)
+	th.Request.Header.Set("Accept", "text/html")
+	th.ReplyNegotiated(200, user)
+	th.AssertAPIError(t, 406, "not_acceptable")
+}
+
+func TestRequestObject(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, codec := range DefaultCodecs {
+		data, err := codec.Encode(codecTestUser{Name: "bob", Age: 42})
+		require.NoError(err)
+
+		th := NewTestHandler("POST", "/users", bytes.NewReader(data))
+		th.Request.Header.Set("Content-Type", codec.MediaType())
+
+		var user codecTestUser
+		if assert.NoError(th.RequestObject(&user), codec.MediaType()) {
+			assert.Equal("bob", user.Name)
+			assert.Equal(42, user.Age)
+		}
+	}
+
+	data, err := MsgPackCodec{}.Encode(codecTestUser{Age: 42})
+	require.NoError(err)
+
+	th := NewTestHandler("POST", "/users", bytes.NewReader(data))
+	th.Request.Header.Set("Content-Type", "application/msgpack")
+
+	var user codecTestUser
+	assert.Error(th.RequestObject(&user))
+	th.AssertValidationError(t, "/name", "empty_string")
+
+	th = NewTestHandler("POST", "/users", bytes.NewReader(data))
+	th.Request.Header.Set("Content-Type", "text/plain")
+	assert.Error(th.RequestObject(&user))
+	th.AssertAPIError(t, 415, "unsupported_media_type")
+}
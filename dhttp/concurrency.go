@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type ConcurrencyStats struct {
+	MaxRequests      int   `json:"max_requests"`
+	ActiveRequests   int   `json:"active_requests"`
+	QueuedRequests   int   `json:"queued_requests"`
+	RejectedRequests int64 `json:"rejected_requests"`
+}
+
+func (s *Server) initConcurrencyLimit() {
+	if s.Cfg.MaxConcurrentRequests > 0 {
+		s.requestSlots = make(chan struct{}, s.Cfg.MaxConcurrentRequests)
+	}
+}
+
+// ConcurrencyStats returns the current state of the concurrency limiter.
+// The number of rejected requests is cumulative.
+func (s *Server) ConcurrencyStats() ConcurrencyStats {
+	return ConcurrencyStats{
+		MaxRequests:      s.Cfg.MaxConcurrentRequests,
+		ActiveRequests:   len(s.requestSlots),
+		QueuedRequests:   int(atomic.LoadInt32(&s.nbQueuedRequests)),
+		RejectedRequests: atomic.LoadInt64(&s.nbRejectedRequests),
+	}
+}
+
+// acquireRequestSlot returns false if the request was rejected, in which
+// case a response has already been sent.
+func (s *Server) acquireRequestSlot(h *Handler) bool {
+	if s.requestSlots == nil {
+		return true
+	}
+
+	select {
+	case s.requestSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timeout := s.Cfg.ConcurrencyQueueTimeout.Duration()
+
+	if timeout > 0 {
+		nbQueued := atomic.AddInt32(&s.nbQueuedRequests, 1)
+		defer atomic.AddInt32(&s.nbQueuedRequests, -1)
+
+		maxQueued := s.Cfg.MaxQueuedRequests
+		if maxQueued == 0 || int(nbQueued) <= maxQueued {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+
+			select {
+			case s.requestSlots <- struct{}{}:
+				return true
+			case <-timer.C:
+			case <-h.Request.Context().Done():
+			}
+		}
+	}
+
+	atomic.AddInt64(&s.nbRejectedRequests, 1)
+
+	h.ResponseWriter.Header().Set("Retry-After", "1")
+	h.ReplyError(503, "server_overloaded", "too many concurrent requests")
+
+	return false
+}
+
+func (s *Server) releaseRequestSlot() {
+	if s.requestSlots != nil {
+		<-s.requestSlots
+	}
+}
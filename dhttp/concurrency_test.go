@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:               make(chan error, 1),
+		MaxConcurrentRequests:   1,
+		ConcurrencyQueueTimeout: dtime.Duration(50 * time.Millisecond),
+	})
+	require.NoError(err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	server.Route("/slow", "GET", func(h *Handler) {
+		close(started)
+		<-release
+		h.ReplyEmpty(204)
+	})
+	server.Route("/fast", "GET", func(h *Handler) {
+		h.ReplyEmpty(204)
+	})
+
+	call := func(path string) int {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(204, call("/slow"))
+	}()
+
+	<-started
+
+	assert.Equal(1, server.ConcurrencyStats().ActiveRequests)
+
+	// The request waits for the queue timeout then is rejected
+	assert.Equal(503, call("/fast"))
+	assert.Equal(int64(1), server.ConcurrencyStats().RejectedRequests)
+
+	// The request waits until the slow request is done
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	assert.Equal(204, call("/fast"))
+
+	wg.Wait()
+
+	assert.Equal(0, server.ConcurrencyStats().ActiveRequests)
+}
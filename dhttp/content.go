@@ -0,0 +1,36 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// ReplyContent sends the content of a seekable reader, handling range
+// requests (Range, If-Range) and conditional requests (If-Modified-Since,
+// If-None-Match when the ETag header is set). The name is used to detect the
+// content type if the Content-Type header is not set; the modification time
+// is ignored if it is zero.
+func (h *Handler) ReplyContent(name string, modTime time.Time, content io.ReadSeeker) {
+	http.ServeContent(h.ResponseWriter, h.Request, name, modTime, content)
+}
+
+// ReplyContentReaderAt is similar to ReplyContent for content whose size is
+// known in advance, e.g. an object in a remote store.
+func (h *Handler) ReplyContentReaderAt(name string, modTime time.Time, content io.ReaderAt, size int64) {
+	h.ReplyContent(name, modTime, io.NewSectionReader(content, 0, size))
+}
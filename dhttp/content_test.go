@@ -0,0 +1,49 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyContent(t *testing.T) {
+	assert := assert.New(t)
+
+	content := "0123456789"
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	th := NewTestHandler("GET", "/file", nil)
+	th.ReplyContent("file.txt", modTime, strings.NewReader(content))
+	th.AssertStatus(t, 200)
+	assert.Equal(content, string(th.Body()))
+	assert.Equal("bytes", th.Recorder.Header().Get("Accept-Ranges"))
+
+	th = NewTestHandler("GET", "/file", nil)
+	th.Request.Header.Set("Range", "bytes=2-5")
+	th.ReplyContentReaderAt("file.txt", modTime, strings.NewReader(content),
+		int64(len(content)))
+	th.AssertStatus(t, 206)
+	assert.Equal("2345", string(th.Body()))
+	assert.Equal("bytes 2-5/10", th.Recorder.Header().Get("Content-Range"))
+
+	th = NewTestHandler("GET", "/file", nil)
+	th.Request.Header.Set("Range", "bytes=20-")
+	th.ReplyContent("file.txt", modTime, strings.NewReader(content))
+	th.AssertStatus(t, 416)
+}
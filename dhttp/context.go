@@ -0,0 +1,55 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+
+	"github.com/exograd/go-daemon/dlog"
+)
+
+type loggerContextKey struct{}
+
+func ContextWithLogger(ctx context.Context, log *dlog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, log)
+}
+
+func LoggerFromContext(ctx context.Context) *dlog.Logger {
+	if log, ok := ctx.Value(loggerContextKey{}).(*dlog.Logger); ok {
+		return log
+	}
+
+	return nil
+}
+
+func HandlerFromContext(ctx context.Context) *Handler {
+	if h, ok := ctx.Value(contextKeyHandler).(*Handler); ok {
+		return h
+	}
+
+	return nil
+}
+
+// Context returns the context of the request, which contains the handler,
+// the request id and the logger of the handler.
+//
+// The context is canceled when the client closes the connection or when
+// the server is shut down, so that long-running handlers should pass it to
+// database queries and outgoing requests to abort them early. Note that
+// for HTTP/1.x, a closed connection can only be detected once the request
+// body has been read entirely.
+func (h *Handler) Context() context.Context {
+	return h.Request.Context()
+}
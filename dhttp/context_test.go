@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerContext(t *testing.T) {
+	assert := assert.New(t)
+
+	th := NewTestHandler("GET", "/", nil)
+	ctx := th.Context()
+
+	assert.Equal(th.Handler, HandlerFromContext(ctx))
+	assert.Equal(th.Log, LoggerFromContext(ctx))
+}
+
+func TestHandlerContextClientDisconnect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		Address:   "localhost:0",
+	})
+	require.NoError(err)
+
+	canceled := make(chan struct{})
+
+	server.Route("/slow", "GET", func(h *Handler) {
+		select {
+		case <-h.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	require.NoError(server.Start())
+	defer server.Stop()
+
+	client := http.Client{Timeout: 100 * time.Millisecond}
+	_, err = client.Get("http://" + server.Address() + "/slow")
+	assert.Error(err)
+
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Error("request context was not canceled")
+	}
+}
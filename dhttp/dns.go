@@ -0,0 +1,221 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+type Resolver interface {
+	LookupIPAddr(context.Context, string) ([]net.IPAddr, error)
+}
+
+// DNSCfg controls the resolution of host names by http clients.
+//
+// Hosts contains static addresses for host names, bypassing resolution
+// entirely. When the cache is enabled, resolved addresses are kept for
+// CacheTTL (the standard resolver does not expose record TTLs); expired
+// entries are still used for up to StaleTTL if resolution fails.
+type DNSCfg struct {
+	Hosts map[string][]string `json:"hosts,omitempty"`
+
+	Cache    bool           `json:"cache,omitempty"`
+	CacheTTL dtime.Duration `json:"cache_ttl,omitempty"`
+	StaleTTL dtime.Duration `json:"stale_ttl,omitempty"`
+
+	// The resolver used for names which are not static hosts;
+	// net.DefaultResolver if nil.
+	Resolver Resolver `json:"-"`
+}
+
+func (cfg *DNSCfg) Check(c *check.Checker) {
+	c.WithChild("hosts", func() {
+		for host, addresses := range cfg.Hosts {
+			c.WithChild(host, func() {
+				for i, address := range addresses {
+					c.Check(i, net.ParseIP(address) != nil, "invalid_address",
+						"string must be an ip address")
+				}
+			})
+
+			c.CheckArrayNotEmpty(host, addresses)
+		}
+	})
+
+	c.CheckDurationMin("cache_ttl", cfg.CacheTTL.Duration(), 0)
+	c.CheckDurationMin("stale_ttl", cfg.StaleTTL.Duration(), 0)
+}
+
+type dnsResolver struct {
+	resolver Resolver
+	hosts    map[string][]net.IP
+
+	cache    bool
+	cacheTTL time.Duration
+	staleTTL time.Duration
+
+	entries     map[string]*dnsCacheEntry
+	entriesLock sync.Mutex
+}
+
+type dnsCacheEntry struct {
+	addresses  []net.IP
+	expiration time.Time
+}
+
+func newDNSResolver(cfg *DNSCfg) (*dnsResolver, error) {
+	r := dnsResolver{
+		resolver: cfg.Resolver,
+		hosts:    make(map[string][]net.IP),
+
+		cache:    cfg.Cache,
+		cacheTTL: cfg.CacheTTL.Duration(),
+		staleTTL: cfg.StaleTTL.Duration(),
+
+		entries: make(map[string]*dnsCacheEntry),
+	}
+
+	if r.resolver == nil {
+		r.resolver = net.DefaultResolver
+	}
+
+	if r.cacheTTL == 0 {
+		r.cacheTTL = time.Minute
+	}
+
+	if r.staleTTL == 0 {
+		r.staleTTL = 10 * time.Minute
+	}
+
+	for host, addresses := range cfg.Hosts {
+		ips := make([]net.IP, len(addresses))
+
+		for i, address := range addresses {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q for host %q",
+					address, host)
+			}
+
+			ips[i] = ip
+		}
+
+		r.hosts[strings.ToLower(host)] = ips
+	}
+
+	return &r, nil
+}
+
+func (r *dnsResolver) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(host)
+
+	if ips, found := r.hosts[host]; found {
+		return ips, nil
+	}
+
+	if !r.cache {
+		return r.resolve(ctx, host)
+	}
+
+	now := time.Now()
+
+	r.entriesLock.Lock()
+	entry := r.entries[host]
+	r.entriesLock.Unlock()
+
+	if entry != nil && now.Before(entry.expiration) {
+		return entry.addresses, nil
+	}
+
+	ips, err := r.resolve(ctx, host)
+	if err != nil {
+		if entry != nil && now.Before(entry.expiration.Add(r.staleTTL)) {
+			return entry.addresses, nil
+		}
+
+		return nil, err
+	}
+
+	r.entriesLock.Lock()
+	r.entries[host] = &dnsCacheEntry{
+		addresses:  ips,
+		expiration: now.Add(r.cacheTTL),
+	}
+	r.entriesLock.Unlock()
+
+	return ips, nil
+}
+
+func (r *dnsResolver) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address found for host %q", host)
+	}
+
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+
+	return ips, nil
+}
+
+// dialContext connects to an address using the resolver, trying each
+// address of the host in order until a connection is established.
+func (r *dnsResolver) dialContext(ctx context.Context, dialer *net.Dialer, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	var lastErr error
+
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network,
+			net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		lastErr = err
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
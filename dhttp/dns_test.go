@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testResolver struct {
+	addresses []net.IPAddr
+	err       error
+	nbLookups int
+}
+
+func (r *testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.nbLookups++
+	return r.addresses, r.err
+}
+
+func TestDNSResolverCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tr := testResolver{
+		addresses: []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}},
+	}
+
+	r, err := newDNSResolver(&DNSCfg{
+		Hosts: map[string][]string{"static.test": {"198.51.100.1"}},
+
+		Cache:    true,
+		CacheTTL: dtime.Duration(time.Hour),
+		Resolver: &tr,
+	})
+	require.NoError(err)
+
+	ctx := context.Background()
+
+	ips, err := r.lookup(ctx, "Static.Test")
+	if assert.NoError(err) && assert.Len(ips, 1) {
+		assert.Equal("198.51.100.1", ips[0].String())
+	}
+	assert.Equal(0, tr.nbLookups)
+
+	for i := 0; i < 2; i++ {
+		ips, err = r.lookup(ctx, "example.test")
+		if assert.NoError(err) && assert.Len(ips, 1) {
+			assert.Equal("192.0.2.1", ips[0].String())
+		}
+	}
+	assert.Equal(1, tr.nbLookups)
+
+	// Expired entries are used when resolution fails
+	r.entries["example.test"].expiration = time.Now().Add(-time.Minute)
+	tr.err = errors.New("resolution failure")
+
+	ips, err = r.lookup(ctx, "example.test")
+	if assert.NoError(err) && assert.Len(ips, 1) {
+		assert.Equal("192.0.2.1", ips[0].String())
+	}
+	assert.Equal(2, tr.nbLookups)
+
+	r.entries["example.test"].expiration = time.Now().Add(-time.Hour)
+
+	_, err = r.lookup(ctx, "example.test")
+	assert.Error(err)
+}
+
+func TestClientDNSHosts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(err)
+
+	client, err := NewClient(ClientCfg{
+		DNS: &DNSCfg{
+			Hosts: map[string][]string{"stub.test": {"127.0.0.1"}},
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	req, err := http.NewRequest("GET", "http://stub.test:"+port+"/", nil)
+	require.NoError(err)
+
+	res, err := client.Do(req)
+	if assert.NoError(err) {
+		res.Body.Close()
+		assert.Equal(204, res.StatusCode)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+type DownloadOptions struct {
+	Header http.Header
+
+	// The expected SHA-256 checksum of the file, in hexadecimal.
+	SHA256 string
+
+	// Resume an interrupted download using the partial file left by a
+	// previous call instead of starting again.
+	Resume bool
+
+	// Called each time data are written with the number of bytes
+	// downloaded so far and the total size of the file, or -1 if it is not
+	// known.
+	Progress func(size, totalSize int64)
+}
+
+// DownloadFile downloads a file to destPath. Data are written to a
+// temporary file named destPath + ".part" which is renamed once the download
+// is complete and its checksum verified. Note that the timeout of the client
+// applies to the entire download.
+func (c *Client) DownloadFile(ctx context.Context, uri, destPath string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+
+	partPath := destPath + ".part"
+
+	if err := c.downloadFile(ctx, uri, partPath, opts); err != nil {
+		if !opts.Resume || errors.Is(err, ErrChecksumMismatch) {
+			os.Remove(partPath)
+		}
+
+		return err
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		return fmt.Errorf("cannot rename %q: %w", partPath, err)
+	}
+
+	return nil
+}
+
+func (c *Client) downloadFile(ctx context.Context, uri, partPath string, opts *DownloadOptions) error {
+	var offset int64
+
+	if opts.Resume {
+		info, err := os.Stat(partPath)
+		if err == nil {
+			offset = info.Size()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot stat %q: %w", partPath, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	for name, values := range opts.Header {
+		req.Header[name] = values
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	totalSize := int64(-1)
+
+	switch {
+	case res.StatusCode == 206 && offset > 0:
+		start, size, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+
+		if start != offset {
+			return fmt.Errorf("server returned range starting at %d instead "+
+				"of %d", start, offset)
+		}
+
+		totalSize = size
+
+	case res.StatusCode == 416 && offset > 0:
+		// The partial file is already complete
+		return verifyDownloadChecksum(partPath, nil, opts)
+
+	case res.StatusCode == 200:
+		offset = 0
+
+		if res.ContentLength >= 0 {
+			totalSize = res.ContentLength
+		}
+
+	default:
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset > 0 {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", partPath, err)
+	}
+	defer file.Close()
+
+	var h hash.Hash
+	if opts.SHA256 != "" {
+		h = sha256.New()
+
+		if offset > 0 {
+			if err := hashFile(h, partPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := &downloadWriter{
+		file:      file,
+		hash:      h,
+		size:      offset,
+		totalSize: totalSize,
+		progress:  opts.Progress,
+	}
+
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return fmt.Errorf("cannot download file: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("cannot sync %q: %w", partPath, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("cannot close %q: %w", partPath, err)
+	}
+
+	return verifyDownloadChecksum(partPath, h, opts)
+}
+
+func verifyDownloadChecksum(filePath string, h hash.Hash, opts *DownloadOptions) error {
+	if opts.SHA256 == "" {
+		return nil
+	}
+
+	if h == nil {
+		h = sha256.New()
+
+		if err := hashFile(h, filePath); err != nil {
+			return err
+		}
+	}
+
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(checksum, opts.SHA256) {
+		return fmt.Errorf("%w: expected %s but got %s", ErrChecksumMismatch,
+			strings.ToLower(opts.SHA256), checksum)
+	}
+
+	return nil
+}
+
+func hashFile(h hash.Hash, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// parseContentRange parses a Content-Range header value of the form
+// "bytes <first>-<last>/<size>", size being -1 if it is unknown.
+func parseContentRange(s string) (int64, int64, error) {
+	invalid := fmt.Errorf("invalid content range %q", s)
+
+	rangeString, sizeString, found := strings.Cut(strings.TrimPrefix(s, "bytes "), "/")
+	if !found {
+		return 0, 0, invalid
+	}
+
+	firstString, _, found := strings.Cut(rangeString, "-")
+	if !found {
+		return 0, 0, invalid
+	}
+
+	first, err := strconv.ParseInt(firstString, 10, 64)
+	if err != nil {
+		return 0, 0, invalid
+	}
+
+	size := int64(-1)
+	if sizeString != "*" {
+		size, err = strconv.ParseInt(sizeString, 10, 64)
+		if err != nil {
+			return 0, 0, invalid
+		}
+	}
+
+	return first, size, nil
+}
+
+type downloadWriter struct {
+	file      *os.File
+	hash      hash.Hash
+	size      int64
+	totalSize int64
+	progress  func(int64, int64)
+}
+
+func (w *downloadWriter) Write(data []byte) (int, error) {
+	n, err := w.file.Write(data)
+
+	if w.hash != nil {
+		w.hash.Write(data[:n])
+	}
+
+	w.size += int64(n)
+
+	if w.progress != nil && n > 0 {
+		w.progress(w.size, w.totalSize)
+	}
+
+	return n, err
+}
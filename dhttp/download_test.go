@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDownloadFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := bytes.Repeat([]byte("0123456789"), 10_000)
+	hash := sha256.Sum256(content)
+	checksum := hex.EncodeToString(hash[:])
+
+	var ranges []string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			ranges = append(ranges, req.Header.Get("Range"))
+			http.ServeContent(w, req, "file", time.Time{},
+				bytes.NewReader(content))
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{BaseURI: server.URL})
+	require.NoError(err)
+	defer client.Terminate()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Complete download
+	destPath := filepath.Join(dir, "a")
+
+	var lastSize, lastTotalSize int64
+
+	err = client.DownloadFile(ctx, "/file", destPath, &DownloadOptions{
+		SHA256: checksum,
+		Progress: func(size, totalSize int64) {
+			lastSize, lastTotalSize = size, totalSize
+		},
+	})
+	if assert.NoError(err) {
+		data, err := os.ReadFile(destPath)
+		require.NoError(err)
+		assert.Equal(content, data)
+
+		assert.Equal(int64(len(content)), lastSize)
+		assert.Equal(int64(len(content)), lastTotalSize)
+	}
+
+	// Resumed download
+	destPath = filepath.Join(dir, "b")
+
+	err = os.WriteFile(destPath+".part", content[:12_345], 0644)
+	require.NoError(err)
+
+	ranges = nil
+
+	err = client.DownloadFile(ctx, "/file", destPath, &DownloadOptions{
+		SHA256: checksum,
+		Resume: true,
+	})
+	if assert.NoError(err) {
+		assert.Equal([]string{"bytes=12345-"}, ranges)
+
+		data, err := os.ReadFile(destPath)
+		require.NoError(err)
+		assert.Equal(content, data)
+	}
+
+	// Checksum mismatch
+	destPath = filepath.Join(dir, "c")
+
+	invalidChecksum := []byte(checksum)
+	invalidChecksum[0] ^= 1
+
+	err = client.DownloadFile(ctx, "/file", destPath, &DownloadOptions{
+		SHA256: string(invalidChecksum),
+	})
+	assert.True(errors.Is(err, ErrChecksumMismatch))
+
+	assert.NoFileExists(destPath)
+	assert.NoFileExists(destPath + ".part")
+}
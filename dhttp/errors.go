@@ -1,6 +1,22 @@
 package dhttp
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/exograd/go-daemon/derr"
+)
+
+// ErrorCodeStatuses associates derr codes with the status of the response
+// sent by ReplyCodedError. Errors with other codes are internal errors.
+var ErrorCodeStatuses = map[string]int{
+	derr.CodeInvalidInput: 400,
+	derr.CodeUnauthorized: 401,
+	derr.CodeForbidden:    403,
+	derr.CodeNotFound:     404,
+	derr.CodeConflict:     409,
+	derr.CodeUnavailable:  503,
+	derr.CodeTimeout:      504,
+}
 
 type InvalidQueryParameterError struct {
 	Name    string
@@ -17,3 +33,46 @@ func NewInvalidQueryParameterError(name, format string, args ...interface{}) *In
 func (err InvalidQueryParameterError) Error() string {
 	return fmt.Sprintf("invalid query parameter %q: %s", err.Name, err.Message)
 }
+
+// ReplyCodedError replies with the status associated with the code of the
+// first derr.Error in the chain of an error. Errors without code or with an
+// unknown code are handled as internal errors.
+//
+// Only the message of the derr.Error is sent to the client; the message of
+// the errors it wraps can contain internal details and is only logged.
+func (h *Handler) ReplyCodedError(err error) {
+	codedErr, ok := derr.As(err)
+	if !ok {
+		h.ReplyInternalError(500, "%v", err)
+		return
+	}
+
+	status, found := ErrorCodeStatuses[codedErr.Code]
+	if !found {
+		h.ReplyInternalError(500, "%v", err)
+		return
+	}
+
+	msg := codedErr.Message
+	if msg == "" {
+		msg = codedErr.Code
+	}
+
+	if status >= 500 && h.ClientAborted() {
+		h.handleClientAbort(err.Error())
+		return
+	}
+
+	if status >= 500 {
+		h.Log.Error("%s error: %v", codedErr.Code, err)
+
+		if h.Server.Cfg.HideInternalErrors {
+			msg = codedErr.Code
+		}
+	}
+
+	h.errorCode = codedErr.Code
+
+	h.ReplyErrorData(status, codedErr.Code, APIErrorData(codedErr.Data),
+		"%s", msg)
+}
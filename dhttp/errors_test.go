@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+package dhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exograd/go-daemon/derr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplyCodedError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	server.Route("/conflict", "GET", func(h *Handler) {
+		baseErr := errors.New(`duplicate key "users_email_key"`)
+		err := fmt.Errorf("cannot insert user: %w",
+			derr.Wrap(baseErr, derr.CodeConflict, "user already exists"))
+		h.ReplyCodedError(err)
+	})
+
+	server.Route("/no-message", "GET", func(h *Handler) {
+		baseErr := errors.New("relation \"users\" does not exist")
+		h.ReplyCodedError(derr.Wrap(baseErr, derr.CodeNotFound, ""))
+	})
+
+	call := func(uri string) (int, APIError) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+
+		var apiErr APIError
+		require.NoError(json.Unmarshal(w.Body.Bytes(), &apiErr))
+
+		return w.Code, apiErr
+	}
+
+	status, apiErr := call("/conflict")
+	assert.Equal(409, status)
+	assert.Equal(derr.CodeConflict, apiErr.Code)
+	assert.Equal("user already exists", apiErr.Message)
+
+	status, apiErr = call("/no-message")
+	assert.Equal(404, status)
+	assert.Equal(derr.CodeNotFound, apiErr.Code)
+	assert.Equal(derr.CodeNotFound, apiErr.Message)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONETag returns a strong entity tag computed from the JSON representation
+// of a value, as sent by ReplyJSONWithETag.
+func JSONETag(value interface{}) (string, error) {
+	data, err := encodeIndentedJSON(value)
+	if err != nil {
+		return "", err
+	}
+
+	return dataETag(data), nil
+}
+
+func dataETag(data []byte) string {
+	hash := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+func encodeIndentedJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(value); err != nil {
+		return nil, fmt.Errorf("cannot encode json value: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ReplyJSONWithETag is similar to ReplyJSON but sets the ETag header. For
+// GET and HEAD requests whose If-None-Match header matches the entity tag,
+// an empty response with the 304 status is sent instead.
+func (h *Handler) ReplyJSONWithETag(status int, value interface{}) {
+	data, err := encodeIndentedJSON(value)
+	if err != nil {
+		h.Log.Error("%v", err)
+		h.ResponseWriter.WriteHeader(500)
+		return
+	}
+
+	etag := dataETag(data)
+
+	header := h.ResponseWriter.Header()
+	header.Set("ETag", etag)
+
+	method := h.Request.Method
+	if (method == "GET" || method == "HEAD") && status >= 200 && status < 300 {
+		if etagListMatch(h.Request.Header.Get("If-None-Match"), etag, true) {
+			h.ReplyEmpty(304)
+			return
+		}
+	}
+
+	header.Set("Content-Type", "application/json")
+
+	h.Reply(status, bytes.NewReader(data))
+}
+
+// CheckIfMatch validates the If-Match header of the request against the
+// current entity tag of the resource. If the header is present and does not
+// match, a 412 error is sent and the function returns false. Handlers
+// implementing optimistic concurrency should call it before applying an
+// update.
+func (h *Handler) CheckIfMatch(etag string) bool {
+	value := h.Request.Header.Get("If-Match")
+	if value == "" {
+		return true
+	}
+
+	if etagListMatch(value, etag, false) {
+		return true
+	}
+
+	h.ReplyError(412, "precondition_failed",
+		"resource has been modified")
+
+	return false
+}
+
+// RequireIfMatch is similar to CheckIfMatch but also rejects requests without
+// an If-Match header with a 428 error.
+func (h *Handler) RequireIfMatch(etag string) bool {
+	if h.Request.Header.Get("If-Match") == "" {
+		h.ReplyError(428, "precondition_required",
+			"missing If-Match header")
+		return false
+	}
+
+	return h.CheckIfMatch(etag)
+}
+
+// etagListMatch checks if an entity tag is part of the list of entity tags
+// of an If-Match or If-None-Match header. Weak comparison (used for
+// If-None-Match) ignores the W/ prefix; strong comparison never matches weak
+// tags.
+func etagListMatch(header, etag string, weak bool) bool {
+	if header == "" {
+		return false
+	}
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplyJSONWithETag(t *testing.T) {
+	assert := assert.New(t)
+
+	value := map[string]string{"name": "bob"}
+
+	etag, err := JSONETag(value)
+	require.NoError(t, err)
+
+	th := NewTestHandler("GET", "/users/1", nil)
+	th.ReplyJSONWithETag(200, value)
+	th.AssertStatus(t, 200)
+	assert.Equal(etag, th.Recorder.Header().Get("ETag"))
+
+	th = NewTestHandler("GET", "/users/1", nil)
+	th.Request.Header.Set("If-None-Match", `"foo", W/`+etag)
+	th.ReplyJSONWithETag(200, value)
+	th.AssertStatus(t, 304)
+	assert.Empty(th.Body())
+
+	th = NewTestHandler("GET", "/users/1", nil)
+	th.Request.Header.Set("If-None-Match", `"foo"`)
+	th.ReplyJSONWithETag(200, value)
+	th.AssertStatus(t, 200)
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	etag := `"abc"`
+
+	th := NewTestHandler("PUT", "/users/1", strings.NewReader("{}"))
+	assert.True(th.CheckIfMatch(etag))
+
+	th = NewTestHandler("PUT", "/users/1", strings.NewReader("{}"))
+	th.Request.Header.Set("If-Match", `"abc"`)
+	assert.True(th.CheckIfMatch(etag))
+
+	th = NewTestHandler("PUT", "/users/1", strings.NewReader("{}"))
+	th.Request.Header.Set("If-Match", `"def"`)
+	assert.False(th.CheckIfMatch(etag))
+	th.AssertAPIError(t, 412, "precondition_failed")
+
+	th = NewTestHandler("PUT", "/users/1", strings.NewReader("{}"))
+	assert.False(th.RequireIfMatch(etag))
+	th.AssertAPIError(t, 428, "precondition_required")
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"github.com/exograd/go-daemon/dflag"
+)
+
+func (h *Handler) FlagBucketKey() string {
+	if name := h.Server.Cfg.FlagBucketHeader; name != "" {
+		if value := h.Request.Header.Get(name); value != "" {
+			return value
+		}
+	}
+
+	return h.ClientAddress
+}
+
+func (h *Handler) FlagEnabled(f *dflag.PercentageFlag) bool {
+	return f.Enabled(h.FlagBucketKey())
+}
+
+func (h *Handler) FlagEnabledByHeader(f *dflag.PercentageFlag, name string) bool {
+	key := h.Request.Header.Get(name)
+	if key == "" {
+		key = h.ClientAddress
+	}
+
+	return f.Enabled(key)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+// GraphQLCfg controls GraphQL requests. If PersistedQueries is set, queries
+// are first sent as a SHA-256 hash following the automatic persisted query
+// protocol, and only sent in full if the server does not know the hash.
+type GraphQLCfg struct {
+	Path             string `json:"path,omitempty"` // "/graphql" by default
+	PersistedQueries bool   `json:"persisted_queries,omitempty"`
+}
+
+func (cfg *GraphQLCfg) Check(c *check.Checker) {
+	if cfg.Path != "" {
+		_, err := url.Parse(cfg.Path)
+		c.Check("path", err == nil, "invalid_uri_reference",
+			"string must be a valid uri reference")
+	}
+}
+
+type GraphQLErrorLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLErrorLocation `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (err GraphQLError) Error() string {
+	return err.Message
+}
+
+// Code returns the "code" extension of the error, the convention used by
+// most servers to identify errors.
+func (err GraphQLError) Code() string {
+	code, _ := err.Extensions["code"].(string)
+	return code
+}
+
+// DecodeExtensions decodes the extensions of the error into a value.
+func (err GraphQLError) DecodeExtensions(dest interface{}) error {
+	data, err2 := json.Marshal(err.Extensions)
+	if err2 != nil {
+		return fmt.Errorf("cannot encode extensions: %w", err2)
+	}
+
+	if err2 := json.Unmarshal(data, dest); err2 != nil {
+		return fmt.Errorf("cannot decode extensions: %w", err2)
+	}
+
+	return nil
+}
+
+type GraphQLErrors []GraphQLError
+
+func (errs GraphQLErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+
+	return "graphql errors: " + strings.Join(messages, "; ")
+}
+
+// HasCode returns true if at least one error has a specific code.
+func (errs GraphQLErrors) HasCode(code string) bool {
+	for _, err := range errs {
+		if err.Code() == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// SendGraphQL sends a GraphQL query and decodes the data field of the
+// response into dest. If the response contains errors, they are returned as
+// a GraphQLErrors value; data are still decoded since servers can return
+// partial results.
+func (c *APIClient) SendGraphQL(ctx context.Context, query string, variables map[string]interface{}, dest interface{}) error {
+	req := graphQLRequest{
+		Query:     query,
+		Variables: variables,
+	}
+
+	cfg := c.Cfg.GraphQL
+	if cfg == nil {
+		cfg = &GraphQLCfg{}
+	}
+
+	if cfg.PersistedQueries {
+		hash := sha256.Sum256([]byte(query))
+
+		req.Query = ""
+		req.Extensions = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hex.EncodeToString(hash[:]),
+			},
+		}
+
+		res, err := c.sendGraphQLRequest(ctx, cfg, &req)
+		if err == nil || !isPersistedQueryNotFound(err) {
+			return decodeGraphQLResponse(res, err, dest)
+		}
+
+		req.Query = query
+	}
+
+	res, err := c.sendGraphQLRequest(ctx, cfg, &req)
+	return decodeGraphQLResponse(res, err, dest)
+}
+
+func (c *APIClient) sendGraphQLRequest(ctx context.Context, cfg *GraphQLCfg, req *graphQLRequest) (*graphQLResponse, error) {
+	uriPath := cfg.Path
+	if uriPath == "" {
+		uriPath = "/graphql"
+	}
+
+	uri, err := c.ResolveURI(uriPath)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode request body: %w", err)
+	}
+
+	header := map[string]string{
+		"Accept":       "application/graphql-response+json, application/json",
+		"Content-Type": "application/json",
+	}
+
+	res, err := c.Client.SendRequestContext(ctx, "POST", uri, header,
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	var statusErr error
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		statusErr = &APIRequestError{
+			Status: res.StatusCode,
+			Message: fmt.Sprintf("request failed with status %d",
+				res.StatusCode),
+		}
+	}
+
+	// Servers can use 4xx and 5xx status codes for responses containing
+	// errors, so the body is decoded first.
+	var gqlRes graphQLResponse
+	if err := json.Unmarshal(resBody, &gqlRes); err != nil {
+		if statusErr != nil {
+			return nil, statusErr
+		}
+
+		return nil, fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	if len(gqlRes.Errors) > 0 {
+		return &gqlRes, gqlRes.Errors
+	}
+
+	if statusErr != nil {
+		return nil, statusErr
+	}
+
+	return &gqlRes, nil
+}
+
+func decodeGraphQLResponse(res *graphQLResponse, err error, dest interface{}) error {
+	if res == nil {
+		return err
+	}
+
+	if dest != nil && len(res.Data) > 0 && string(res.Data) != "null" {
+		if err2 := json.Unmarshal(res.Data, dest); err2 != nil {
+			return fmt.Errorf("cannot decode response data: %w", err2)
+		}
+	}
+
+	return err
+}
+
+func isPersistedQueryNotFound(err error) bool {
+	var errs GraphQLErrors
+	if !errors.As(err, &errs) {
+		return false
+	}
+
+	for _, err := range errs {
+		if err.Message == "PersistedQueryNotFound" ||
+			err.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+
+	return false
+}
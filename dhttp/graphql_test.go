@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIClientSendGraphQL(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	persistedQueries := make(map[string]string)
+
+	var requests []graphQLRequest
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			assert.Equal("/api/graphql", req.URL.Path)
+
+			var gqlReq graphQLRequest
+			require.NoError(json.NewDecoder(req.Body).Decode(&gqlReq))
+
+			requests = append(requests, gqlReq)
+
+			query := gqlReq.Query
+
+			if pq, ok := gqlReq.Extensions["persistedQuery"].(map[string]interface{}); ok {
+				hash := pq["sha256Hash"].(string)
+
+				if query == "" {
+					query = persistedQueries[hash]
+				} else {
+					persistedQueries[hash] = query
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+
+			switch query {
+			case "":
+				w.Write([]byte(`{"errors": [{"message": "PersistedQueryNotFound", "extensions": {"code": "PERSISTED_QUERY_NOT_FOUND"}}]}`))
+
+			case "query { user }":
+				w.Write([]byte(`{"data": {"user": "bob"}}`))
+
+			default:
+				w.WriteHeader(400)
+				w.Write([]byte(`{"data": {"user": null}, "errors": [{"message": "forbidden", "path": ["user"], "extensions": {"code": "FORBIDDEN", "retry": false}}]}`))
+			}
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{
+		BaseURI: server.URL,
+		GraphQL: &GraphQLCfg{
+			Path:             "/api/graphql",
+			PersistedQueries: true,
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	apiClient := NewAPIClient(client)
+
+	ctx := context.Background()
+
+	var data struct {
+		User *string `json:"user"`
+	}
+
+	// The first request registers the query, the second one only uses the
+	// hash.
+	for i := 0; i < 2; i++ {
+		err = apiClient.SendGraphQL(ctx, "query { user }", nil, &data)
+		if assert.NoError(err) && assert.NotNil(data.User) {
+			assert.Equal("bob", *data.User)
+		}
+	}
+
+	if assert.Len(requests, 3) {
+		assert.Empty(requests[0].Query)
+		assert.NotEmpty(requests[1].Query)
+		assert.Empty(requests[2].Query)
+	}
+
+	err = apiClient.SendGraphQL(ctx, "query { admin }",
+		map[string]interface{}{"id": 42}, &data)
+
+	var errs GraphQLErrors
+	if assert.True(errors.As(err, &errs)) && assert.Len(errs, 1) {
+		assert.True(errs.HasCode("FORBIDDEN"))
+		assert.Equal([]interface{}{"user"}, errs[0].Path)
+
+		var extensions struct {
+			Retry bool `json:"retry"`
+		}
+
+		require.NoError(errs[0].DecodeExtensions(&extensions))
+		assert.False(extensions.Retry)
+	}
+
+	assert.Nil(data.User)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import "strings"
+
+// Middleware wraps a route function, e.g. to run code before or after it.
+type Middleware func(RouteFunc) RouteFunc
+
+// Group is a set of routes sharing a host, a pattern prefix, middlewares,
+// authentication requirements and error handling settings. Groups are
+// created with Server.Group or Server.Host and can be nested.
+type Group struct {
+	Server *Server
+	Host   string // empty for groups matching all hosts
+	Prefix string
+
+	middlewares  []Middleware
+	authRequired bool
+	authScopes   []string
+	errorHandler ErrorHandler
+	errorFormat  ErrorFormat
+}
+
+// Group creates a group of routes whose patterns start with prefix and calls
+// fn to configure it and register its routes.
+func (s *Server) Group(prefix string, fn func(*Group)) *Group {
+	g := &Group{
+		Server: s,
+		Prefix: prefix,
+	}
+
+	fn(g)
+
+	return g
+}
+
+// Group creates a child group which inherits the settings of g.
+func (g *Group) Group(prefix string, fn func(*Group)) *Group {
+	g2 := &Group{
+		Server: g.Server,
+		Host:   g.Host,
+		Prefix: joinRoutePatterns(g.Prefix, prefix),
+
+		middlewares:  append([]Middleware{}, g.middlewares...),
+		authRequired: g.authRequired,
+		authScopes:   append([]string{}, g.authScopes...),
+		errorHandler: g.errorHandler,
+		errorFormat:  g.errorFormat,
+	}
+
+	fn(g2)
+
+	return g2
+}
+
+// Use adds middlewares to the group. Middlewares only apply to routes
+// registered after the call, and are called in the order they were added.
+func (g *Group) Use(middlewares ...Middleware) *Group {
+	g.middlewares = append(g.middlewares, middlewares...)
+	return g
+}
+
+func (g *Group) RequireAuth(scopes ...string) *Group {
+	g.authRequired = true
+	g.authScopes = append(g.authScopes, scopes...)
+	return g
+}
+
+func (g *Group) SetErrorHandler(handler ErrorHandler) *Group {
+	g.errorHandler = handler
+	return g
+}
+
+func (g *Group) SetErrorFormat(format ErrorFormat) *Group {
+	g.errorFormat = format
+	return g
+}
+
+func (g *Group) Route(pattern, method string, routeFunc RouteFunc) *Route {
+	for i := len(g.middlewares) - 1; i >= 0; i-- {
+		routeFunc = g.middlewares[i](routeFunc)
+	}
+
+	route := g.Server.route(g.Host, joinRoutePatterns(g.Prefix, pattern),
+		method, routeFunc)
+
+	if g.authRequired {
+		route.RequireAuth(g.authScopes...)
+	}
+
+	route.ErrorHandler = g.errorHandler
+	route.ErrorFormat = g.errorFormat
+
+	return route
+}
+
+func joinRoutePatterns(prefix, pattern string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	if pattern == "" || pattern == "/" {
+		if prefix == "" {
+			return "/"
+		}
+
+		return prefix
+	}
+
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+
+	return prefix + pattern
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroups(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	authenticator := AuthenticatorFunc(func(h *Handler) (*Principal, error) {
+		if h.BearerToken() == "admin" {
+			return &Principal{Id: "a", Scopes: []string{"admin"}}, nil
+		}
+
+		return nil, nil
+	})
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:      make(chan error, 1),
+		Authenticators: []Authenticator{authenticator},
+	})
+	require.NoError(err)
+
+	var calls []string
+
+	middleware := func(name string) Middleware {
+		return func(fn RouteFunc) RouteFunc {
+			return func(h *Handler) {
+				calls = append(calls, name)
+				fn(h)
+			}
+		}
+	}
+
+	reply := func(h *Handler) { h.ReplyEmpty(204) }
+
+	server.Group("/v1", func(g *Group) {
+		g.Use(middleware("v1"))
+
+		g.Route("/things", "GET", reply)
+
+		g.Group("/admin/", func(g *Group) {
+			g.Use(middleware("admin"))
+			g.RequireAuth("admin")
+			g.SetErrorFormat(ErrorFormatProblemDetails)
+
+			g.Route("/users", "GET", reply)
+		})
+	})
+
+	call := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(204, call("/v1/things", "").Code)
+	assert.Equal([]string{"v1"}, calls)
+
+	calls = nil
+	w := call("/v1/admin/users", "")
+	assert.Equal(401, w.Code)
+	assert.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	assert.Empty(calls)
+
+	assert.Equal(204, call("/v1/admin/users", "admin").Code)
+	assert.Equal([]string{"v1", "admin"}, calls)
+
+	assert.Equal(404, call("/things", "").Code)
+}
+
+func TestJoinRoutePatterns(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/", joinRoutePatterns("", "/"))
+	assert.Equal("/v1", joinRoutePatterns("/v1/", ""))
+	assert.Equal("/v1/things", joinRoutePatterns("/v1", "things"))
+	assert.Equal("/v1/things/{id}", joinRoutePatterns("/v1/", "/things/{id}"))
+}
@@ -16,7 +16,9 @@ package dhttp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,6 +27,7 @@ import (
 	"net/url"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/exograd/go-daemon/check"
@@ -32,6 +35,11 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// StatusClientClosedRequest is the status recorded, but never sent, for
+// requests aborted by the client. It is not a standard status but is widely
+// used for this purpose.
+const StatusClientClosedRequest = 499
+
 type APIError struct {
 	Message string       `json:"error"`
 	Code    string       `json:"code,omitempty"`
@@ -50,6 +58,7 @@ type Handler struct {
 	Pattern string
 	Method  string
 	RouteId string
+	Route   *Route
 	Query   url.Values
 
 	Request        *http.Request
@@ -57,7 +66,54 @@ type Handler struct {
 
 	StartTime time.Time
 
-	errorCode string
+	// The options used by ReplyJSON, initialized from ServerCfg.JSONEncoding
+	JSONEncoding JSONEncodingCfg
+
+	// The options used to decode JSON request bodies, initialized from
+	// ServerCfg.JSONDecoding
+	JSONDecoding JSONDecodingCfg
+
+	principal *Principal
+
+	errorCode         string
+	accessLogDisabled bool
+}
+
+// Status returns the status of the response, or 0 if no status has been
+// sent yet.
+func (h *Handler) Status() int {
+	if w, ok := h.ResponseWriter.(*ResponseWriter); ok {
+		return w.Status
+	}
+
+	return 0
+}
+
+// ClientAborted indicates whether the client closed the connection before
+// the response was sent, either because the request context was canceled
+// while the server was still running or because the response could not be
+// written.
+func (h *Handler) ClientAborted() bool {
+	if w, ok := h.ResponseWriter.(*ResponseWriter); ok && w.WriteError != nil {
+		return true
+	}
+
+	if h.Request == nil || (h.Server.ctx != nil && h.Server.ctx.Err() != nil) {
+		return false
+	}
+
+	return errors.Is(h.Request.Context().Err(), context.Canceled)
+}
+
+// handleClientAbort records that the request was aborted by the client
+// instead of replying with an error nobody will receive.
+func (h *Handler) handleClientAbort(msg string) {
+	h.errorCode = "client_aborted"
+	h.Log.Info("request aborted by client: %s", msg)
+
+	if w, ok := h.ResponseWriter.(*ResponseWriter); ok && w.Status == 0 {
+		w.Status = StatusClientClosedRequest
+	}
 }
 
 func (h *Handler) RouteVariable(name string) string {
@@ -88,13 +144,7 @@ func (h *Handler) JSONRequestData(dest interface{}) error {
 		return err
 	}
 
-	if err := json.Unmarshal(data, dest); err != nil {
-		h.ReplyError(400, "invalid_request_body",
-			"invalid request body: %v", err)
-		return fmt.Errorf("invalid request body: %w", err)
-	}
-
-	return nil
+	return h.decodeJSONRequestBody(data, dest)
 }
 
 func (h *Handler) JSONRequestObject(obj check.Object) error {
@@ -106,6 +156,10 @@ func (h *Handler) JSONRequestObject2(obj check.Object, fn func(*check.Checker))
 		return err
 	}
 
+	return h.checkRequestObject(obj, fn)
+}
+
+func (h *Handler) checkRequestObject(obj check.Object, fn func(*check.Checker)) error {
 	checker := check.NewChecker()
 
 	obj.Check(checker)
@@ -136,7 +190,13 @@ func (h *Handler) Reply(status int, r io.Reader) {
 
 	if r != nil {
 		if _, err := io.Copy(h.ResponseWriter, r); err != nil {
-			h.Server.Log.Error("cannot write response: %v", err)
+			if h.ClientAborted() {
+				h.errorCode = "client_aborted"
+				h.Log.Info("cannot write response: %v", err)
+			} else {
+				h.Server.Log.Error("cannot write response: %v", err)
+			}
+
 			return
 		}
 	}
@@ -157,25 +217,38 @@ func (h *Handler) ReplyJSON(status int, value interface{}) {
 	header := h.ResponseWriter.Header()
 	header.Set("Content-Type", "application/json")
 
-	var buf bytes.Buffer
-	encoder := json.NewEncoder(&buf)
-	encoder.SetIndent("", "  ")
-
-	if err := encoder.Encode(value); err != nil {
-		h.Log.Error("cannot encode json response: %v", err)
-		h.ResponseWriter.WriteHeader(500)
-		return
-	}
-
-	h.Reply(status, &buf)
+	h.replyJSON(status, value, h.JSONEncoding)
 }
 
 func (h *Handler) ReplyCompactJSON(status int, value interface{}) {
 	header := h.ResponseWriter.Header()
 	header.Set("Content-Type", "application/json")
 
+	cfg := h.JSONEncoding
+	cfg.Compact = true
+
+	h.replyJSON(status, value, cfg)
+}
+
+func (h *Handler) replyJSON(status int, value interface{}, cfg JSONEncodingCfg) {
+	if cfg.Streaming {
+		// Encoding errors cannot be reported to the client since the status
+		// has already been sent.
+		h.ResponseWriter.WriteHeader(status)
+
+		encoder := json.NewEncoder(h.ResponseWriter)
+		cfg.configureEncoder(encoder)
+
+		if err := encoder.Encode(value); err != nil {
+			h.Log.Error("cannot encode json response: %v", err)
+		}
+
+		return
+	}
+
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
+	cfg.configureEncoder(encoder)
 
 	if err := encoder.Encode(value); err != nil {
 		h.Log.Error("cannot encode json response: %v", err)
@@ -188,6 +261,12 @@ func (h *Handler) ReplyCompactJSON(status int, value interface{}) {
 
 func (h *Handler) ReplyInternalError(status int, format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
+
+	if h.ClientAborted() {
+		h.handleClientAbort(msg)
+		return
+	}
+
 	h.Log.Error("internal error: %s", msg)
 
 	if h.Server.Cfg.HideInternalErrors {
@@ -227,6 +306,16 @@ func (h *Handler) handlePanic(value interface{}) string {
 
 	h.Log.Error("panic: %s\n%s", msg, string(buf))
 
+	atomic.AddInt64(&h.Server.nbPanics, 1)
+
+	if reporter := h.Server.Cfg.ErrorReporter; reporter != nil {
+		data := dlog.MergeData(h.Log.Data, dlog.Data{
+			"stack": string(buf),
+		})
+
+		reporter.ReportError("panic: "+msg, data)
+	}
+
 	return msg
 }
 
@@ -234,12 +323,32 @@ func (h *Handler) logRequest() {
 	req := h.Request
 	w := h.ResponseWriter.(*ResponseWriter)
 
+	if h.errorCode == "client_aborted" || w.Status == StatusClientClosedRequest {
+		atomic.AddInt64(&h.Server.nbClientAborts, 1)
+	} else if w.Status >= 500 {
+		atomic.AddInt64(&h.Server.nbServerErrors, 1)
+	}
+
+	if h.Route != nil && h.Server.routeMetrics != nil {
+		h.Server.routeMetrics.record(h.Route, time.Since(h.StartTime),
+			w.Status)
+	}
+
+	if !h.accessLogEnabled() {
+		return
+	}
+
 	if h.Server.Cfg.HideSuccessfulRequests {
 		if w.Status >= 100 && w.Status < 400 {
 			return
 		}
 	}
 
+	if h.Server.accessLogWriter != nil {
+		h.writeAccessLogLine(h.Server.accessLogWriter)
+		return
+	}
+
 	reqTime := time.Since(h.StartTime)
 	seconds := reqTime.Seconds()
 
@@ -278,6 +387,8 @@ func (h *Handler) logRequest() {
 		data["error"] = h.errorCode
 	}
 
-	h.Log.InfoData(data, "%s %s %s %s %s",
+	log := h.Server.accessLog.Child("", h.Log.Data)
+
+	log.InfoData(data, "%s %s %s %s %s",
 		req.Method, req.URL.Path, statusString, resSizeString, reqTimeString)
 }
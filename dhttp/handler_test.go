@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *failingResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestClientAborts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	server.Route("/canceled", "GET", func(h *Handler) {
+		h.ReplyInternalError(500, "%v", h.Request.Context().Err())
+	})
+
+	server.Route("/write", "GET", func(h *Handler) {
+		h.ReplyJSON(200, "foo")
+	})
+
+	server.Route("/error", "GET", func(h *Handler) {
+		h.ReplyInternalError(500, "test error")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/canceled", nil).WithContext(ctx)
+	server.ServeHTTP(w, req)
+	assert.Equal(0, w.Body.Len())
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/write", nil)
+	server.ServeHTTP(&failingResponseWriter{ResponseWriter: w}, req)
+
+	assert.Equal(int64(2), server.NbClientAborts())
+	assert.Equal(int64(0), server.NbServerErrors())
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/error", nil))
+	assert.Equal(500, w.Code)
+
+	assert.Equal(int64(2), server.NbClientAborts())
+	assert.Equal(int64(1), server.NbServerErrors())
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+// The maximum duration of the operations used to complete or release an
+// idempotency record once the route has been called.
+const idempotencyStoreTimeout = 10 * time.Second
+
+// IdempotencyCfg enables support for the Idempotency-Key header on POST,
+// PUT, PATCH and DELETE requests. The response of the first request sent
+// with a key is stored and replayed for all subsequent requests using the
+// same key, principal, method and path until it expires.
+type IdempotencyCfg struct {
+	Store IdempotencyStore `json:"-"`
+
+	TTL dtime.Duration `json:"ttl,omitempty"`
+
+	// The maximum size of the body of requests sent with an idempotency
+	// key. The body is read in memory to compute the fingerprint of the
+	// request.
+	MaxBodySize int `json:"max_body_size,omitempty"`
+}
+
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+
+	// A record is incomplete while the first request is being processed
+	Completed bool
+
+	Status int
+	Header http.Header
+	Body   []byte
+
+	ExpirationTime time.Time
+}
+
+type IdempotencyStore interface {
+	// Reserve creates an incomplete record for a key if there is no
+	// unexpired record for it. If a record already exists, it is returned
+	// and the boolean is false.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error)
+
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+
+	// Release deletes an incomplete record, so that the request can be
+	// retried.
+	Release(ctx context.Context, key string) error
+}
+
+func (cfg *IdempotencyCfg) Check(c *check.Checker) {
+	c.CheckDurationMin("ttl", cfg.TTL.Duration(), 0)
+	c.CheckIntMin("max_body_size", cfg.MaxBodySize, 0)
+}
+
+func (s *Server) initIdempotency() error {
+	if s.Cfg.Idempotency == nil {
+		return nil
+	}
+
+	cfg := *s.Cfg.Idempotency
+
+	if cfg.Store == nil {
+		return fmt.Errorf("missing idempotency store")
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = dtime.Duration(24 * time.Hour)
+	}
+
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1024 * 1024
+	}
+
+	s.Cfg.Idempotency = &cfg
+
+	return nil
+}
+
+func (s *Server) idempotencyKey(h *Handler) string {
+	if s.Cfg.Idempotency == nil {
+		return ""
+	}
+
+	switch h.Request.Method {
+	case "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return ""
+	}
+
+	key := h.Request.Header.Get("Idempotency-Key")
+	if key == "" {
+		return ""
+	}
+
+	// Keys are chosen by clients and are only unique for a client and an
+	// operation: they are scoped by principal, method and path so that
+	// clients cannot obtain the responses of other clients.
+	var principalId string
+	if principal := h.Principal(); principal != nil {
+		principalId = principal.Type + ":" + principal.Id
+	}
+
+	scope := sha256.Sum256([]byte(strings.Join([]string{principalId,
+		h.Request.Method, h.Request.URL.Path}, "\x00")))
+
+	return hex.EncodeToString(scope[:]) + ":" + key
+}
+
+func (s *Server) callRouteIdempotent(h *Handler, route *Route, routeFunc RouteFunc, key string) {
+	cfg := s.Cfg.Idempotency
+	ctx := h.Request.Context()
+
+	data, err := ioutil.ReadAll(io.LimitReader(h.Request.Body,
+		int64(cfg.MaxBodySize)+1))
+	if err != nil {
+		h.ReplyInternalError(500, "cannot read request body: %v", err)
+		return
+	}
+
+	if len(data) > cfg.MaxBodySize {
+		h.ReplyError(413, "request_body_too_large",
+			"request body too large for an idempotent request")
+		return
+	}
+
+	h.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	fingerprint := idempotencyFingerprint(h.Request.Method,
+		h.Request.URL.RequestURI(), data)
+
+	record, created, err := cfg.Store.Reserve(ctx, key, fingerprint,
+		cfg.TTL.Duration())
+	if err != nil {
+		h.ReplyInternalError(500, "cannot reserve idempotency key: %v", err)
+		return
+	}
+
+	if !created {
+		s.replayIdempotentResponse(h, record, fingerprint)
+		return
+	}
+
+	rw := h.ResponseWriter.(*ResponseWriter)
+
+	cw := &captureResponseWriter{w: rw.w}
+
+	rw.w = cw
+	completed := false
+
+	// The request context is canceled as soon as the client goes away;
+	// the record must still be completed or released, otherwise the key
+	// stays reserved until it expires.
+	storeCtx, cancel := context.WithTimeout(context.Background(),
+		idempotencyStoreTimeout)
+	defer cancel()
+
+	defer func() {
+		rw.w = cw.w
+
+		if !completed {
+			// Either the route panicked or the response was a server
+			// error; in both cases the client must be able to retry.
+			if err := cfg.Store.Release(storeCtx, key); err != nil {
+				h.Log.Error("cannot release idempotency key %q: %v",
+					h.Request.Header.Get("Idempotency-Key"), err)
+			}
+		}
+	}()
+
+	s.callRoute(h, route, routeFunc)
+
+	if cw.status >= 500 {
+		return
+	}
+
+	status := cw.status
+	if status == 0 {
+		status = 200
+	}
+
+	record.Completed = true
+	record.Status = status
+	record.Header = cw.Header().Clone()
+	record.Body = cw.body.Bytes()
+
+	if err := cfg.Store.Complete(storeCtx, record); err != nil {
+		h.Log.Error("cannot store idempotent response for key %q: %v",
+			h.Request.Header.Get("Idempotency-Key"), err)
+		return
+	}
+
+	completed = true
+}
+
+func (s *Server) replayIdempotentResponse(h *Handler, record *IdempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		h.ReplyError(422, "idempotency_key_reused",
+			"idempotency key already used for a different request")
+		return
+	}
+
+	if !record.Completed {
+		h.ReplyError(409, "idempotent_request_in_progress",
+			"a request with the same idempotency key is being processed")
+		return
+	}
+
+	header := h.ResponseWriter.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set("Idempotent-Replayed", "true")
+
+	h.Reply(record.Status, bytes.NewReader(record.Body))
+}
+
+func idempotencyFingerprint(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(uri))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+type captureResponseWriter struct {
+	w http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureResponseWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w *captureResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(200)
+	}
+
+	w.body.Write(data)
+
+	return w.w.Write(data)
+}
+
+func (w *captureResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.w.WriteHeader(status)
+}
+
+// Expired records of MemoryIdempotencyStore are purged when records are
+// reserved, at most once per purge interval.
+const memoryIdempotencyStorePurgeInterval = time.Minute
+
+type MemoryIdempotencyStore struct {
+	records   map[string]*IdempotencyRecord
+	lastPurge time.Time
+	mutex     sync.Mutex
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]*IdempotencyRecord),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(s.lastPurge) >= memoryIdempotencyStorePurgeInterval {
+		s.purge(now)
+	}
+
+	if record, found := s.records[key]; found {
+		if now.Before(record.ExpirationTime) {
+			recordCopy := *record
+			return &recordCopy, false, nil
+		}
+	}
+
+	record := IdempotencyRecord{
+		Key:            key,
+		Fingerprint:    fingerprint,
+		ExpirationTime: now.Add(ttl),
+	}
+
+	recordCopy := record
+	s.records[key] = &recordCopy
+
+	return &record, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	recordCopy := *record
+	s.records[record.Key] = &recordCopy
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) purge(now time.Time) {
+	for key, record := range s.records {
+		if !now.Before(record.ExpirationTime) {
+			delete(s.records, key)
+		}
+	}
+
+	s.lastPurge = now
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/exograd/go-daemon/pg"
+	"github.com/jackc/pgx/v4"
+)
+
+// PgIdempotencyStoreTableSQL is the definition of the table used by
+// PgIdempotencyStore; it must be created by a schema migration. The name of
+// the table can be changed as long as it matches the name configured in the
+// store.
+const PgIdempotencyStoreTableSQL = `
+CREATE TABLE idempotency_records (
+  key VARCHAR NOT NULL PRIMARY KEY,
+  fingerprint VARCHAR NOT NULL,
+  completed BOOLEAN NOT NULL DEFAULT FALSE,
+  status INTEGER,
+  header JSONB,
+  body BYTEA,
+  expiration_time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_records_expiration_time_idx
+  ON idempotency_records (expiration_time);
+`
+
+type PgIdempotencyStore struct {
+	Pg    *pg.Client
+	Table string
+}
+
+func NewPgIdempotencyStore(client *pg.Client) *PgIdempotencyStore {
+	return &PgIdempotencyStore{
+		Pg:    client,
+		Table: "idempotency_records",
+	}
+}
+
+func (s *PgIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	var record *IdempotencyRecord
+	var created bool
+
+	err := s.Pg.WithTx(func(conn pg.Conn) error {
+		query := fmt.Sprintf(`
+DELETE FROM %s
+  WHERE key = $1 AND expiration_time < (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+`, s.Table)
+
+		if _, err := conn.Exec(ctx, query, key); err != nil {
+			return fmt.Errorf("cannot delete expired record: %w", err)
+		}
+
+		expirationTime := time.Now().UTC().Add(ttl)
+
+		query = fmt.Sprintf(`
+INSERT INTO %s (key, fingerprint, expiration_time)
+  VALUES ($1, $2, $3)
+  ON CONFLICT (key) DO NOTHING
+`, s.Table)
+
+		tag, err := conn.Exec(ctx, query, key, fingerprint, expirationTime)
+		if err != nil {
+			return fmt.Errorf("cannot insert record: %w", err)
+		}
+
+		if tag.RowsAffected() == 1 {
+			created = true
+			record = &IdempotencyRecord{
+				Key:            key,
+				Fingerprint:    fingerprint,
+				ExpirationTime: expirationTime,
+			}
+
+			return nil
+		}
+
+		record, err = s.loadRecord(ctx, conn, key)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, created, nil
+}
+
+func (s *PgIdempotencyStore) loadRecord(ctx context.Context, conn pg.Conn, key string) (*IdempotencyRecord, error) {
+	query := fmt.Sprintf(`
+SELECT fingerprint, completed, status, header, body, expiration_time
+  FROM %s
+  WHERE key = $1
+`, s.Table)
+
+	record := IdempotencyRecord{Key: key}
+
+	var status *int32
+	var headerData []byte
+
+	err := conn.QueryRow(ctx, query, key).Scan(&record.Fingerprint,
+		&record.Completed, &status, &headerData, &record.Body,
+		&record.ExpirationTime)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("record not found")
+		}
+
+		return nil, fmt.Errorf("cannot load record: %w", err)
+	}
+
+	if status != nil {
+		record.Status = int(*status)
+	}
+
+	if headerData != nil {
+		if err := json.Unmarshal(headerData, &record.Header); err != nil {
+			return nil, fmt.Errorf("cannot decode header: %w", err)
+		}
+	}
+
+	return &record, nil
+}
+
+func (s *PgIdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	header := record.Header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("cannot encode header: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+UPDATE %s
+  SET completed = TRUE, status = $2, header = $3, body = $4
+  WHERE key = $1
+`, s.Table)
+
+	return s.Pg.WithConn(func(conn pg.Conn) error {
+		_, err := conn.Exec(ctx, query, record.Key, record.Status,
+			headerData, record.Body)
+		return err
+	})
+}
+
+func (s *PgIdempotencyStore) Release(ctx context.Context, key string) error {
+	query := fmt.Sprintf(`
+DELETE FROM %s WHERE key = $1 AND NOT completed
+`, s.Table)
+
+	return s.Pg.WithConn(func(conn pg.Conn) error {
+		_, err := conn.Exec(ctx, query, key)
+		return err
+	})
+}
+
+// DeleteExpired deletes expired records; it should be called periodically.
+func (s *PgIdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf(`
+DELETE FROM %s WHERE expiration_time < (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+`, s.Table)
+
+	var n int64
+
+	err := s.Pg.WithConn(func(conn pg.Conn) error {
+		var err error
+		n, err = pg.Exec2Context(ctx, conn, query)
+		return err
+	})
+
+	return n, err
+}
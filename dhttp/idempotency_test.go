@@ -0,0 +1,257 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotency(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		Idempotency: &IdempotencyCfg{
+			Store: NewMemoryIdempotencyStore(),
+		},
+	})
+	require.NoError(err)
+
+	nbCalls := 0
+	failing := false
+
+	server.Route("/orders", "POST", func(h *Handler) {
+		nbCalls++
+
+		if failing {
+			h.ReplyInternalError(500, "failure")
+			return
+		}
+
+		h.ReplyJSON(201, map[string]int{"call": nbCalls})
+	})
+
+	call := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("a", "{}")
+	assert.Equal(201, w.Code)
+	assert.Equal(1, nbCalls)
+
+	// Replay
+	w2 := call("a", "{}")
+	assert.Equal(201, w2.Code)
+	assert.Equal(w.Body.String(), w2.Body.String())
+	assert.Equal("true", w2.Header().Get("Idempotent-Replayed"))
+	assert.Equal(1, nbCalls)
+
+	// Different request with the same key
+	w = call("a", `{"foo": 1}`)
+	assert.Equal(422, w.Code)
+	assert.Equal(1, nbCalls)
+
+	// No key
+	call("", "{}")
+	assert.Equal(2, nbCalls)
+
+	// Server errors are not stored
+	failing = true
+	assert.Equal(500, call("b", "{}").Code)
+	failing = false
+	assert.Equal(201, call("b", "{}").Code)
+	assert.Equal(4, nbCalls)
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		Authenticators: []Authenticator{
+			AuthenticatorFunc(func(h *Handler) (*Principal, error) {
+				if id := h.Request.Header.Get("X-User"); id != "" {
+					return &Principal{Id: id}, nil
+				}
+
+				return nil, nil
+			}),
+		},
+		Idempotency: &IdempotencyCfg{
+			Store: NewMemoryIdempotencyStore(),
+		},
+	})
+	require.NoError(err)
+
+	nbCalls := 0
+
+	handler := func(h *Handler) {
+		nbCalls++
+		h.ReplyEmpty(204)
+	}
+
+	server.Route("/orders", "POST", handler)
+	server.Route("/payments", "POST", handler)
+
+	call := func(user, path string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader("{}"))
+		req.Header.Set("Idempotency-Key", "a")
+		req.Header.Set("X-User", user)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(204, w.Code)
+	}
+
+	call("bob", "/orders")
+	call("bob", "/orders")
+	assert.Equal(1, nbCalls)
+
+	call("alice", "/orders")
+	assert.Equal(2, nbCalls)
+
+	call("bob", "/payments")
+	assert.Equal(3, nbCalls)
+}
+
+func TestMemoryIdempotencyStorePurge(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	_, created, err := store.Reserve(ctx, "a", "x", time.Millisecond)
+	require.NoError(err)
+	assert.True(created)
+
+	time.Sleep(5 * time.Millisecond)
+	store.lastPurge = time.Time{}
+
+	_, created, err = store.Reserve(ctx, "b", "x", time.Hour)
+	require.NoError(err)
+	assert.True(created)
+
+	assert.NotContains(store.records, "a")
+	assert.Contains(store.records, "b")
+}
+
+func TestIdempotencyMaxBodySize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		Idempotency: &IdempotencyCfg{
+			Store:       NewMemoryIdempotencyStore(),
+			MaxBodySize: 8,
+		},
+	})
+	require.NoError(err)
+
+	nbCalls := 0
+
+	server.Route("/orders", "POST", func(h *Handler) {
+		nbCalls++
+		h.ReplyEmpty(204)
+	})
+
+	call := func(body string) int {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "a")
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(413, call(`{"foo": "bar"}`))
+	assert.Equal(0, nbCalls)
+
+	assert.Equal(204, call(`{}`))
+	assert.Equal(1, nbCalls)
+}
+
+type contextCheckingIdempotencyStore struct {
+	*MemoryIdempotencyStore
+}
+
+func (s contextCheckingIdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.MemoryIdempotencyStore.Complete(ctx, record)
+}
+
+func TestIdempotencyClientCancellation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		Idempotency: &IdempotencyCfg{
+			Store: contextCheckingIdempotencyStore{
+				MemoryIdempotencyStore: NewMemoryIdempotencyStore(),
+			},
+		},
+	})
+	require.NoError(err)
+
+	nbCalls := 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	server.Route("/orders", "POST", func(h *Handler) {
+		nbCalls++
+		cancel()
+		h.ReplyEmpty(204)
+	})
+
+	call := func(ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader("{}"))
+		req = req.WithContext(ctx)
+		req.Header.Set("Idempotency-Key", "a")
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	call(ctx)
+	assert.Equal(1, nbCalls)
+
+	// The response was stored even though the request context was canceled
+	w := call(context.Background())
+	assert.Equal(204, w.Code)
+	assert.Equal("true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(1, nbCalls)
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+)
+
+// JSONEncodingCfg controls the encoding of JSON responses. By default,
+// responses are indented, HTML characters are escaped, and the response body
+// is buffered so that encoding errors can be reported with a 500 status.
+//
+// Streaming encodes values directly to the response writer: it saves memory
+// for large responses, but the client receives a truncated body if encoding
+// fails.
+type JSONEncodingCfg struct {
+	Compact             bool `json:"compact"`
+	DisableHTMLEscaping bool `json:"disable_html_escaping"`
+	Streaming           bool `json:"streaming"`
+}
+
+func (cfg JSONEncodingCfg) configureEncoder(encoder *json.Encoder) {
+	if !cfg.Compact {
+		encoder.SetIndent("", "  ")
+	}
+
+	encoder.SetEscapeHTML(!cfg.DisableHTMLEscaping)
+}
+
+// JSONDecodingCfg controls the decoding of JSON request bodies. When
+// DisallowUnknownFields is set, members which do not match any field of the
+// destination structure are rejected. Documents whose nesting depth is
+// greater than MaxDepth are rejected (no limit if zero).
+type JSONDecodingCfg struct {
+	DisallowUnknownFields bool `json:"disallow_unknown_fields"`
+	MaxDepth              int  `json:"max_depth,omitempty"`
+}
+
+func (cfg *JSONDecodingCfg) Check(c *check.Checker) {
+	c.CheckIntMin("max_depth", cfg.MaxDepth, 0)
+}
+
+func (cfg JSONDecodingCfg) strict() bool {
+	return cfg.DisallowUnknownFields || cfg.MaxDepth > 0
+}
+
+// decodeJSONRequestBody decodes a JSON request body and replies with an error
+// if it is not valid.
+func (h *Handler) decodeJSONRequestBody(data []byte, dest interface{}) error {
+	cfg := h.JSONDecoding
+
+	if !cfg.strict() {
+		if err := json.Unmarshal(data, dest); err != nil {
+			h.ReplyError(400, "invalid_request_body",
+				"invalid request body: %v", err)
+			return fmt.Errorf("invalid request body: %w", err)
+		}
+
+		return nil
+	}
+
+	keys, err := scanJSONDocument(data, cfg.MaxDepth)
+	if err != nil {
+		var verr *check.ValidationError
+		if errors.As(err, &verr) {
+			h.ReplyRequestBodyValidationErrors(check.ValidationErrors{verr})
+		} else {
+			h.ReplyError(400, "invalid_request_body",
+				"invalid request body: %v", err)
+		}
+
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if cfg.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(dest); err != nil {
+		if name := unknownJSONField(err); name != "" {
+			verr := check.ValidationError{
+				Pointer: unknownJSONFieldPointer(keys, name),
+				Code:    "unknown_member",
+				Message: fmt.Sprintf("unknown member %q", name),
+			}
+
+			h.ReplyRequestBodyValidationErrors(check.ValidationErrors{&verr})
+			return fmt.Errorf("invalid request body: %w", verr)
+		}
+
+		h.ReplyError(400, "invalid_request_body",
+			"invalid request body: %v", err)
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+// scanJSONDocument checks the syntax and the depth of a JSON document and
+// returns the pointers of all object members in document order.
+func scanJSONDocument(data []byte, maxDepth int) ([]djson.Pointer, error) {
+	type frame struct {
+		object    bool
+		index     int
+		expectKey bool
+	}
+
+	var frames []*frame
+	var pointer djson.Pointer
+	var keys []djson.Pointer
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var f *frame
+		if len(frames) > 0 {
+			f = frames[len(frames)-1]
+		}
+
+		// Decoder.Token returns object keys as strings; in objects, keys and
+		// values alternate.
+		if key, ok := token.(string); ok && f != nil && f.expectKey {
+			pointer = append(pointer, key)
+			keys = append(keys, append(djson.Pointer{}, pointer...))
+			f.expectKey = false
+			continue
+		}
+
+		if token == json.Delim('}') || token == json.Delim(']') {
+			frames = frames[:len(frames)-1]
+
+			if len(frames) > 0 {
+				parent := frames[len(frames)-1]
+				pointer = pointer[:len(pointer)-1]
+				parent.expectKey = parent.object
+			}
+
+			continue
+		}
+
+		if f != nil && !f.object {
+			pointer = append(pointer, strconv.Itoa(f.index))
+			f.index++
+		}
+
+		if token == json.Delim('{') || token == json.Delim('[') {
+			if maxDepth > 0 && len(frames) >= maxDepth {
+				return nil, &check.ValidationError{
+					Pointer: append(djson.Pointer{}, pointer...),
+					Code:    "max_depth_exceeded",
+					Message: fmt.Sprintf("value nesting depth must be "+
+						"lower or equal to %d", maxDepth),
+				}
+			}
+
+			object := token == json.Delim('{')
+			frames = append(frames, &frame{object: object, expectKey: object})
+			continue
+		}
+
+		if f != nil {
+			pointer = pointer[:len(pointer)-1]
+			f.expectKey = f.object
+		}
+	}
+
+	return keys, nil
+}
+
+// unknownJSONFieldPointer returns the pointer of the member reported by an
+// unknown field decoding error. The decoding error only contains the name
+// of the field: if several members of the document have this name, we
+// cannot know which one is unknown and return an empty pointer, i.e. a
+// pointer to the whole document.
+func unknownJSONFieldPointer(keys []djson.Pointer, name string) djson.Pointer {
+	var pointer djson.Pointer
+
+	for _, key := range keys {
+		if key[len(key)-1] == name {
+			if pointer != nil {
+				return djson.Pointer{}
+			}
+
+			pointer = key
+		}
+	}
+
+	if pointer == nil {
+		return djson.Pointer{}
+	}
+
+	return pointer
+}
+
+// unknownJSONField returns the name of the field reported by an unknown
+// field decoding error, or an empty string if the error is of another kind.
+func unknownJSONField(err error) string {
+	// The encoding/json package does not provide a specific error type
+	msg := err.Error()
+
+	prefix := "json: unknown field "
+	if !strings.HasPrefix(msg, prefix) {
+		return ""
+	}
+
+	name, err := strconv.Unquote(msg[len(prefix):])
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
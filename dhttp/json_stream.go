@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	jsonStreamFlushCount    = 100
+	jsonStreamFlushInterval = time.Second
+)
+
+// ReplyJSONStreamFunc writes a JSON array incrementally: fn is called with a
+// function which appends a value to the array. The response is flushed
+// regularly so that the client receives data as soon as possible.
+//
+// Since the status and part of the body may already have been sent when fn
+// fails, errors cannot be reported to the client; the connection is aborted
+// so that the client does not receive an incomplete but valid document.
+func (h *Handler) ReplyJSONStreamFunc(status int, fn func(func(interface{}) error) error) {
+	header := h.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json")
+
+	h.ResponseWriter.WriteHeader(status)
+
+	w := bufio.NewWriter(h.ResponseWriter)
+	encoder := json.NewEncoder(w)
+
+	n := 0
+	lastFlush := time.Now()
+
+	flush := func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if f, ok := h.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		lastFlush = time.Now()
+		return nil
+	}
+
+	emit := func(value interface{}) error {
+		if n == 0 {
+			w.WriteByte('[')
+		} else {
+			w.WriteByte(',')
+		}
+
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("cannot encode value: %w", err)
+		}
+
+		n++
+
+		if n%jsonStreamFlushCount == 0 ||
+			time.Since(lastFlush) >= jsonStreamFlushInterval {
+			if err := flush(); err != nil {
+				return fmt.Errorf("cannot write response: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	err := fn(emit)
+	if err == nil {
+		if n == 0 {
+			w.WriteByte('[')
+		}
+
+		w.WriteString("]\n")
+
+		err = flush()
+	}
+
+	if err != nil {
+		h.Log.Error("cannot stream response: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// ReplyJSONStream writes all values read from a channel as a JSON array. The
+// producer must close the channel when done, and should stop sending values
+// when the context of the request is canceled.
+func (h *Handler) ReplyJSONStream(status int, values <-chan interface{}) {
+	ctx := h.Request.Context()
+
+	h.ReplyJSONStreamFunc(status, func(emit func(interface{}) error) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+
+			case value, ok := <-values:
+				if !ok {
+					return nil
+				}
+
+				if err := emit(value); err != nil {
+					return err
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyJSONStream(t *testing.T) {
+	assert := assert.New(t)
+
+	th := NewTestHandler("GET", "/values", nil)
+
+	values := make(chan interface{})
+	go func() {
+		defer close(values)
+
+		for i := 0; i < 250; i++ {
+			values <- map[string]int{"i": i}
+		}
+	}()
+
+	th.ReplyJSONStream(200, values)
+	th.AssertStatus(t, 200)
+
+	var result []map[string]int
+	if assert.NoError(th.DecodeJSON(&result)) {
+		assert.Len(result, 250)
+		assert.Equal(249, result[249]["i"])
+	}
+
+	th = NewTestHandler("GET", "/values", nil)
+	th.ReplyJSONStreamFunc(200, func(emit func(interface{}) error) error {
+		return nil
+	})
+	assert.JSONEq("[]", string(th.Body()))
+
+	th = NewTestHandler("GET", "/values", nil)
+	assert.PanicsWithValue(http.ErrAbortHandler, func() {
+		th.ReplyJSONStreamFunc(200, func(emit func(interface{}) error) error {
+			emit(1)
+			return errors.New("failure")
+		})
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplyJSONEncoding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	value := map[string]string{"a": "<b>"}
+
+	server.Route("/default", "GET", func(h *Handler) {
+		h.ReplyJSON(200, value)
+	})
+
+	server.Route("/custom", "GET", func(h *Handler) {
+		h.JSONEncoding = JSONEncodingCfg{
+			Compact:             true,
+			DisableHTMLEscaping: true,
+			Streaming:           true,
+		}
+
+		h.ReplyJSON(200, value)
+	})
+
+	call := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := call("/default")
+	assert.Equal(200, w.Code)
+	assert.Equal("{\n  \"a\": \"\\u003cb\\u003e\"\n}\n", w.Body.String())
+
+	w = call("/custom")
+	assert.Equal(200, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	assert.Equal("{\"a\":\"<b>\"}\n", w.Body.String())
+}
+
+type testJSONRequest struct {
+	Name    string               `json:"name"`
+	Options *testJSONRequestOpts `json:"options"`
+}
+
+type testJSONRequestOpts struct {
+	Color string `json:"color"`
+}
+
+func (r *testJSONRequest) Check(c *check.Checker) {
+}
+
+func TestJSONRequestDecoding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		JSONDecoding: &JSONDecodingCfg{
+			DisallowUnknownFields: true,
+			MaxDepth:              3,
+		},
+	})
+	require.NoError(err)
+
+	server.Route("/", "POST", func(h *Handler) {
+		var r testJSONRequest
+		if err := h.JSONRequestObject(&r); err != nil {
+			return
+		}
+
+		h.ReplyEmpty(204)
+	})
+
+	call := func(body string) (int, check.ValidationErrors) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		server.ServeHTTP(w, req)
+
+		var res struct {
+			Data struct {
+				ValidationErrors check.ValidationErrors `json:"validation_errors"`
+			} `json:"data"`
+		}
+
+		if w.Code != 204 {
+			require.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+		}
+
+		return w.Code, res.Data.ValidationErrors
+	}
+
+	status, _ := call(`{"name": "foo", "options": {"color": "red"}}`)
+	assert.Equal(204, status)
+
+	status, errs := call(`{"name": "foo", "options": {"colour": "red"}}`)
+	assert.Equal(400, status)
+	if assert.Equal(1, len(errs)) {
+		assert.Equal(djson.Pointer{"options", "colour"}, errs[0].Pointer)
+		assert.Equal("unknown_member", errs[0].Code)
+	}
+
+	// The name of the unknown member is also used at another level: we
+	// cannot know which member is unknown.
+	status, errs = call(`{"name": "foo", "options": {"name": "red"}}`)
+	assert.Equal(400, status)
+	if assert.Equal(1, len(errs)) {
+		assert.Equal(djson.Pointer{}, errs[0].Pointer)
+		assert.Equal("unknown_member", errs[0].Code)
+	}
+
+	status, errs = call(`{"name": "foo", "x": [[{"a": 1}]]}`)
+	assert.Equal(400, status)
+	if assert.Equal(1, len(errs)) {
+		assert.Equal(djson.Pointer{"x", "0", "0"}, errs[0].Pointer)
+		assert.Equal("max_depth_exceeded", errs[0].Code)
+	}
+}
+
+func TestScanJSONDocument(t *testing.T) {
+	assert := assert.New(t)
+
+	keys, err := scanJSONDocument([]byte(
+		`{"a": [1, {"b": "c"}, ["d"]], "e": {"f": null}, "g": "h"}`), 0)
+	if assert.NoError(err) {
+		assert.Equal([]djson.Pointer{
+			{"a"},
+			{"a", "1", "b"},
+			{"e"},
+			{"e", "f"},
+			{"g"},
+		}, keys)
+	}
+}
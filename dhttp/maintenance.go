@@ -0,0 +1,104 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+// MaintenanceCfg controls the response sent by a server in maintenance mode.
+// Requests whose path is listed in ExcludedPaths (e.g. health checks) are
+// processed normally.
+type MaintenanceCfg struct {
+	Enabled bool `json:"enabled"`
+
+	Code       string         `json:"code,omitempty"`
+	Message    string         `json:"message,omitempty"`
+	RetryAfter dtime.Duration `json:"retry_after,omitempty"`
+
+	ExcludedPaths []string `json:"excluded_paths,omitempty"`
+}
+
+func (cfg *MaintenanceCfg) Check(c *check.Checker) {
+	c.CheckDurationMin("retry_after", cfg.RetryAfter.Duration(), 0)
+}
+
+func (s *Server) initMaintenance() {
+	var cfg MaintenanceCfg
+	if s.Cfg.Maintenance != nil {
+		cfg = *s.Cfg.Maintenance
+	}
+
+	if cfg.Code == "" {
+		cfg.Code = "service_unavailable"
+	}
+
+	if cfg.Message == "" {
+		cfg.Message = "service unavailable for maintenance"
+	}
+
+	s.maintenanceExcludedPaths = make(map[string]struct{})
+	for _, path := range cfg.ExcludedPaths {
+		s.maintenanceExcludedPaths[path] = struct{}{}
+	}
+
+	s.Cfg.Maintenance = &cfg
+
+	s.SetMaintenance(cfg.Enabled)
+}
+
+func (s *Server) SetMaintenance(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&s.maintenance, value) != value {
+		if enabled {
+			s.Log.Info("entering maintenance mode")
+		} else {
+			s.Log.Info("leaving maintenance mode")
+		}
+	}
+}
+
+func (s *Server) InMaintenance() bool {
+	return atomic.LoadInt32(&s.maintenance) == 1
+}
+
+func (s *Server) handleMaintenance(h *Handler) bool {
+	if !s.InMaintenance() {
+		return false
+	}
+
+	if _, excluded := s.maintenanceExcludedPaths[h.Request.URL.Path]; excluded {
+		return false
+	}
+
+	cfg := s.Cfg.Maintenance
+
+	if cfg.RetryAfter > 0 {
+		seconds := int(cfg.RetryAfter.Duration().Seconds())
+		h.ResponseWriter.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	h.ReplyError(503, cfg.Code, "%s", cfg.Message)
+
+	return true
+}
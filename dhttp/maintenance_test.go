@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	maintenanceCfg := MaintenanceCfg{
+		RetryAfter:    dtime.Duration(2 * time.Minute),
+		ExcludedPaths: []string{"/health"},
+	}
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:   make(chan error, 1),
+		Maintenance: &maintenanceCfg,
+	})
+	require.NoError(err)
+
+	assert.Empty(maintenanceCfg.Code)
+	assert.Empty(maintenanceCfg.Message)
+
+	reply := func(h *Handler) { h.ReplyEmpty(204) }
+	server.Route("/health", "GET", reply)
+	server.Route("/foo", "GET", reply)
+
+	call := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	assert.Equal(204, call("/foo").Code)
+
+	server.SetMaintenance(true)
+	assert.True(server.InMaintenance())
+
+	w := call("/foo")
+	assert.Equal(503, w.Code)
+	assert.Equal("120", w.Header().Get("Retry-After"))
+
+	var apiErr APIError
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &apiErr))
+	assert.Equal("service_unavailable", apiErr.Code)
+
+	assert.Equal(204, call("/health").Code)
+
+	server.SetMaintenance(false)
+	assert.Equal(204, call("/foo").Code)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleAutomaticMethods handles HEAD and OPTIONS requests for routes which
+// do not define them when the server is configured to do so. It returns true
+// if a response was sent.
+func (s *Server) handleAutomaticMethods(h *Handler) bool {
+	req := h.Request
+
+	switch req.Method {
+	case "HEAD":
+		if !s.Cfg.AutomaticHead {
+			return false
+		}
+
+		path := requestRoutingPath(req)
+		router := s.requestRouter(req)
+
+		if router.Match(chi.NewRouteContext(), "HEAD", path) ||
+			!router.Match(chi.NewRouteContext(), "GET", path) {
+			return false
+		}
+
+		// Route the request as a GET request; the http server does not send
+		// the body of responses to HEAD requests, but we do not even want to
+		// copy it.
+		rctx := chi.NewRouteContext()
+		rctx.RouteMethod = "GET"
+
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		h.Request = req.WithContext(ctx)
+
+		if w, ok := h.ResponseWriter.(*ResponseWriter); ok {
+			w.discardBody = true
+		}
+
+		return false
+
+	case "OPTIONS":
+		if !s.Cfg.AutomaticOptions {
+			return false
+		}
+
+		path := requestRoutingPath(req)
+
+		if s.requestRouter(req).Match(chi.NewRouteContext(), "OPTIONS", path) {
+			return false
+		}
+
+		methods := s.allowedMethods(req)
+		if len(methods) == 0 {
+			return false
+		}
+
+		h.ResponseWriter.Header().Set("Allow", strings.Join(methods, ", "))
+		h.ReplyEmpty(204)
+
+		return true
+	}
+
+	return false
+}
+
+func requestRoutingPath(req *http.Request) string {
+	if req.URL.RawPath != "" {
+		return req.URL.RawPath
+	}
+
+	return req.URL.Path
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+
+	return false
+}
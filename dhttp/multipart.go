@@ -0,0 +1,185 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type FilePart struct {
+	FieldName   string
+	FileName    string
+	ContentType string // application/octet-stream if empty
+
+	Reader io.Reader
+
+	// The size of the file if it is known. If the size of all files is
+	// known, the request is sent with a Content-Length header instead of
+	// using chunked transfer encoding.
+	Size int64
+
+	// Called each time data are sent with the number of bytes of the file
+	// sent so far.
+	Progress func(int64)
+}
+
+func (c *Client) SendMultipartRequest(method string, uri *url.URL, fields map[string]string, files []FilePart) (*http.Response, error) {
+	ctx := context.Background()
+	return c.SendMultipartRequestContext(ctx, method, uri, fields, files)
+}
+
+// SendMultipartRequestContext sends a multipart/form-data request. Files are
+// streamed from their reader while the request is being sent.
+func (c *Client) SendMultipartRequestContext(ctx context.Context, method string, uri *url.URL, fields map[string]string, files []FilePart) (*http.Response, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	pr, pw := io.Pipe()
+
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), pr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type",
+		"multipart/form-data; boundary="+boundary)
+
+	if size, err := multipartBodySize(boundary, fields, files); err == nil {
+		req.ContentLength = size
+	}
+
+	go func() {
+		pw.CloseWithError(writeMultipartBody(pw, boundary, fields, files))
+	}()
+
+	res, err := c.Do(req)
+
+	// Unblock the writing goroutine if the request was not fully sent
+	pr.Close()
+
+	return res, err
+}
+
+func writeMultipartBody(w io.Writer, boundary string, fields map[string]string, files []FilePart) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := mw.WriteField(name, fields[name]); err != nil {
+			return fmt.Errorf("cannot write field %q: %w", name, err)
+		}
+	}
+
+	for _, file := range files {
+		pw, err := mw.CreatePart(file.header())
+		if err != nil {
+			return fmt.Errorf("cannot create part %q: %w", file.FieldName, err)
+		}
+
+		var fw io.Writer = pw
+		if file.Progress != nil {
+			fw = &progressWriter{w: pw, progress: file.Progress}
+		}
+
+		if _, err := io.Copy(fw, file.Reader); err != nil {
+			return fmt.Errorf("cannot write file %q: %w", file.FileName, err)
+		}
+	}
+
+	return mw.Close()
+}
+
+// multipartBodySize computes the size of a multipart body by encoding it
+// without the content of files, whose size must be known.
+func multipartBodySize(boundary string, fields map[string]string, files []FilePart) (int64, error) {
+	var size int64
+
+	emptyFiles := make([]FilePart, len(files))
+
+	for i, file := range files {
+		if file.Size <= 0 {
+			return 0, fmt.Errorf("unknown size for file %q", file.FileName)
+		}
+
+		size += file.Size
+
+		emptyFiles[i] = file
+		emptyFiles[i].Reader = strings.NewReader("")
+		emptyFiles[i].Progress = nil
+	}
+
+	var w countingWriter
+	if err := writeMultipartBody(&w, boundary, fields, emptyFiles); err != nil {
+		return 0, err
+	}
+
+	return size + w.n, nil
+}
+
+func (file *FilePart) header() textproto.MIMEHeader {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	escape := strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escape(file.FieldName), escape(file.FileName)))
+	header.Set("Content-Type", contentType)
+
+	return header
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	w.n += int64(len(data))
+	return len(data), nil
+}
+
+type progressWriter struct {
+	w        io.Writer
+	n        int64
+	progress func(int64)
+}
+
+func (w *progressWriter) Write(data []byte) (int, error) {
+	n, err := w.w.Write(data)
+
+	w.n += int64(n)
+	w.progress(w.n)
+
+	return n, err
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSendMultipartRequest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := strings.Repeat("0123456789", 10_000)
+
+	var contentLengths []int64
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			contentLengths = append(contentLengths, req.ContentLength)
+
+			require.NoError(req.ParseMultipartForm(1024))
+
+			assert.Equal("bar", req.FormValue("foo"))
+
+			file, header, err := req.FormFile("file")
+			require.NoError(err)
+			defer file.Close()
+
+			assert.Equal("a \"b\".txt", header.Filename)
+			assert.Equal("text/plain", header.Header.Get("Content-Type"))
+
+			data, err := io.ReadAll(file)
+			require.NoError(err)
+			assert.Equal(content, string(data))
+
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{})
+	require.NoError(err)
+	defer client.Terminate()
+
+	uri, err := client.ResolveURI(server.URL)
+	require.NoError(err)
+
+	for _, size := range []int64{0, int64(len(content))} {
+		var progress int64
+
+		files := []FilePart{{
+			FieldName:   "file",
+			FileName:    "a \"b\".txt",
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(content),
+			Size:        size,
+			Progress: func(n int64) {
+				progress = n
+			},
+		}}
+
+		res, err := client.SendMultipartRequest("POST", uri,
+			map[string]string{"foo": "bar"}, files)
+		require.NoError(err)
+		res.Body.Close()
+
+		assert.Equal(204, res.StatusCode)
+		assert.Equal(int64(len(content)), progress)
+	}
+
+	if assert.Len(contentLengths, 2) {
+		assert.Equal(int64(-1), contentLengths[0])
+		assert.Greater(contentLengths[1], int64(len(content)))
+	}
+}
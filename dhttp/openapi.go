@@ -0,0 +1,368 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	checkObjectType   = reflect.TypeOf((*check.Object)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+
+	schemaNames map[reflect.Type]string
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty"`
+}
+
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+func NewOpenAPIDocument(info OpenAPIInfo) *OpenAPIDocument {
+	return &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]*OpenAPISchema),
+		},
+
+		schemaNames: make(map[reflect.Type]string),
+	}
+}
+
+func (s *Server) OpenAPIDocument(info OpenAPIInfo) *OpenAPIDocument {
+	doc := NewOpenAPIDocument(info)
+	doc.AddRoutes(s.Routes())
+
+	return doc
+}
+
+// AddRoutes adds operations for a set of routes. The tags are added to
+// operations of routes which do not have any tag.
+func (doc *OpenAPIDocument) AddRoutes(routes []*Route, tags ...string) {
+	for _, route := range routes {
+		doc.AddRoute(route, tags...)
+	}
+}
+
+func (doc *OpenAPIDocument) AddRoute(route *Route, tags ...string) {
+	op := OpenAPIOperation{
+		Summary:     route.Summary,
+		Description: route.Description,
+		Tags:        route.Tags,
+		Deprecated:  route.Deprecated,
+		Responses:   make(map[string]*OpenAPIResponse),
+	}
+
+	if len(op.Tags) == 0 {
+		op.Tags = tags
+	}
+
+	for _, p := range route.Parameters {
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required,
+			Schema:      doc.valueSchema(p.Value),
+		})
+	}
+
+	if route.RequestBody != nil {
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content:  doc.jsonContent(route.RequestBody),
+		}
+	}
+
+	for status, r := range route.Responses {
+		res := OpenAPIResponse{Description: r.Description}
+
+		if r.Value != nil {
+			res.Content = doc.jsonContent(r.Value)
+		}
+
+		op.Responses[strconv.Itoa(status)] = &res
+	}
+
+	if len(op.Responses) == 0 {
+		op.Responses["200"] = &OpenAPIResponse{Description: "success"}
+	}
+
+	op.Responses["default"] = &OpenAPIResponse{
+		Description: "error",
+		Content:     doc.jsonContent(APIError{}),
+	}
+
+	path := route.openAPIPath()
+
+	pathItem, found := doc.Paths[path]
+	if !found {
+		pathItem = make(map[string]*OpenAPIOperation)
+		doc.Paths[path] = pathItem
+	}
+
+	pathItem[strings.ToLower(route.Method)] = &op
+}
+
+func (doc *OpenAPIDocument) jsonContent(value interface{}) map[string]*OpenAPIMediaType {
+	return map[string]*OpenAPIMediaType{
+		"application/json": {Schema: doc.valueSchema(value)},
+	}
+}
+
+func (doc *OpenAPIDocument) valueSchema(value interface{}) *OpenAPISchema {
+	if value == nil {
+		return &OpenAPISchema{}
+	}
+
+	return doc.typeSchema(reflect.TypeOf(value))
+}
+
+func (doc *OpenAPIDocument) typeSchema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+
+	case t.Implements(textMarshalerType),
+		reflect.PtrTo(t).Implements(textMarshalerType):
+		return &OpenAPISchema{Type: "string"}
+
+	case t.Implements(jsonMarshalerType),
+		reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// We cannot know what the value will look like
+		return &OpenAPISchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+
+		return &OpenAPISchema{Type: "array", Items: doc.typeSchema(t.Elem())}
+
+	case reflect.Map:
+		return &OpenAPISchema{
+			Type:                 "object",
+			AdditionalProperties: doc.typeSchema(t.Elem()),
+		}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+
+		return doc.namedStructSchema(t)
+	}
+
+	return &OpenAPISchema{}
+}
+
+func (doc *OpenAPIDocument) namedStructSchema(t reflect.Type) *OpenAPISchema {
+	name, found := doc.schemaNames[t]
+	if !found {
+		name = t.Name()
+
+		if _, found := doc.Components.Schemas[name]; found {
+			pkgPath := t.PkgPath()
+			name = pkgPath[strings.LastIndex(pkgPath, "/")+1:] + "." + name
+		}
+
+		doc.schemaNames[t] = name
+
+		// Register the name before building the schema to support recursive
+		// types.
+		doc.Components.Schemas[name] = &OpenAPISchema{}
+		*doc.Components.Schemas[name] = *doc.structSchema(t)
+	}
+
+	return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func (doc *OpenAPIDocument) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := OpenAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*OpenAPISchema),
+	}
+
+	doc.addStructProperties(&schema, t)
+
+	schema.Required = structRequiredFields(t)
+
+	return &schema
+}
+
+func (doc *OpenAPIDocument) addStructProperties(schema *OpenAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.SplitN(tag, ",", 2)[0]
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				doc.addStructProperties(schema, ft)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = doc.typeSchema(field.Type)
+	}
+}
+
+// structRequiredFields uses the validation rules of types implementing
+// check.Object to find which fields are required: any top-level member
+// signaled as invalid for a zero value is considered required.
+func structRequiredFields(t reflect.Type) []string {
+	ptr := reflect.New(t)
+	if !ptr.Type().Implements(checkObjectType) {
+		return nil
+	}
+
+	obj := ptr.Interface().(check.Object)
+
+	checker := check.NewChecker()
+
+	func() {
+		// Validation functions may not expect zero values
+		defer func() {
+			recover()
+		}()
+
+		obj.Check(checker)
+	}()
+
+	names := make(map[string]struct{})
+	for _, err := range checker.Errors {
+		if len(err.Pointer) == 1 {
+			names[err.Pointer[0]] = struct{}{}
+		}
+	}
+
+	var required []string
+	for name := range names {
+		required = append(required, name)
+	}
+
+	sort.Strings(required)
+
+	return required
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPITestUser struct {
+	Id           string             `json:"id"`
+	Name         string             `json:"name"`
+	Age          int                `json:"age,omitempty"`
+	CreationTime time.Time          `json:"creation_time"`
+	Friends      []*openAPITestUser `json:"friends,omitempty"`
+	Secret       string             `json:"-"`
+}
+
+func (u *openAPITestUser) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("name", u.Name)
+	c.CheckIntMin("age", u.Age, 0)
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	route := newRoute("/users/{id:[0-9]+}", "PUT").
+		SetSummary("update a user").
+		SetRequestBody(&openAPITestUser{}).
+		AddResponse(200, "the user", &openAPITestUser{})
+
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "test", Version: "1.0.0"})
+	doc.AddRoute(route)
+
+	require.Contains(doc.Paths, "/users/{id}")
+	op := doc.Paths["/users/{id}"]["put"]
+	require.NotNil(op)
+
+	assert.Equal("update a user", op.Summary)
+	require.Len(op.Parameters, 1)
+	assert.Equal("id", op.Parameters[0].Name)
+	assert.Equal("path", op.Parameters[0].In)
+
+	require.NotNil(op.RequestBody)
+	bodySchema := op.RequestBody.Content["application/json"].Schema
+	assert.Equal("#/components/schemas/openAPITestUser", bodySchema.Ref)
+
+	require.Contains(op.Responses, "200")
+	require.Contains(op.Responses, "default")
+
+	schema := doc.Components.Schemas["openAPITestUser"]
+	require.NotNil(schema)
+	assert.Equal([]string{"name"}, schema.Required)
+	assert.Equal("date-time", schema.Properties["creation_time"].Format)
+	assert.Equal("#/components/schemas/openAPITestUser",
+		schema.Properties["friends"].Items.Ref)
+	assert.NotContains(schema.Properties, "Secret")
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Page struct {
+	URI      *url.URL
+	Response *http.Response // the body has already been read
+	Body     []byte
+
+	// The target of the Link header with the "next" relation type, if
+	// there is one, resolved relatively to the URI of the page.
+	NextLink string
+}
+
+func (p *Page) Decode(dest interface{}) error {
+	if err := json.Unmarshal(p.Body, dest); err != nil {
+		return fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	return nil
+}
+
+// PageFunc processes a page and returns the URI of the next page to fetch,
+// or an empty string to stop.
+type PageFunc func(*Page) (string, error)
+
+// Paginate fetches pages starting at firstURI and calls fn for each of them
+// until it returns an empty URI. For APIs using Link headers, fn can simply
+// return page.NextLink.
+func (c *APIClient) Paginate(ctx context.Context, firstURI string, fn PageFunc) error {
+	visited := make(map[string]bool)
+
+	for next := firstURI; next != ""; {
+		if visited[next] {
+			return fmt.Errorf("pagination loop on %q", next)
+		}
+		visited[next] = true
+
+		page, err := c.fetchPage(ctx, next)
+		if err != nil {
+			return err
+		}
+
+		next, err = fn(page)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type LongPollOptions struct {
+	InitialRetryDelay time.Duration // 1s by default
+	MaxRetryDelay     time.Duration // 1m by default
+}
+
+// LongPoll repeatedly fetches uri, calling fn for each response and polling
+// the URI it returns next, until fn returns an empty URI or the context is
+// canceled. Empty (204) responses are ignored. Connection errors, 429 and 5xx
+// responses are retried after an exponential delay with jitter, using the
+// Retry-After header if the server sent one.
+func (c *APIClient) LongPoll(ctx context.Context, uri string, opts *LongPollOptions, fn PageFunc) error {
+	var o LongPollOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.InitialRetryDelay == 0 {
+		o.InitialRetryDelay = time.Second
+	}
+
+	if o.MaxRetryDelay == 0 {
+		o.MaxRetryDelay = time.Minute
+	}
+
+	nbFailures := 0
+
+	for uri != "" {
+		page, err := c.fetchPage(ctx, uri)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if !isRetryablePollError(err) {
+				return err
+			}
+
+			delay := retryDelay(err, nbFailures, &o)
+			nbFailures++
+
+			c.Log.Error("cannot poll %q, retrying in %v: %v", uri,
+				delay.Round(time.Millisecond), err)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+
+			continue
+		}
+
+		nbFailures = 0
+
+		if page.Response.StatusCode == 204 {
+			continue
+		}
+
+		uri, err = fn(page)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *APIClient) fetchPage(ctx context.Context, s string) (*Page, error) {
+	uri, err := c.ResolveURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]string{
+		"Accept": "application/json",
+	}
+
+	res, err := c.SendRequestContext(ctx, "GET", uri, header, nil)
+	if err != nil {
+		if res != nil {
+			res.Body.Close()
+		}
+
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	page := Page{
+		URI:      uri,
+		Response: res,
+		Body:     body,
+	}
+
+	if next := parseLinkHeader(res.Header)["next"]; next != "" {
+		if ref, err := url.Parse(next); err == nil {
+			page.NextLink = uri.ResolveReference(ref).String()
+		}
+	}
+
+	return &page, nil
+}
+
+func isRetryablePollError(err error) bool {
+	var reqErr *APIRequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Status == 429 || reqErr.Status >= 500
+	}
+
+	return true
+}
+
+func retryDelay(err error, nbFailures int, opts *LongPollOptions) time.Duration {
+	var reqErr *APIRequestError
+	if errors.As(err, &reqErr) && reqErr.RetryAfter > 0 {
+		return reqErr.RetryAfter
+	}
+
+	delay := opts.InitialRetryDelay
+	for i := 0; i < nbFailures && delay < opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > opts.MaxRetryDelay {
+		delay = opts.MaxRetryDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseLinkHeader returns the targets of the links of a Link header
+// (RFC 8288) indexed by relation type.
+func parseLinkHeader(header http.Header) map[string]string {
+	links := make(map[string]string)
+
+	for _, v := range header.Values("Link") {
+		for {
+			start := strings.IndexByte(v, '<')
+			end := strings.IndexByte(v, '>')
+			if start < 0 || end < start {
+				break
+			}
+
+			target := v[start+1 : end]
+
+			v = v[end+1:]
+
+			params := v
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				params, v = v[:i], v[i+1:]
+			} else {
+				v = ""
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.ToLower(name) != "rel" {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					links[strings.ToLower(rel)] = target
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(s); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(s); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
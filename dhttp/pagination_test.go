@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	header := http.Header{}
+	header.Add("Link", `</items?a=1,2>; rel="next", </items?page=0>; rel="prev first"`)
+
+	assert.Equal(map[string]string{
+		"next":  "/items?a=1,2",
+		"prev":  "/items?page=0",
+		"first": "/items?page=0",
+	}, parseLinkHeader(header))
+}
+
+func TestAPIClientPaginate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+
+			if req.URL.Path == "/items" && page < 2 {
+				w.Header().Set("Link",
+					fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, "[%d]", page)
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{BaseURI: server.URL})
+	require.NoError(err)
+	defer client.Terminate()
+
+	apiClient := NewAPIClient(client)
+
+	ctx := context.Background()
+
+	var items []int
+
+	err = apiClient.Paginate(ctx, "/items", func(page *Page) (string, error) {
+		var pageItems []int
+		if err := page.Decode(&pageItems); err != nil {
+			return "", err
+		}
+
+		items = append(items, pageItems...)
+
+		return page.NextLink, nil
+	})
+	if assert.NoError(err) {
+		assert.Equal([]int{0, 1, 2}, items)
+	}
+
+	err = apiClient.Paginate(ctx, "/loop", func(page *Page) (string, error) {
+		return "/loop", nil
+	})
+	assert.Error(err)
+}
+
+func TestAPIClientLongPoll(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	nbRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			nbRequests++
+
+			switch nbRequests {
+			case 1:
+				w.WriteHeader(503)
+			case 2:
+				w.WriteHeader(204)
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, "%d", nbRequests)
+			}
+		}))
+	defer server.Close()
+
+	client, err := NewClient(ClientCfg{BaseURI: server.URL})
+	require.NoError(err)
+	defer client.Terminate()
+
+	apiClient := NewAPIClient(client)
+
+	opts := LongPollOptions{
+		InitialRetryDelay: time.Millisecond,
+	}
+
+	var values []int
+
+	err = apiClient.LongPoll(context.Background(), "/events", &opts,
+		func(page *Page) (string, error) {
+			var value int
+			if err := page.Decode(&value); err != nil {
+				return "", err
+			}
+
+			values = append(values, value)
+
+			if len(values) == 2 {
+				return "", nil
+			}
+
+			return "/events", nil
+		})
+	if assert.NoError(err) {
+		assert.Equal([]int{3, 4}, values)
+	}
+}
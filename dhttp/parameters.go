@@ -0,0 +1,211 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+)
+
+// RequestParameters decodes request parameters into the fields of a
+// structure, then validates it. Fields are bound with the following tags:
+//
+//   - query:"name" for query parameters;
+//   - header:"name" for request headers;
+//   - path:"name" for route variables.
+//
+// Supported field types are strings, booleans, integers, floats,
+// time.Duration, pointers to these types and slices of these types (the
+// latter for query parameters which can be repeated). Fields whose parameter
+// is not present are left untouched so that callers can set default values
+// before calling RequestParameters.
+//
+// Validation errors are reported with pointers of the form /<source>/<name>,
+// e.g. /query/limit. Errors reported by the Check method of the object whose
+// first token is the name of a bound parameter are rewritten the same way.
+func (h *Handler) RequestParameters(obj check.Object) error {
+	value := reflect.ValueOf(obj)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("value %#v (%T) is not a structure pointer",
+			obj, obj))
+	}
+
+	c := check.NewChecker()
+
+	sources := make(map[string]string)
+
+	structValue := value.Elem()
+	structType := structValue.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		var source, name string
+		var values []string
+
+		if name = field.Tag.Get("query"); name != "" {
+			source = "query"
+			values = h.Query[name]
+		} else if name = field.Tag.Get("header"); name != "" {
+			source = "header"
+			values = h.Request.Header.Values(name)
+		} else if name = field.Tag.Get("path"); name != "" {
+			source = "path"
+			if value := h.RouteVariable(name); value != "" {
+				values = []string{value}
+			}
+		} else {
+			continue
+		}
+
+		if _, found := sources[name]; !found {
+			sources[name] = source
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		pointer := djson.Pointer{source, name}
+
+		if err := setParameterField(structValue.Field(i), values); err != nil {
+			c.AddError(pointer, "invalid_parameter", "%v", err)
+		}
+	}
+
+	if err := c.Error(); err != nil {
+		h.ReplyRequestParametersValidationErrors(c.Errors)
+		return fmt.Errorf("invalid request parameters: %w", err)
+	}
+
+	obj.Check(c)
+
+	for _, verr := range c.Errors {
+		if len(verr.Pointer) == 0 {
+			continue
+		}
+
+		if source, found := sources[verr.Pointer[0]]; found {
+			verr.Pointer = append(djson.Pointer{source}, verr.Pointer...)
+		}
+	}
+
+	if err := c.Error(); err != nil {
+		h.ReplyRequestParametersValidationErrors(c.Errors)
+		return fmt.Errorf("invalid request parameters: %w", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) ReplyRequestParametersValidationErrors(err check.ValidationErrors) {
+	data := map[string]interface{}{
+		"validation_errors": err,
+	}
+
+	h.ReplyErrorData(400, "invalid_request_parameters", data,
+		"invalid request parameters:\n%v", err)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setParameterField(field reflect.Value, values []string) error {
+	switch field.Kind() {
+	case reflect.Pointer:
+		value := reflect.New(field.Type().Elem())
+		if err := setParameterValue(value.Elem(), values[0]); err != nil {
+			return err
+		}
+
+		field.Set(value)
+		return nil
+
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+
+		for i, s := range values {
+			if err := setParameterValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+		return nil
+	}
+
+	return setParameterValue(field, values[0])
+}
+
+func setParameterValue(value reflect.Value, s string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration")
+		}
+
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean")
+		}
+
+		value.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer")
+		}
+
+		value.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid positive integer")
+		}
+
+		value.SetUint(i)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number")
+		}
+
+		value.SetFloat(f)
+
+	default:
+		panic(fmt.Sprintf("unsupported parameter field type %v",
+			value.Type()))
+	}
+
+	return nil
+}
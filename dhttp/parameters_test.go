@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRequestParameters struct {
+	Id      string        `path:"id"`
+	Limit   int           `query:"limit"`
+	Tags    []string      `query:"tag"`
+	Timeout time.Duration `query:"timeout"`
+	Verbose *bool         `query:"verbose"`
+	Tenant  string        `header:"X-Tenant"`
+}
+
+func (p *testRequestParameters) Check(c *check.Checker) {
+	c.CheckIntMinMax("limit", p.Limit, 1, 100)
+	c.CheckStringNotEmpty("X-Tenant", p.Tenant)
+}
+
+func TestRequestParameters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	var params testRequestParameters
+
+	server.Route("/things/{id}", "GET", func(h *Handler) {
+		params = testRequestParameters{Limit: 10}
+		if err := h.RequestParameters(&params); err != nil {
+			return
+		}
+
+		h.ReplyEmpty(204)
+	})
+
+	call := func(uri, tenant string) (int, check.ValidationErrors) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", uri, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		server.ServeHTTP(w, req)
+
+		var res struct {
+			Data struct {
+				ValidationErrors check.ValidationErrors `json:"validation_errors"`
+			} `json:"data"`
+		}
+
+		if w.Code != 204 {
+			require.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+		}
+
+		return w.Code, res.Data.ValidationErrors
+	}
+
+	status, _ := call("/things/42?tag=a&tag=b&timeout=5s&verbose=true", "t1")
+	assert.Equal(204, status)
+	assert.Equal("42", params.Id)
+	assert.Equal(10, params.Limit)
+	assert.Equal([]string{"a", "b"}, params.Tags)
+	assert.Equal(5*time.Second, params.Timeout)
+	if assert.NotNil(params.Verbose) {
+		assert.True(*params.Verbose)
+	}
+	assert.Equal("t1", params.Tenant)
+
+	status, errs := call("/things/42?limit=foo", "t1")
+	assert.Equal(400, status)
+	if assert.Equal(1, len(errs)) {
+		assert.Equal(djson.Pointer{"query", "limit"}, errs[0].Pointer)
+		assert.Equal("invalid_parameter", errs[0].Code)
+	}
+
+	status, errs = call("/things/42?limit=500", "")
+	assert.Equal(400, status)
+	if assert.Equal(2, len(errs)) {
+		assert.Equal(djson.Pointer{"query", "limit"}, errs[0].Pointer)
+		assert.Equal("integer_too_large", errs[0].Code)
+		assert.Equal(djson.Pointer{"header", "X-Tenant"}, errs[1].Pointer)
+		assert.Equal("empty_string", errs[1].Code)
+	}
+}
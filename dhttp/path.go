@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PathNormalization string
+
+const (
+	// Paths are routed as they are
+	PathNormalizationStrict PathNormalization = "strict"
+
+	// Clients are redirected to the normalized path
+	PathNormalizationRedirect PathNormalization = "redirect"
+
+	// Requests are routed using the normalized path
+	PathNormalizationRewrite PathNormalization = "rewrite"
+)
+
+var PathNormalizationValues = []PathNormalization{
+	PathNormalizationStrict,
+	PathNormalizationRedirect,
+	PathNormalizationRewrite,
+}
+
+// handlePathNormalization normalizes the path of requests which do not match
+// any route: duplicate slashes and dot segments are removed, and a trailing
+// slash is added or removed if the resulting path matches a route. It
+// returns true if a response was sent.
+func (s *Server) handlePathNormalization(h *Handler) bool {
+	policy := s.Cfg.PathNormalization
+	if policy == "" || policy == PathNormalizationStrict {
+		return false
+	}
+
+	req := h.Request
+
+	router := s.requestRouter(req)
+
+	reqPath := req.URL.Path
+	if s.pathMatches(router, reqPath) {
+		return false
+	}
+
+	normalizedPath := normalizePath(reqPath)
+
+	candidates := []string{normalizedPath}
+	if normalizedPath != "/" {
+		if strings.HasSuffix(normalizedPath, "/") {
+			candidates = append(candidates,
+				strings.TrimSuffix(normalizedPath, "/"))
+		} else {
+			candidates = append(candidates, normalizedPath+"/")
+		}
+	}
+
+	var newPath string
+	for _, candidate := range candidates {
+		if candidate != reqPath && s.pathMatches(router, candidate) {
+			newPath = candidate
+			break
+		}
+	}
+
+	if newPath == "" {
+		return false
+	}
+
+	switch policy {
+	case PathNormalizationRedirect:
+		uri := url.URL{Path: newPath, RawQuery: req.URL.RawQuery}
+
+		// 308 preserves the method and the body of the request
+		status := 308
+		if req.Method == "GET" || req.Method == "HEAD" {
+			status = 301
+		}
+
+		h.ReplyRedirect(status, uri.String())
+		return true
+
+	case PathNormalizationRewrite:
+		newURL := *req.URL
+		newURL.Path = newPath
+		newURL.RawPath = ""
+
+		req2 := req.Clone(req.Context())
+		req2.URL = &newURL
+
+		h.Request = req2
+		h.Log.Data["original_path"] = reqPath
+	}
+
+	return false
+}
+
+// pathMatches indicates whether a path matches a route of a router for any
+// method.
+func (s *Server) pathMatches(router *chi.Mux, p string) bool {
+	var methods []string
+
+	for _, route := range s.Routes() {
+		method := strings.ToUpper(route.Method)
+		if containsString(methods, method) {
+			continue
+		}
+
+		methods = append(methods, method)
+
+		if router.Match(chi.NewRouteContext(), method, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	trailingSlash := strings.HasSuffix(p, "/")
+
+	p = path.Clean("/" + p)
+	if trailingSlash && p != "/" {
+		p += "/"
+	}
+
+	return p
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/", normalizePath(""))
+	assert.Equal("/", normalizePath("//"))
+	assert.Equal("/a/b", normalizePath("/a//b"))
+	assert.Equal("/a/c/", normalizePath("/a/./b/../c/"))
+	assert.Equal("/a", normalizePath("/../a"))
+}
+
+func TestPathNormalization(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newServer := func(policy PathNormalization) *Server {
+		server, err := NewServer(ServerCfg{
+			ErrorChan:         make(chan error, 1),
+			PathNormalization: policy,
+		})
+		require.NoError(err)
+
+		reply := func(h *Handler) { h.ReplyJSON(200, h.Request.URL.Path) }
+
+		server.Route("/foo", "GET", reply)
+		server.Route("/bar/", "POST", reply)
+
+		return server
+	}
+
+	call := func(server *Server, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	server := newServer(PathNormalizationStrict)
+	assert.Equal(200, call(server, "GET", "/foo").Code)
+	assert.Equal(404, call(server, "GET", "/foo/").Code)
+
+	server = newServer(PathNormalizationRedirect)
+	w := call(server, "GET", "/x/..//foo/?a=1")
+	assert.Equal(301, w.Code)
+	assert.Equal("/foo?a=1", w.Header().Get("Location"))
+	w = call(server, "POST", "/bar")
+	assert.Equal(308, w.Code)
+	assert.Equal("/bar/", w.Header().Get("Location"))
+	assert.Equal(404, call(server, "GET", "/baz/").Code)
+
+	server = newServer(PathNormalizationRewrite)
+	w = call(server, "GET", "//foo/")
+	assert.Equal(200, w.Code)
+	assert.Equal("\"/foo\"\n", w.Body.String())
+}
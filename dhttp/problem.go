@@ -0,0 +1,154 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type ErrorFormat string
+
+const (
+	ErrorFormatAPIError       ErrorFormat = "api_error"
+	ErrorFormatProblemDetails ErrorFormat = "problem_details"
+)
+
+var ErrorFormatValues = []ErrorFormat{
+	ErrorFormatAPIError,
+	ErrorFormatProblemDetails,
+}
+
+// ProblemDetails is an error response as defined in RFC 7807. Extension
+// members are encoded at the top level of the JSON object.
+type ProblemDetails struct {
+	Type       string                 `json:"type,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Status     int                    `json:"status,omitempty"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (pd ProblemDetails) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]interface{}, len(pd.Extensions)+5)
+
+	for name, value := range pd.Extensions {
+		obj[name] = value
+	}
+
+	setMember := func(name, value string) {
+		if value != "" {
+			obj[name] = value
+		}
+	}
+
+	setMember("type", pd.Type)
+	setMember("title", pd.Title)
+	setMember("detail", pd.Detail)
+	setMember("instance", pd.Instance)
+
+	if pd.Status != 0 {
+		obj["status"] = pd.Status
+	}
+
+	return json.Marshal(obj)
+}
+
+func (pd *ProblemDetails) UnmarshalJSON(data []byte) error {
+	type problemDetails ProblemDetails
+
+	var pd2 problemDetails
+	if err := json.Unmarshal(data, &pd2); err != nil {
+		return err
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(obj, name)
+	}
+
+	if len(obj) > 0 {
+		pd2.Extensions = obj
+	}
+
+	*pd = ProblemDetails(pd2)
+	return nil
+}
+
+func (h *Handler) ReplyProblemDetails(pd ProblemDetails) {
+	if pd.Status == 0 {
+		pd.Status = 500
+	}
+
+	if pd.Type == "" {
+		pd.Type = "about:blank"
+	}
+
+	if pd.Title == "" {
+		pd.Title = http.StatusText(pd.Status)
+	}
+
+	if code, ok := pd.Extensions["code"].(string); ok {
+		h.errorCode = code
+	}
+
+	header := h.ResponseWriter.Header()
+	header.Set("Content-Type", "application/problem+json")
+
+	h.replyJSON(pd.Status, pd, h.JSONEncoding)
+}
+
+func (s *Server) errorFormat(h *Handler) ErrorFormat {
+	if h.Route != nil && h.Route.ErrorFormat != "" {
+		return h.Route.ErrorFormat
+	}
+
+	if s.Cfg.ErrorFormat != "" {
+		return s.Cfg.ErrorFormat
+	}
+
+	return ErrorFormatAPIError
+}
+
+func (s *Server) problemDetails(h *Handler, status int, code, msg string, data APIErrorData) ProblemDetails {
+	pd := ProblemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   msg,
+		Instance: h.Request.URL.Path,
+	}
+
+	if code != "" && s.Cfg.ProblemTypeBaseURI != "" {
+		pd.Type = strings.TrimSuffix(s.Cfg.ProblemTypeBaseURI, "/") + "/" + code
+	}
+
+	pd.Extensions = make(map[string]interface{}, len(data)+1)
+	for name, value := range data {
+		pd.Extensions[name] = value
+	}
+
+	if code != "" {
+		pd.Extensions["code"] = code
+	}
+
+	return pd
+}
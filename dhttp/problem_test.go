@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblemDetails(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:          make(chan error, 1),
+		ProblemTypeBaseURI: "https://example.com/errors/",
+	})
+	require.NoError(err)
+
+	replyError := func(h *Handler) {
+		h.ReplyErrorData(409, "duplicate_name", APIErrorData{"name": "foo"},
+			"name %q already used", "foo")
+	}
+
+	server.Route("/default", "GET", replyError)
+	server.Route("/problem", "GET", replyError).
+		SetErrorFormat(ErrorFormatProblemDetails)
+
+	call := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := call("/default")
+	assert.Equal(409, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+
+	w = call("/problem")
+	assert.Equal(409, w.Code)
+	assert.Equal("application/problem+json", w.Header().Get("Content-Type"))
+
+	var pd ProblemDetails
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &pd))
+	assert.Equal("https://example.com/errors/duplicate_name", pd.Type)
+	assert.Equal("Conflict", pd.Title)
+	assert.Equal(409, pd.Status)
+	assert.Equal(`name "foo" already used`, pd.Detail)
+	assert.Equal("/problem", pd.Instance)
+	assert.Equal("duplicate_name", pd.Extensions["code"])
+	assert.Equal("foo", pd.Extensions["name"])
+
+	server.Cfg.ErrorFormat = ErrorFormatProblemDetails
+
+	w = call("/unknown")
+	assert.Equal(404, w.Code)
+	assert.Equal("application/problem+json", w.Header().Get("Content-Type"))
+}
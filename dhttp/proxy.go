@@ -0,0 +1,190 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/dlog"
+)
+
+type ProxyOptions struct {
+	// The name of the upstream used for metrics, the host of the target URI
+	// by default.
+	Upstream string
+
+	// A prefix removed from the request path before it is appended to the
+	// path of the target URI.
+	StripPrefix string
+
+	RequestHeader        http.Header // headers set on upstream requests
+	RemoveRequestHeaders []string
+
+	ResponseHeader        http.Header // headers set on responses
+	RemoveResponseHeaders []string
+
+	Transport http.RoundTripper
+
+	// The interval between flushes of the response; responses are flushed
+	// after each write if negative, which is required for streaming
+	// responses such as server-sent events.
+	FlushInterval time.Duration
+}
+
+type ProxyUpstreamStats struct {
+	NbRequests int64         `json:"nb_requests"`
+	NbErrors   int64         `json:"nb_errors"`
+	TotalTime  time.Duration `json:"total_time"`
+}
+
+type proxyStats struct {
+	upstreams map[string]*ProxyUpstreamStats
+	mutex     sync.Mutex
+}
+
+func (s *proxyStats) update(upstream string, d time.Duration, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.upstreams == nil {
+		s.upstreams = make(map[string]*ProxyUpstreamStats)
+	}
+
+	stats, found := s.upstreams[upstream]
+	if !found {
+		stats = &ProxyUpstreamStats{}
+		s.upstreams[upstream] = stats
+	}
+
+	stats.NbRequests++
+	if failed {
+		stats.NbErrors++
+	}
+	stats.TotalTime += d
+}
+
+// ProxyStats returns cumulative statistics for each upstream used by
+// Handler.Proxy.
+func (s *Server) ProxyStats() map[string]ProxyUpstreamStats {
+	s.proxyStats.mutex.Lock()
+	defer s.proxyStats.mutex.Unlock()
+
+	stats := make(map[string]ProxyUpstreamStats)
+	for upstream, upstreamStats := range s.proxyStats.upstreams {
+		stats[upstream] = *upstreamStats
+	}
+
+	return stats
+}
+
+// Proxy forwards the request to an upstream server and copies the response.
+// The request id is propagated using the X-Request-Id header.
+func (h *Handler) Proxy(target *url.URL, opts ProxyOptions) {
+	upstream := opts.Upstream
+	if upstream == "" {
+		upstream = target.Host
+	}
+
+	start := time.Now()
+	failed := false
+
+	director := func(req *http.Request) {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.Host = target.Host
+
+		path := strings.TrimPrefix(req.URL.Path, opts.StripPrefix)
+		req.URL.Path = singleJoiningSlash(target.Path, path)
+		req.URL.RawPath = ""
+
+		if target.RawQuery != "" {
+			if req.URL.RawQuery == "" {
+				req.URL.RawQuery = target.RawQuery
+			} else {
+				req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+			}
+		}
+
+		for _, name := range opts.RemoveRequestHeaders {
+			req.Header.Del(name)
+		}
+
+		for name, values := range opts.RequestHeader {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+
+		req.Header.Set("X-Request-Id", h.RequestId)
+
+		if _, found := req.Header["User-Agent"]; !found {
+			// Prevent the http client from setting its default user agent
+			req.Header.Set("User-Agent", "")
+		}
+	}
+
+	modifyResponse := func(res *http.Response) error {
+		for _, name := range opts.RemoveResponseHeaders {
+			res.Header.Del(name)
+		}
+
+		for name, values := range opts.ResponseHeader {
+			res.Header[http.CanonicalHeaderKey(name)] = values
+		}
+
+		if res.StatusCode >= 500 {
+			failed = true
+		}
+
+		return nil
+	}
+
+	errorHandler := func(w http.ResponseWriter, req *http.Request, err error) {
+		failed = true
+
+		h.Log.Error("cannot proxy request to %q: %v", upstream, err)
+		h.ReplyError(502, "upstream_error", "cannot reach upstream server")
+	}
+
+	proxy := httputil.ReverseProxy{
+		Director:       director,
+		ModifyResponse: modifyResponse,
+		ErrorHandler:   errorHandler,
+		Transport:      opts.Transport,
+		FlushInterval:  opts.FlushInterval,
+		ErrorLog:       h.Log.StdLogger(dlog.LevelError),
+	}
+
+	proxy.ServeHTTP(h.ResponseWriter, h.Request)
+
+	h.Server.proxyStats.update(upstream, time.Since(start), failed)
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+
+	return a + b
+}
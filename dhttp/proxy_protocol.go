@@ -0,0 +1,262 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+var proxyProtocolV2Signature = []byte{
+	0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a,
+}
+
+var ErrInvalidProxyProtocolHeader = errors.New("invalid proxy protocol header")
+
+// ProxyProtocolCfg enables support for the PROXY protocol (versions 1 and 2)
+// used by TCP load balancers to transmit the address of the client. Once
+// enabled, connections must start with a PROXY header; connections from
+// addresses which are not in TrustedAddresses (if it is not empty) are
+// handled as direct connections and must not send any header.
+type ProxyProtocolCfg struct {
+	HeaderTimeout    dtime.Duration `json:"header_timeout,omitempty"`
+	TrustedAddresses []string       `json:"trusted_addresses,omitempty"`
+}
+
+func (cfg *ProxyProtocolCfg) Check(c *check.Checker) {
+	c.CheckDurationMin("header_timeout", cfg.HeaderTimeout.Duration(), 0)
+	checkAddressList(c, "trusted_addresses", cfg.TrustedAddresses)
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+
+	headerTimeout    time.Duration
+	trustedAddresses addressList
+}
+
+func newProxyProtocolListener(l net.Listener, cfg *ProxyProtocolCfg) (*proxyProtocolListener, error) {
+	trustedAddresses, err := parseAddressList(cfg.TrustedAddresses)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted addresses: %w", err)
+	}
+
+	headerTimeout := cfg.HeaderTimeout.Duration()
+	if headerTimeout == 0 {
+		headerTimeout = 5 * time.Second
+	}
+
+	pl := proxyProtocolListener{
+		Listener: l,
+
+		headerTimeout:    headerTimeout,
+		trustedAddresses: trustedAddresses,
+	}
+
+	return &pl, nil
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(l.trustedAddresses) > 0 {
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if !l.trustedAddresses.contains(host) {
+			return conn, nil
+		}
+	}
+
+	pconn := proxyProtocolConn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		headerTimeout: l.headerTimeout,
+	}
+
+	return &pconn, nil
+}
+
+// proxyProtocolConn reads the PROXY header the first time the connection is
+// used, i.e. in the goroutine handling the connection and not in the one
+// accepting connections.
+type proxyProtocolConn struct {
+	net.Conn
+
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	headerOnce sync.Once
+	headerErr  error
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtocolConn) Read(data []byte) (int, error) {
+	c.headerOnce.Do(c.readHeader)
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+
+	return c.reader.Read(data)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.headerOnce.Do(c.readHeader)
+
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	addr, err := readProxyProtocolHeader(c.reader)
+	if err != nil {
+		c.headerErr = err
+		c.Conn.Close()
+		return
+	}
+
+	c.remoteAddr = addr
+}
+
+// readProxyProtocolHeader reads a PROXY header and returns the source
+// address it contains, or nil for connections established by the proxy
+// itself (e.g. health checks).
+func readProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	signature, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read proxy protocol header: %w", err)
+	}
+
+	if bytes.Equal(signature, proxyProtocolV2Signature) {
+		return readProxyProtocolV2Header(r)
+	} else if bytes.HasPrefix(signature, []byte("PROXY ")) {
+		return readProxyProtocolV1Header(r)
+	}
+
+	return nil, ErrInvalidProxyProtocolHeader
+}
+
+func readProxyProtocolV1Header(r *bufio.Reader) (net.Addr, error) {
+	// The maximum length of a v1 header is 107 bytes including CRLF
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read proxy protocol header: %w",
+				err)
+		}
+
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyProtocolHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyProtocolHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, ErrInvalidProxyProtocolHeader
+	}
+
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, ErrInvalidProxyProtocolHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyProtocolV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("cannot read proxy protocol header: %w", err)
+	}
+
+	version := header[12] >> 4
+	command := header[12] & 0x0f
+	family := header[13] >> 4
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	if version != 2 || command > 1 {
+		return nil, ErrInvalidProxyProtocolHeader
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("cannot read proxy protocol header: %w", err)
+	}
+
+	// LOCAL command: the connection was established by the proxy itself
+	if command == 0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 0x1: // AF_INET
+		if len(data) < 12 {
+			return nil, ErrInvalidProxyProtocolHeader
+		}
+
+		return &net.TCPAddr{
+			IP:   net.IP(data[0:4]),
+			Port: int(binary.BigEndian.Uint16(data[8:10])),
+		}, nil
+
+	case 0x2: // AF_INET6
+		if len(data) < 36 {
+			return nil, ErrInvalidProxyProtocolHeader
+		}
+
+		return &net.TCPAddr{
+			IP:   net.IP(data[0:16]),
+			Port: int(binary.BigEndian.Uint16(data[32:34])),
+		}, nil
+	}
+
+	// Unspecified or unsupported (e.g. unix sockets) families
+	return nil, nil
+}
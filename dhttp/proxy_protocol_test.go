@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	read := func(data []byte) (net.Addr, string, error) {
+		r := bufio.NewReader(bytes.NewReader(data))
+
+		addr, err := readProxyProtocolHeader(r)
+		rest, _ := io.ReadAll(r)
+
+		return addr, string(rest), err
+	}
+
+	addr, rest, err := read([]byte(
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET /"))
+	if assert.NoError(err) {
+		assert.Equal("192.0.2.1:56324", addr.String())
+		assert.Equal("GET /", rest)
+	}
+
+	addr, _, err = read([]byte("PROXY UNKNOWN\r\n"))
+	if assert.NoError(err) {
+		assert.Nil(addr)
+	}
+
+	v2 := append([]byte{}, proxyProtocolV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0x00, 0x0c)
+	v2 = append(v2, 192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb)
+	v2 = append(v2, []byte("GET /")...)
+
+	addr, rest, err = read(v2)
+	if assert.NoError(err) {
+		assert.Equal("192.0.2.1:56324", addr.String())
+		assert.Equal("GET /", rest)
+	}
+
+	_, _, err = read([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.ErrorIs(err, ErrInvalidProxyProtocolHeader)
+}
+
+func TestProxyProtocolServer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:     make(chan error, 1),
+		Address:       "127.0.0.1:0",
+		ProxyProtocol: &ProxyProtocolCfg{},
+	})
+	require.NoError(err)
+
+	server.Route("/address", "GET", func(h *Handler) {
+		h.ReplyJSON(200, h.ClientAddress)
+	})
+
+	require.NoError(server.Start())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.Address())
+	require.NoError(err)
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")
+	fmt.Fprintf(conn, "GET /address HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(err)
+
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("\"192.0.2.1\"\n", string(body))
+}
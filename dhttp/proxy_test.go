@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Path", req.URL.Path)
+			w.Header().Set("X-Upstream-Request-Id", req.Header.Get("X-Request-Id"))
+			w.Header().Set("X-Foo", req.Header.Get("X-Foo"))
+			w.Header().Set("Server", "upstream")
+			w.WriteHeader(201)
+			w.Write([]byte("hello"))
+		}))
+	defer upstream.Close()
+
+	target, err := url.Parse(upstream.URL + "/api")
+	require.NoError(err)
+
+	server, err := NewServer(ServerCfg{ErrorChan: make(chan error, 1)})
+	require.NoError(err)
+
+	server.Route("/proxy/*", "GET", func(h *Handler) {
+		h.Proxy(target, ProxyOptions{
+			Upstream:              "test",
+			StripPrefix:           "/proxy",
+			RequestHeader:         http.Header{"X-Foo": []string{"bar"}},
+			RemoveResponseHeaders: []string{"Server"},
+		})
+	})
+
+	req := httptest.NewRequest("GET", "/proxy/users/1", nil)
+	req.Header.Set("X-Request-Id", "abc")
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	assert.Equal(201, w.Code)
+	assert.Equal("hello", w.Body.String())
+	assert.Equal("/api/users/1", w.Header().Get("X-Path"))
+	assert.Equal("abc", w.Header().Get("X-Upstream-Request-Id"))
+	assert.Equal("bar", w.Header().Get("X-Foo"))
+	assert.Empty(w.Header().Get("Server"))
+
+	stats := server.ProxyStats()["test"]
+	assert.Equal(int64(1), stats.NbRequests)
+	assert.Equal(int64(0), stats.NbErrors)
+}
+
+func TestProxyError(t *testing.T) {
+	assert := assert.New(t)
+
+	target, _ := url.Parse("http://localhost:1")
+
+	th := NewTestHandler("GET", "/proxy", nil)
+	th.Proxy(target, ProxyOptions{})
+	th.AssertAPIError(t, 502, "upstream_error")
+
+	assert.Equal(int64(1), th.Server.ProxyStats()["localhost:1"].NbErrors)
+}
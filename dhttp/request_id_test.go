@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIdPropagation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var requestId string
+	target := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			requestId = req.Header.Get("X-Request-Id")
+		}))
+	defer target.Close()
+
+	targetURI, err := url.Parse(target.URL)
+	require.NoError(err)
+
+	client, err := NewClient(ClientCfg{PropagateRequestId: true})
+	require.NoError(err)
+	defer client.Terminate()
+
+	// The id of the request being handled is available in the request
+	// context and copied to outgoing requests.
+	server, err := NewServer(ServerCfg{ErrorChan: make(chan error, 1)})
+	require.NoError(err)
+
+	var handlerRequestId string
+	server.Route("/", "GET", func(h *Handler) {
+		handlerRequestId = h.RequestId
+		assert.Equal(h.RequestId, RequestIdFromContext(h.Request.Context()))
+
+		res, err := client.SendRequestContext(h.Request.Context(), "GET",
+			targetURI, nil, nil)
+		if err != nil {
+			h.ReplyInternalError(500, "%v", err)
+			return
+		}
+		res.Body.Close()
+
+		h.ReplyEmpty(204)
+	})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(204, w.Code)
+
+	assert.NotEmpty(handlerRequestId)
+	assert.Equal(handlerRequestId, requestId)
+
+	// Explicit request ids are not replaced
+	ctx := ContextWithRequestId(context.Background(), "foo")
+	res, err := client.SendRequestContext(ctx, "GET", targetURI,
+		map[string]string{"X-Request-Id": "bar"}, nil)
+	require.NoError(err)
+	res.Body.Close()
+	assert.Equal("bar", requestId)
+
+	// Request ids are only propagated if the option is set
+	client2, err := NewClient(ClientCfg{})
+	require.NoError(err)
+	defer client2.Terminate()
+
+	res, err = client2.SendRequestContext(ctx, "GET", targetURI, nil, nil)
+	require.NoError(err)
+	res.Body.Close()
+	assert.Equal("", requestId)
+
+	assert.Equal("", RequestIdFromContext(context.Background()))
+}
@@ -20,7 +20,13 @@ type ResponseWriter struct {
 	Status           int
 	ResponseBodySize int
 
+	// The first error returned when writing the response body, usually
+	// because the client closed the connection
+	WriteError error
+
 	w http.ResponseWriter
+
+	discardBody bool
 }
 
 func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
@@ -36,7 +42,16 @@ func (w *ResponseWriter) Header() http.Header {
 func (w *ResponseWriter) Write(data []byte) (int, error) {
 	w.ResponseBodySize += len(data)
 
-	return w.w.Write(data)
+	if w.discardBody {
+		return len(data), nil
+	}
+
+	n, err := w.w.Write(data)
+	if err != nil && w.WriteError == nil {
+		w.WriteError = err
+	}
+
+	return n, err
 }
 
 func (w *ResponseWriter) WriteHeader(status int) {
@@ -44,3 +59,9 @@ func (w *ResponseWriter) WriteHeader(status int) {
 
 	w.w.WriteHeader(status)
 }
+
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
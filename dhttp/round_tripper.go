@@ -15,20 +15,32 @@
 package dhttp
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/exograd/go-daemon/dlog"
 )
 
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
 type RoundTripper struct {
 	Cfg *ClientCfg
 	Log *dlog.Logger
 
 	http.RoundTripper
+
+	metrics *clientMetrics
 }
 
 func NewRoundTripper(rt http.RoundTripper, cfg *ClientCfg) *RoundTripper {
@@ -37,6 +49,8 @@ func NewRoundTripper(rt http.RoundTripper, cfg *ClientCfg) *RoundTripper {
 		Log: cfg.Log,
 
 		RoundTripper: rt,
+
+		metrics: newClientMetrics(),
 	}
 }
 
@@ -45,21 +59,48 @@ func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	rt.finalizeReq(req)
 
+	var reqBody *bodyCapture
+	if rt.logBodies() && req.Body != nil {
+		reqBody = newBodyCapture(req.Body, rt.Cfg.RequestLog.MaxBodySize)
+		req.Body = reqBody
+	}
+
+	req, trace := rt.metrics.start(req)
+
 	res, err := rt.RoundTripper.RoundTrip(req)
 
+	rt.metrics.record(req, res, trace, time.Since(start))
+
 	if err == nil && rt.Cfg.LogRequests {
-		rt.logRequest(req, res, time.Since(start).Seconds())
+		seconds := time.Since(start).Seconds()
+
+		if rt.Cfg.RequestLog == nil {
+			rt.logRequest(req, res, seconds)
+		} else {
+			rt.logRequestData(req, res, reqBody, seconds)
+		}
 	}
 
 	return res, err
 }
 
+func (rt *RoundTripper) logBodies() bool {
+	return rt.Cfg.LogRequests && rt.Cfg.RequestLog != nil &&
+		rt.Cfg.RequestLog.Bodies
+}
+
 func (rt *RoundTripper) finalizeReq(req *http.Request) {
 	for name, values := range rt.Cfg.Header {
 		for _, value := range values {
 			req.Header.Add(name, value)
 		}
 	}
+
+	if rt.Cfg.PropagateRequestId && req.Header.Get("X-Request-Id") == "" {
+		if id := RequestIdFromContext(req.Context()); id != "" {
+			req.Header.Set("X-Request-Id", id)
+		}
+	}
 }
 
 func (rt *RoundTripper) logRequest(req *http.Request, res *http.Response, seconds float64) {
@@ -70,15 +111,152 @@ func (rt *RoundTripper) logRequest(req *http.Request, res *http.Response, second
 		statusString = strconv.Itoa(res.StatusCode)
 	}
 
-	var reqTimeString string
+	rt.Log.Info("%s %s %s %s", req.Method, req.URL.String(), statusString,
+		formatRequestTime(seconds))
+}
+
+func (rt *RoundTripper) logRequestData(req *http.Request, res *http.Response, reqBody *bodyCapture, seconds float64) {
+	cfg := rt.Cfg.RequestLog
+
+	data := dlog.Data{
+		"method": req.Method,
+		"uri":    req.URL.String(),
+		"time":   int64(seconds * 1e6),
+	}
+
+	statusString := "-"
+	if res != nil {
+		statusString = strconv.Itoa(res.StatusCode)
+		data["status"] = res.StatusCode
+	}
+
+	if cfg.Headers {
+		data["request_header"] = rt.redactHeader(req.Header)
+
+		if res != nil {
+			data["response_header"] = rt.redactHeader(res.Header)
+		}
+	}
+
+	if cfg.Bodies {
+		if reqBody != nil {
+			data["request_body"] = reqBody.String()
+		}
+
+		if res != nil && res.Body != nil {
+			resBody, err := captureResponseBody(res, cfg.MaxBodySize)
+			if err != nil {
+				rt.Log.Error("cannot read response body: %v", err)
+			} else {
+				data["response_body"] = resBody
+			}
+		}
+	}
+
+	rt.Log.InfoData(data, "%s %s %s %s", req.Method, req.URL.String(),
+		statusString, formatRequestTime(seconds))
+}
+
+func (rt *RoundTripper) redactHeader(header http.Header) map[string]string {
+	redacted := make(map[string]struct{})
+
+	for _, name := range DefaultRedactedHeaders {
+		redacted[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+
+	for _, name := range rt.Cfg.RequestLog.RedactedHeaders {
+		redacted[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+
+	values := make(map[string]string)
+
+	for name, headerValues := range header {
+		if _, found := redacted[http.CanonicalHeaderKey(name)]; found {
+			values[name] = "[redacted]"
+		} else {
+			values[name] = strings.Join(headerValues, ", ")
+		}
+	}
+
+	return values
+}
+
+func formatRequestTime(seconds float64) string {
 	if seconds < 0.001 {
-		reqTimeString = fmt.Sprintf("%dµs", int(math.Ceil(seconds*1e6)))
+		return fmt.Sprintf("%dµs", int(math.Ceil(seconds*1e6)))
 	} else if seconds < 1.0 {
-		reqTimeString = fmt.Sprintf("%dms", int(math.Ceil(seconds*1e3)))
-	} else {
-		reqTimeString = fmt.Sprintf("%.1fs", seconds)
+		return fmt.Sprintf("%dms", int(math.Ceil(seconds*1e3)))
 	}
 
-	rt.Log.Info("%s %s %s %s", req.Method, req.URL.String(), statusString,
-		reqTimeString)
+	return fmt.Sprintf("%.1fs", seconds)
+}
+
+type bodyCapture struct {
+	io.ReadCloser
+
+	buf       bytes.Buffer
+	maxSize   int
+	truncated bool
+}
+
+func newBodyCapture(body io.ReadCloser, maxSize int) *bodyCapture {
+	return &bodyCapture{
+		ReadCloser: body,
+		maxSize:    maxSize,
+	}
+}
+
+func (c *bodyCapture) Read(data []byte) (int, error) {
+	n, err := c.ReadCloser.Read(data)
+
+	if n > 0 {
+		if rest := c.maxSize - c.buf.Len(); rest >= n {
+			c.buf.Write(data[:n])
+		} else {
+			if rest > 0 {
+				c.buf.Write(data[:rest])
+			}
+
+			c.truncated = true
+		}
+	}
+
+	return n, err
+}
+
+func (c *bodyCapture) String() string {
+	s := c.buf.String()
+
+	if c.truncated {
+		s += " [truncated]"
+	}
+
+	return s
+}
+
+func captureResponseBody(res *http.Response, maxSize int) (string, error) {
+	// We read at most maxSize+1 bytes to know if the body was truncated, then
+	// put the data we read back in front of the remaining body so that the
+	// caller can still read the entire response.
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, int64(maxSize)+1))
+	if err != nil {
+		return "", err
+	}
+
+	res.Body = &multiReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(data), res.Body),
+		Closer: res.Body,
+	}
+
+	if len(data) > maxSize {
+		return string(data[:maxSize]) + " [truncated]", nil
+	}
+
+	return string(data), nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
 }
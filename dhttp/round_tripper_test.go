@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogBackend struct {
+	messages []dlog.Message
+	mutex    sync.Mutex
+}
+
+func newTestLogger() (*dlog.Logger, *testLogBackend) {
+	backend := &testLogBackend{}
+
+	log := dlog.DefaultLogger("test")
+	log.Backend = backend
+
+	return log, backend
+}
+
+func (b *testLogBackend) Log(msg dlog.Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.messages = append(b.messages, msg)
+}
+
+func (b *testLogBackend) Messages() []dlog.Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]dlog.Message(nil), b.messages...)
+}
+
+func TestRoundTripperRequestLog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Set-Cookie", "session=abc")
+			w.Header().Set("X-Response", "foo")
+			io.WriteString(w, "0123456789")
+		}))
+	defer server.Close()
+
+	log, backend := newTestLogger()
+
+	client, err := NewClient(ClientCfg{
+		Log: log,
+
+		LogRequests: true,
+		RequestLog: &RequestLogCfg{
+			Headers:         true,
+			Bodies:          true,
+			MaxBodySize:     4,
+			RedactedHeaders: []string{"x-api-key"},
+		},
+	})
+	require.NoError(err)
+	defer client.Terminate()
+
+	uri, err := url.Parse(server.URL + "/foo")
+	require.NoError(err)
+
+	header := map[string]string{
+		"Authorization": "Bearer secret",
+		"X-Api-Key":     "secret",
+		"X-Request":     "bar",
+	}
+
+	res, err := client.SendRequest("POST", uri, header,
+		strings.NewReader("abcdef"))
+	require.NoError(err)
+
+	// The response body must still be entirely readable
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(err)
+	assert.Equal("0123456789", string(body))
+
+	messages := backend.Messages()
+	require.Equal(1, len(messages))
+
+	data := messages[0].Data
+	assert.Equal("POST", data["method"])
+	assert.Equal(200, data["status"])
+	assert.Equal("abcd [truncated]", data["request_body"])
+	assert.Equal("0123 [truncated]", data["response_body"])
+
+	reqHeader := data["request_header"].(map[string]string)
+	assert.Equal("[redacted]", reqHeader["Authorization"])
+	assert.Equal("[redacted]", reqHeader["X-Api-Key"])
+	assert.Equal("bar", reqHeader["X-Request"])
+
+	resHeader := data["response_header"].(map[string]string)
+	assert.Equal("[redacted]", resHeader["Set-Cookie"])
+	assert.Equal("foo", resHeader["X-Response"])
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"regexp"
+	"strings"
+)
+
+var routeVariableRE = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// Route contains the metadata associated with a route. It is used to document
+// the route, and to validate and authorize requests.
+type Route struct {
+	Host    string // empty for routes matching all hosts
+	Pattern string
+	Method  string
+
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+
+	Parameters  []*RouteParameter
+	RequestBody interface{}
+	Responses   map[int]*RouteResponse
+
+	AuthRequired bool
+	AuthScopes   []string
+
+	// The action recorded in audit events, e.g. "user.create"
+	AuditAction string
+
+	// The format of error responses, overriding ServerCfg.ErrorFormat
+	ErrorFormat ErrorFormat
+
+	// The function used to reply with errors, overriding
+	// ServerCfg.ErrorHandler
+	ErrorHandler ErrorHandler
+}
+
+type RouteParameter struct {
+	Name        string
+	In          string // "path", "query" or "header"
+	Description string
+	Required    bool
+	Value       interface{}
+}
+
+type RouteResponse struct {
+	Description string
+	Value       interface{}
+}
+
+func newRoute(pattern, method string) *Route {
+	r := &Route{
+		Pattern: pattern,
+		Method:  method,
+
+		Responses: make(map[int]*RouteResponse),
+	}
+
+	for _, name := range routeVariables(pattern) {
+		r.Parameters = append(r.Parameters, &RouteParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Value:    "",
+		})
+	}
+
+	return r
+}
+
+func (r *Route) String() string {
+	if r.Host == "" {
+		return r.Method + " " + r.Pattern
+	}
+
+	return r.Method + " " + r.Host + r.Pattern
+}
+
+// conflicts indicates whether two routes would be handled by the same route
+// function.
+func (r *Route) conflicts(r2 *Route) bool {
+	if r.Host != r2.Host || !strings.EqualFold(r.Method, r2.Method) {
+		return false
+	}
+
+	return normalizeRoutePattern(r.Pattern) == normalizeRoutePattern(r2.Pattern)
+}
+
+func normalizeRoutePattern(pattern string) string {
+	return routeVariableRE.ReplaceAllStringFunc(pattern, func(s string) string {
+		if i := strings.IndexByte(s, ':'); i >= 0 {
+			return "{" + s[i:]
+		}
+
+		return "{}"
+	})
+}
+
+func (r *Route) SetSummary(summary string) *Route {
+	r.Summary = summary
+	return r
+}
+
+func (r *Route) SetDescription(description string) *Route {
+	r.Description = description
+	return r
+}
+
+func (r *Route) AddTags(tags ...string) *Route {
+	r.Tags = append(r.Tags, tags...)
+	return r
+}
+
+func (r *Route) SetDeprecated() *Route {
+	r.Deprecated = true
+	return r
+}
+
+func (r *Route) DescribeRouteVariable(name, description string) *Route {
+	for _, p := range r.Parameters {
+		if p.In == "path" && p.Name == name {
+			p.Description = description
+		}
+	}
+
+	return r
+}
+
+func (r *Route) AddQueryParameter(name, description string, value interface{}) *Route {
+	r.Parameters = append(r.Parameters, &RouteParameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Value:       value,
+	})
+
+	return r
+}
+
+func (r *Route) AddHeader(name, description string, required bool) *Route {
+	r.Parameters = append(r.Parameters, &RouteParameter{
+		Name:        name,
+		In:          "header",
+		Description: description,
+		Required:    required,
+		Value:       "",
+	})
+
+	return r
+}
+
+func (r *Route) SetAuditAction(action string) *Route {
+	r.AuditAction = action
+	return r
+}
+
+func (r *Route) SetErrorFormat(format ErrorFormat) *Route {
+	r.ErrorFormat = format
+	return r
+}
+
+func (r *Route) SetErrorHandler(handler ErrorHandler) *Route {
+	r.ErrorHandler = handler
+	return r
+}
+
+// SetRequestBody sets the type of the request body using a value of this
+// type, e.g. &CreateUserRequest{}.
+func (r *Route) SetRequestBody(value interface{}) *Route {
+	r.RequestBody = value
+	return r
+}
+
+// AddResponse documents a response; value is nil for responses without
+// body.
+func (r *Route) AddResponse(status int, description string, value interface{}) *Route {
+	r.Responses[status] = &RouteResponse{
+		Description: description,
+		Value:       value,
+	}
+
+	return r
+}
+
+func (r *Route) openAPIPath() string {
+	path := routeVariableRE.ReplaceAllString(r.Pattern, "{$1}")
+	return strings.TrimSuffix(path, "/*")
+}
+
+func routeVariables(pattern string) []string {
+	var names []string
+
+	for _, match := range routeVariableRE.FindAllStringSubmatch(pattern, -1) {
+		names = append(names, match[1])
+	}
+
+	return names
+}
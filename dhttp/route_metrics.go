@@ -0,0 +1,227 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+var DefaultRouteMetricsBuckets = []dtime.Duration{
+	dtime.Duration(time.Millisecond),
+	dtime.Duration(2500 * time.Microsecond),
+	dtime.Duration(5 * time.Millisecond),
+	dtime.Duration(10 * time.Millisecond),
+	dtime.Duration(25 * time.Millisecond),
+	dtime.Duration(50 * time.Millisecond),
+	dtime.Duration(100 * time.Millisecond),
+	dtime.Duration(250 * time.Millisecond),
+	dtime.Duration(500 * time.Millisecond),
+	dtime.Duration(time.Second),
+	dtime.Duration(2500 * time.Millisecond),
+	dtime.Duration(5 * time.Second),
+	dtime.Duration(10 * time.Second),
+}
+
+// RouteMetricsCfg contains the upper bounds of the buckets of the response
+// time histograms maintained for each route. Percentiles are estimated from
+// these histograms, so buckets should be dense around expected response
+// times.
+type RouteMetricsCfg struct {
+	Buckets []dtime.Duration `json:"buckets,omitempty"`
+}
+
+func (cfg *RouteMetricsCfg) Check(c *check.Checker) {
+	c.WithChild("buckets", func() {
+		for i, bucket := range cfg.Buckets {
+			c.CheckDurationMin(i, bucket.Duration(), 1)
+
+			if i > 0 {
+				c.Check(i, bucket > cfg.Buckets[i-1], "invalid_bucket",
+					"buckets must be sorted in ascending order")
+			}
+		}
+	})
+}
+
+// RouteMetrics contains the statistics of the requests handled by a route
+// during a period of time. Durations are expressed in microseconds.
+type RouteMetrics struct {
+	Route *Route
+
+	NbRequests     int64
+	NbServerErrors int64
+
+	TimeMin  int64
+	TimeMax  int64
+	TimeMean int64
+	TimeP50  int64
+	TimeP95  int64
+	TimeP99  int64
+
+	// The number of requests in each bucket; the last element is the number
+	// of requests whose response time exceeded the last bucket.
+	Buckets []int64
+}
+
+type routeHistogram struct {
+	route *Route
+
+	nbRequests     int64
+	nbServerErrors int64
+	sum            int64
+	min            int64
+	max            int64
+	counts         []int64
+}
+
+type routeMetrics struct {
+	buckets []int64 // microseconds
+
+	histograms map[*Route]*routeHistogram
+	lock       sync.Mutex
+}
+
+func (s *Server) initRouteMetrics() {
+	bucketDurations := DefaultRouteMetricsBuckets
+	if cfg := s.Cfg.RouteMetrics; cfg != nil && len(cfg.Buckets) > 0 {
+		bucketDurations = cfg.Buckets
+	}
+
+	buckets := make([]int64, len(bucketDurations))
+	for i, d := range bucketDurations {
+		buckets[i] = d.Duration().Microseconds()
+	}
+
+	s.routeMetrics = &routeMetrics{
+		buckets:    buckets,
+		histograms: make(map[*Route]*routeHistogram),
+	}
+}
+
+func (m *routeMetrics) record(route *Route, d time.Duration, status int) {
+	t := d.Microseconds()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	h, found := m.histograms[route]
+	if !found {
+		h = &routeHistogram{
+			route:  route,
+			min:    t,
+			counts: make([]int64, len(m.buckets)+1),
+		}
+
+		m.histograms[route] = h
+	}
+
+	h.nbRequests++
+	if status >= 500 {
+		h.nbServerErrors++
+	}
+
+	h.sum += t
+
+	if t < h.min {
+		h.min = t
+	}
+
+	if t > h.max {
+		h.max = t
+	}
+
+	i := sort.Search(len(m.buckets), func(i int) bool {
+		return t <= m.buckets[i]
+	})
+
+	h.counts[i]++
+}
+
+// FlushRouteMetrics returns the metrics of all routes which handled
+// requests since the last call and resets them.
+func (s *Server) FlushRouteMetrics() []RouteMetrics {
+	m := s.routeMetrics
+
+	m.lock.Lock()
+	histograms := m.histograms
+	m.histograms = make(map[*Route]*routeHistogram)
+	m.lock.Unlock()
+
+	metrics := make([]RouteMetrics, 0, len(histograms))
+
+	for _, h := range histograms {
+		metrics = append(metrics, RouteMetrics{
+			Route: h.route,
+
+			NbRequests:     h.nbRequests,
+			NbServerErrors: h.nbServerErrors,
+
+			TimeMin:  h.min,
+			TimeMax:  h.max,
+			TimeMean: h.sum / h.nbRequests,
+			TimeP50:  h.percentile(0.50, m.buckets),
+			TimeP95:  h.percentile(0.95, m.buckets),
+			TimeP99:  h.percentile(0.99, m.buckets),
+
+			Buckets: h.counts,
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Route.String() < metrics[j].Route.String()
+	})
+
+	return metrics
+}
+
+// percentile estimates a percentile by linear interpolation in the bucket
+// containing it.
+func (h *routeHistogram) percentile(p float64, buckets []int64) int64 {
+	rank := p * float64(h.nbRequests)
+
+	var n int64
+
+	for i, count := range h.counts {
+		if count == 0 {
+			continue
+		}
+
+		if float64(n+count) < rank {
+			n += count
+			continue
+		}
+
+		lower := h.min
+		if i > 0 && buckets[i-1] > lower {
+			lower = buckets[i-1]
+		}
+
+		upper := h.max
+		if i < len(buckets) && buckets[i] < upper {
+			upper = buckets[i]
+		}
+
+		ratio := (rank - float64(n)) / float64(count)
+
+		return lower + int64(ratio*float64(upper-lower))
+	}
+
+	return h.max
+}
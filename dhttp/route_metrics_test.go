@@ -0,0 +1,71 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteMetrics(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+		RouteMetrics: &RouteMetricsCfg{
+			Buckets: []dtime.Duration{
+				dtime.Duration(10 * time.Millisecond),
+				dtime.Duration(100 * time.Millisecond),
+			},
+		},
+	})
+	require.NoError(err)
+
+	route := newRoute("/foo", "GET")
+
+	for i := 1; i <= 100; i++ {
+		status := 200
+		if i == 100 {
+			status = 500
+		}
+
+		server.routeMetrics.record(route, time.Duration(i)*time.Millisecond,
+			status)
+	}
+
+	metrics := server.FlushRouteMetrics()
+	if assert.Equal(1, len(metrics)) {
+		m := metrics[0]
+
+		assert.Equal(route, m.Route)
+		assert.Equal(int64(100), m.NbRequests)
+		assert.Equal(int64(1), m.NbServerErrors)
+		assert.Equal(int64(1000), m.TimeMin)
+		assert.Equal(int64(100_000), m.TimeMax)
+		assert.Equal(int64(50_500), m.TimeMean)
+		assert.Equal([]int64{10, 90, 0}, m.Buckets)
+
+		assert.InDelta(50_000, m.TimeP50, 1000)
+		assert.InDelta(95_000, m.TimeP95, 1000)
+		assert.InDelta(99_000, m.TimeP99, 1000)
+	}
+
+	assert.Empty(server.FlushRouteMetrics())
+}
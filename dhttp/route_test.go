@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteConflicts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	reply := func(h *Handler) { h.ReplyEmpty(204) }
+
+	server.Route("/things/{id}", "GET", reply)
+	server.Route("/things/{id}", "DELETE", reply)
+	server.Route("/things/{id:[0-9]+}/parts", "GET", reply)
+
+	assert.PanicsWithValue(
+		"route get /things/{name} conflicts with route GET /things/{id}",
+		func() { server.Route("/things/{name}", "get", reply) })
+
+	assert.Panics(func() {
+		server.Group("/things", func(g *Group) {
+			g.Route("/{x:[0-9]+}/parts", "GET", reply)
+		})
+	})
+
+	routes := server.Routes()
+	if assert.Equal(3, len(routes)) {
+		assert.Equal("DELETE", routes[1].Method)
+		assert.Equal("/things/{id}", routes[1].Pattern)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	reply := func(h *Handler) { h.ReplyEmpty(204) }
+
+	server.Route("/things/{id}", "GET", reply)
+	server.Route("/things/{id}", "DELETE", reply)
+	server.Route("/things", "POST", reply)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("PUT", "/things/42", nil))
+
+	assert.Equal(405, w.Code)
+	assert.Equal("DELETE, GET", w.Header().Get("Allow"))
+
+	var apiErr APIError
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &apiErr))
+	assert.Equal("unhandled_method", apiErr.Code)
+	assert.Equal([]interface{}{"DELETE", "GET"},
+		apiErr.Data["allowed_methods"])
+}
+
+func TestAutomaticMethods(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan:        make(chan error, 1),
+		AutomaticHead:    true,
+		AutomaticOptions: true,
+	})
+	require.NoError(err)
+
+	var method string
+
+	server.Route("/things", "GET", func(h *Handler) {
+		method = h.Method
+		h.ResponseWriter.Header().Set("X-Foo", "bar")
+		h.ReplyJSON(200, []string{"a", "b"})
+	})
+	server.Route("/things", "POST", func(h *Handler) {
+		h.ReplyEmpty(201)
+	})
+
+	call := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := call("HEAD", "/things")
+	assert.Equal(200, w.Code)
+	assert.Equal("GET", method)
+	assert.Equal("bar", w.Header().Get("X-Foo"))
+	assert.Equal(0, w.Body.Len())
+
+	w = call("OPTIONS", "/things")
+	assert.Equal(204, w.Code)
+	assert.Equal("GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+
+	w = call("DELETE", "/things")
+	assert.Equal(405, w.Code)
+	assert.Equal("GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+
+	assert.Equal(404, call("OPTIONS", "/unknown").Code)
+}
@@ -16,16 +16,19 @@ package dhttp
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/exograd/go-daemon/check"
 	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
 	"github.com/exograd/go-daemon/ksuid"
 	"github.com/go-chi/chi/v5"
 )
@@ -40,23 +43,125 @@ type RouteFunc func(*Handler)
 
 type ErrorHandler func(*Handler, int, string, string, APIErrorData)
 
+type ErrorReporter interface {
+	ReportError(string, dlog.Data)
+}
+
 type ServerCfg struct {
 	Log       *dlog.Logger `json:"-"`
 	ErrorChan chan<- error `json:"-"`
 
-	ErrorHandler ErrorHandler `json:"-"`
+	ErrorHandler  ErrorHandler  `json:"-"`
+	ErrorReporter ErrorReporter `json:"-"`
 
 	Address string `json:"address"`
 
 	TLS *TLSServerCfg `json:"tls,omitempty"`
 
+	// The format of error responses, either api_error (the default) or
+	// problem_details (RFC 7807). Routes can override it with
+	// Route.SetErrorFormat.
+	ErrorFormat ErrorFormat `json:"error_format,omitempty"`
+
+	// If set, the type of problem details responses is the base URI followed
+	// by the error code; "about:blank" is used otherwise.
+	ProblemTypeBaseURI string `json:"problem_type_base_uri,omitempty"`
+
+	JSONEncoding *JSONEncodingCfg `json:"json_encoding,omitempty"`
+	JSONDecoding *JSONDecodingCfg `json:"json_decoding,omitempty"`
+
+	RouteMetrics *RouteMetricsCfg `json:"route_metrics,omitempty"`
+
+	ProxyProtocol *ProxyProtocolCfg `json:"proxy_protocol,omitempty"`
+
+	// Virtual hosts are only required for hosts using their own TLS
+	// certificate; routes are associated with hosts with Server.Host.
+	VirtualHosts []*VirtualHostCfg `json:"virtual_hosts,omitempty"`
+
+	// The handling of request paths which do not match any route because of
+	// duplicate slashes, dot segments or trailing slashes; strict by default.
+	PathNormalization PathNormalization `json:"path_normalization,omitempty"`
+
+	// If AutomaticHead is set, HEAD requests are handled by the GET route
+	// matching the path if there is no HEAD route. If AutomaticOptions is
+	// set, OPTIONS requests are answered with the list of allowed methods if
+	// there is no OPTIONS route.
+	AutomaticHead    bool `json:"automatic_head"`
+	AutomaticOptions bool `json:"automatic_options"`
+
 	HideInternalErrors     bool `json:"hide_internal_errors"`
 	HideSuccessfulRequests bool `json:"hide_successful_requests"`
+
+	AccessLog *AccessLogCfg `json:"access_log,omitempty"`
+
+	Validation *ValidationCfg `json:"validation,omitempty"`
+
+	// The request header used to assign requests to percentage flag buckets;
+	// the client address is used if the header is not set or not present.
+	FlagBucketHeader string `json:"flag_bucket_header,omitempty"`
+
+	Maintenance *MaintenanceCfg `json:"maintenance,omitempty"`
+
+	// Headers added to all responses
+	DefaultHeaders map[string]string `json:"default_headers,omitempty"`
+
+	// IP addresses or CIDR networks. Forwarding headers (X-Forwarded-For and
+	// X-Real-IP) are ignored for requests not sent by a trusted proxy.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+
+	// IP addresses or CIDR networks. If the allow list is not empty, only
+	// clients whose address is in the list are accepted. The deny list always
+	// takes precedence.
+	AllowedAddresses []string `json:"allowed_addresses,omitempty"`
+	DeniedAddresses  []string `json:"denied_addresses,omitempty"`
+
+	// When the maximum number of concurrent requests is reached, new requests
+	// wait up to ConcurrencyQueueTimeout for a slot, with at most
+	// MaxQueuedRequests waiting requests (no limit if zero). Requests which
+	// cannot be processed are rejected with a 503 status code.
+	MaxConcurrentRequests   int            `json:"max_concurrent_requests,omitempty"`
+	MaxQueuedRequests       int            `json:"max_queued_requests,omitempty"`
+	ConcurrencyQueueTimeout dtime.Duration `json:"concurrency_queue_timeout,omitempty"`
+
+	Idempotency *IdempotencyCfg `json:"idempotency,omitempty"`
+
+	// The codecs used by ReplyNegotiated and RequestObject; DefaultCodecs if
+	// empty.
+	Codecs []Codec `json:"-"`
+
+	// Authenticators are called in order until one of them returns a
+	// principal. Routes requiring authentication are configured with
+	// Route.RequireAuth.
+	Authenticators []Authenticator `json:"-"`
+
+	// Observers are called once a route function has returned.
+	Observers []RequestObserver `json:"-"`
+}
+
+type RequestObserver interface {
+	ObserveRequest(*Handler)
 }
 
 type TLSServerCfg struct {
 	Certificate string `json:"certificate"`
 	PrivateKey  string `json:"private_key"`
+
+	// If client certificate authorities are set, client certificates are
+	// verified when they are provided. They are mandatory if
+	// RequireClientCertificate is set.
+	ClientCertificateAuthorities []string `json:"client_certificate_authorities,omitempty"`
+	RequireClientCertificate     bool     `json:"require_client_certificate,omitempty"`
+
+	// TLS versions are "1.0", "1.1", "1.2" or "1.3". The minimum version is
+	// 1.2 by default.
+	MinVersion TLSVersion `json:"min_version,omitempty"`
+	MaxVersion TLSVersion `json:"max_version,omitempty"`
+
+	// Cipher suites are identified by their standard names, e.g.
+	// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. They only apply to TLS 1.2
+	// and older; TLS 1.3 cipher suites are not configurable. The default
+	// list only contains suites with forward secrecy and AEAD encryption.
+	CipherSuites []string `json:"cipher_suites,omitempty"`
 }
 
 type Server struct {
@@ -66,6 +171,40 @@ type Server struct {
 	server *http.Server
 	Router *chi.Mux
 
+	accessLog              *dlog.Logger
+	accessLogWriter        io.Writer
+	accessLogExcludedPaths map[string]struct{}
+
+	routes      []*Route
+	hostRouters map[string]*chi.Mux
+	routesLock  sync.Mutex
+
+	listener net.Listener
+
+	trustedProxies   addressList
+	allowedAddresses addressList
+	deniedAddresses  addressList
+
+	requestSlots       chan struct{}
+	nbQueuedRequests   int32
+	nbRejectedRequests int64
+
+	routeMetrics *routeMetrics
+
+	nbPanics       int64
+	nbServerErrors int64
+	nbClientAborts int64
+
+	proxyStats proxyStats
+
+	connections *connectionTracker
+
+	maintenance              int32
+	maintenanceExcludedPaths map[string]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	stopChan  chan struct{}
 	errorChan chan<- error
 	wg        sync.WaitGroup
@@ -74,11 +213,68 @@ type Server struct {
 func (cfg *ServerCfg) Check(c *check.Checker) {
 	c.CheckStringNotEmpty("address", cfg.Address)
 	c.CheckOptionalObject("tls", cfg.TLS)
+	c.CheckOptionalObject("access_log", cfg.AccessLog)
+	c.CheckOptionalObject("validation", cfg.Validation)
+	c.CheckOptionalObject("maintenance", cfg.Maintenance)
+	c.CheckOptionalObject("json_decoding", cfg.JSONDecoding)
+	c.CheckObjectArray("virtual_hosts", cfg.VirtualHosts)
+	c.CheckOptionalObject("route_metrics", cfg.RouteMetrics)
+	c.CheckOptionalObject("proxy_protocol", cfg.ProxyProtocol)
+
+	if cfg.PathNormalization != "" {
+		c.CheckStringValue("path_normalization", cfg.PathNormalization,
+			PathNormalizationValues)
+	}
+
+	if cfg.ErrorFormat != "" {
+		c.CheckStringValue("error_format", cfg.ErrorFormat, ErrorFormatValues)
+	}
+
+	if cfg.ProblemTypeBaseURI != "" {
+		c.CheckStringURI("problem_type_base_uri", cfg.ProblemTypeBaseURI)
+	}
+
+	checkAddressList(c, "trusted_proxies", cfg.TrustedProxies)
+	checkAddressList(c, "allowed_addresses", cfg.AllowedAddresses)
+	checkAddressList(c, "denied_addresses", cfg.DeniedAddresses)
+
+	c.CheckIntMin("max_concurrent_requests", cfg.MaxConcurrentRequests, 0)
+	c.CheckIntMin("max_queued_requests", cfg.MaxQueuedRequests, 0)
+	c.CheckDurationMin("concurrency_queue_timeout",
+		cfg.ConcurrencyQueueTimeout.Duration(), 0)
+
+	c.CheckOptionalObject("idempotency", cfg.Idempotency)
 }
 
 func (cfg *TLSServerCfg) Check(c *check.Checker) {
 	c.CheckStringNotEmpty("certificate", cfg.Certificate)
 	c.CheckStringNotEmpty("private_key", cfg.PrivateKey)
+
+	if cfg.MinVersion != "" {
+		c.CheckStringValue("min_version", cfg.MinVersion, TLSVersionValues)
+	}
+
+	if cfg.MaxVersion != "" {
+		c.CheckStringValue("max_version", cfg.MaxVersion, TLSVersionValues)
+	}
+
+	if cfg.MinVersion != "" && cfg.MaxVersion != "" {
+		c.Check("max_version", cfg.MaxVersion.id() >= cfg.MinVersion.id(),
+			"invalid_value", "maximum version must be greater or equal "+
+				"to minimum version")
+	}
+
+	c.WithChild("cipher_suites", func() {
+		for i, name := range cfg.CipherSuites {
+			c.Check(i, cipherSuiteId(name) != 0, "unknown_cipher_suite",
+				"unknown cipher suite %q", name)
+		}
+	})
+
+	c.Check("require_client_certificate", !cfg.RequireClientCertificate ||
+		len(cfg.ClientCertificateAuthorities) > 0, "missing_value",
+		"client certificates cannot be required without client "+
+			"certificate authorities")
 }
 
 func NewServer(cfg ServerCfg) (*Server, error) {
@@ -100,23 +296,53 @@ func NewServer(cfg ServerCfg) (*Server, error) {
 
 		stopChan:  make(chan struct{}),
 		errorChan: cfg.ErrorChan,
+
+		connections: newConnectionTracker(),
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if err := s.initAccessLog(); err != nil {
+		return nil, err
+	}
+
+	if err := s.initAddressFilters(); err != nil {
+		return nil, err
+	}
+
+	if err := s.initIdempotency(); err != nil {
+		return nil, err
 	}
 
-	s.Router = chi.NewMux()
-	s.Router.NotFound(s.handleNotFound)
-	s.Router.MethodNotAllowed(s.handleMethodNotAllowed)
+	s.initMaintenance()
+	s.initRouteMetrics()
+	s.initConcurrencyLimit()
+
+	s.Router = s.newRouter()
 
 	s.server = &http.Server{
 		Addr:     cfg.Address,
 		Handler:  s,
 		ErrorLog: s.Log.StdLogger(dlog.LevelError),
+
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+
+		ConnState: s.connections.update,
 	}
 
 	if cfg.TLS != nil {
-		s.server.TLSConfig = &tls.Config{
-			MinVersion:               tls.VersionTLS13,
-			PreferServerCipherSuites: true,
+		tlsCfg, err := cfg.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
 		}
+
+		s.server.TLSConfig = tlsCfg
+	}
+
+	if err := s.initVirtualHosts(); err != nil {
+		return nil, err
 	}
 
 	return s, nil
@@ -128,7 +354,19 @@ func (s *Server) Start() error {
 		return fmt.Errorf("cannot listen on %q: %w", s.Cfg.Address, err)
 	}
 
-	s.Log.Info("listening on %q", s.Cfg.Address)
+	s.Log.Info("listening on %q", listener.Addr().String())
+
+	if cfg := s.Cfg.ProxyProtocol; cfg != nil {
+		pl, err := newProxyProtocolListener(listener, cfg)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		listener = pl
+	}
+
+	s.listener = listener
 
 	go func() {
 		var err error
@@ -157,12 +395,23 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// Address returns the address the server is listening on, which is only
+// known once the server has been started when the configured port is 0.
+func (s *Server) Address() string {
+	if s.listener == nil {
+		return s.Cfg.Address
+	}
+
+	return s.listener.Addr().String()
+}
+
 func (s *Server) Stop() {
 	close(s.stopChan)
 	s.wg.Wait()
 }
 
 func (s *Server) Terminate() {
+	s.closeAccessLog()
 }
 
 func (s *Server) main() {
@@ -183,6 +432,9 @@ func (s *Server) shutdown() {
 	if err := s.server.Shutdown(ctx); err != nil {
 		s.Log.Error("cannot shutdown server: %v", err)
 	}
+
+	// Cancel the context of requests which are still running
+	s.cancel()
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -193,13 +445,15 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		StartTime: time.Now(),
 	}
 
-	ctx := req.Context()
-	ctx = context.WithValue(ctx, contextKeyHandler, h)
+	if s.Cfg.JSONEncoding != nil {
+		h.JSONEncoding = *s.Cfg.JSONEncoding
+	}
 
-	h.Request = req.WithContext(ctx)
-	h.ResponseWriter = NewResponseWriter(w)
+	if s.Cfg.JSONDecoding != nil {
+		h.JSONDecoding = *s.Cfg.JSONDecoding
+	}
 
-	h.ClientAddress = requestClientAddress(req)
+	h.ClientAddress = s.requestClientAddress(req)
 	h.Log.Data["address"] = h.ClientAddress
 
 	h.RequestId = requestId(req)
@@ -208,21 +462,84 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	h.Log.Data["request_id"] = h.RequestId
 
+	if req.TLS != nil {
+		addTLSLogData(h.Log.Data, req.TLS)
+	}
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, contextKeyHandler, h)
+	ctx = ContextWithRequestId(ctx, h.RequestId)
+	ctx = ContextWithLogger(ctx, h.Log)
+
+	h.Request = req.WithContext(ctx)
+	h.ResponseWriter = NewResponseWriter(w)
+
+	for name, value := range s.Cfg.DefaultHeaders {
+		w.Header().Set(name, value)
+	}
+
 	h.Query = req.URL.Query()
 
 	defer h.logRequest()
 
 	defer func() {
 		if value := recover(); value != nil {
+			if value == http.ErrAbortHandler {
+				// Let the http server abort the connection
+				panic(value)
+			}
+
 			msg := h.handlePanic(value)
 			h.ReplyInternalError(500, "panic: %s", msg)
 		}
 	}()
 
-	s.Router.ServeHTTP(h.ResponseWriter, h.Request)
+	if s.handleAddressFilters(h) {
+		return
+	}
+
+	if s.handleMaintenance(h) {
+		return
+	}
+
+	if s.handlePathNormalization(h) {
+		return
+	}
+
+	if !s.acquireRequestSlot(h) {
+		return
+	}
+	defer s.releaseRequestSlot()
+
+	if s.handleAutomaticMethods(h) {
+		return
+	}
+
+	s.requestRouter(h.Request).ServeHTTP(h.ResponseWriter, h.Request)
+}
+
+// Route registers a route function. It panics if a route with the same
+// method and an equivalent pattern, i.e. only differing by the names of its
+// variables, has already been registered.
+func (s *Server) Route(pattern, method string, routeFunc RouteFunc) *Route {
+	return s.route("", pattern, method, routeFunc)
 }
 
-func (s *Server) Route(pattern, method string, routeFunc RouteFunc) {
+func (s *Server) route(host, pattern, method string, routeFunc RouteFunc) *Route {
+	route := newRoute(pattern, method)
+	route.Host = host
+
+	s.routesLock.Lock()
+	for _, r := range s.routes {
+		if r.conflicts(route) {
+			s.routesLock.Unlock()
+			panic(fmt.Sprintf("route %s conflicts with route %s",
+				route, r))
+		}
+	}
+	s.routes = append(s.routes, route)
+	s.routesLock.Unlock()
+
 	handlerFunc := func(w http.ResponseWriter, req *http.Request) {
 		h := requestHandler(req)
 		h.Request = req // the request object was modified by chi
@@ -233,20 +550,56 @@ func (s *Server) Route(pattern, method string, routeFunc RouteFunc) {
 		h.Pattern = pattern
 		h.Method = method
 		h.RouteId = routeId
+		h.Route = route
+
+		if !s.authenticate(h, route) {
+			return
+		}
 
-		routeFunc(h)
+		if key := s.idempotencyKey(h); key != "" {
+			s.callRouteIdempotent(h, route, routeFunc, key)
+		} else {
+			s.callRoute(h, route, routeFunc)
+		}
+
+		for _, observer := range s.Cfg.Observers {
+			observer.ObserveRequest(h)
+		}
 	}
 
-	s.Router.MethodFunc(method, pattern, handlerFunc)
+	s.hostRouter(host).MethodFunc(method, pattern, handlerFunc)
+
+	return route
+}
+
+// Routes returns all registered routes in registration order.
+func (s *Server) Routes() []*Route {
+	s.routesLock.Lock()
+	defer s.routesLock.Unlock()
+
+	routes := make([]*Route, len(s.routes))
+	copy(routes, s.routes)
+
+	return routes
 }
 
 func (s *Server) handleError(h *Handler, status int, code, msg string, data APIErrorData) {
-	if s.Cfg.ErrorHandler == nil {
-		h.ReplyJSON(status, APIError{Message: msg, Code: code, Data: data})
+	if h.Route != nil && h.Route.ErrorHandler != nil {
+		h.Route.ErrorHandler(h, status, code, msg, data)
 		return
 	}
 
-	s.Cfg.ErrorHandler(h, status, code, msg, data)
+	if s.Cfg.ErrorHandler != nil {
+		s.Cfg.ErrorHandler(h, status, code, msg, data)
+		return
+	}
+
+	switch s.errorFormat(h) {
+	case ErrorFormatProblemDetails:
+		h.ReplyProblemDetails(s.problemDetails(h, status, code, msg, data))
+	default:
+		h.ReplyJSON(status, APIError{Message: msg, Code: code, Data: data})
+	}
 }
 
 func (s *Server) handleNotFound(w http.ResponseWriter, req *http.Request) {
@@ -258,27 +611,48 @@ func (s *Server) handleNotFound(w http.ResponseWriter, req *http.Request) {
 func (s *Server) handleMethodNotAllowed(w http.ResponseWriter, req *http.Request) {
 	h := requestHandler(req)
 
-	h.ReplyError(405, "unhandled_method", "unhandled method")
+	methods := s.allowedMethods(req)
+
+	h.ResponseWriter.Header().Set("Allow", strings.Join(methods, ", "))
+
+	data := APIErrorData{"allowed_methods": methods}
+	h.ReplyErrorData(405, "unhandled_method", data, "unhandled method")
 }
 
-func requestClientAddress(req *http.Request) string {
-	if v := req.Header.Get("X-Real-IP"); v != "" {
-		return v
-	} else if v := req.Header.Get("X-Forwarded-For"); v != "" {
-		i := strings.Index(v, ", ")
-		if i == -1 {
-			return v
+// allowedMethods returns the methods of the routes matching the path of a
+// request.
+func (s *Server) allowedMethods(req *http.Request) []string {
+	path := requestRoutingPath(req)
+	router := s.requestRouter(req)
+
+	methods := []string{}
+
+	for _, route := range s.Routes() {
+		method := strings.ToUpper(route.Method)
+
+		if containsString(methods, method) {
+			continue
 		}
 
-		return v[:i]
-	} else {
-		host, _, err := net.SplitHostPort(req.RemoteAddr)
-		if err != nil {
-			return ""
+		if router.Match(chi.NewRouteContext(), method, path) {
+			methods = append(methods, method)
+		}
+	}
+
+	if len(methods) > 0 {
+		if s.Cfg.AutomaticHead && !containsString(methods, "HEAD") &&
+			containsString(methods, "GET") {
+			methods = append(methods, "HEAD")
 		}
 
-		return host
+		if s.Cfg.AutomaticOptions && !containsString(methods, "OPTIONS") {
+			methods = append(methods, "OPTIONS")
+		}
 	}
+
+	sort.Strings(methods)
+
+	return methods
 }
 
 func requestId(req *http.Request) string {
@@ -286,10 +660,24 @@ func requestId(req *http.Request) string {
 }
 
 func requestHandler(req *http.Request) *Handler {
-	value := req.Context().Value(contextKeyHandler)
-	if value == nil {
-		return nil
-	}
+	return HandlerFromContext(req.Context())
+}
+
+// NbPanics returns the number of panics recovered in route functions since
+// the server was created.
+func (s *Server) NbPanics() int64 {
+	return atomic.LoadInt64(&s.nbPanics)
+}
+
+// NbServerErrors returns the number of requests which failed with a 5xx
+// status since the server was created. Requests aborted by the client are
+// not included.
+func (s *Server) NbServerErrors() int64 {
+	return atomic.LoadInt64(&s.nbServerErrors)
+}
 
-	return value.(*Handler)
+// NbClientAborts returns the number of requests aborted by the client since
+// the server was created.
+func (s *Server) NbClientAborts() int64 {
+	return atomic.LoadInt64(&s.nbClientAborts)
 }
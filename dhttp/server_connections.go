@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+type ConnectionCounts struct {
+	Open   int `json:"open"`
+	Active int `json:"active"`
+	Idle   int `json:"idle"`
+}
+
+type connectionTracker struct {
+	states map[net.Conn]http.ConnState
+	mutex  sync.Mutex
+}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{
+		states: make(map[net.Conn]http.ConnState),
+	}
+}
+
+func (t *connectionTracker) update(conn net.Conn, state http.ConnState) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(t.states, conn)
+	default:
+		t.states[conn] = state
+	}
+}
+
+func (t *connectionTracker) counts() ConnectionCounts {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts := ConnectionCounts{
+		Open: len(t.states),
+	}
+
+	for _, state := range t.states {
+		switch state {
+		case http.StateActive:
+			counts.Active++
+		case http.StateIdle:
+			counts.Idle++
+		}
+	}
+
+	return counts
+}
+
+// ConnectionCounts returns the number of connections currently open on the
+// server. Hijacked connections, e.g. websockets, are not included.
+func (s *Server) ConnectionCounts() ConnectionCounts {
+	return s.connections.counts()
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerConnectionCounts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	var counts ConnectionCounts
+
+	server.Route("/", "GET", func(h *Handler) {
+		counts = server.ConnectionCounts()
+		h.ReplyEmpty(204)
+	})
+
+	ts := httptest.NewUnstartedServer(server)
+	ts.Config.ConnState = server.connections.update
+	ts.Start()
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL)
+	require.NoError(err)
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	assert.Equal(http.StatusNoContent, res.StatusCode)
+	assert.Equal(ConnectionCounts{Open: 1, Active: 1}, counts)
+
+	ts.Client().CloseIdleConnections()
+	ts.Close()
+
+	assert.Equal(ConnectionCounts{}, server.ConnectionCounts())
+}
@@ -0,0 +1,383 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exograd/go-daemon/dcrypto"
+)
+
+type RequestSigner interface {
+	SignRequest(*http.Request) error
+}
+
+type signingTransport struct {
+	signer RequestSigner
+
+	http.RoundTripper
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	if err := t.signer.SignRequest(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, fmt.Errorf("cannot sign request: %w", err)
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+type HMACSigner struct {
+	Key []byte
+
+	// The header containing the hex-encoded signature, X-Signature by
+	// default.
+	Header string
+
+	// The header containing the UNIX timestamp used in the signature,
+	// X-Signature-Timestamp by default.
+	TimestampHeader string
+}
+
+func (s *HMACSigner) SignRequest(req *http.Request) error {
+	header := s.Header
+	if header == "" {
+		header = "X-Signature"
+	}
+
+	timestampHeader := s.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Signature-Timestamp"
+	}
+
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	data := hmacSignatureData(req.Method, req.URL.RequestURI(), timestamp,
+		body)
+
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(header, dcrypto.SignHMAC256Hex(data, s.Key))
+
+	return nil
+}
+
+func hmacSignatureData(method, requestURI, timestamp string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+
+	var buf bytes.Buffer
+	buf.WriteString(method)
+	buf.WriteByte('\n')
+	buf.WriteString(requestURI)
+	buf.WriteByte('\n')
+	buf.WriteString(timestamp)
+	buf.WriteByte('\n')
+	buf.WriteString(hex.EncodeToString(bodyHash[:]))
+
+	return buf.Bytes()
+}
+
+type AWSSigV4Signer struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+
+	Region  string
+	Service string
+
+	// If true, the request body is not included in the signature, which
+	// avoids reading it in memory. Only supported by S3.
+	UnsignedPayload bool
+
+	// Used to obtain the signature time; time.Now is used if nil.
+	Now func() time.Time
+}
+
+func (s *AWSSigV4Signer) now() time.Time {
+	if s.Now != nil {
+		return s.Now().UTC()
+	}
+
+	return time.Now().UTC()
+}
+
+func (s *AWSSigV4Signer) SignRequest(req *http.Request) error {
+	t := s.now()
+	amzDate := t.Format("20060102T150405Z")
+
+	payloadHash := "UNSIGNED-PAYLOAD"
+
+	if !s.UnsignedPayload {
+		body, err := requestBody(req)
+		if err != nil {
+			return err
+		}
+
+		bodyHash := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(bodyHash[:])
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	if s.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lname := strings.ToLower(name)
+		if lname == "content-type" || strings.HasPrefix(lname, "x-amz-") {
+			trimmedValues := make([]string, len(values))
+			for i, value := range values {
+				trimmedValues[i] = strings.Join(strings.Fields(value), " ")
+			}
+
+			headers[lname] = strings.Join(trimmedValues, ",")
+		}
+	}
+
+	canonicalReq, signedHeaders := awsCanonicalRequest(req.Method, req.URL,
+		headers, payloadHash)
+
+	scope, signature := s.sign(t, canonicalReq)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyId, scope, signedHeaders, signature))
+
+	return nil
+}
+
+// PresignURL returns a copy of a URL containing a signature in its query
+// string, so that it can be used without credentials until it expires.
+func (s *AWSSigV4Signer) PresignURL(method string, uri *url.URL, expiration time.Duration) *url.URL {
+	t := s.now()
+	amzDate := t.Format("20060102T150405Z")
+
+	u := *uri
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKeyId+"/"+s.scope(t))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiration.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	if s.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	u.RawQuery = query.Encode()
+
+	headers := map[string]string{"host": u.Host}
+
+	canonicalReq, _ := awsCanonicalRequest(method, &u, headers,
+		"UNSIGNED-PAYLOAD")
+
+	_, signature := s.sign(t, canonicalReq)
+
+	u.RawQuery = awsCanonicalQuery(&u) + "&X-Amz-Signature=" + signature
+
+	return &u
+}
+
+func (s *AWSSigV4Signer) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.Region + "/" + s.Service +
+		"/aws4_request"
+}
+
+func (s *AWSSigV4Signer) sign(t time.Time, canonicalReq []byte) (string, string) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	scope := s.scope(t)
+
+	canonicalReqHash := sha256.Sum256(canonicalReq)
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(canonicalReqHash[:])
+
+	key := dcrypto.SignHMAC256([]byte(date), []byte("AWS4"+s.SecretAccessKey))
+	key = dcrypto.SignHMAC256([]byte(s.Region), key)
+	key = dcrypto.SignHMAC256([]byte(s.Service), key)
+	key = dcrypto.SignHMAC256([]byte("aws4_request"), key)
+
+	signature := dcrypto.SignHMAC256Hex([]byte(stringToSign), key)
+
+	return scope, signature
+}
+
+func awsCanonicalRequest(method string, uri *url.URL, headers map[string]string, payloadHash string) ([]byte, string) {
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	signedHeaders := strings.Join(headerNames, ";")
+
+	var canonicalReq bytes.Buffer
+	canonicalReq.WriteString(method)
+	canonicalReq.WriteByte('\n')
+	canonicalReq.WriteString(awsCanonicalURI(uri))
+	canonicalReq.WriteByte('\n')
+	canonicalReq.WriteString(awsCanonicalQuery(uri))
+	canonicalReq.WriteByte('\n')
+	for _, name := range headerNames {
+		canonicalReq.WriteString(name)
+		canonicalReq.WriteByte(':')
+		canonicalReq.WriteString(headers[name])
+		canonicalReq.WriteByte('\n')
+	}
+	canonicalReq.WriteByte('\n')
+	canonicalReq.WriteString(signedHeaders)
+	canonicalReq.WriteByte('\n')
+	canonicalReq.WriteString(payloadHash)
+
+	return canonicalReq.Bytes(), signedHeaders
+}
+
+func awsCanonicalURI(uri *url.URL) string {
+	// Note that we do not double-encode path segments as required for
+	// services other than S3. Paths used with these services rarely contain
+	// characters which would have to be encoded.
+
+	p := uri.Path
+	if p == "" {
+		return "/"
+	}
+
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = awsURIEncode(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func awsCanonicalQuery(uri *url.URL) string {
+	// Parameters must be sorted after being encoded: encoding changes the
+	// order of some characters, e.g. "/" is encoded as "%2F" and is then
+	// sorted before "-".
+
+	var parts []string
+	for key, values := range uri.Query() {
+		encodedKey := awsURIEncode(key)
+
+		for _, value := range values {
+			parts = append(parts, encodedKey+"="+awsURIEncode(value))
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		ki, vi := splitAWSQueryPart(parts[i])
+		kj, vj := splitAWSQueryPart(parts[j])
+
+		if ki != kj {
+			return ki < kj
+		}
+
+		return vi < vj
+	})
+
+	return strings.Join(parts, "&")
+}
+
+func splitAWSQueryPart(part string) (string, string) {
+	// Encoded keys cannot contain "="
+	i := strings.IndexByte(part, '=')
+	return part[:i], part[i+1:]
+}
+
+func awsURIEncode(s string) string {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') ||
+			(c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+
+	return buf.String()
+}
+
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain request body: %w", err)
+		}
+		defer body.Close()
+
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read request body: %w", err)
+		}
+
+		return data, nil
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read request body: %w", err)
+	}
+	req.Body.Close()
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return data, nil
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/go-chi/chi/v5"
+)
+
+// TestHandler wraps a handler which is not associated with a running server
+// and records its response, so that route functions can be called directly
+// in unit tests.
+type TestHandler struct {
+	*Handler
+
+	Recorder *httptest.ResponseRecorder
+
+	routeContext *chi.Context
+}
+
+func NewTestHandler(method, path string, body io.Reader) *TestHandler {
+	req := httptest.NewRequest(method, path, body)
+	recorder := httptest.NewRecorder()
+
+	log := dlog.DefaultLogger("test")
+
+	server := &Server{
+		Log: log,
+	}
+
+	routeContext := chi.NewRouteContext()
+
+	hLog := log.Child("", nil)
+
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeContext)
+	ctx = ContextWithLogger(ctx, hLog)
+
+	h := &Handler{
+		Server: server,
+		Log:    hLog,
+
+		ClientAddress: server.requestClientAddress(req),
+
+		Pattern: path,
+		Method:  method,
+		RouteId: path + " " + method,
+		Query:   req.URL.Query(),
+
+		Request:        req.WithContext(ctx),
+		ResponseWriter: NewResponseWriter(recorder),
+
+		StartTime: time.Now(),
+	}
+
+	if server.Cfg.JSONEncoding != nil {
+		h.JSONEncoding = *server.Cfg.JSONEncoding
+	}
+
+	if server.Cfg.JSONDecoding != nil {
+		h.JSONDecoding = *server.Cfg.JSONDecoding
+	}
+
+	h.Request = h.Request.WithContext(
+		context.WithValue(h.Request.Context(), contextKeyHandler, h))
+
+	return &TestHandler{
+		Handler:  h,
+		Recorder: recorder,
+
+		routeContext: routeContext,
+	}
+}
+
+func (th *TestHandler) SetRouteVariable(name, value string) {
+	th.routeContext.URLParams.Add(name, value)
+}
+
+func (th *TestHandler) Status() int {
+	return th.Recorder.Code
+}
+
+func (th *TestHandler) Body() []byte {
+	return th.Recorder.Body.Bytes()
+}
+
+func (th *TestHandler) DecodeJSON(dest interface{}) error {
+	if err := json.Unmarshal(th.Body(), dest); err != nil {
+		return fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	return nil
+}
+
+func (th *TestHandler) APIError() (*APIError, error) {
+	var apiErr APIError
+	if err := th.DecodeJSON(&apiErr); err != nil {
+		return nil, err
+	}
+
+	return &apiErr, nil
+}
+
+func (th *TestHandler) ValidationErrors() (check.ValidationErrors, error) {
+	var body struct {
+		Data struct {
+			ValidationErrors check.ValidationErrors `json:"validation_errors"`
+		} `json:"data"`
+	}
+
+	if err := th.DecodeJSON(&body); err != nil {
+		return nil, err
+	}
+
+	return body.Data.ValidationErrors, nil
+}
+
+func (th *TestHandler) AssertStatus(t testing.TB, status int) bool {
+	t.Helper()
+
+	if th.Status() != status {
+		t.Errorf("response status is %d instead of %d: %s",
+			th.Status(), status, th.Body())
+		return false
+	}
+
+	return true
+}
+
+func (th *TestHandler) AssertJSON(t testing.TB, status int, dest interface{}) bool {
+	t.Helper()
+
+	if !th.AssertStatus(t, status) {
+		return false
+	}
+
+	if err := th.DecodeJSON(dest); err != nil {
+		t.Error(err)
+		return false
+	}
+
+	return true
+}
+
+func (th *TestHandler) AssertAPIError(t testing.TB, status int, code string) *APIError {
+	t.Helper()
+
+	if !th.AssertStatus(t, status) {
+		return nil
+	}
+
+	apiErr, err := th.APIError()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	if apiErr.Code != code {
+		t.Errorf("error code is %q instead of %q", apiErr.Code, code)
+		return nil
+	}
+
+	return apiErr
+}
+
+func (th *TestHandler) AssertValidationError(t testing.TB, pointer, code string) bool {
+	t.Helper()
+
+	if th.AssertAPIError(t, 400, "invalid_request_body") == nil {
+		return false
+	}
+
+	verrs, err := th.ValidationErrors()
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+
+	var p djson.Pointer
+	if err := p.Parse(pointer); err != nil {
+		t.Errorf("invalid json pointer %q: %v", pointer, err)
+		return false
+	}
+
+	for _, verr := range verrs {
+		if verr.Pointer.String() == p.String() && verr.Code == code {
+			return true
+		}
+	}
+
+	t.Errorf("missing validation error %q at %q in %v", code, pointer, verrs)
+	return false
+}
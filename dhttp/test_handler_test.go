@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHandlerBody struct {
+	Name string `json:"name"`
+}
+
+func (b *testHandlerBody) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("name", b.Name)
+}
+
+func TestTestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	th := NewTestHandler("GET", "/users/42", nil)
+	th.SetRouteVariable("id", "42")
+
+	func(h *Handler) {
+		h.ReplyJSON(200, map[string]string{"id": h.RouteVariable("id")})
+	}(th.Handler)
+
+	var body map[string]string
+	if th.AssertJSON(t, 200, &body) {
+		assert.Equal("42", body["id"])
+	}
+
+	th = NewTestHandler("POST", "/users", strings.NewReader(`{"name": ""}`))
+
+	func(h *Handler) {
+		var body testHandlerBody
+		h.JSONRequestObject(&body)
+	}(th.Handler)
+
+	th.AssertValidationError(t, "/name", "empty_string")
+}
@@ -15,11 +15,118 @@
 package dhttp
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"os"
+
+	"github.com/exograd/go-daemon/dlog"
+)
+
+type TLSVersion string
+
+const (
+	TLSVersion10 TLSVersion = "1.0"
+	TLSVersion11 TLSVersion = "1.1"
+	TLSVersion12 TLSVersion = "1.2"
+	TLSVersion13 TLSVersion = "1.3"
 )
 
+var TLSVersionValues = []TLSVersion{
+	TLSVersion10,
+	TLSVersion11,
+	TLSVersion12,
+	TLSVersion13,
+}
+
+var DefaultTLSCipherSuites = []string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+func (v TLSVersion) id() uint16 {
+	switch v {
+	case TLSVersion10:
+		return tls.VersionTLS10
+	case TLSVersion11:
+		return tls.VersionTLS11
+	case TLSVersion12:
+		return tls.VersionTLS12
+	case TLSVersion13:
+		return tls.VersionTLS13
+	}
+
+	return 0
+}
+
+// cipherSuiteId returns the identifier of a cipher suite, or 0 if the name
+// is unknown.
+func cipherSuiteId(name string) uint16 {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID
+		}
+	}
+
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			return suite.ID
+		}
+	}
+
+	return 0
+}
+
+func (cfg *TLSServerCfg) tlsConfig() (*tls.Config, error) {
+	minVersion := cfg.MinVersion
+	if minVersion == "" {
+		minVersion = TLSVersion12
+	}
+
+	names := cfg.CipherSuites
+	if len(names) == 0 {
+		names = DefaultTLSCipherSuites
+	}
+
+	cipherSuites := make([]uint16, len(names))
+	for i, name := range names {
+		id := cipherSuiteId(name)
+		if id == 0 {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+
+		cipherSuites[i] = id
+	}
+
+	tlsCfg := tls.Config{
+		MinVersion:   minVersion.id(),
+		MaxVersion:   cfg.MaxVersion.id(),
+		CipherSuites: cipherSuites,
+	}
+
+	if len(cfg.ClientCertificateAuthorities) > 0 {
+		pool, err := LoadCertificates(cfg.ClientCertificateAuthorities)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate "+
+				"authorities: %w", err)
+		}
+
+		tlsCfg.ClientCAs = pool
+
+		if cfg.RequireClientCertificate {
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return &tlsCfg, nil
+}
+
 func LoadCertificates(certificates []string) (*x509.CertPool, error) {
 	pool := x509.NewCertPool()
 
@@ -37,3 +144,29 @@ func LoadCertificates(certificates []string) (*x509.CertPool, error) {
 
 	return pool, nil
 }
+
+// TLSState returns the state of the TLS connection the request was received
+// on, or nil if the connection does not use TLS.
+func (h *Handler) TLSState() *tls.ConnectionState {
+	return h.Request.TLS
+}
+
+// ClientCertificate returns the verified certificate provided by the client,
+// or nil if there is none.
+func (h *Handler) ClientCertificate() *x509.Certificate {
+	state := h.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+func addTLSLogData(data dlog.Data, state *tls.ConnectionState) {
+	data["tls_version"] = tls.VersionName(state.Version)
+	data["tls_cipher_suite"] = tls.CipherSuiteName(state.CipherSuite)
+
+	if len(state.PeerCertificates) > 0 {
+		data["tls_client_subject"] = state.PeerCertificates[0].Subject.String()
+	}
+}
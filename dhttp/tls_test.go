@@ -0,0 +1,193 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSState(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	server.Route("/tls", "GET", func(h *Handler) {
+		state := h.TLSState()
+		if state == nil {
+			h.ReplyJSON(200, "")
+			return
+		}
+
+		assert.Nil(h.ClientCertificate())
+		assert.Equal("TLS 1.3", h.Log.Data["tls_version"])
+
+		h.ReplyJSON(200, tls.VersionName(state.Version))
+	})
+
+	ts := httptest.NewUnstartedServer(server)
+	ts.TLS = &tls.Config{MinVersion: tls.VersionTLS13}
+	ts.StartTLS()
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL + "/tls")
+	require.NoError(err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(err)
+
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("\"TLS 1.3\"\n", string(body))
+}
+
+func TestTLSServerCfg(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cfg := TLSServerCfg{
+		Certificate: "cert.pem",
+		PrivateKey:  "key.pem",
+	}
+
+	tlsCfg, err := cfg.tlsConfig()
+	require.NoError(err)
+	assert.Equal(uint16(tls.VersionTLS12), tlsCfg.MinVersion)
+	assert.Equal(uint16(0), tlsCfg.MaxVersion)
+	assert.Equal(len(DefaultTLSCipherSuites), len(tlsCfg.CipherSuites))
+
+	cfg.MinVersion = TLSVersion13
+	cfg.MaxVersion = TLSVersion12
+	cfg.CipherSuites = []string{"TLS_RSA_WITH_AES_128_CBC_SHA", "foo"}
+
+	c := check.NewChecker()
+	cfg.Check(c)
+	if assert.Equal(2, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"max_version"}, c.Errors[0].Pointer)
+		assert.Equal(djson.Pointer{"cipher_suites", "1"}, c.Errors[1].Pointer)
+	}
+}
+
+func TestClientPublicKeyPinsProxy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	// A proxy forwarding all CONNECT requests to the server
+	proxy := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != "CONNECT" {
+				w.WriteHeader(405)
+				return
+			}
+
+			serverConn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				w.WriteHeader(502)
+				return
+			}
+
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				serverConn.Close()
+				return
+			}
+
+			io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+			go func() {
+				io.Copy(serverConn, conn)
+				serverConn.Close()
+			}()
+
+			go func() {
+				io.Copy(conn, serverConn)
+				conn.Close()
+			}()
+		}))
+	defer proxy.Close()
+
+	cert := server.Certificate()
+
+	certPath := filepath.Join(t.TempDir(), "ca.pem")
+	certData := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})
+	require.NoError(os.WriteFile(certPath, certData, 0644))
+
+	pubKeyData, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	require.NoError(err)
+	pubKeyHash := sha256.Sum256(pubKeyData)
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(err)
+
+	send := func(pin string) error {
+		client, err := NewClient(ClientCfg{
+			ProxyURI: proxy.URL,
+			TLS: &TLSClientCfg{
+				CACertificates: []string{certPath},
+				PublicKeyPins:  map[string][]string{"example.com": {pin}},
+			},
+		})
+		require.NoError(err)
+		defer client.Terminate()
+
+		uri, err := url.Parse("https://example.com:" + port)
+		require.NoError(err)
+
+		res, err := client.SendRequest("GET", uri, nil, nil)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		return nil
+	}
+
+	assert.NoError(send(hex.EncodeToString(pubKeyHash[:])))
+
+	err = send(strings.Repeat("0", 64))
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "unknown public key")
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+type ValidationMode string
+
+const (
+	ValidationModeStrict ValidationMode = "strict"
+	ValidationModeLog    ValidationMode = "log"
+)
+
+var ValidationModeValues = []ValidationMode{
+	ValidationModeStrict,
+	ValidationModeLog,
+}
+
+// ValidationCfg controls the validation of request and response bodies
+// against the types declared in route metadata. In log mode, invalid bodies
+// are logged but requests are processed normally.
+type ValidationCfg struct {
+	Mode      ValidationMode `json:"mode,omitempty"`
+	Requests  bool           `json:"requests"`
+	Responses bool           `json:"responses"`
+}
+
+func (cfg *ValidationCfg) Check(c *check.Checker) {
+	if cfg.Mode != "" {
+		c.CheckStringValue("mode", cfg.Mode, ValidationModeValues)
+	}
+}
+
+func (cfg *ValidationCfg) strict() bool {
+	return cfg.Mode == "" || cfg.Mode == ValidationModeStrict
+}
+
+type validationResponseWriter struct {
+	w        http.ResponseWriter
+	buffered bool
+
+	status int
+	body   bytes.Buffer
+}
+
+func (w *validationResponseWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w *validationResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(200)
+	}
+
+	w.body.Write(data)
+
+	if w.buffered {
+		return len(data), nil
+	}
+
+	return w.w.Write(data)
+}
+
+func (w *validationResponseWriter) WriteHeader(status int) {
+	w.status = status
+
+	if !w.buffered {
+		w.w.WriteHeader(status)
+	}
+}
+
+func (w *validationResponseWriter) flush() {
+	if w.status != 0 {
+		w.w.WriteHeader(w.status)
+	}
+
+	w.w.Write(w.body.Bytes())
+}
+
+func (s *Server) callRoute(h *Handler, route *Route, routeFunc RouteFunc) {
+	cfg := s.Cfg.Validation
+
+	if cfg == nil {
+		routeFunc(h)
+		return
+	}
+
+	if cfg.Requests && route.RequestBody != nil {
+		if !s.validateRequest(h, route) {
+			return
+		}
+	}
+
+	if !cfg.Responses || len(route.Responses) == 0 {
+		routeFunc(h)
+		return
+	}
+
+	rw := h.ResponseWriter.(*ResponseWriter)
+
+	vw := &validationResponseWriter{
+		w:        rw.w,
+		buffered: cfg.strict(),
+	}
+
+	rw.w = vw
+	defer func() {
+		rw.w = vw.w
+	}()
+
+	routeFunc(h)
+
+	rw.w = vw.w
+
+	s.validateResponse(h, route, vw)
+}
+
+func (s *Server) validateRequest(h *Handler, route *Route) bool {
+	data, err := ioutil.ReadAll(h.Request.Body)
+	if err != nil {
+		h.ReplyInternalError(500, "cannot read request body: %v", err)
+		return false
+	}
+
+	h.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	verrs, err := validateJSONValue(data, route.RequestBody)
+	if err == nil && len(verrs) == 0 {
+		return true
+	}
+
+	if !s.Cfg.Validation.strict() {
+		if err != nil {
+			h.Log.Error("invalid request body: %v", err)
+		} else {
+			h.Log.Error("invalid request body: %v", verrs)
+		}
+
+		return true
+	}
+
+	if err != nil {
+		h.ReplyError(400, "invalid_request_body",
+			"invalid request body: %v", err)
+	} else {
+		h.ReplyRequestBodyValidationErrors(verrs)
+	}
+
+	return false
+}
+
+func (s *Server) validateResponse(h *Handler, route *Route, w *validationResponseWriter) {
+	status := w.status
+	if status == 0 {
+		status = 200
+	}
+
+	var validationErr error
+
+	if res, found := route.Responses[status]; found {
+		if res.Value != nil {
+			verrs, err := validateJSONValue(w.body.Bytes(), res.Value)
+			if err != nil {
+				validationErr = err
+			} else if len(verrs) > 0 {
+				validationErr = verrs
+			}
+		}
+	} else if status < 400 {
+		validationErr = fmt.Errorf("undocumented status %d", status)
+	}
+
+	if validationErr == nil {
+		if w.buffered {
+			w.flush()
+		}
+
+		return
+	}
+
+	if w.buffered {
+		h.ReplyInternalError(500, "invalid response: %v", validationErr)
+	} else {
+		h.Log.Error("invalid response: %v", validationErr)
+	}
+}
+
+func validateJSONValue(data []byte, value interface{}) (check.ValidationErrors, error) {
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	ptr := reflect.New(t)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(ptr.Interface()); err != nil {
+		return nil, err
+	}
+
+	obj, ok := ptr.Interface().(check.Object)
+	if !ok {
+		return nil, nil
+	}
+
+	checker := check.NewChecker()
+	obj.Check(checker)
+
+	return checker.Errors, nil
+}
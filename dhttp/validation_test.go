@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	route := newRoute("/users", "POST").
+		SetRequestBody(&openAPITestUser{}).
+		AddResponse(201, "the user", &openAPITestUser{})
+
+	cfg := ValidationCfg{Requests: true, Responses: true}
+
+	call := func(body string, routeFunc RouteFunc) *TestHandler {
+		th := NewTestHandler("POST", "/users", strings.NewReader(body))
+		th.Server.Cfg.Validation = &cfg
+		th.Server.callRoute(th.Handler, route, routeFunc)
+		return th
+	}
+
+	validReply := func(h *Handler) {
+		h.ReplyJSON(201, openAPITestUser{Id: "1", Name: "bob"})
+	}
+
+	invalidReply := func(h *Handler) {
+		h.ReplyJSON(201, map[string]string{"foo": "bar"})
+	}
+
+	// Valid request
+	th := call(`{"name": "bob"}`, validReply)
+	th.AssertStatus(t, 201)
+
+	// Invalid requests
+	th = call(`{"name": ""}`, validReply)
+	th.AssertValidationError(t, "/name", "empty_string")
+
+	th = call(`{"name": "bob", "foo": 1}`, validReply)
+	th.AssertAPIError(t, 400, "invalid_request_body")
+
+	// Invalid response
+	th = call(`{"name": "bob"}`, invalidReply)
+	th.AssertAPIError(t, 500, "internal_error")
+
+	// Log-only mode
+	cfg.Mode = ValidationModeLog
+
+	th = call(`{"name": ""}`, invalidReply)
+	th.AssertStatus(t, 201)
+	assert.Contains(string(th.Body()), "foo")
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/go-chi/chi/v5"
+)
+
+// VirtualHostCfg contains the settings of a host served by the server. Its
+// TLS certificate, if there is one, is selected with SNI; connections for
+// other hosts use the certificate of the server.
+type VirtualHostCfg struct {
+	Host string        `json:"host"`
+	TLS  *TLSServerCfg `json:"tls,omitempty"`
+}
+
+func (cfg *VirtualHostCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("host", cfg.Host)
+	c.CheckOptionalObject("tls", cfg.TLS)
+}
+
+// Host creates a group of routes only matched for requests whose Host
+// header is host. Requests for hosts without routes are handled by the
+// routes registered with Server.Route.
+func (s *Server) Host(host string, fn func(*Group)) *Group {
+	g := &Group{
+		Server: s,
+		Host:   normalizeHost(host),
+	}
+
+	fn(g)
+
+	return g
+}
+
+func (s *Server) initVirtualHosts() error {
+	certificates := make(map[string]*tls.Certificate)
+
+	for _, hostCfg := range s.Cfg.VirtualHosts {
+		if hostCfg.TLS == nil {
+			continue
+		}
+
+		certificate, err := tls.LoadX509KeyPair(hostCfg.TLS.Certificate,
+			hostCfg.TLS.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("cannot load tls certificate for host %q: %w",
+				hostCfg.Host, err)
+		}
+
+		certificates[normalizeHost(hostCfg.Host)] = &certificate
+	}
+
+	if len(certificates) == 0 || s.server.TLSConfig == nil {
+		return nil
+	}
+
+	s.server.TLSConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		// Returning nil without error makes the tls package use the default
+		// certificate.
+		return certificates[normalizeHost(hello.ServerName)], nil
+	}
+
+	return nil
+}
+
+func (s *Server) newRouter() *chi.Mux {
+	router := chi.NewMux()
+	router.NotFound(s.handleNotFound)
+	router.MethodNotAllowed(s.handleMethodNotAllowed)
+
+	return router
+}
+
+// hostRouter returns the router used for a host, creating it if necessary.
+func (s *Server) hostRouter(host string) *chi.Mux {
+	if host == "" {
+		return s.Router
+	}
+
+	s.routesLock.Lock()
+	defer s.routesLock.Unlock()
+
+	router, found := s.hostRouters[host]
+	if !found {
+		if s.hostRouters == nil {
+			s.hostRouters = make(map[string]*chi.Mux)
+		}
+
+		router = s.newRouter()
+		s.hostRouters[host] = router
+	}
+
+	return router
+}
+
+// requestRouter returns the router used to handle a request.
+func (s *Server) requestRouter(req *http.Request) *chi.Mux {
+	s.routesLock.Lock()
+	defer s.routesLock.Unlock()
+
+	if len(s.hostRouters) > 0 {
+		if router, found := s.hostRouters[normalizeHost(req.Host)]; found {
+			return router
+		}
+	}
+
+	return s.Router
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualHosts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, err := NewServer(ServerCfg{
+		ErrorChan: make(chan error, 1),
+	})
+	require.NoError(err)
+
+	reply := func(value string) RouteFunc {
+		return func(h *Handler) { h.ReplyJSON(200, value) }
+	}
+
+	server.Route("/", "GET", reply("default"))
+
+	server.Host("API.example.com", func(g *Group) {
+		g.Route("/", "GET", reply("api"))
+		g.Route("/things", "GET", reply("api things"))
+	})
+
+	server.Host("admin.example.com", func(g *Group) {
+		g.Route("/", "GET", reply("admin"))
+	})
+
+	call := func(host, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal("\"default\"\n", call("example.com", "/").Body.String())
+	assert.Equal("\"api\"\n", call("api.example.com:443", "/").Body.String())
+	assert.Equal("\"api things\"\n",
+		call("api.example.com", "/things").Body.String())
+	assert.Equal("\"admin\"\n", call("admin.example.com.", "/").Body.String())
+	assert.Equal(404, call("admin.example.com", "/things").Code)
+	assert.Equal(404, call("example.com", "/things").Code)
+
+	routes := server.Routes()
+	if assert.Equal(4, len(routes)) {
+		assert.Equal("api.example.com", routes[1].Host)
+	}
+}
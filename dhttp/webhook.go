@@ -0,0 +1,232 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/dcrypto"
+)
+
+type WebhookVerifier struct {
+	Secret []byte
+
+	// The maximum difference between the timestamp of a signature and the
+	// current time. Signatures already seen are rejected until their
+	// timestamp is outside of this window.
+	Tolerance time.Duration
+
+	seen      map[string]time.Time // key -> expiration date
+	lastPurge time.Time
+	seenMutex sync.Mutex
+}
+
+func NewWebhookVerifier(secret []byte, tolerance time.Duration) *WebhookVerifier {
+	if tolerance == 0 {
+		tolerance = 5 * time.Minute
+	}
+
+	return &WebhookVerifier{
+		Secret:    secret,
+		Tolerance: tolerance,
+
+		seen:      make(map[string]time.Time),
+		lastPurge: time.Now(),
+	}
+}
+
+func (v *WebhookVerifier) checkTimestamp(s string) (time.Time, error) {
+	timestamp, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp")
+	}
+
+	t := time.Unix(timestamp, 0)
+
+	delta := time.Since(t)
+	if delta < 0 {
+		delta = -delta
+	}
+
+	if delta > v.Tolerance {
+		return time.Time{}, fmt.Errorf("timestamp outside of tolerance window")
+	}
+
+	return t, nil
+}
+
+// checkReplay rejects keys which have already been seen. Keys are
+// remembered until their expiration date: for timestamped signatures, this
+// must be the end of the tolerance window of the timestamp, since a
+// signature remains valid until then.
+func (v *WebhookVerifier) checkReplay(key string, expiration time.Time) error {
+	v.seenMutex.Lock()
+	defer v.seenMutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(v.lastPurge) > v.Tolerance {
+		for k, t := range v.seen {
+			if now.After(t) {
+				delete(v.seen, k)
+			}
+		}
+
+		v.lastPurge = now
+	}
+
+	if t, found := v.seen[key]; found && !now.After(t) {
+		return fmt.Errorf("webhook already received")
+	}
+
+	v.seen[key] = expiration
+
+	return nil
+}
+
+func (v *WebhookVerifier) checkSignature(signature string, data []byte) error {
+	if !dcrypto.VerifyHMAC256Hex(data, v.Secret, signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+// VerifyGitHubWebhook checks the signature of a GitHub webhook request.
+//
+// GitHub does not sign any timestamp or delivery identifier: the
+// X-GitHub-Delivery header is only used to discard duplicate deliveries and
+// offers no protection against replay attacks, since a captured payload can
+// be sent again with a different delivery identifier. Handlers which must
+// not process a request twice have to deduplicate events based on data
+// contained in the signed body.
+func (h *Handler) VerifyGitHubWebhook(v *WebhookVerifier) error {
+	return h.verifyWebhook(func(body []byte) error {
+		header := h.Request.Header.Get("X-Hub-Signature-256")
+		if header == "" {
+			return fmt.Errorf("missing X-Hub-Signature-256 header")
+		}
+
+		signature := strings.TrimPrefix(header, "sha256=")
+		if err := v.checkSignature(signature, body); err != nil {
+			return err
+		}
+
+		if deliveryId := h.Request.Header.Get("X-GitHub-Delivery"); deliveryId != "" {
+			return v.checkReplay(deliveryId, time.Now().Add(2*v.Tolerance))
+		}
+
+		return nil
+	})
+}
+
+func (h *Handler) VerifyStripeWebhook(v *WebhookVerifier) error {
+	return h.verifyWebhook(func(body []byte) error {
+		header := h.Request.Header.Get("Stripe-Signature")
+		if header == "" {
+			return fmt.Errorf("missing Stripe-Signature header")
+		}
+
+		var timestamp string
+		var signatures []string
+
+		for _, part := range strings.Split(header, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			switch kv[0] {
+			case "t":
+				timestamp = kv[1]
+			case "v1":
+				signatures = append(signatures, kv[1])
+			}
+		}
+
+		if timestamp == "" || len(signatures) == 0 {
+			return fmt.Errorf("invalid Stripe-Signature header")
+		}
+
+		t, err := v.checkTimestamp(timestamp)
+		if err != nil {
+			return err
+		}
+
+		data := append([]byte(timestamp+"."), body...)
+
+		for _, signature := range signatures {
+			if err = v.checkSignature(signature, data); err == nil {
+				return v.checkReplay(signature, t.Add(v.Tolerance))
+			}
+		}
+
+		return err
+	})
+}
+
+func (h *Handler) VerifyHMACWebhook(v *WebhookVerifier) error {
+	// Verify requests signed by HMACSigner with default headers.
+
+	return h.verifyWebhook(func(body []byte) error {
+		signature := h.Request.Header.Get("X-Signature")
+		if signature == "" {
+			return fmt.Errorf("missing X-Signature header")
+		}
+
+		timestamp := h.Request.Header.Get("X-Signature-Timestamp")
+		if timestamp == "" {
+			return fmt.Errorf("missing X-Signature-Timestamp header")
+		}
+
+		t, err := v.checkTimestamp(timestamp)
+		if err != nil {
+			return err
+		}
+
+		data := hmacSignatureData(h.Request.Method, h.Request.URL.RequestURI(),
+			timestamp, body)
+
+		if err := v.checkSignature(signature, data); err != nil {
+			return err
+		}
+
+		return v.checkReplay(signature, t.Add(v.Tolerance))
+	})
+}
+
+func (h *Handler) verifyWebhook(fn func([]byte) error) error {
+	body, err := h.RequestData()
+	if err != nil {
+		return err
+	}
+
+	// Restore the request body so that it can be decoded after verification
+	h.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := fn(body); err != nil {
+		h.ReplyError(401, "invalid_webhook_signature",
+			"invalid webhook signature: %v", err)
+		return fmt.Errorf("invalid webhook signature: %w", err)
+	}
+
+	return nil
+}
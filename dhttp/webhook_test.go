@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dhttp
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dcrypto"
+	"github.com/stretchr/testify/assert"
+)
+
+var testWebhookSecret = []byte("secret")
+
+const testWebhookBody = `{"event":"test"}`
+
+func TestGitHubWebhook(t *testing.T) {
+	sign := func(body string) string {
+		return "sha256=" + dcrypto.SignHMAC256Hex([]byte(body), testWebhookSecret)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		valid  bool
+	}{
+		{"valid",
+			map[string]string{
+				"X-Hub-Signature-256": sign(testWebhookBody),
+				"X-GitHub-Delivery":   "1",
+			}, true},
+		{"wrong signature",
+			map[string]string{
+				"X-Hub-Signature-256": sign("foo"),
+				"X-GitHub-Delivery":   "2",
+			}, false},
+		{"missing signature",
+			map[string]string{
+				"X-GitHub-Delivery": "3",
+			}, false},
+		{"replayed delivery",
+			map[string]string{
+				"X-Hub-Signature-256": sign(testWebhookBody),
+				"X-GitHub-Delivery":   "1",
+			}, false},
+	}
+
+	v := NewWebhookVerifier(testWebhookSecret, time.Minute)
+
+	for _, test := range tests {
+		th := newWebhookTestHandler(test.header, testWebhookBody)
+		testWebhookVerification(t, th, th.VerifyGitHubWebhook(v),
+			test.name, test.valid)
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	now := time.Now().Unix()
+
+	sign := func(timestamp int64, body string) string {
+		data := strconv.FormatInt(timestamp, 10) + "." + body
+		return dcrypto.SignHMAC256Hex([]byte(data), testWebhookSecret)
+	}
+
+	header := func(timestamp int64, signatures ...string) map[string]string {
+		value := "t=" + strconv.FormatInt(timestamp, 10)
+		for _, signature := range signatures {
+			value += ",v1=" + signature
+		}
+
+		return map[string]string{"Stripe-Signature": value}
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		valid  bool
+	}{
+		{"valid",
+			header(now, sign(now, testWebhookBody)), true},
+		{"wrong signature",
+			header(now-1, sign(now-1, "foo")), false},
+		{"stale timestamp",
+			header(now-120, sign(now-120, testWebhookBody)), false},
+		{"future timestamp",
+			header(now+120, sign(now+120, testWebhookBody)), false},
+		{"replayed signature",
+			header(now, sign(now, testWebhookBody)), false},
+		{"multiple signatures",
+			header(now-2, sign(now-2, "foo"), sign(now-2, testWebhookBody)),
+			true},
+		{"multiple invalid signatures",
+			header(now-3, sign(now-3, "foo"), sign(now-3, "bar")), false},
+	}
+
+	v := NewWebhookVerifier(testWebhookSecret, time.Minute)
+
+	for _, test := range tests {
+		th := newWebhookTestHandler(test.header, testWebhookBody)
+		testWebhookVerification(t, th, th.VerifyStripeWebhook(v),
+			test.name, test.valid)
+	}
+}
+
+func TestHMACWebhook(t *testing.T) {
+	now := time.Now().Unix()
+
+	header := func(timestamp int64, body string) map[string]string {
+		ts := strconv.FormatInt(timestamp, 10)
+		data := hmacSignatureData("POST", "/webhook", ts, []byte(body))
+
+		return map[string]string{
+			"X-Signature":           dcrypto.SignHMAC256Hex(data, testWebhookSecret),
+			"X-Signature-Timestamp": ts,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		valid  bool
+	}{
+		{"valid", header(now, testWebhookBody), true},
+		{"wrong signature", header(now-1, "foo"), false},
+		{"stale timestamp", header(now-120, testWebhookBody), false},
+		{"future timestamp", header(now+120, testWebhookBody), false},
+		{"replayed signature", header(now, testWebhookBody), false},
+		{"missing timestamp",
+			map[string]string{"X-Signature": "abcd"}, false},
+	}
+
+	v := NewWebhookVerifier(testWebhookSecret, time.Minute)
+
+	for _, test := range tests {
+		th := newWebhookTestHandler(test.header, testWebhookBody)
+		testWebhookVerification(t, th, th.VerifyHMACWebhook(v),
+			test.name, test.valid)
+	}
+}
+
+func TestWebhookReplayExpiration(t *testing.T) {
+	assert := assert.New(t)
+
+	v := NewWebhookVerifier(testWebhookSecret, time.Minute)
+
+	now := time.Now()
+
+	// A signature with a timestamp in the future remains valid until the
+	// end of the tolerance window of this timestamp, and must be rejected
+	// until then even after a purge.
+	assert.NoError(v.checkReplay("future", now.Add(2*time.Minute)))
+	assert.NoError(v.checkReplay("expired", now.Add(-time.Second)))
+
+	v.lastPurge = now.Add(-2 * time.Minute)
+
+	assert.Error(v.checkReplay("future", now.Add(2*time.Minute)))
+	assert.NotContains(v.seen, "expired")
+
+	assert.NoError(v.checkReplay("expired", now.Add(time.Minute)))
+}
+
+func newWebhookTestHandler(header map[string]string, body string) *TestHandler {
+	th := NewTestHandler("POST", "/webhook", bytes.NewReader([]byte(body)))
+
+	for name, value := range header {
+		th.Request.Header.Set(name, value)
+	}
+
+	return th
+}
+
+func testWebhookVerification(t *testing.T, th *TestHandler, err error, name string, valid bool) {
+	if valid {
+		if assert.NoError(t, err, name) {
+			// The body must still be readable after verification
+			data, _ := io.ReadAll(th.Request.Body)
+			assert.Equal(t, testWebhookBody, string(data), name)
+		}
+	} else {
+		if assert.Error(t, err, name) {
+			th.AssertAPIError(t, 401, "invalid_webhook_signature")
+		}
+	}
+}
@@ -101,6 +101,13 @@ func (p Pointer) Child(tokens ...string) Pointer {
 }
 
 func (p Pointer) Find(value interface{}) interface{} {
+	v, _ := p.Find2(value)
+	return v
+}
+
+// Find2 is similar to Find but also indicates whether the value was found,
+// making it possible to distinguish missing values from null values.
+func (p Pointer) Find2(value interface{}) (interface{}, bool) {
 	v := value
 
 	for _, token := range p {
@@ -108,11 +115,11 @@ func (p Pointer) Find(value interface{}) interface{} {
 		case []interface{}:
 			i, err := strconv.ParseInt(token, 10, 64)
 			if err != nil {
-				return nil
+				return nil, false
 			}
 
 			if i < 0 || i >= int64(len(tv)) {
-				return nil
+				return nil, false
 			}
 
 			v = tv[i]
@@ -120,17 +127,17 @@ func (p Pointer) Find(value interface{}) interface{} {
 		case map[string]interface{}:
 			child, found := tv[token]
 			if !found {
-				return nil
+				return nil, false
 			}
 
 			v = child
 
 		default:
-			return nil
+			return nil, false
 		}
 	}
 
-	return v
+	return v, true
 }
 
 func encodeToken(s string) string {
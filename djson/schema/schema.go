@@ -0,0 +1,430 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package schema validates untyped JSON documents against JSON schemas.
+//
+// The following subset of JSON Schema draft 2020-12 is supported: boolean
+// schemas, type, enum, const, the numeric, string, array and object
+// validation keywords, allOf, anyOf, oneOf, not, $defs and local $ref
+// references (e.g. "#/$defs/name"). Other keywords, including format, are
+// ignored.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/exograd/go-daemon/djson"
+)
+
+var typeValues = []string{
+	"null", "boolean", "object", "array", "number", "string", "integer",
+}
+
+type InvalidSchemaError struct {
+	Pointer djson.Pointer
+	Err     error
+}
+
+func (err *InvalidSchemaError) Error() string {
+	return fmt.Sprintf("invalid schema at %v: %v", err.Pointer, err.Err)
+}
+
+func (err *InvalidSchemaError) Unwrap() error {
+	return err.Err
+}
+
+type Schema struct {
+	root *schema
+}
+
+type schema struct {
+	pointer djson.Pointer
+
+	boolean *bool
+
+	types    []string
+	enum     []djson.Value
+	constant djson.Value
+	hasConst bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	prefixItems []*schema
+	items       *schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	properties           map[string]*schema
+	patternProperties    []*patternProperty
+	additionalProperties *schema
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+
+	allOf []*schema
+	anyOf []*schema
+	oneOf []*schema
+	not   *schema
+
+	ref       string
+	refSchema *schema
+}
+
+type patternProperty struct {
+	re     *regexp.Regexp
+	schema *schema
+}
+
+type compiler struct {
+	schemas map[string]*schema
+	refs    []*schema
+}
+
+// Compile parses and compiles a JSON schema.
+func Compile(data []byte) (*Schema, error) {
+	var value djson.Value
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	return CompileValue(value)
+}
+
+// CompileValue compiles a JSON schema which has already been decoded.
+func CompileValue(value djson.Value) (*Schema, error) {
+	c := compiler{
+		schemas: make(map[string]*schema),
+	}
+
+	root, err := c.compile(value, djson.Pointer{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range c.refs {
+		if !strings.HasPrefix(s.ref, "#") {
+			return nil, &InvalidSchemaError{
+				Pointer: s.pointer,
+				Err:     fmt.Errorf("unsupported non-local reference %q", s.ref),
+			}
+		}
+
+		var pointer djson.Pointer
+		if err := pointer.Parse(s.ref[1:]); err != nil {
+			return nil, &InvalidSchemaError{
+				Pointer: s.pointer,
+				Err:     fmt.Errorf("invalid reference %q: %w", s.ref, err),
+			}
+		}
+
+		target, found := c.schemas[pointer.String()]
+		if !found {
+			return nil, &InvalidSchemaError{
+				Pointer: s.pointer,
+				Err:     fmt.Errorf("unknown reference %q", s.ref),
+			}
+		}
+
+		s.refSchema = target
+	}
+
+	return &Schema{root: root}, nil
+}
+
+// MustCompile is similar to Compile but panics on error.
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+func (c *compiler) compile(value djson.Value, pointer djson.Pointer) (*schema, error) {
+	s := &schema{pointer: pointer}
+
+	c.schemas[pointer.String()] = s
+
+	if b, ok := value.(bool); ok {
+		s.boolean = &b
+		return s, nil
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &InvalidSchemaError{
+			Pointer: pointer,
+			Err:     fmt.Errorf("schemas must be objects or booleans"),
+		}
+	}
+
+	for key, value := range obj {
+		if err := c.compileKeyword(s, key, value, pointer.Child(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (c *compiler) compileKeyword(s *schema, key string, value djson.Value, pointer djson.Pointer) error {
+	var err error
+
+	switch key {
+	case "type":
+		s.types, err = compileTypes(value)
+
+	case "enum":
+		array, ok := value.([]interface{})
+		if !ok {
+			err = fmt.Errorf("value must be an array")
+		}
+		for _, element := range array {
+			s.enum = append(s.enum, element)
+		}
+
+	case "const":
+		s.constant = value
+		s.hasConst = true
+
+	case "minimum":
+		s.minimum, err = compileNumber(value)
+	case "maximum":
+		s.maximum, err = compileNumber(value)
+	case "exclusiveMinimum":
+		s.exclusiveMinimum, err = compileNumber(value)
+	case "exclusiveMaximum":
+		s.exclusiveMaximum, err = compileNumber(value)
+	case "multipleOf":
+		s.multipleOf, err = compileNumber(value)
+		if err == nil && *s.multipleOf <= 0.0 {
+			err = fmt.Errorf("value must be strictly positive")
+		}
+
+	case "minLength":
+		s.minLength, err = compileCount(value)
+	case "maxLength":
+		s.maxLength, err = compileCount(value)
+	case "pattern":
+		s.pattern, err = compilePattern(value)
+
+	case "prefixItems":
+		s.prefixItems, err = c.compileSchemaArray(value, pointer)
+	case "items":
+		s.items, err = c.compile(value, pointer)
+	case "minItems":
+		s.minItems, err = compileCount(value)
+	case "maxItems":
+		s.maxItems, err = compileCount(value)
+	case "uniqueItems":
+		b, ok := value.(bool)
+		if !ok {
+			err = fmt.Errorf("value must be a boolean")
+		}
+		s.uniqueItems = b
+
+	case "properties":
+		s.properties, err = c.compileSchemaMap(value, pointer)
+	case "patternProperties":
+		var schemas map[string]*schema
+		schemas, err = c.compileSchemaMap(value, pointer)
+		for pattern, ps := range schemas {
+			var re *regexp.Regexp
+			if re, err = compilePattern(pattern); err != nil {
+				break
+			}
+
+			s.patternProperties = append(s.patternProperties,
+				&patternProperty{re: re, schema: ps})
+		}
+	case "additionalProperties":
+		s.additionalProperties, err = c.compile(value, pointer)
+	case "required":
+		s.required, err = compileStrings(value)
+	case "minProperties":
+		s.minProperties, err = compileCount(value)
+	case "maxProperties":
+		s.maxProperties, err = compileCount(value)
+
+	case "allOf":
+		s.allOf, err = c.compileSchemaArray(value, pointer)
+	case "anyOf":
+		s.anyOf, err = c.compileSchemaArray(value, pointer)
+	case "oneOf":
+		s.oneOf, err = c.compileSchemaArray(value, pointer)
+	case "not":
+		s.not, err = c.compile(value, pointer)
+
+	case "$defs":
+		_, err = c.compileSchemaMap(value, pointer)
+
+	case "$ref":
+		ref, ok := value.(string)
+		if !ok {
+			err = fmt.Errorf("value must be a string")
+		}
+		s.ref = ref
+		c.refs = append(c.refs, s)
+	}
+
+	if err != nil {
+		var schemaErr *InvalidSchemaError
+		if errors.As(err, &schemaErr) {
+			return err
+		}
+
+		return &InvalidSchemaError{Pointer: pointer, Err: err}
+	}
+
+	return nil
+}
+
+func (c *compiler) compileSchemaArray(value djson.Value, pointer djson.Pointer) ([]*schema, error) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value must be an array")
+	}
+
+	schemas := make([]*schema, len(array))
+
+	for i, element := range array {
+		s, err := c.compile(element, pointer.Child(fmt.Sprintf("%d", i)))
+		if err != nil {
+			return nil, err
+		}
+
+		schemas[i] = s
+	}
+
+	return schemas, nil
+}
+
+func (c *compiler) compileSchemaMap(value djson.Value, pointer djson.Pointer) (map[string]*schema, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value must be an object")
+	}
+
+	schemas := make(map[string]*schema, len(obj))
+
+	for key, member := range obj {
+		s, err := c.compile(member, pointer.Child(key))
+		if err != nil {
+			return nil, err
+		}
+
+		schemas[key] = s
+	}
+
+	return schemas, nil
+}
+
+func compileTypes(value djson.Value) ([]string, error) {
+	var types []string
+
+	switch v := value.(type) {
+	case string:
+		types = []string{v}
+	case []interface{}:
+		var err error
+		if types, err = compileStrings(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("value must be a string or an array of strings")
+	}
+
+	for _, t := range types {
+		found := false
+		for _, t2 := range typeValues {
+			if t == t2 {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("invalid type %q", t)
+		}
+	}
+
+	return types, nil
+}
+
+func compileNumber(value djson.Value) (*float64, error) {
+	f, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("value must be a number")
+	}
+
+	return &f, nil
+}
+
+func compileCount(value djson.Value) (*int, error) {
+	f, ok := value.(float64)
+	if !ok || f < 0 || f != float64(int(f)) {
+		return nil, fmt.Errorf("value must be a positive integer")
+	}
+
+	i := int(f)
+	return &i, nil
+}
+
+func compileStrings(value djson.Value) ([]string, error) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value must be an array of strings")
+	}
+
+	values := make([]string, len(array))
+
+	for i, element := range array {
+		s, ok := element.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be an array of strings")
+		}
+
+		values[i] = s
+	}
+
+	return values, nil
+}
+
+func compilePattern(value djson.Value) (*regexp.Regexp, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("value must be a string")
+	}
+
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	return re, nil
+}
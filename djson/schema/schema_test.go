@@ -0,0 +1,115 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = `{
+  "type": "object",
+  "required": ["name", "kind"],
+  "properties": {
+    "name": {"type": "string", "minLength": 1, "maxLength": 8},
+    "kind": {"enum": ["a", "b"]},
+    "count": {"type": "integer", "minimum": 0, "exclusiveMaximum": 100},
+    "tags": {
+      "type": "array",
+      "items": {"$ref": "#/$defs/tag"},
+      "uniqueItems": true
+    },
+    "target": {
+      "oneOf": [
+        {"type": "string", "pattern": "^[a-z]+$"},
+        {"type": "object", "required": ["id"]}
+      ]
+    }
+  },
+  "additionalProperties": false,
+  "$defs": {
+    "tag": {"type": "string", "pattern": "^[a-z]+$"}
+  }
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s, err := Compile([]byte(testSchema))
+	require.NoError(err)
+
+	assert.NoError(s.ValidateData([]byte(`{"name": "foo", "kind": "a",
+"count": 42, "tags": ["x", "y"], "target": {"id": 1}}`)))
+
+	err = s.ValidateData([]byte(`{"name": "", "count": 1.5,
+"tags": ["x", "x", "Y"], "target": 3, "foo": true}`))
+	require.Error(err)
+
+	errs, ok := err.(check.ValidationErrors)
+	require.True(ok)
+
+	pointers := make(map[string]string)
+	for _, err := range errs {
+		pointers[err.Pointer.String()] = err.Code
+	}
+
+	assert.Equal(map[string]string{
+		"/kind":   "missing_value",
+		"/count":  "invalid_value_type",
+		"/foo":    "invalid_value",
+		"/name":   "string_too_small",
+		"/tags/1": "duplicate_value",
+		"/tags/2": "invalid_string_format",
+		"/target": "invalid_value",
+	}, pointers)
+}
+
+func TestSchemaCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	s := MustCompile([]byte(`{"type": "string"}`))
+
+	c := check.NewChecker()
+	c.WithChild("template", func() {
+		assert.False(s.Check(c, 42.0))
+	})
+
+	if assert.Equal(1, len(c.Errors)) {
+		assert.Equal(djson.Pointer{"template"}, c.Errors[0].Pointer)
+	}
+}
+
+func TestSchemaCompile(t *testing.T) {
+	assert := assert.New(t)
+
+	schemas := []string{
+		`42`,
+		`{"type": "foo"}`,
+		`{"minLength": -1}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": {"$ref": "#/$defs/unknown"}}}`,
+		`{"$ref": "https://example.com/schema.json"}`,
+	}
+
+	for _, data := range schemas {
+		_, err := Compile([]byte(data))
+		assert.Error(err, data)
+	}
+}
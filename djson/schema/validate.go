@@ -0,0 +1,385 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+)
+
+// Validate validates a document and returns check.ValidationErrors if it is
+// not valid.
+func (s *Schema) Validate(value djson.Value) error {
+	c := check.NewChecker()
+	s.Check(c, value)
+	return c.Error()
+}
+
+// ValidateData decodes and validates a JSON document.
+func (s *Schema) ValidateData(data []byte) error {
+	var value djson.Value
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("cannot decode json data: %w", err)
+	}
+
+	return s.Validate(value)
+}
+
+// Check validates a document, reporting errors relative to the current
+// pointer of the checker. It returns true if the document is valid.
+func (s *Schema) Check(c *check.Checker, value djson.Value) bool {
+	return s.root.check(c, value)
+}
+
+func (s *schema) check(c *check.Checker, value djson.Value) bool {
+	if s.boolean != nil {
+		return c.Check(djson.Pointer{}, *s.boolean, "invalid_value",
+			"value is not allowed")
+	}
+
+	if s.refSchema != nil && !s.refSchema.check(c, value) {
+		return false
+	}
+
+	if len(s.types) > 0 && !checkType(c, value, s.types) {
+		return false
+	}
+
+	ok := true
+
+	if len(s.enum) > 0 {
+		found := false
+		for _, v := range s.enum {
+			if equal(value, v) {
+				found = true
+				break
+			}
+		}
+
+		ok = c.Check(djson.Pointer{}, found, "invalid_value",
+			"value must be one of the values of the enumeration") && ok
+	}
+
+	if s.hasConst {
+		ok = c.Check(djson.Pointer{}, equal(value, s.constant),
+			"invalid_value", "value must be equal to %s",
+			encodeValue(s.constant)) && ok
+	}
+
+	switch v := value.(type) {
+	case float64:
+		ok = s.checkNumber(c, v) && ok
+	case string:
+		ok = s.checkString(c, v) && ok
+	case []interface{}:
+		ok = s.checkArray(c, v) && ok
+	case map[string]interface{}:
+		ok = s.checkObject(c, v) && ok
+	}
+
+	for _, s2 := range s.allOf {
+		ok = s2.check(c, value) && ok
+	}
+
+	if len(s.anyOf) > 0 {
+		nbMatches := countMatches(c, value, s.anyOf)
+		ok = c.Check(djson.Pointer{}, nbMatches > 0, "invalid_value",
+			"value must match at least one schema") && ok
+	}
+
+	if len(s.oneOf) > 0 {
+		nbMatches := countMatches(c, value, s.oneOf)
+		ok = c.Check(djson.Pointer{}, nbMatches == 1, "invalid_value",
+			"value must match exactly one schema") && ok
+	}
+
+	if s.not != nil {
+		nbMatches := countMatches(c, value, []*schema{s.not})
+		ok = c.Check(djson.Pointer{}, nbMatches == 0, "invalid_value",
+			"value must not match the schema") && ok
+	}
+
+	return ok
+}
+
+func (s *schema) checkNumber(c *check.Checker, f float64) bool {
+	ok := true
+
+	if s.minimum != nil {
+		ok = c.CheckFloatMin(djson.Pointer{}, f, *s.minimum) && ok
+	}
+
+	if s.maximum != nil {
+		ok = c.CheckFloatMax(djson.Pointer{}, f, *s.maximum) && ok
+	}
+
+	if s.exclusiveMinimum != nil {
+		ok = c.Check(djson.Pointer{}, f > *s.exclusiveMinimum,
+			"float_too_small", "number %s must be greater than %s",
+			formatNumber(f), formatNumber(*s.exclusiveMinimum)) && ok
+	}
+
+	if s.exclusiveMaximum != nil {
+		ok = c.Check(djson.Pointer{}, f < *s.exclusiveMaximum,
+			"float_too_large", "number %s must be lower than %s",
+			formatNumber(f), formatNumber(*s.exclusiveMaximum)) && ok
+	}
+
+	if s.multipleOf != nil {
+		q := f / *s.multipleOf
+		ok = c.Check(djson.Pointer{}, q == math.Trunc(q), "invalid_value",
+			"number %s must be a multiple of %s",
+			formatNumber(f), formatNumber(*s.multipleOf)) && ok
+	}
+
+	return ok
+}
+
+func (s *schema) checkString(c *check.Checker, str string) bool {
+	ok := true
+
+	length := utf8.RuneCountInString(str)
+
+	if s.minLength != nil {
+		ok = c.Check(djson.Pointer{}, length >= *s.minLength,
+			"string_too_small", "string length must be greater or equal "+
+				"to %d", *s.minLength) && ok
+	}
+
+	if s.maxLength != nil {
+		ok = c.Check(djson.Pointer{}, length <= *s.maxLength,
+			"string_too_large", "string length must be lower or equal "+
+				"to %d", *s.maxLength) && ok
+	}
+
+	if s.pattern != nil {
+		ok = c.CheckStringMatch(djson.Pointer{}, str, s.pattern) && ok
+	}
+
+	return ok
+}
+
+func (s *schema) checkArray(c *check.Checker, array []interface{}) bool {
+	ok := true
+
+	if s.minItems != nil {
+		ok = c.CheckArrayLengthMin(djson.Pointer{}, array, *s.minItems) && ok
+	}
+
+	if s.maxItems != nil {
+		ok = c.CheckArrayLengthMax(djson.Pointer{}, array, *s.maxItems) && ok
+	}
+
+	if s.uniqueItems {
+	loop:
+		for i := 0; i < len(array); i++ {
+			for j := i + 1; j < len(array); j++ {
+				if equal(array[i], array[j]) {
+					c.AddError(j, "duplicate_value",
+						"value is identical to element %d", i)
+					ok = false
+					break loop
+				}
+			}
+		}
+	}
+
+	for i, element := range array {
+		var s2 *schema
+
+		if i < len(s.prefixItems) {
+			s2 = s.prefixItems[i]
+		} else if s.items != nil {
+			s2 = s.items
+		}
+
+		if s2 != nil {
+			c.WithChild(i, func() {
+				ok = s2.check(c, element) && ok
+			})
+		}
+	}
+
+	return ok
+}
+
+func (s *schema) checkObject(c *check.Checker, obj map[string]interface{}) bool {
+	ok := true
+
+	if s.minProperties != nil {
+		ok = c.Check(djson.Pointer{}, len(obj) >= *s.minProperties,
+			"object_too_small", "object must contain %d or more members",
+			*s.minProperties) && ok
+	}
+
+	if s.maxProperties != nil {
+		ok = c.Check(djson.Pointer{}, len(obj) <= *s.maxProperties,
+			"object_too_large", "object must contain %d or less members",
+			*s.maxProperties) && ok
+	}
+
+	for _, key := range s.required {
+		if _, found := obj[key]; !found {
+			c.AddError(key, "missing_value", "missing value")
+			ok = false
+		}
+	}
+
+	// Iterate on sorted keys so that errors are reported in a stable order
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := obj[key]
+		matched := false
+
+		var schemas []*schema
+
+		if s2, found := s.properties[key]; found {
+			schemas = append(schemas, s2)
+			matched = true
+		}
+
+		for _, pp := range s.patternProperties {
+			if pp.re.MatchString(key) {
+				schemas = append(schemas, pp.schema)
+				matched = true
+			}
+		}
+
+		if !matched && s.additionalProperties != nil {
+			schemas = append(schemas, s.additionalProperties)
+		}
+
+		c.WithChild(key, func() {
+			for _, s2 := range schemas {
+				ok = s2.check(c, value) && ok
+			}
+		})
+	}
+
+	return ok
+}
+
+func checkType(c *check.Checker, value djson.Value, types []string) bool {
+	vt := valueType(value)
+
+	for _, t := range types {
+		if t == vt || (t == "number" && vt == "integer") {
+			return true
+		}
+	}
+
+	c.AddError(djson.Pointer{}, "invalid_value_type",
+		"value must be of type %s", strings.Join(types, " or "))
+
+	return false
+}
+
+func countMatches(c *check.Checker, value djson.Value, schemas []*schema) int {
+	nbMatches := 0
+
+	for _, s := range schemas {
+		c2 := check.NewChecker()
+		c2.Pointer = append(djson.Pointer{}, c.Pointer...)
+
+		if s.check(c2, value) {
+			nbMatches++
+		}
+	}
+
+	return nbMatches
+}
+
+func valueType(value djson.Value) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(v1, v2 djson.Value) bool {
+	switch tv1 := v1.(type) {
+	case []interface{}:
+		tv2, ok := v2.([]interface{})
+		if !ok || len(tv1) != len(tv2) {
+			return false
+		}
+
+		for i := range tv1 {
+			if !equal(tv1[i], tv2[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	case map[string]interface{}:
+		tv2, ok := v2.(map[string]interface{})
+		if !ok || len(tv1) != len(tv2) {
+			return false
+		}
+
+		for key, value1 := range tv1 {
+			value2, found := tv2[key]
+			if !found || !equal(value1, value2) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return v1 == v2
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func encodeValue(value djson.Value) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(data)
+}
@@ -18,6 +18,8 @@ type BackendType string
 
 const (
 	BackendTypeTerminal BackendType = "terminal"
+	BackendTypeJSON     BackendType = "json"
+	BackendTypeSyslog   BackendType = "syslog"
 )
 
 type Backend interface {
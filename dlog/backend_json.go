@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type JSONBackendCfg struct {
+	// The file messages are appended to. Messages are written to the
+	// standard error output if it is empty.
+	Path string `json:"path,omitempty"`
+}
+
+type JSONBackend struct {
+	Cfg JSONBackendCfg
+
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+type jsonMessage struct {
+	Time       string `json:"time"`
+	Level      Level  `json:"level"`
+	DebugLevel int    `json:"debug_level,omitempty"`
+	Domain     string `json:"domain"`
+	Message    string `json:"message"`
+	Data       Data   `json:"data,omitempty"`
+}
+
+func NewJSONBackend(cfg JSONBackendCfg) (*JSONBackend, error) {
+	b := &JSONBackend{
+		Cfg: cfg,
+	}
+
+	if cfg.Path == "" {
+		b.w = os.Stderr
+	} else {
+		flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+
+		file, err := os.OpenFile(cfg.Path, flags, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open %q: %w", cfg.Path, err)
+		}
+
+		b.w = file
+	}
+
+	return b, nil
+}
+
+func (b *JSONBackend) Log(msg Message) {
+	jsonMsg := jsonMessage{
+		Time:       msg.Time.Format(time.RFC3339Nano),
+		Level:      msg.Level,
+		DebugLevel: msg.DebugLevel,
+		Domain:     msg.domain,
+		Message:    msg.Message,
+		Data:       msg.Data,
+	}
+
+	data, err := json.Marshal(jsonMsg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot encode log message: %v\n", err)
+		return
+	}
+
+	data = append(data, '\n')
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.w.Write(data)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !windows && !plan9
+
+package dlog
+
+import (
+	"bytes"
+	"fmt"
+	"log/syslog"
+	"sort"
+)
+
+type SyslogBackendCfg struct {
+	// The network and address of the syslog server; the local syslog server
+	// is used if they are empty.
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+
+	Tag string `json:"tag,omitempty"`
+}
+
+type SyslogBackend struct {
+	Cfg SyslogBackendCfg
+
+	writer *syslog.Writer
+}
+
+func NewSyslogBackend(cfg SyslogBackendCfg) (*SyslogBackend, error) {
+	priority := syslog.LOG_DAEMON | syslog.LOG_INFO
+
+	writer, err := syslog.Dial(cfg.Network, cfg.Address, priority, cfg.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to syslog server: %w", err)
+	}
+
+	b := &SyslogBackend{
+		Cfg: cfg,
+
+		writer: writer,
+	}
+
+	return b, nil
+}
+
+func (b *SyslogBackend) Log(msg Message) {
+	var buf bytes.Buffer
+
+	buf.WriteString(msg.domain)
+	buf.WriteString(": ")
+	buf.WriteString(msg.Message)
+
+	if len(msg.Data) > 0 {
+		keys := make([]string, 0, len(msg.Data))
+		for k := range msg.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(&buf, " %s=%s", k, formatDatum(msg.Data[k]))
+		}
+	}
+
+	s := buf.String()
+
+	switch msg.Level {
+	case LevelDebug:
+		b.writer.Debug(s)
+	case LevelInfo:
+		b.writer.Info(s)
+	case LevelError:
+		b.writer.Err(s)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build windows || plan9
+
+package dlog
+
+import "errors"
+
+type SyslogBackendCfg struct {
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+
+	Tag string `json:"tag,omitempty"`
+}
+
+type SyslogBackend struct {
+	Cfg SyslogBackendCfg
+}
+
+func NewSyslogBackend(cfg SyslogBackendCfg) (*SyslogBackend, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (b *SyslogBackend) Log(msg Message) {
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Return true if a domain matches a domain pattern, i.e. if the pattern is a
+// sequence of components of the domain starting at a component boundary.
+// For example, "http-server" and "app.http-server" both match the domain
+// "app.http-server.main". The returned length can be used to select the most
+// specific pattern.
+func domainMatch(domain, pattern string) (bool, int) {
+	if domain == pattern ||
+		strings.HasPrefix(domain, pattern+".") ||
+		strings.HasSuffix(domain, "."+pattern) ||
+		strings.Contains(domain, "."+pattern+".") {
+		return true, len(pattern)
+	}
+
+	return false, 0
+}
+
+// The levels shared by a logger and all its children. Levels can be set
+// for a limited duration, in which case the previous value is restored
+// automatically when the duration expires.
+type domainLevels struct {
+	levels map[string]Level
+
+	level      Level // the minimal level of domains not in levels
+	debugLevel *int  // overrides the debug level of loggers
+
+	reversions map[string]*levelReversion
+
+	mutex sync.RWMutex
+}
+
+type levelReversion struct {
+	expiration time.Time
+	timer      *time.Timer
+	restore    func()
+}
+
+func newDomainLevels(levels map[string]Level) *domainLevels {
+	dls := domainLevels{
+		levels: make(map[string]Level),
+
+		reversions: make(map[string]*levelReversion),
+	}
+
+	for domain, level := range levels {
+		dls.levels[domain] = level
+	}
+
+	return &dls
+}
+
+func (dls *domainLevels) minLevel(domain string) (Level, bool) {
+	if dls == nil {
+		return "", false
+	}
+
+	dls.mutex.RLock()
+	defer dls.mutex.RUnlock()
+
+	var level Level
+	bestLength := -1
+
+	for pattern, l := range dls.levels {
+		if ok, length := domainMatch(domain, pattern); ok {
+			if length > bestLength {
+				level = l
+				bestLength = length
+			}
+		}
+	}
+
+	if bestLength < 0 && dls.level != "" {
+		return dls.level, true
+	}
+
+	return level, bestLength >= 0
+}
+
+func (dls *domainLevels) debugLevelOverride() (int, bool) {
+	if dls == nil {
+		return 0, false
+	}
+
+	dls.mutex.RLock()
+	defer dls.mutex.RUnlock()
+
+	if dls.debugLevel == nil {
+		return 0, false
+	}
+
+	return *dls.debugLevel, true
+}
+
+func (dls *domainLevels) set(domain string, level Level, d time.Duration) {
+	dls.mutex.Lock()
+	defer dls.mutex.Unlock()
+
+	prevLevel, found := dls.levels[domain]
+	restore := func() {
+		if found {
+			dls.levels[domain] = prevLevel
+		} else {
+			delete(dls.levels, domain)
+		}
+	}
+
+	dls.levels[domain] = level
+	dls.updateReversion("domain:"+domain, restore, d)
+}
+
+func (dls *domainLevels) unset(domain string) {
+	dls.mutex.Lock()
+	defer dls.mutex.Unlock()
+
+	delete(dls.levels, domain)
+	dls.updateReversion("domain:"+domain, nil, 0)
+}
+
+func (dls *domainLevels) setLevel(level Level, d time.Duration) {
+	dls.mutex.Lock()
+	defer dls.mutex.Unlock()
+
+	prevLevel := dls.level
+	restore := func() {
+		dls.level = prevLevel
+	}
+
+	dls.level = level
+	dls.updateReversion("level", restore, d)
+}
+
+func (dls *domainLevels) setDebugLevel(level *int, d time.Duration) {
+	dls.mutex.Lock()
+	defer dls.mutex.Unlock()
+
+	prevLevel := dls.debugLevel
+	restore := func() {
+		dls.debugLevel = prevLevel
+	}
+
+	dls.debugLevel = level
+	dls.updateReversion("debug_level", restore, d)
+}
+
+// Must be called with the mutex locked. If the duration is zero, the change
+// is permanent and any pending reversion is cancelled. Otherwise the restore
+// function is called once the duration has elapsed; if a reversion was
+// already pending, the value it would have restored is kept so that
+// successive temporary changes revert to the last permanent value.
+func (dls *domainLevels) updateReversion(key string, restore func(), d time.Duration) {
+	if r, found := dls.reversions[key]; found {
+		r.timer.Stop()
+		delete(dls.reversions, key)
+
+		restore = r.restore
+	}
+
+	if d <= 0 {
+		return
+	}
+
+	r := &levelReversion{
+		expiration: time.Now().Add(d),
+		restore:    restore,
+	}
+
+	r.timer = time.AfterFunc(d, func() {
+		dls.mutex.Lock()
+		defer dls.mutex.Unlock()
+
+		if dls.reversions[key] == r {
+			r.restore()
+			delete(dls.reversions, key)
+		}
+	})
+
+	dls.reversions[key] = r
+}
+
+func (dls *domainLevels) all() map[string]Level {
+	dls.mutex.RLock()
+	defer dls.mutex.RUnlock()
+
+	levels := make(map[string]Level)
+	for domain, level := range dls.levels {
+		levels[domain] = level
+	}
+
+	return levels
+}
+
+func (dls *domainLevels) state() LevelState {
+	dls.mutex.RLock()
+	defer dls.mutex.RUnlock()
+
+	state := LevelState{
+		Level:        dls.level,
+		DomainLevels: make(map[string]Level),
+		Expirations:  make(map[string]time.Time),
+	}
+
+	if dls.debugLevel != nil {
+		debugLevel := *dls.debugLevel
+		state.DebugLevel = &debugLevel
+	}
+
+	for domain, level := range dls.levels {
+		state.DomainLevels[domain] = level
+	}
+
+	for key, r := range dls.reversions {
+		state.Expirations[key] = r.expiration.UTC()
+	}
+
+	return state
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainLevelsReversion(t *testing.T) {
+	assert := assert.New(t)
+
+	dls := newDomainLevels(map[string]Level{"a": LevelError})
+
+	dls.set("a", LevelDebug, 20*time.Millisecond)
+	dls.set("a", LevelInfo, 20*time.Millisecond)
+	dls.setLevel(LevelError, 20*time.Millisecond)
+
+	level, found := dls.minLevel("a.b")
+	assert.True(found)
+	assert.Equal(LevelInfo, level)
+
+	level, found = dls.minLevel("c")
+	assert.True(found)
+	assert.Equal(LevelError, level)
+
+	assert.Eventually(func() bool {
+		level, _ := dls.minLevel("a.b")
+		_, found := dls.minLevel("c")
+		return level == LevelError && !found
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Empty(dls.state().Expirations)
+}
+
+func TestDomainLevelsPermanentChange(t *testing.T) {
+	assert := assert.New(t)
+
+	dls := newDomainLevels(nil)
+
+	debugLevel := 2
+	dls.setDebugLevel(&debugLevel, 10*time.Millisecond)
+	dls.setDebugLevel(nil, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, found := dls.debugLevelOverride()
+	assert.False(found)
+
+	dls.set("a", LevelDebug, 10*time.Millisecond)
+	dls.set("a", LevelInfo, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	level, found := dls.minLevel("a")
+	assert.True(found)
+	assert.Equal(LevelInfo, level)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (l *Logger) ErrorErr(err error, data Data, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	if err == nil {
+		l.ErrorData(data, "%s", msg)
+		return
+	}
+
+	l.ErrorData(MergeData(data, ErrorData(err)), "%s: %v", msg, err)
+}
+
+// ErrorData returns structured information about an error: its message, the
+// chain of wrapped errors and, if one of these errors carries more
+// information when formatted with %+v (as errors carrying a stack trace
+// usually do), the detailed representation of the innermost one.
+func ErrorData(err error) Data {
+	var chain []string
+	var detail string
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		chain = append(chain, fmt.Sprintf("%T: %s", e, e.Error()))
+
+		if s := fmt.Sprintf("%+v", e); s != e.Error() {
+			detail = s
+		}
+	}
+
+	data := Data{
+		"error":       err.Error(),
+		"error_chain": chain,
+	}
+
+	if detail != "" {
+		data["error_detail"] = detail
+	}
+
+	return data
+}
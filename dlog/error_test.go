@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDetailedError struct{}
+
+func (err testDetailedError) Error() string {
+	return "detailed"
+}
+
+func (err testDetailedError) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprint(s, "detailed\nstack trace")
+		return
+	}
+
+	fmt.Fprint(s, err.Error())
+}
+
+func TestErrorData(t *testing.T) {
+	assert := assert.New(t)
+
+	err1 := errors.New("foo")
+	err2 := fmt.Errorf("bar: %w", err1)
+
+	data := ErrorData(err2)
+	assert.Equal("bar: foo", data["error"])
+	assert.Equal([]string{"*fmt.wrapError: bar: foo", "*errors.errorString: foo"},
+		data["error_chain"])
+	assert.NotContains(data, "error_detail")
+
+	err3 := fmt.Errorf("baz: %w", testDetailedError{})
+
+	data = ErrorData(err3)
+	assert.Equal("detailed\nstack trace", data["error_detail"])
+}
@@ -26,6 +26,21 @@ const (
 	LevelError Level = "error"
 )
 
+var LevelValues = []Level{LevelDebug, LevelInfo, LevelError}
+
+func (level Level) order() int {
+	switch level {
+	case LevelDebug:
+		return 0
+	case LevelInfo:
+		return 1
+	case LevelError:
+		return 2
+	}
+
+	return -1
+}
+
 type Message struct {
 	Time       *time.Time
 	Level      Level
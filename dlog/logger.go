@@ -30,6 +30,20 @@ type LoggerCfg struct {
 	BackendData *json.RawMessage `json:"backend,omitempty"`
 	Backend     interface{}      `json:"-"`
 	DebugLevel  int              `json:"debug_level"`
+
+	// Additional backends messages are sent to
+	Backends []BackendCfg `json:"backends,omitempty"`
+
+	// The minimal level of messages logged for specific domains
+	DomainLevels map[string]Level `json:"domain_levels,omitempty"`
+
+	RateLimits map[string]RateLimitCfg `json:"rate_limits,omitempty"`
+}
+
+type BackendCfg struct {
+	Type    BackendType      `json:"type"`
+	Data    *json.RawMessage `json:"backend,omitempty"`
+	Backend interface{}      `json:"-"`
 }
 
 type Logger struct {
@@ -38,9 +52,36 @@ type Logger struct {
 	Domain     string
 	Data       Data
 	DebugLevel int
+
+	domainLevels *domainLevels
+
+	rateLimiters *rateLimiters
+	rateLimiter  *rateLimiter
 }
 
 func (cfg *LoggerCfg) Check(c *check.Checker) {
+	c.WithChild("backends", func() {
+		for i := range cfg.Backends {
+			c.CheckObject(i, &cfg.Backends[i])
+		}
+	})
+
+	c.WithChild("domain_levels", func() {
+		for domain, level := range cfg.DomainLevels {
+			c.CheckStringValue(domain, level, LevelValues)
+		}
+	})
+
+	c.WithChild("rate_limits", func() {
+		for domain, rateLimitCfg := range cfg.RateLimits {
+			rateLimitCfg := rateLimitCfg
+			c.CheckObject(domain, &rateLimitCfg)
+		}
+	})
+}
+
+func (cfg *BackendCfg) Check(c *check.Checker) {
+	c.CheckStringNotEmpty("type", string(cfg.Type))
 }
 
 func DefaultLogger(name string) *Logger {
@@ -55,6 +96,8 @@ func DefaultLogger(name string) *Logger {
 		Backend: backend,
 		Domain:  name,
 		Data:    Data{},
+
+		domainLevels: newDomainLevels(nil),
 	}
 }
 
@@ -65,15 +108,56 @@ func NewLogger(name string, cfg LoggerCfg) (*Logger, error) {
 		Domain:     name,
 		Data:       Data{},
 		DebugLevel: cfg.DebugLevel,
+
+		domainLevels: newDomainLevels(cfg.DomainLevels),
+
+		rateLimiters: newRateLimiters(cfg.RateLimits),
+	}
+
+	l.rateLimiter = l.rateLimiters.limiter(name)
+
+	var backends []Backend
+
+	if cfg.BackendType != "" {
+		backend, err := newBackend(cfg.BackendType, cfg.BackendData,
+			cfg.Backend)
+		if err != nil {
+			return nil, err
+		}
+
+		backends = append(backends, backend)
+	}
+
+	for i, backendCfg := range cfg.Backends {
+		backend, err := newBackend(backendCfg.Type, backendCfg.Data,
+			backendCfg.Backend)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend %d: %w", i, err)
+		}
+
+		backends = append(backends, backend)
 	}
 
+	switch len(backends) {
+	case 0:
+		return nil, fmt.Errorf("missing or empty backend type")
+	case 1:
+		l.Backend = backends[0]
+	default:
+		l.Backend = NewMultiBackend(backends...)
+	}
+
+	return l, nil
+}
+
+func newBackend(backendType BackendType, data *json.RawMessage, cfg interface{}) (Backend, error) {
 	backendCfg := func(cfgObj interface{}) (interface{}, error) {
 		switch {
-		case cfg.Backend != nil:
-			return cfg.Backend, nil
+		case cfg != nil:
+			return cfg, nil
 
-		case cfg.BackendData != nil:
-			if err := json.Unmarshal(*cfg.BackendData, cfgObj); err != nil {
+		case data != nil:
+			if err := json.Unmarshal(*data, cfgObj); err != nil {
 				return nil,
 					fmt.Errorf("invalid backend configuration: %w", err)
 			}
@@ -84,23 +168,93 @@ func NewLogger(name string, cfg LoggerCfg) (*Logger, error) {
 		return cfgObj, nil
 	}
 
-	switch cfg.BackendType {
+	switch backendType {
 	case BackendTypeTerminal:
 		bcfg, err := backendCfg(&TerminalBackendCfg{})
 		if err != nil {
 			return nil, err
 		}
 		bcfg2 := bcfg.(*TerminalBackendCfg)
-		l.Backend = NewTerminalBackend(*bcfg2)
+		return NewTerminalBackend(*bcfg2), nil
+
+	case BackendTypeJSON:
+		bcfg, err := backendCfg(&JSONBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*JSONBackendCfg)
+		return NewJSONBackend(*bcfg2)
+
+	case BackendTypeSyslog:
+		bcfg, err := backendCfg(&SyslogBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*SyslogBackendCfg)
+		return NewSyslogBackend(*bcfg2)
 
 	case "":
 		return nil, fmt.Errorf("missing or empty backend type")
 
 	default:
-		return nil, fmt.Errorf("invalid backend type %q", cfg.BackendType)
+		return nil, fmt.Errorf("invalid backend type %q", backendType)
 	}
+}
 
-	return l, nil
+// The state of the levels shared by a logger and its children. Expirations
+// are indexed by "level", "debug_level" or "domain:<domain>" for levels set
+// temporarily.
+type LevelState struct {
+	Level        Level                `json:"level,omitempty"`
+	DebugLevel   *int                 `json:"debug_level,omitempty"`
+	DomainLevels map[string]Level     `json:"domain_levels"`
+	Expirations  map[string]time.Time `json:"expirations,omitempty"`
+}
+
+func (l *Logger) SetDomainLevel(domain string, level Level) {
+	l.domainLevels.set(domain, level, 0)
+}
+
+// SetDomainLevelFor sets the minimal level of a domain and restores the
+// previous one once the duration has elapsed.
+func (l *Logger) SetDomainLevelFor(domain string, level Level, d time.Duration) {
+	l.domainLevels.set(domain, level, d)
+}
+
+// SetLevel sets the minimal level of all domains which do not have their own
+// domain level. An empty level removes the minimal level.
+func (l *Logger) SetLevel(level Level) {
+	l.domainLevels.setLevel(level, 0)
+}
+
+func (l *Logger) SetLevelFor(level Level, d time.Duration) {
+	l.domainLevels.setLevel(level, d)
+}
+
+// SetDebugLevel overrides the debug level of the logger and of all its
+// children.
+func (l *Logger) SetDebugLevel(level int) {
+	l.domainLevels.setDebugLevel(&level, 0)
+}
+
+func (l *Logger) SetDebugLevelFor(level int, d time.Duration) {
+	l.domainLevels.setDebugLevel(&level, d)
+}
+
+func (l *Logger) UnsetDebugLevel() {
+	l.domainLevels.setDebugLevel(nil, 0)
+}
+
+func (l *Logger) LevelState() LevelState {
+	return l.domainLevels.state()
+}
+
+func (l *Logger) UnsetDomainLevel(domain string) {
+	l.domainLevels.unset(domain)
+}
+
+func (l *Logger) DomainLevels() map[string]Level {
+	return l.domainLevels.all()
 }
 
 func (l *Logger) Child(domain string, data Data) *Logger {
@@ -116,16 +270,32 @@ func (l *Logger) Child(domain string, data Data) *Logger {
 		Domain:     childDomain,
 		Data:       MergeData(l.Data, data),
 		DebugLevel: l.DebugLevel,
+
+		domainLevels: l.domainLevels,
+
+		rateLimiters: l.rateLimiters,
+		rateLimiter:  l.rateLimiters.limiter(childDomain),
 	}
 
 	return child
 }
 
 func (l *Logger) Log(msg Message) {
-	if msg.Level == LevelDebug && l.DebugLevel < msg.DebugLevel {
+	debugLevel := l.DebugLevel
+	if level, found := l.domainLevels.debugLevelOverride(); found {
+		debugLevel = level
+	}
+
+	if msg.Level == LevelDebug && debugLevel < msg.DebugLevel {
 		return
 	}
 
+	if minLevel, found := l.domainLevels.minLevel(l.Domain); found {
+		if msg.Level.order() < minLevel.order() {
+			return
+		}
+	}
+
 	var t time.Time
 	if msg.Time == nil {
 		t = time.Now()
@@ -136,6 +306,19 @@ func (l *Logger) Log(msg Message) {
 	t = t.UTC()
 	msg.Time = &t
 
+	if l.rateLimiter != nil {
+		ok, suppressed := l.rateLimiter.allow(t, func(suppressed int) {
+			l.logSuppressed(time.Now().UTC(), suppressed)
+		})
+		if !ok {
+			return
+		}
+
+		if suppressed > 0 {
+			l.logSuppressed(t, suppressed)
+		}
+	}
+
 	msg.domain = l.Domain
 
 	if msg.Data == nil {
@@ -147,6 +330,17 @@ func (l *Logger) Log(msg Message) {
 	l.Backend.Log(msg)
 }
 
+func (l *Logger) logSuppressed(t time.Time, suppressed int) {
+	l.Backend.Log(Message{
+		Time:    &t,
+		Level:   LevelInfo,
+		Message: fmt.Sprintf("%d messages suppressed", suppressed),
+		Data:    MergeData(l.Data, Data{"suppressed": suppressed}),
+
+		domain: l.Domain,
+	})
+}
+
 func (l *Logger) Debug(level int, format string, args ...interface{}) {
 	l.Log(Message{
 		Level:      LevelDebug,
@@ -0,0 +1,189 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+type RateLimitCfg struct {
+	// Only log one message out of SampleRate messages.
+	SampleRate int `json:"sample_rate,omitempty"`
+
+	// Log at most Burst messages during each interval.
+	Burst    int            `json:"burst,omitempty"`
+	Interval dtime.Duration `json:"interval,omitempty"`
+}
+
+func (cfg *RateLimitCfg) Check(c *check.Checker) {
+	c.CheckIntMin("sample_rate", cfg.SampleRate, 0)
+	c.CheckIntMin("burst", cfg.Burst, 0)
+	c.CheckDurationMin("interval", cfg.Interval.Duration(), 0)
+}
+
+type rateLimiters struct {
+	cfgs map[string]RateLimitCfg
+
+	limiters map[string]*rateLimiter
+	mutex    sync.Mutex
+}
+
+func newRateLimiters(cfgs map[string]RateLimitCfg) *rateLimiters {
+	if len(cfgs) == 0 {
+		return nil
+	}
+
+	return &rateLimiters{
+		cfgs:     cfgs,
+		limiters: make(map[string]*rateLimiter),
+	}
+}
+
+func (ls *rateLimiters) limiter(domain string) *rateLimiter {
+	// If multiple rate limits match the domain, we use the most specific
+	// one.
+
+	if ls == nil {
+		return nil
+	}
+
+	var key string
+	bestLength := -1
+
+	for k := range ls.cfgs {
+		if ok, length := domainMatch(domain, k); ok && length > bestLength {
+			key = k
+			bestLength = length
+		}
+	}
+
+	if bestLength < 0 {
+		return nil
+	}
+
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	l, found := ls.limiters[key]
+	if !found {
+		l = newRateLimiter(ls.cfgs[key])
+		ls.limiters[key] = l
+	}
+
+	return l
+}
+
+type rateLimiter struct {
+	cfg RateLimitCfg
+
+	count       int64
+	windowStart time.Time
+	windowCount int
+	suppressed  int
+	flushTimer  *time.Timer
+
+	mutex sync.Mutex
+}
+
+func newRateLimiter(cfg RateLimitCfg) *rateLimiter {
+	if cfg.Interval == 0 {
+		cfg.Interval = dtime.Duration(time.Second)
+	}
+
+	return &rateLimiter{
+		cfg: cfg,
+	}
+}
+
+// Return whether a message should be logged and, if it should, the number of
+// messages suppressed since the last logged message. If messages are
+// suppressed and no message is logged until the end of the rate window, the
+// flush function, if not nil, is called with the number of suppressed
+// messages so that they are reported even if the burst is followed by
+// silence.
+func (l *rateLimiter) allow(now time.Time, flush func(int)) (bool, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.count++
+
+	if l.cfg.SampleRate > 1 && (l.count-1)%int64(l.cfg.SampleRate) != 0 {
+		l.suppress(now, flush)
+		return false, 0
+	}
+
+	if l.cfg.Burst > 0 {
+		if now.Sub(l.windowStart) >= l.cfg.Interval.Duration() {
+			l.windowStart = now
+			l.windowCount = 0
+		}
+
+		if l.windowCount >= l.cfg.Burst {
+			l.suppress(now, flush)
+			return false, 0
+		}
+
+		l.windowCount++
+	}
+
+	if l.flushTimer != nil {
+		l.flushTimer.Stop()
+		l.flushTimer = nil
+	}
+
+	suppressed := l.suppressed
+	l.suppressed = 0
+
+	return true, suppressed
+}
+
+func (l *rateLimiter) suppress(now time.Time, flush func(int)) {
+	l.suppressed++
+
+	if flush == nil || l.flushTimer != nil {
+		return
+	}
+
+	delay := l.cfg.Interval.Duration()
+	if l.cfg.Burst > 0 {
+		delay = l.windowStart.Add(delay).Sub(now)
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		l.mutex.Lock()
+
+		if l.flushTimer != timer {
+			l.mutex.Unlock()
+			return
+		}
+
+		suppressed := l.suppressed
+		l.suppressed = 0
+		l.flushTimer = nil
+
+		l.mutex.Unlock()
+
+		if suppressed > 0 {
+			flush(suppressed)
+		}
+	})
+
+	l.flushTimer = timer
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterSampling(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newRateLimiter(RateLimitCfg{SampleRate: 3})
+	now := time.Now()
+
+	var allowed []bool
+	for i := 0; i < 7; i++ {
+		ok, _ := l.allow(now, nil)
+		allowed = append(allowed, ok)
+	}
+
+	assert.Equal([]bool{true, false, false, true, false, false, true},
+		allowed)
+
+	_, suppressed := l.allow(now, nil)
+	assert.Equal(0, suppressed)
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newRateLimiter(RateLimitCfg{
+		Burst:    2,
+		Interval: dtime.Duration(time.Second),
+	})
+	now := time.Now()
+
+	ok, _ := l.allow(now, nil)
+	assert.True(ok)
+	ok, _ = l.allow(now, nil)
+	assert.True(ok)
+	ok, _ = l.allow(now, nil)
+	assert.False(ok)
+	ok, _ = l.allow(now.Add(500*time.Millisecond), nil)
+	assert.False(ok)
+
+	ok, suppressed := l.allow(now.Add(time.Second), nil)
+	assert.True(ok)
+	assert.Equal(2, suppressed)
+}
+
+func TestRateLimiterBurstThenSilence(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newRateLimiter(RateLimitCfg{
+		Burst:    1,
+		Interval: dtime.Duration(20 * time.Millisecond),
+	})
+
+	flushed := make(chan int, 1)
+	flush := func(suppressed int) {
+		flushed <- suppressed
+	}
+
+	now := time.Now()
+
+	ok, _ := l.allow(now, flush)
+	assert.True(ok)
+
+	for i := 0; i < 3; i++ {
+		ok, _ = l.allow(now, flush)
+		assert.False(ok)
+	}
+
+	select {
+	case suppressed := <-flushed:
+		assert.Equal(3, suppressed)
+	case <-time.After(time.Second):
+		assert.Fail("suppressed messages not flushed")
+	}
+
+	// The count was reported and must not be reported again
+	ok, suppressed := l.allow(time.Now().Add(time.Second), flush)
+	assert.True(ok)
+	assert.Equal(0, suppressed)
+}
+
+func TestRateLimitersDomains(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newRateLimiters(map[string]RateLimitCfg{
+		"a":   {Burst: 1},
+		"a.b": {Burst: 2},
+	})
+
+	assert.Nil(ls.limiter("b"))
+	assert.Nil(ls.limiter("ab"))
+	assert.Same(ls.limiter("a"), ls.limiter("x.a"))
+	assert.Same(ls.limiter("a"), ls.limiter("a.c"))
+	assert.Same(ls.limiter("a.b"), ls.limiter("a.b.c"))
+	assert.NotSame(ls.limiter("a"), ls.limiter("a.b"))
+}
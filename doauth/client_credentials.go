@@ -0,0 +1,210 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+// ClientCredentialsCfg configures the OAuth2 client credentials flow used for
+// service-to-service authentication.
+type ClientCredentialsCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	TokenURI     string   `json:"token_uri"`
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Audience     string   `json:"audience,omitempty"`
+
+	// Tokens are refreshed when they expire in less than RefreshMargin, 30
+	// seconds by default.
+	RefreshMargin dtime.Duration `json:"refresh_margin,omitempty"`
+}
+
+func (cfg *ClientCredentialsCfg) Check(c *check.Checker) {
+	c.CheckStringURI("token_uri", cfg.TokenURI)
+	c.CheckStringNotEmpty("client_id", cfg.ClientId)
+	c.CheckStringNotEmpty("client_secret", cfg.ClientSecret)
+	c.CheckDurationMin("refresh_margin", cfg.RefreshMargin.Duration(), 0)
+}
+
+// TokenSource fetches and caches access tokens. It implements
+// dhttp.RequestSigner so that it can be used as the signer of a dhttp.Client
+// to authenticate all requests.
+type TokenSource struct {
+	Cfg ClientCredentialsCfg
+
+	httpClient *http.Client
+
+	token          string
+	expirationTime time.Time
+	mutex          sync.Mutex
+}
+
+type TokenError struct {
+	Status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (err *TokenError) Error() string {
+	if err.Code == "" {
+		return fmt.Sprintf("request failed with status %d", err.Status)
+	}
+
+	msg := fmt.Sprintf("request failed with status %d: %s",
+		err.Status, err.Code)
+	if err.Description != "" {
+		msg += ": " + err.Description
+	}
+
+	return msg
+}
+
+func NewTokenSource(cfg ClientCredentialsCfg) *TokenSource {
+	if cfg.RefreshMargin == 0 {
+		cfg.RefreshMargin = dtime.Duration(30 * time.Second)
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &TokenSource{
+		Cfg: cfg,
+
+		httpClient: httpClient,
+	}
+}
+
+// Token returns a valid access token, fetching a new one if there is no
+// cached token or if the cached token is about to expire.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	refreshTime := s.expirationTime.Add(-s.Cfg.RefreshMargin.Duration())
+	if s.token != "" && time.Now().Before(refreshTime) {
+		return s.token, nil
+	}
+
+	token, expiresIn, err := s.fetchToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch access token: %w", err)
+	}
+
+	s.token = token
+	s.expirationTime = time.Now().Add(expiresIn)
+
+	return s.token, nil
+}
+
+// Invalidate removes the cached token, e.g. after the token was rejected by
+// a server.
+func (s *TokenSource) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.token = ""
+}
+
+func (s *TokenSource) SignRequest(req *http.Request) error {
+	token, err := s.Token(req.Context())
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (s *TokenSource) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	if len(s.Cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.Cfg.Scopes, " "))
+	}
+
+	if s.Cfg.Audience != "" {
+		form.Set("audience", s.Cfg.Audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.Cfg.TokenURI,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.Cfg.ClientId),
+		url.QueryEscape(s.Cfg.ClientSecret))
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		tokenErr := TokenError{Status: res.StatusCode}
+		json.Unmarshal(data, &tokenErr)
+		return "", 0, &tokenErr
+	}
+
+	var tokenRes struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal(data, &tokenRes); err != nil {
+		return "", 0, fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	if tokenRes.AccessToken == "" {
+		return "", 0, fmt.Errorf("missing or empty access token")
+	}
+
+	if tokenRes.TokenType != "" && !strings.EqualFold(tokenRes.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token type %q", tokenRes.TokenType)
+	}
+
+	expiresIn := time.Duration(tokenRes.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+
+	return tokenRes.AccessToken, expiresIn, nil
+}
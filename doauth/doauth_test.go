@@ -0,0 +1,202 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSource(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	nbRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			nbRequests++
+
+			clientId, clientSecret, _ := req.BasicAuth()
+			if clientId != "client" || clientSecret != "secret" {
+				w.WriteHeader(401)
+				w.Write([]byte(`{"error": "invalid_client"}`))
+				return
+			}
+
+			assert.Equal("client_credentials", req.FormValue("grant_type"))
+			assert.Equal("a b", req.FormValue("scope"))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "token",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		}))
+	defer server.Close()
+
+	source := NewTokenSource(ClientCredentialsCfg{
+		TokenURI:     server.URL,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"a", "b"},
+	})
+
+	token, err := source.Token(context.Background())
+	require.NoError(err)
+	assert.Equal("token", token)
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	require.NoError(source.SignRequest(req))
+	assert.Equal("Bearer token", req.Header.Get("Authorization"))
+	assert.Equal(1, nbRequests)
+
+	source = NewTokenSource(ClientCredentialsCfg{
+		TokenURI:     server.URL,
+		ClientId:     "client",
+		ClientSecret: "invalid",
+	})
+
+	_, err = source.Token(context.Background())
+	var tokenErr *TokenError
+	if assert.ErrorAs(err, &tokenErr) {
+		assert.Equal("invalid_client", tokenErr.Code)
+	}
+}
+
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims Claims) string {
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	header := map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}
+	signed := encode(header) + "." + encode(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256,
+		digest[:])
+	require.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCValidator(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+
+	var issuer string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration",
+		func(w http.ResponseWriter, req *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":   issuer,
+				"jwks_uri": issuer + "/jwks",
+			})
+		})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, req *http.Request) {
+		e := big.NewInt(int64(key.E)).Bytes()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(e),
+			}},
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	issuer = server.URL
+
+	validator := NewOIDCValidator(OIDCCfg{
+		Issuer:   issuer,
+		Audience: "api",
+	})
+
+	now := time.Now()
+
+	claims := Claims{
+		"iss":   issuer,
+		"sub":   "service-a",
+		"aud":   []string{"api"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": "read write",
+	}
+
+	th := dhttp.NewTestHandler("GET", "/", nil)
+	th.Request.Header.Set("Authorization",
+		"Bearer "+signTestJWT(t, key, "key1", claims))
+
+	principal, err := validator.Authenticate(th.Handler)
+	require.NoError(err)
+	if assert.NotNil(principal) {
+		assert.Equal("service-a", principal.Id)
+		assert.Equal([]string{"read", "write"}, principal.Scopes)
+	}
+
+	ctx := context.Background()
+
+	// Invalid claims
+	expiredClaims := Claims{"iss": issuer, "aud": "api",
+		"exp": now.Add(-time.Hour).Unix()}
+	_, err = validator.Validate(ctx, signTestJWT(t, key, "key1", expiredClaims))
+	assert.ErrorIs(err, ErrInvalidToken)
+
+	otherAudClaims := Claims{"iss": issuer, "aud": "other",
+		"exp": now.Add(time.Hour).Unix()}
+	_, err = validator.Validate(ctx, signTestJWT(t, key, "key1", otherAudClaims))
+	assert.ErrorIs(err, ErrInvalidToken)
+
+	// Invalid signature
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+	_, err = validator.Validate(ctx, signTestJWT(t, otherKey, "key1", claims))
+	assert.ErrorIs(err, ErrInvalidToken)
+
+	// Unknown key
+	_, err = validator.Validate(ctx, signTestJWT(t, key, "key2", claims))
+	assert.ErrorIs(err, ErrInvalidToken)
+
+	// No token
+	th = dhttp.NewTestHandler("GET", "/", nil)
+	principal, err = validator.Authenticate(th.Handler)
+	assert.NoError(err)
+	assert.Nil(principal)
+}
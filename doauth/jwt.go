@@ -0,0 +1,268 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c Claims) Time(name string) (time.Time, bool) {
+	n, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(n), 0), true
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+func (c Claims) Issuer() string {
+	return c.String("iss")
+}
+
+func (c Claims) Audiences() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+
+	case []interface{}:
+		var audiences []string
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+
+		return audiences
+	}
+
+	return nil
+}
+
+// Scopes returns scopes contained either in the "scope" claim (a space
+// separated string) or in the "scp" claim (an array of strings).
+func (c Claims) Scopes() []string {
+	if s := c.String("scope"); s != "" {
+		return strings.Fields(s)
+	}
+
+	if values, ok := c["scp"].([]interface{}); ok {
+		var scopes []string
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+
+		return scopes
+	}
+
+	return nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+type jwt struct {
+	header    jwtHeader
+	claims    Claims
+	signed    []byte
+	signature []byte
+}
+
+func parseJWT(s string) (*jwt, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: invalid format", ErrInvalidToken)
+	}
+
+	var token jwt
+
+	if err := decodeJWTPart(parts[0], &token.header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %v", ErrInvalidToken, err)
+	}
+
+	if err := decodeJWTPart(parts[1], &token.claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding",
+			ErrInvalidToken)
+	}
+
+	token.signed = []byte(parts[0] + "." + parts[1])
+	token.signature = signature
+
+	return &token, nil
+}
+
+func decodeJWTPart(s string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid base64 encoding")
+	}
+
+	return json.Unmarshal(data, dest)
+}
+
+func (t *jwt) verifySignature(key crypto.PublicKey) error {
+	var hash crypto.Hash
+
+	switch t.header.Algorithm {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken,
+			t.header.Algorithm)
+	}
+
+	h := hash.New()
+	h.Write(t.signed)
+	digest := h.Sum(nil)
+
+	var valid bool
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch t.header.Algorithm[:2] {
+		case "RS":
+			valid = rsa.VerifyPKCS1v15(k, hash, digest, t.signature) == nil
+		case "PS":
+			valid = rsa.VerifyPSS(k, hash, digest, t.signature, nil) == nil
+		}
+
+	case *ecdsa.PublicKey:
+		if t.header.Algorithm[:2] != "ES" {
+			break
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			break
+		}
+
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+
+		valid = ecdsa.Verify(k, digest, r, s)
+	}
+
+	if !valid {
+		return fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	Use     string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 encoding")
+		}
+
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
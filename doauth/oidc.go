@@ -0,0 +1,279 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doauth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+)
+
+// OIDCCfg configures the validation of JWT access tokens issued by an OpenID
+// Connect provider. Signing keys are obtained using OIDC discovery.
+type OIDCCfg struct {
+	Log        *dlog.Logger `json:"-"`
+	HTTPClient *http.Client `json:"-"`
+
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience,omitempty"`
+
+	KeyRefreshInterval dtime.Duration `json:"key_refresh_interval,omitempty"`
+	ClockSkew          dtime.Duration `json:"clock_skew,omitempty"`
+}
+
+func (cfg *OIDCCfg) Check(c *check.Checker) {
+	c.CheckStringURI("issuer", cfg.Issuer)
+	c.CheckDurationMin("key_refresh_interval",
+		cfg.KeyRefreshInterval.Duration(), 0)
+	c.CheckDurationMin("clock_skew", cfg.ClockSkew.Duration(), 0)
+}
+
+// OIDCValidator validates tokens; it implements dhttp.Authenticator for
+// requests using bearer tokens.
+type OIDCValidator struct {
+	Cfg OIDCCfg
+	Log *dlog.Logger
+
+	httpClient *http.Client
+
+	keys           map[string]crypto.PublicKey
+	keyRefreshTime time.Time
+	mutex          sync.Mutex
+}
+
+func NewOIDCValidator(cfg OIDCCfg) *OIDCValidator {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("oidc")
+	}
+
+	if cfg.KeyRefreshInterval == 0 {
+		cfg.KeyRefreshInterval = dtime.Duration(time.Hour)
+	}
+
+	if cfg.ClockSkew == 0 {
+		cfg.ClockSkew = dtime.Duration(time.Minute)
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &OIDCValidator{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		httpClient: httpClient,
+	}
+}
+
+func (v *OIDCValidator) Authenticate(h *dhttp.Handler) (*dhttp.Principal, error) {
+	token := h.BearerToken()
+	if token == "" {
+		return nil, nil
+	}
+
+	claims, err := v.Validate(h.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", dhttp.ErrInvalidCredentials, err)
+	}
+
+	principal := dhttp.Principal{
+		Id:     claims.Subject(),
+		Type:   "oidc",
+		Scopes: claims.Scopes(),
+		Data:   claims,
+	}
+
+	return &principal, nil
+}
+
+// Validate checks the signature and the claims of a token and returns its
+// claims.
+func (v *OIDCValidator) Validate(ctx context.Context, token string) (Claims, error) {
+	t, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.key(ctx, t.header.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.verifySignature(key); err != nil {
+		return nil, err
+	}
+
+	if err := v.validateClaims(t.claims); err != nil {
+		return nil, err
+	}
+
+	return t.claims, nil
+}
+
+func (v *OIDCValidator) validateClaims(claims Claims) error {
+	now := time.Now()
+	skew := v.Cfg.ClockSkew.Duration()
+
+	if claims.Issuer() != v.Cfg.Issuer {
+		return fmt.Errorf("%w: invalid issuer", ErrInvalidToken)
+	}
+
+	if v.Cfg.Audience != "" {
+		found := false
+		for _, audience := range claims.Audiences() {
+			if audience == v.Cfg.Audience {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%w: invalid audience", ErrInvalidToken)
+		}
+	}
+
+	exp, found := claims.Time("exp")
+	if !found {
+		return fmt.Errorf("%w: missing expiration time", ErrInvalidToken)
+	}
+
+	if now.After(exp.Add(skew)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+
+	if nbf, found := claims.Time("nbf"); found && now.Add(skew).Before(nbf) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+func (v *OIDCValidator) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	now := time.Now()
+
+	key, found := v.keys[id]
+
+	// Refresh keys when they are too old, or when the key is unknown, which
+	// usually means that keys were rotated; in the latter case we avoid
+	// refreshing more than every few seconds since anyone can send a token
+	// with an arbitrary key id.
+	refresh := now.After(v.keyRefreshTime.Add(v.Cfg.KeyRefreshInterval.Duration())) ||
+		(!found && now.After(v.keyRefreshTime.Add(10*time.Second)))
+
+	if refresh {
+		keys, err := v.fetchKeys(ctx)
+		if err != nil {
+			if v.keys == nil {
+				return nil, fmt.Errorf("cannot fetch keys: %w", err)
+			}
+
+			v.Log.Error("cannot refresh keys: %v", err)
+		} else {
+			v.keys = keys
+			v.keyRefreshTime = now
+		}
+
+		key, found = v.keys[id]
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, id)
+	}
+
+	return key, nil
+}
+
+func (v *OIDCValidator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	discoveryURI := strings.TrimSuffix(v.Cfg.Issuer, "/") +
+		"/.well-known/openid-configuration"
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+
+	if err := v.getJSON(ctx, discoveryURI, &discovery); err != nil {
+		return nil, fmt.Errorf("cannot fetch provider configuration: %w", err)
+	}
+
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("missing jwks_uri in provider configuration")
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := v.getJSON(ctx, discovery.JWKSURI, &keySet); err != nil {
+		return nil, fmt.Errorf("cannot fetch key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			v.Log.Error("ignoring key %q: %v", jwk.KeyId, err)
+			continue
+		}
+
+		keys[jwk.KeyId] = key
+	}
+
+	return keys, nil
+}
+
+func (v *OIDCValidator) getJSON(ctx context.Context, uri string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(dest); err != nil {
+		return fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,434 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doutbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/broker"
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/exograd/go-daemon/ksuid"
+	"github.com/exograd/go-daemon/pg"
+	"github.com/jackc/pgx/v4"
+)
+
+// TableSQL is the definition of the outbox table; it must be created by a
+// schema migration.
+const TableSQL = `
+CREATE TABLE outbox_events (
+  id VARCHAR NOT NULL PRIMARY KEY,
+  creation_time TIMESTAMP NOT NULL
+    DEFAULT (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'),
+  subject VARCHAR NOT NULL,
+  data BYTEA NOT NULL,
+  header JSONB,
+  nb_attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_time TIMESTAMP
+    DEFAULT (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'),
+  last_error VARCHAR,
+  sent_time TIMESTAMP
+);
+
+CREATE INDEX outbox_events_next_attempt_time_idx
+  ON outbox_events (next_attempt_time)
+  WHERE sent_time IS NULL;
+`
+
+type Event struct {
+	Id           string        `json:"id"`
+	CreationTime time.Time     `json:"creation_time"`
+	Subject      string        `json:"subject"`
+	Data         []byte        `json:"data"`
+	Header       broker.Header `json:"header,omitempty"`
+	NbAttempts   int           `json:"nb_attempts"`
+}
+
+func (e *Event) FromRow(row pgx.Row) error {
+	return row.Scan(&e.Id, &e.CreationTime, &e.Subject, &e.Data, &e.Header,
+		&e.NbAttempts)
+}
+
+type Events []*Event
+
+func (es *Events) AddFromRow(row pgx.Row) error {
+	var e Event
+	if err := e.FromRow(row); err != nil {
+		return err
+	}
+
+	*es = append(*es, &e)
+	return nil
+}
+
+// Publisher sends events outside of the database. Events are delivered at
+// least once: a publisher can be called several times for the same event,
+// so receivers should use the event identifier to deduplicate them.
+type Publisher interface {
+	Publish(context.Context, *Event) error
+}
+
+type PublisherFunc func(context.Context, *Event) error
+
+func (fn PublisherFunc) Publish(ctx context.Context, e *Event) error {
+	return fn(ctx, e)
+}
+
+type OutboxCfg struct {
+	Log       *dlog.Logger `json:"-"`
+	Pg        *pg.Client   `json:"-"`
+	Publisher Publisher    `json:"-"`
+
+	Table        string             `json:"table,omitempty"`
+	PollInterval dtime.Duration     `json:"poll_interval,omitempty"`
+	BatchSize    int                `json:"batch_size,omitempty"`
+	MaxAttempts  int                `json:"max_attempts,omitempty"`
+	Backoff      *broker.BackoffCfg `json:"backoff,omitempty"`
+
+	// How long sent events are kept before being deleted
+	Retention dtime.Duration `json:"retention,omitempty"`
+}
+
+func (cfg *OutboxCfg) Check(c *check.Checker) {
+	if cfg.PollInterval != 0 {
+		c.CheckDurationMin("poll_interval", cfg.PollInterval.Duration(),
+			10*time.Millisecond)
+	}
+
+	c.CheckIntMin("batch_size", cfg.BatchSize, 0)
+	c.CheckIntMin("max_attempts", cfg.MaxAttempts, 0)
+	c.CheckOptionalObject("backoff", cfg.Backoff)
+
+	if cfg.Retention != 0 {
+		c.CheckDurationMin("retention", cfg.Retention.Duration(), time.Minute)
+	}
+}
+
+type Outbox struct {
+	Cfg OutboxCfg
+	Log *dlog.Logger
+
+	wakeChan chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewOutbox(cfg OutboxCfg) (*Outbox, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("outbox")
+	}
+
+	if cfg.Pg == nil {
+		return nil, fmt.Errorf("missing pg client")
+	}
+
+	if cfg.Publisher == nil {
+		return nil, fmt.Errorf("missing publisher")
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "outbox_events"
+	}
+
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = dtime.Duration(time.Second)
+	}
+
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 20
+	}
+
+	backoff := broker.BackoffCfg{}
+	if cfg.Backoff != nil {
+		backoff = *cfg.Backoff
+	}
+
+	if backoff.InitialDelay == 0 {
+		backoff.InitialDelay = dtime.Duration(time.Second)
+	}
+
+	if backoff.MaxDelay == 0 {
+		backoff.MaxDelay = dtime.Duration(time.Hour)
+	}
+
+	if backoff.Multiplier == 0 {
+		backoff.Multiplier = 2.0
+	}
+
+	cfg.Backoff = &backoff
+
+	if cfg.Retention == 0 {
+		cfg.Retention = dtime.Duration(7 * 24 * time.Hour)
+	}
+
+	o := &Outbox{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		wakeChan: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+
+	return o, nil
+}
+
+func (o *Outbox) Start() {
+	o.wg.Add(1)
+	go o.main()
+}
+
+func (o *Outbox) Stop() {
+	close(o.stopChan)
+	o.wg.Wait()
+}
+
+// Write inserts an event in the outbox. It must be called with the
+// connection of the transaction used to write business data so that the
+// event is only published if the transaction is committed.
+func (o *Outbox) Write(conn pg.Conn, subject string, data []byte, header broker.Header) (*Event, error) {
+	e := Event{
+		Id:      ksuid.Generate().String(),
+		Subject: subject,
+		Data:    data,
+		Header:  header,
+	}
+
+	var headerData []byte
+	if len(header) > 0 {
+		var err error
+		headerData, err = json.Marshal(header)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode header: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf(`
+INSERT INTO %s (id, subject, data, header)
+  VALUES ($1, $2, $3, $4)
+  RETURNING creation_time
+`, o.Cfg.Table)
+
+	err := conn.QueryRow(context.Background(), query, e.Id, e.Subject, e.Data,
+		headerData).Scan(&e.CreationTime)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert event: %w", err)
+	}
+
+	return &e, nil
+}
+
+// WriteJSON encodes a value and inserts it in the outbox.
+func (o *Outbox) WriteJSON(conn pg.Conn, subject string, value interface{}, header broker.Header) (*Event, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode value: %w", err)
+	}
+
+	return o.Write(conn, subject, data, header)
+}
+
+// Notify wakes up the publishing goroutine; it can be called after a
+// transaction writing events has been committed to avoid waiting for the
+// next poll.
+func (o *Outbox) Notify() {
+	select {
+	case o.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) main() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(o.Cfg.PollInterval.Duration())
+	defer ticker.Stop()
+
+	cleanupTicker := time.NewTicker(time.Hour)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-o.stopChan:
+			return
+
+		case <-ticker.C:
+		case <-o.wakeChan:
+
+		case <-cleanupTicker.C:
+			if err := o.deleteSentEvents(); err != nil {
+				o.Log.Error("cannot delete sent events: %v", err)
+			}
+
+			continue
+		}
+
+		for {
+			n, err := o.processEvents()
+			if err != nil {
+				o.Log.Error("cannot process events: %v", err)
+				break
+			}
+
+			if n < o.Cfg.BatchSize {
+				break
+			}
+
+			select {
+			case <-o.stopChan:
+				return
+			default:
+			}
+		}
+	}
+}
+
+func (o *Outbox) processEvents() (int, error) {
+	var events Events
+
+	err := o.Cfg.Pg.WithTx(func(conn pg.Conn) error {
+		query := fmt.Sprintf(`
+SELECT id, creation_time, subject, data, COALESCE(header, '{}'::JSONB),
+       nb_attempts
+  FROM %s
+  WHERE sent_time IS NULL
+    AND next_attempt_time <= (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+  ORDER BY creation_time
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+`, o.Cfg.Table)
+
+		err := pg.QueryObjects(conn, &events, query, o.Cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("cannot load events: %w", err)
+		}
+
+		for _, e := range events {
+			if err := o.publishEvent(conn, e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+func (o *Outbox) publishEvent(conn pg.Conn, e *Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	publishErr := o.Cfg.Publisher.Publish(ctx, e)
+	if publishErr == nil {
+		query := fmt.Sprintf(`
+UPDATE %s
+  SET sent_time = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'),
+      nb_attempts = nb_attempts + 1,
+      last_error = NULL
+  WHERE id = $1
+`, o.Cfg.Table)
+
+		if err := pg.Exec(conn, query, e.Id); err != nil {
+			return fmt.Errorf("cannot update event %s: %w", e.Id, err)
+		}
+
+		return nil
+	}
+
+	nbAttempts := e.NbAttempts + 1
+
+	// Events which cannot be sent anymore are kept with a null next attempt
+	// time so that they can be inspected and retried manually.
+	var nextAttemptTime *time.Time
+	if nbAttempts < o.Cfg.MaxAttempts {
+		t := time.Now().UTC().Add(o.Cfg.Backoff.Delay(nbAttempts))
+		nextAttemptTime = &t
+
+		o.Log.Error("cannot publish event %s (attempt %d/%d): %v",
+			e.Id, nbAttempts, o.Cfg.MaxAttempts, publishErr)
+	} else {
+		o.Log.Error("cannot publish event %s, giving up after %d "+
+			"attempts: %v", e.Id, nbAttempts, publishErr)
+	}
+
+	query := fmt.Sprintf(`
+UPDATE %s
+  SET nb_attempts = $2,
+      next_attempt_time = $3,
+      last_error = $4
+  WHERE id = $1
+`, o.Cfg.Table)
+
+	err := pg.Exec(conn, query, e.Id, nbAttempts, nextAttemptTime,
+		publishErr.Error())
+	if err != nil {
+		return fmt.Errorf("cannot update event %s: %w", e.Id, err)
+	}
+
+	return nil
+}
+
+// Retry schedules an event which could not be published for immediate
+// publication.
+func (o *Outbox) Retry(id string) error {
+	return o.Cfg.Pg.WithConn(func(conn pg.Conn) error {
+		query := fmt.Sprintf(`
+UPDATE %s
+  SET nb_attempts = 0,
+      next_attempt_time = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+  WHERE id = $1 AND sent_time IS NULL
+`, o.Cfg.Table)
+
+		n, err := pg.Exec2(conn, query, id)
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return ErrEventNotFound
+		}
+
+		return nil
+	})
+}
+
+var ErrEventNotFound = errors.New("event not found")
+
+func (o *Outbox) deleteSentEvents() error {
+	return o.Cfg.Pg.WithConn(func(conn pg.Conn) error {
+		query := fmt.Sprintf(`
+DELETE FROM %s
+  WHERE sent_time < (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') - $1::INTERVAL
+`, o.Cfg.Table)
+
+		retention := fmt.Sprintf("%d seconds",
+			int64(o.Cfg.Retention.Duration().Seconds()))
+
+		return pg.Exec(conn, query, retention)
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doutbox
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/broker"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/pg/pgtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxWrite(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn := pgtest.NewConn()
+
+	now := time.Now().UTC()
+
+	conn.Expect(`INSERT INTO outbox_events (id, subject, data, header)
+  VALUES ($1, $2, $3, $4) RETURNING creation_time`).
+		ReturnRows([]string{"creation_time"}, []interface{}{now})
+
+	outbox := &Outbox{Cfg: OutboxCfg{Table: "outbox_events"}}
+
+	e, err := outbox.WriteJSON(conn, "users.created", map[string]int{"id": 1},
+		nil)
+	require.NoError(err)
+
+	assert.NotEmpty(e.Id)
+	assert.Equal(now, e.CreationTime)
+	assert.Equal(`{"id":1}`, string(e.Data))
+
+	assert.NoError(conn.ExpectationsWereMet())
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var req *http.Request
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			req = r
+			body, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	client, err := dhttp.NewClient(dhttp.ClientCfg{})
+	require.NoError(err)
+
+	publisher := &WebhookPublisher{
+		Client: client,
+		URI:    server.URL,
+	}
+
+	e := &Event{
+		Id:      "42",
+		Subject: "users.created",
+		Data:    []byte(`{"id":1}`),
+		Header:  broker.Header{"X-Tenant": "foo"},
+	}
+
+	require.NoError(publisher.Publish(context.Background(), e))
+
+	if assert.NotNil(req) {
+		assert.Equal("42", req.Header.Get("X-Event-Id"))
+		assert.Equal("users.created", req.Header.Get("X-Event-Subject"))
+		assert.Equal("foo", req.Header.Get("X-Tenant"))
+		assert.Equal(`{"id":1}`, string(body))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package doutbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/exograd/go-daemon/broker"
+	"github.com/exograd/go-daemon/dhttp"
+)
+
+// BrokerPublisher publishes events as broker messages using the event
+// subject. The event identifier is sent in the Outbox-Event-Id header.
+type BrokerPublisher struct {
+	Broker broker.Broker
+}
+
+func (p *BrokerPublisher) Publish(ctx context.Context, e *Event) error {
+	header := make(broker.Header)
+	for name, value := range e.Header {
+		header[name] = value
+	}
+
+	header["Outbox-Event-Id"] = e.Id
+
+	return p.Broker.Publish(ctx, e.Subject, e.Data, header)
+}
+
+// WebhookPublisher sends events in POST requests. The http client can be
+// configured to sign requests, e.g. with dhttp.HMACSigner.
+type WebhookPublisher struct {
+	Client      *dhttp.Client
+	URI         string
+	ContentType string // default: "application/json"
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, e *Event) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.URI,
+		bytes.NewReader(e.Data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	for name, value := range e.Header {
+		req.Header.Set(name, value)
+	}
+
+	req.Header.Set("X-Event-Id", e.Id)
+	req.Header.Set("X-Event-Subject", e.Subject)
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	ioutil.ReadAll(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dredis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/exograd/go-daemon/influx"
+	"github.com/go-redis/redis/v8"
+)
+
+type Mode string
+
+const (
+	ModeStandalone Mode = "standalone"
+	ModeCluster    Mode = "cluster"
+	ModeSentinel   Mode = "sentinel"
+)
+
+var ModeValues = []Mode{
+	ModeStandalone,
+	ModeCluster,
+	ModeSentinel,
+}
+
+type ClientCfg struct {
+	Log    *dlog.Logger   `json:"-"`
+	Influx *influx.Client `json:"-"`
+
+	Mode      Mode     `json:"mode,omitempty"`
+	Addresses []string `json:"addresses"`
+	Database  int      `json:"database,omitempty"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	MasterName       string `json:"master_name,omitempty"`
+	SentinelPassword string `json:"sentinel_password,omitempty"`
+
+	TLS *TLSClientCfg `json:"tls,omitempty"`
+
+	PoolSize     int `json:"pool_size,omitempty"`
+	MinIdleConns int `json:"min_idle_conns,omitempty"`
+
+	DialTimeout  dtime.Duration `json:"dial_timeout,omitempty"`
+	ReadTimeout  dtime.Duration `json:"read_timeout,omitempty"`
+	WriteTimeout dtime.Duration `json:"write_timeout,omitempty"`
+
+	HealthCheckInterval dtime.Duration `json:"health_check_interval,omitempty"`
+}
+
+type TLSClientCfg struct {
+	CACertificates []string `json:"ca_certificates"`
+	ServerName     string   `json:"server_name,omitempty"`
+}
+
+type Client struct {
+	Cfg ClientCfg
+	Log *dlog.Logger
+
+	Client redis.UniversalClient
+
+	healthy int32
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (cfg *ClientCfg) Check(c *check.Checker) {
+	if cfg.Mode != "" {
+		c.CheckStringValue("mode", cfg.Mode, ModeValues)
+	}
+
+	c.WithChild("addresses", func() {
+		for i, address := range cfg.Addresses {
+			c.CheckStringNotEmpty(i, address)
+		}
+	})
+
+	c.CheckIntMin("database", cfg.Database, 0)
+
+	if cfg.Mode == ModeSentinel {
+		c.CheckStringNotEmpty("master_name", cfg.MasterName)
+	}
+
+	if cfg.Mode == ModeCluster && cfg.Database != 0 {
+		c.AddError("database", "invalid_database",
+			"database selection is not supported in cluster mode")
+	}
+
+	c.CheckOptionalObject("tls", cfg.TLS)
+
+	c.CheckIntMin("pool_size", cfg.PoolSize, 0)
+	c.CheckIntMin("min_idle_conns", cfg.MinIdleConns, 0)
+}
+
+func (cfg *TLSClientCfg) Check(c *check.Checker) {
+	c.WithChild("ca_certificates", func() {
+		for i, cert := range cfg.CACertificates {
+			c.CheckStringNotEmpty(i, cert)
+		}
+	})
+}
+
+func NewClient(cfg ClientCfg) (*Client, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("redis")
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = ModeStandalone
+	}
+
+	if len(cfg.Addresses) == 0 {
+		cfg.Addresses = []string{"localhost:6379"}
+	}
+
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = dtime.Duration(5 * time.Second)
+	}
+
+	if cfg.HealthCheckInterval == 0 {
+		cfg.HealthCheckInterval = dtime.Duration(10 * time.Second)
+	}
+
+	c := &Client{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		stopChan: make(chan struct{}),
+	}
+
+	var tlsCfg *tls.Config
+	if cfg.TLS != nil {
+		caCertificatePool, err := dhttp.LoadCertificates(cfg.TLS.CACertificates)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load ca certificates: %w", err)
+		}
+
+		tlsCfg = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    caCertificatePool,
+			ServerName: cfg.TLS.ServerName,
+		}
+	}
+
+	switch cfg.Mode {
+	case ModeStandalone:
+		c.Client = redis.NewClient(&redis.Options{
+			Addr:         cfg.Addresses[0],
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			DB:           cfg.Database,
+			TLSConfig:    tlsCfg,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout.Duration(),
+			ReadTimeout:  cfg.ReadTimeout.Duration(),
+			WriteTimeout: cfg.WriteTimeout.Duration(),
+		})
+
+	case ModeCluster:
+		c.Client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addresses,
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			TLSConfig:    tlsCfg,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout.Duration(),
+			ReadTimeout:  cfg.ReadTimeout.Duration(),
+			WriteTimeout: cfg.WriteTimeout.Duration(),
+		})
+
+	case ModeSentinel:
+		c.Client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addresses,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.Database,
+			TLSConfig:        tlsCfg,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+			DialTimeout:      cfg.DialTimeout.Duration(),
+			ReadTimeout:      cfg.ReadTimeout.Duration(),
+			WriteTimeout:     cfg.WriteTimeout.Duration(),
+		})
+
+	default:
+		return nil, fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+
+	cfg.Log.Info("connecting to %v", cfg.Addresses)
+
+	if err := c.Ping(context.Background()); err != nil {
+		c.Client.Close()
+		return nil, fmt.Errorf("cannot connect to redis: %w", err)
+	}
+
+	atomic.StoreInt32(&c.healthy, 1)
+
+	return c, nil
+}
+
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.healthCheckMain()
+}
+
+func (c *Client) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+
+	if err := c.Client.Close(); err != nil {
+		c.Log.Error("cannot close client: %v", err)
+	}
+}
+
+func (c *Client) Healthy() bool {
+	return atomic.LoadInt32(&c.healthy) == 1
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Cfg.DialTimeout.Duration())
+	defer cancel()
+
+	return c.Client.Ping(ctx).Err()
+}
+
+func (c *Client) healthCheckMain() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.Cfg.HealthCheckInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+
+		case <-ticker.C:
+			c.healthCheck()
+		}
+	}
+}
+
+func (c *Client) healthCheck() {
+	err := c.Ping(context.Background())
+
+	if err == nil {
+		if atomic.SwapInt32(&c.healthy, 1) == 0 {
+			c.Log.Info("redis is available again")
+		}
+	} else {
+		if atomic.SwapInt32(&c.healthy, 0) == 1 {
+			c.Log.Error("redis is unavailable: %v", err)
+		}
+	}
+
+	if c.Cfg.Influx != nil {
+		c.Cfg.Influx.EnqueuePoint(c.poolStatsPoint())
+	}
+}
+
+func (c *Client) poolStatsPoint() *influx.Point {
+	stats := c.Client.PoolStats()
+
+	fields := influx.Fields{
+		"healthy":     c.Healthy(),
+		"hits":        stats.Hits,
+		"misses":      stats.Misses,
+		"timeouts":    stats.Timeouts,
+		"total_conns": stats.TotalConns,
+		"idle_conns":  stats.IdleConns,
+		"stale_conns": stats.StaleConns,
+	}
+
+	return influx.NewPoint("redis_pool", influx.Tags{}, fields)
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dredis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A minimal server supporting the subset of the RESP2 protocol and of the
+// commands used by tests.
+type testServer struct {
+	listener net.Listener
+
+	values map[string]string
+	conns  map[net.Conn]struct{}
+	mutex  sync.Mutex
+}
+
+func newTestServer(t *testing.T) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &testServer{
+		listener: listener,
+
+		values: make(map[string]string),
+		conns:  make(map[net.Conn]struct{}),
+	}
+
+	go s.main()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+}
+
+func (s *testServer) main() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readTestCommand(r)
+		if err != nil {
+			return
+		}
+
+		if _, err := io.WriteString(conn, s.execute(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *testServer) execute(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch strings.ToLower(args[0]) {
+	case "ping":
+		return "+PONG\r\n"
+
+	case "get":
+		value, found := s.values[args[1]]
+		if !found {
+			return "$-1\r\n"
+		}
+
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+
+	case "set":
+		s.values[args[1]] = args[2]
+		return "+OK\r\n"
+
+	case "del":
+		n := 0
+		for _, key := range args[1:] {
+			if _, found := s.values[key]; found {
+				delete(s.values, key)
+				n++
+			}
+		}
+
+		return fmt.Sprintf(":%d\r\n", n)
+
+	case "incr":
+		i, _ := strconv.ParseInt(s.values[args[1]], 10, 64)
+		i++
+		s.values[args[1]] = strconv.FormatInt(i, 10)
+
+		return fmt.Sprintf(":%d\r\n", i)
+
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func readTestCommand(r *bufio.Reader) ([]string, error) {
+	readLine := func(prefix byte) (int, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+
+		line = strings.TrimSuffix(line, "\r\n")
+		if len(line) == 0 || line[0] != prefix {
+			return 0, fmt.Errorf("invalid line %q", line)
+		}
+
+		return strconv.Atoi(line[1:])
+	}
+
+	nbArgs, err := readLine('*')
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, nbArgs)
+
+	for i := range args {
+		size, err := readLine('$')
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(data[:size])
+	}
+
+	return args, nil
+}
+
+func newTestClient(t *testing.T, s *testServer) *Client {
+	client, err := NewClient(ClientCfg{
+		Addresses:   []string{s.Address()},
+		DialTimeout: dtime.Duration(time.Second),
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { client.Client.Close() })
+
+	return client
+}
+
+func TestClientCfg(t *testing.T) {
+	assert := assert.New(t)
+
+	checkCfg := func(cfg ClientCfg) error {
+		c := check.NewChecker()
+		cfg.Check(c)
+		return c.Error()
+	}
+
+	assert.NoError(checkCfg(ClientCfg{
+		Addresses: []string{"localhost:6379"},
+	}))
+
+	assert.Error(checkCfg(ClientCfg{
+		Mode:      "foo",
+		Addresses: []string{"localhost:6379"},
+	}))
+
+	assert.Error(checkCfg(ClientCfg{
+		Mode:      ModeSentinel,
+		Addresses: []string{"localhost:26379"},
+	}))
+
+	assert.Error(checkCfg(ClientCfg{
+		Mode:      ModeCluster,
+		Addresses: []string{"localhost:6379"},
+		Database:  1,
+	}))
+
+	assert.Error(checkCfg(ClientCfg{
+		Addresses: []string{""},
+	}))
+}
+
+func TestClientCommands(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := newTestClient(t, newTestServer(t))
+
+	ctx := context.Background()
+
+	_, found, err := client.Get(ctx, "a")
+	require.NoError(err)
+	assert.False(found)
+
+	require.NoError(client.Set(ctx, "a", "foo", 0))
+
+	value, found, err := client.Get(ctx, "a")
+	require.NoError(err)
+	assert.True(found)
+	assert.Equal("foo", value)
+
+	type testValue struct {
+		A int    `json:"a"`
+		B string `json:"b"`
+	}
+
+	require.NoError(client.SetJSON(ctx, "b", testValue{A: 42, B: "bar"}, 0))
+
+	var v testValue
+	found, err = client.GetJSON(ctx, "b", &v)
+	require.NoError(err)
+	assert.True(found)
+	assert.Equal(testValue{A: 42, B: "bar"}, v)
+
+	found, err = client.GetJSON(ctx, "c", &v)
+	require.NoError(err)
+	assert.False(found)
+
+	require.NoError(client.Set(ctx, "d", "{", 0))
+	_, err = client.GetJSON(ctx, "d", &v)
+	assert.Error(err)
+
+	n, err := client.Incr(ctx, "e")
+	require.NoError(err)
+	assert.Equal(int64(1), n)
+
+	n, err = client.Incr(ctx, "e")
+	require.NoError(err)
+	assert.Equal(int64(2), n)
+
+	n, err = client.Delete(ctx, "a", "b", "c")
+	require.NoError(err)
+	assert.Equal(int64(2), n)
+
+	_, found, err = client.Get(ctx, "a")
+	require.NoError(err)
+	assert.False(found)
+}
+
+func TestClientHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestServer(t)
+	client := newTestClient(t, s)
+
+	assert.True(client.Healthy())
+
+	client.healthCheck()
+	assert.True(client.Healthy())
+
+	s.Close()
+
+	client.healthCheck()
+	assert.False(client.Healthy())
+}
+
+func TestClientConnectionError(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestServer(t)
+	s.Close()
+
+	_, err := NewClient(ClientCfg{
+		Addresses:   []string{s.Address()},
+		DialTimeout: dtime.Duration(time.Second),
+	})
+	assert.Error(err)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dredis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := c.Client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Set stores a value; a zero ttl means that the key does not expire.
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.Client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *Client) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return c.Client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (c *Client) GetJSON(ctx context.Context, key string, dest interface{}) (bool, error) {
+	data, found, err := c.Get(ctx, key)
+	if err != nil || !found {
+		return false, err
+	}
+
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return false, fmt.Errorf("cannot decode value: %w", err)
+	}
+
+	return true, nil
+}
+
+func (c *Client) SetJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode value: %w", err)
+	}
+
+	return c.Set(ctx, key, string(data), ttl)
+}
+
+func (c *Client) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return c.Client.Del(ctx, keys...).Result()
+}
+
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return c.Client.Incr(ctx, key).Result()
+}
+
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.Client.Expire(ctx, key, ttl).Result()
+}
+
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.Client.TTL(ctx, key).Result()
+}
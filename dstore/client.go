@@ -0,0 +1,369 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dstore
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ClientCfg struct {
+	Log        *dlog.Logger  `json:"-"`
+	HTTPClient *dhttp.Client `json:"-"`
+
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+
+	// Use path-style URIs (https://endpoint/bucket/key) instead of
+	// virtual-hosted style URIs (https://bucket.endpoint/key). Usually
+	// required for S3-compatible servers such as MinIO.
+	PathStyle bool `json:"path_style"`
+
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+
+	TLS *dhttp.TLSClientCfg `json:"tls,omitempty"`
+
+	MaxRetries  int  `json:"max_retries,omitempty"`
+	LogRequests bool `json:"log_requests"`
+}
+
+type Client struct {
+	Cfg        ClientCfg
+	Log        *dlog.Logger
+	HTTPClient *dhttp.Client
+
+	endpoint *url.URL
+	signer   *dhttp.AWSSigV4Signer
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+type APIError struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (err *APIError) Error() string {
+	if err.Code == "" {
+		return fmt.Sprintf("request failed with status %d", err.Status)
+	}
+
+	return fmt.Sprintf("request failed with status %d: %s: %s",
+		err.Status, err.Code, err.Message)
+}
+
+func (cfg *ClientCfg) Check(c *check.Checker) {
+	c.CheckStringURI("endpoint", cfg.Endpoint)
+	c.CheckStringNotEmpty("bucket", cfg.Bucket)
+	c.CheckStringNotEmpty("access_key_id", cfg.AccessKeyId)
+	c.CheckStringNotEmpty("secret_access_key", cfg.SecretAccessKey)
+	c.CheckOptionalObject("tls", cfg.TLS)
+	c.CheckIntMin("max_retries", cfg.MaxRetries, 0)
+}
+
+func (cfg *ClientCfg) newSigner() *dhttp.AWSSigV4Signer {
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &dhttp.AWSSigV4Signer{
+		AccessKeyId:     cfg.AccessKeyId,
+		SecretAccessKey: cfg.SecretAccessKey,
+		SessionToken:    cfg.SessionToken,
+
+		Region:  region,
+		Service: "s3",
+
+		UnsignedPayload: true,
+	}
+}
+
+func HTTPClientCfg(cfg *ClientCfg) dhttp.ClientCfg {
+	return dhttp.ClientCfg{
+		LogRequests: cfg.LogRequests,
+		TLS:         cfg.TLS,
+		Signer:      cfg.newSigner(),
+	}
+}
+
+func NewClient(cfg ClientCfg) (*Client, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("dstore")
+	}
+
+	if cfg.HTTPClient == nil {
+		return nil, fmt.Errorf("missing http client")
+	}
+
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("missing or empty endpoint")
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("missing or empty bucket")
+	}
+
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+
+	c := &Client{
+		Cfg:        cfg,
+		Log:        cfg.Log,
+		HTTPClient: cfg.HTTPClient,
+
+		endpoint: endpoint,
+		signer:   cfg.newSigner(),
+	}
+
+	return c, nil
+}
+
+func (c *Client) ObjectURI(key string) *url.URL {
+	uri := *c.endpoint
+
+	var segments []string
+
+	if c.Cfg.PathStyle {
+		segments = append(segments, c.Cfg.Bucket)
+	} else {
+		uri.Host = c.Cfg.Bucket + "." + uri.Host
+	}
+
+	segments = append(segments, strings.Split(key, "/")...)
+
+	encodedSegments := make([]string, len(segments))
+	for i, segment := range segments {
+		encodedSegments[i] = uriEncode(segment)
+	}
+
+	uri.Path = strings.TrimSuffix(uri.Path, "/") + "/" +
+		strings.Join(segments, "/")
+	uri.RawPath = strings.TrimSuffix(c.endpoint.EscapedPath(), "/") + "/" +
+		strings.Join(encodedSegments, "/")
+
+	return &uri
+}
+
+// Upload stores an object. The size of the body must be known in advance.
+// If the body implements io.Seeker, the request is retried on failure.
+func (c *Client) Upload(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	seeker, retryable := body.(io.Seeker)
+
+	newBody := func() (io.Reader, error) {
+		if seeker != nil {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("cannot rewind body: %w", err)
+			}
+		}
+
+		return body, nil
+	}
+
+	res, err := c.sendRequest(ctx, "PUT", key, header, newBody, size,
+		retryable)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// Download returns the content of an object; the caller must close it.
+func (c *Client) Download(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	res, err := c.sendRequest(ctx, "GET", key, nil, nil, 0, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res.Body, objectInfo(key, res), nil
+}
+
+func (c *Client) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	res, err := c.sendRequest(ctx, "HEAD", key, nil, nil, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return objectInfo(key, res), nil
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	res, err := c.sendRequest(ctx, "DELETE", key, nil, nil, 0, true)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+func (c *Client) PresignDownloadURI(key string, expiration time.Duration) *url.URL {
+	return c.signer.PresignURL("GET", c.ObjectURI(key), expiration)
+}
+
+func (c *Client) PresignUploadURI(key string, expiration time.Duration) *url.URL {
+	return c.signer.PresignURL("PUT", c.ObjectURI(key), expiration)
+}
+
+func (c *Client) sendRequest(ctx context.Context, method, key string, header http.Header, newBody func() (io.Reader, error), size int64, retryable bool) (*http.Response, error) {
+	uri := c.ObjectURI(key)
+
+	var lastErr error
+
+	for attempt := 0; attempt <= c.Cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(100<<(attempt-1)) * time.Millisecond
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		var body io.Reader
+		if newBody != nil {
+			var err error
+			if body, err = newBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, uri.String(),
+			body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create request: %w", err)
+		}
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		if body != nil {
+			req.ContentLength = size
+		}
+
+		res, err := c.HTTPClient.Do(req)
+		if err != nil {
+			lastErr = err
+		} else if res.StatusCode >= 200 && res.StatusCode < 300 {
+			return res, nil
+		} else {
+			lastErr = responseError(res)
+
+			if res.StatusCode < 500 && res.StatusCode != 429 {
+				return nil, lastErr
+			}
+		}
+
+		if !retryable || ctx.Err() != nil {
+			break
+		}
+
+		c.Log.Error("cannot send %s request for %q (attempt %d): %v",
+			method, key, attempt+1, lastErr)
+	}
+
+	return nil, lastErr
+}
+
+func responseError(res *http.Response) error {
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return ErrObjectNotFound
+	}
+
+	apiErr := APIError{Status: res.StatusCode}
+
+	if data, err := ioutil.ReadAll(res.Body); err == nil && len(data) > 0 {
+		xml.Unmarshal(data, &apiErr)
+	}
+
+	return &apiErr
+}
+
+func objectInfo(key string, res *http.Response) *ObjectInfo {
+	info := ObjectInfo{
+		Key:         key,
+		ContentType: res.Header.Get("Content-Type"),
+		ETag:        strings.Trim(res.Header.Get("ETag"), `"`),
+	}
+
+	if size, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+
+	return &info
+}
+
+func uriEncode(s string) string {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') ||
+			(c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	sync.Mutex
+
+	objects  map[string][]byte
+	failures int
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(403)
+		return
+	}
+
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(503)
+		return
+	}
+
+	key := req.URL.Path
+
+	switch req.Method {
+	case "PUT":
+		data, _ := ioutil.ReadAll(req.Body)
+		s.objects[key] = data
+	case "GET", "HEAD":
+		data, found := s.objects[key]
+		if !found {
+			w.WriteHeader(404)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write(data)
+	case "DELETE":
+		delete(s.objects, key)
+		w.WriteHeader(204)
+	default:
+		w.WriteHeader(405)
+		w.Write([]byte(`<Error><Code>MethodNotAllowed</Code>` +
+			`<Message>method not allowed</Message></Error>`))
+	}
+}
+
+func newTestClient(t *testing.T, server *testServer) *Client {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	cfg := ClientCfg{
+		Endpoint:        httpServer.URL,
+		Bucket:          "test",
+		PathStyle:       true,
+		AccessKeyId:     "key",
+		SecretAccessKey: "secret",
+	}
+
+	httpClient, err := dhttp.NewClient(HTTPClientCfg(&cfg))
+	require.NoError(t, err)
+
+	cfg.HTTPClient = httpClient
+
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := &testServer{objects: make(map[string][]byte)}
+	client := newTestClient(t, server)
+
+	ctx := context.Background()
+	data := []byte("hello world")
+
+	server.failures = 2
+	err := client.Upload(ctx, "a/b c.txt", bytes.NewReader(data),
+		int64(len(data)), "text/plain")
+	require.NoError(err)
+	assert.Contains(server.objects, "/test/a/b c.txt")
+
+	body, info, err := client.Download(ctx, "a/b c.txt")
+	require.NoError(err)
+	content, err := ioutil.ReadAll(body)
+	body.Close()
+	require.NoError(err)
+	assert.Equal(data, content)
+	assert.Equal("abc", info.ETag)
+	assert.Equal(int64(len(data)), info.Size)
+
+	require.NoError(client.Delete(ctx, "a/b c.txt"))
+
+	_, err = client.Stat(ctx, "a/b c.txt")
+	assert.True(errors.Is(err, ErrObjectNotFound))
+}
+
+func TestClientObjectURI(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &Client{Cfg: ClientCfg{Bucket: "test"}}
+	client.endpoint, _ = url.Parse("https://s3.example.com")
+
+	assert.Equal("https://test.s3.example.com/a/b%20c%2B.txt",
+		client.ObjectURI("a/b c+.txt").String())
+
+	client.Cfg.PathStyle = true
+	assert.Equal("https://s3.example.com/test/a/b%20c%2B.txt",
+		client.ObjectURI("a/b c+.txt").String())
+}
+
+func TestClientPresignURI(t *testing.T) {
+	assert := assert.New(t)
+
+	server := &testServer{objects: make(map[string][]byte)}
+	client := newTestClient(t, server)
+
+	uri := client.PresignDownloadURI("foo", time.Hour)
+
+	query := uri.Query()
+	assert.Equal("3600", query.Get("X-Amz-Expires"))
+	assert.NotEmpty(query.Get("X-Amz-Signature"))
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dtime
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const DateLayout = "2006-01-02"
+
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return DateOf(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{Year: year, Month: month, Day: day}
+}
+
+func Today() Date {
+	return DateOf(time.Now().UTC())
+}
+
+func (d *Date) Parse(s string) error {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return fmt.Errorf("invalid date %q", s)
+	}
+
+	*d = DateOf(t)
+	return nil
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+func (d Date) Time(location *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, location)
+}
+
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+func (d Date) AddDays(n int) Date {
+	return DateOf(d.Time(time.UTC).AddDate(0, 0, n))
+}
+
+func (d Date) Before(d2 Date) bool {
+	return d.Time(time.UTC).Before(d2.Time(time.UTC))
+}
+
+func (d Date) After(d2 Date) bool {
+	return d.Time(time.UTC).After(d2.Time(time.UTC))
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid date: value must be a string")
+	}
+
+	return d.Parse(s)
+}
+
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+
+	case time.Time:
+		*d = DateOf(v)
+		return nil
+
+	case string:
+		return d.Parse(v)
+
+	case []byte:
+		return d.Parse(string(v))
+
+	default:
+		return fmt.Errorf("invalid value of type %T", v)
+	}
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDate(t *testing.T) {
+	assert := assert.New(t)
+
+	var d Date
+	if assert.NoError(d.Parse("2022-02-28")) {
+		assert.Equal(NewDate(2022, 2, 28), d)
+		assert.Equal("2022-02-28", d.String())
+		assert.Equal(NewDate(2022, 3, 1), d.AddDays(1))
+		assert.True(d.Before(d.AddDays(1)))
+	}
+
+	assert.Error(d.Parse(""))
+	assert.Error(d.Parse("2022-02-30"))
+	assert.Error(d.Parse("2022-02-28T10:00:00Z"))
+
+	data, err := json.Marshal(NewDate(2022, 1, 5))
+	if assert.NoError(err) {
+		assert.Equal(`"2022-01-05"`, string(data))
+	}
+
+	if assert.NoError(d.Scan(time.Date(2022, 1, 5, 10, 0, 0, 0, time.UTC))) {
+		assert.Equal(NewDate(2022, 1, 5), d)
+	}
+}
+
+func TestTimestampMilli(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := NewTimestampMilli(time.Date(2022, 1, 5, 10, 20, 30, 123456789,
+		time.UTC))
+
+	data, err := json.Marshal(ts)
+	if assert.NoError(err) {
+		assert.Equal(`"2022-01-05T10:20:30.123Z"`, string(data))
+	}
+
+	var ts2 TimestampMilli
+	err = json.Unmarshal([]byte(`"2022-01-05T11:20:30.123999+01:00"`), &ts2)
+	if assert.NoError(err) {
+		assert.True(ts.Time().Equal(ts2.Time()))
+	}
+}
+
+func TestInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	date := func(day int) time.Time {
+		return time.Date(2022, 1, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	i1 := NewInterval(date(1), date(10))
+	i2 := NewInterval(date(5), date(15))
+	i3 := NewInterval(date(10), date(20))
+
+	assert.True(i1.Overlaps(i2))
+	assert.False(i1.Overlaps(i3))
+	assert.True(i1.Contains(date(1)))
+	assert.False(i1.Contains(date(10)))
+
+	i, ok := i1.Intersection(i2)
+	if assert.True(ok) {
+		assert.Equal(NewInterval(date(5), date(10)), i)
+	}
+
+	value, err := i1.Value()
+	if assert.NoError(err) {
+		var i4 Interval
+		if assert.NoError(i4.Scan(value)) {
+			assert.Equal(i1, i4)
+		}
+	}
+
+	var i5 Interval
+	err = i5.Scan(`["2022-01-01 00:00:00+00","2022-01-10 00:00:00+00")`)
+	if assert.NoError(err) {
+		assert.True(i5.Start.Equal(date(1)))
+		assert.True(i5.End.Equal(date(10)))
+	}
+}
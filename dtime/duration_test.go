@@ -0,0 +1,55 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		s string
+		d time.Duration
+	}{
+		{`"0s"`, 0},
+		{`"30s"`, 30 * time.Second},
+		{`"5m"`, 5 * time.Minute},
+		{`"2h30m"`, 2*time.Hour + 30*time.Minute},
+		{`"150ms"`, 150 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		var d Duration
+		if assert.NoError(json.Unmarshal([]byte(test.s), &d), test.s) {
+			assert.Equal(test.d, d.Duration(), test.s)
+		}
+	}
+
+	for _, s := range []string{`""`, `"foo"`, `"10"`, `30`, `null`} {
+		var d Duration
+		assert.Error(json.Unmarshal([]byte(s), &d), s)
+	}
+
+	data, err := json.Marshal(Duration(90 * time.Second))
+	if assert.NoError(err) {
+		assert.Equal(`"1m30s"`, string(data))
+	}
+}
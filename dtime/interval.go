@@ -0,0 +1,144 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dtime
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+)
+
+// Interval is a half-open time interval including its start and excluding
+// its end. It is stored in PostgreSQL as a tstzrange value.
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func NewInterval(start, end time.Time) Interval {
+	return Interval{Start: start, End: end}
+}
+
+func (i *Interval) Check(c *check.Checker) {
+	c.Check("end", !i.End.Before(i.Start), "invalid_interval",
+		"interval end must be greater or equal to interval start")
+}
+
+func (i Interval) String() string {
+	return "[" + i.Start.Format(time.RFC3339Nano) + ", " +
+		i.End.Format(time.RFC3339Nano) + ")"
+}
+
+func (i Interval) Duration() time.Duration {
+	return i.End.Sub(i.Start)
+}
+
+func (i Interval) IsEmpty() bool {
+	return !i.End.After(i.Start)
+}
+
+func (i Interval) Contains(t time.Time) bool {
+	return !t.Before(i.Start) && t.Before(i.End)
+}
+
+func (i Interval) Overlaps(i2 Interval) bool {
+	return i.Start.Before(i2.End) && i2.Start.Before(i.End)
+}
+
+func (i Interval) Intersection(i2 Interval) (Interval, bool) {
+	if !i.Overlaps(i2) {
+		return Interval{}, false
+	}
+
+	start := i.Start
+	if i2.Start.After(start) {
+		start = i2.Start
+	}
+
+	end := i.End
+	if i2.End.Before(end) {
+		end = i2.End
+	}
+
+	return Interval{Start: start, End: end}, true
+}
+
+func (i *Interval) Scan(src interface{}) error {
+	var s string
+
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("invalid value of type %T", v)
+	}
+
+	return i.parseRange(s)
+}
+
+func (i *Interval) parseRange(s string) error {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ')' {
+		return fmt.Errorf("invalid range %q", s)
+	}
+
+	parts := strings.Split(s[1:len(s)-1], ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid range %q", s)
+	}
+
+	var bounds [2]time.Time
+
+	for j, part := range parts {
+		part = strings.Trim(strings.TrimSpace(part), `"`)
+
+		t, err := parseRangeBound(part)
+		if err != nil {
+			return fmt.Errorf("invalid range %q: %w", s, err)
+		}
+
+		bounds[j] = t
+	}
+
+	i.Start = bounds[0]
+	i.End = bounds[1]
+
+	return nil
+}
+
+func parseRangeBound(s string) (time.Time, error) {
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z07",
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+func (i Interval) Value() (driver.Value, error) {
+	return "[" + i.Start.Format(time.RFC3339Nano) + "," +
+		i.End.Format(time.RFC3339Nano) + ")", nil
+}
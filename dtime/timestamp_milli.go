@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package dtime
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const TimestampMilliLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// TimestampMilli is a UTC timestamp truncated to the millisecond, represented
+// in JSON documents as a RFC 3339 string with exactly three fractional
+// digits.
+type TimestampMilli time.Time
+
+func NewTimestampMilli(t time.Time) TimestampMilli {
+	return TimestampMilli(t.UTC().Truncate(time.Millisecond))
+}
+
+func NowMilli() TimestampMilli {
+	return NewTimestampMilli(time.Now())
+}
+
+func (t TimestampMilli) Time() time.Time {
+	return time.Time(t)
+}
+
+func (t TimestampMilli) String() string {
+	return time.Time(t).Format(TimestampMilliLayout)
+}
+
+func (t *TimestampMilli) Parse(s string) error {
+	t2, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	*t = NewTimestampMilli(t2)
+	return nil
+}
+
+func (t TimestampMilli) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *TimestampMilli) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid timestamp: value must be a string")
+	}
+
+	return t.Parse(s)
+}
+
+func (t *TimestampMilli) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = TimestampMilli{}
+		return nil
+
+	case time.Time:
+		*t = NewTimestampMilli(v)
+		return nil
+
+	default:
+		return fmt.Errorf("invalid value of type %T", v)
+	}
+}
+
+func (t TimestampMilli) Value() (driver.Value, error) {
+	return time.Time(t), nil
+}
@@ -16,27 +16,81 @@ package influx
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/derr"
 	"github.com/exograd/go-daemon/dhttp"
 	"github.com/exograd/go-daemon/dlog"
 )
 
+type APIVersion string
+
+const (
+	APIVersionAuto APIVersion = "auto"
+	APIVersion1    APIVersion = "v1"
+	APIVersion2    APIVersion = "v2"
+)
+
+var APIVersionValues = []APIVersion{
+	APIVersionAuto,
+	APIVersion1,
+	APIVersion2,
+}
+
+type OverflowPolicy string
+
+const (
+	OverflowPolicyDropOldest OverflowPolicy = "drop-oldest"
+	OverflowPolicyDropNewest OverflowPolicy = "drop-newest"
+	OverflowPolicyBlock      OverflowPolicy = "block"
+)
+
+var OverflowPolicyValues = []OverflowPolicy{
+	OverflowPolicyDropOldest,
+	OverflowPolicyDropNewest,
+	OverflowPolicyBlock,
+}
+
 type ClientCfg struct {
 	Log        *dlog.Logger  `json:"-"`
 	HTTPClient *dhttp.Client `json:"-"`
 	Hostname   string        `json:"-"`
 
-	URI         string            `json:"uri"`
-	Bucket      string            `json:"bucket"`
-	Org         string            `json:"org"`
+	URI        string     `json:"uri"`
+	APIVersion APIVersion `json:"api_version,omitempty"`
+
+	// InfluxDB 2.x
+	Bucket string `json:"bucket"`
+	Org    string `json:"org"`
+
+	// InfluxDB 1.x and compatible backends; the database defaults to the
+	// bucket. If only the database is set, the api version defaults to v1.
+	Database        string `json:"database,omitempty"`
+	RetentionPolicy string `json:"retention_policy,omitempty"`
+
+	// The precision of timestamps; default: ns
+	Precision Precision `json:"precision,omitempty"`
+
+	InvalidPointPolicy InvalidPointPolicy `json:"invalid_point_policy,omitempty"`
+	MaxTagLength       int                `json:"max_tag_length,omitempty"`
+
+	// The maximum number of points kept in memory while they cannot be
+	// sent; default: 10 times the batch size. With the block policy,
+	// EnqueuePoints blocks until points can be buffered. Points are flushed
+	// as soon as the buffer is full if it is smaller than the batch size.
+	MaxBufferedPoints int            `json:"max_buffered_points,omitempty"`
+	OverflowPolicy    OverflowPolicy `json:"overflow_policy,omitempty"`
+
 	BatchSize   int               `json:"batch_size"`
 	Tags        map[string]string `json:"tags"`
 	LogRequests bool              `json:"log_requests"`
@@ -46,12 +100,47 @@ func (cfg *ClientCfg) Check(c *check.Checker) {
 	// The organization is optional (it is only used for InfluxDB 2.x)
 
 	c.CheckStringURI("uri", cfg.URI)
-	c.CheckStringNotEmpty("bucket", cfg.Bucket)
+
+	if cfg.APIVersion != "" {
+		c.CheckStringValue("api_version", cfg.APIVersion, APIVersionValues)
+	}
+
+	if cfg.Database == "" || cfg.APIVersion == APIVersion2 {
+		c.CheckStringNotEmpty("bucket", cfg.Bucket)
+	}
+
+	if cfg.Precision != "" {
+		c.CheckStringValue("precision", cfg.Precision, PrecisionValues)
+	}
+
+	if cfg.InvalidPointPolicy != "" {
+		c.CheckStringValue("invalid_point_policy", cfg.InvalidPointPolicy,
+			InvalidPointPolicyValues)
+	}
+
+	if cfg.MaxTagLength != 0 {
+		c.CheckIntMin("max_tag_length", cfg.MaxTagLength, 1)
+	}
+
+	if cfg.MaxBufferedPoints != 0 {
+		c.CheckIntMin("max_buffered_points", cfg.MaxBufferedPoints, 1)
+	}
+
+	if cfg.OverflowPolicy != "" {
+		c.CheckStringValue("overflow_policy", cfg.OverflowPolicy,
+			OverflowPolicyValues)
+	}
 
 	if cfg.BatchSize != 0 {
 		c.CheckIntMin("batch_size", cfg.BatchSize, 1)
 	}
 
+	if cfg.MaxBufferedPoints != 0 && cfg.BatchSize != 0 {
+		c.Check("max_buffered_points", cfg.MaxBufferedPoints >= cfg.BatchSize,
+			"invalid_value", "maximum number of buffered points must be "+
+				"greater or equal to batch size")
+	}
+
 	c.WithChild("tags", func() {
 		for name, value := range cfg.Tags {
 			c.CheckStringNotEmpty(name, value)
@@ -70,12 +159,17 @@ type Client struct {
 	Log        *dlog.Logger
 	HTTPClient *dhttp.Client
 
-	uri  *url.URL
-	tags map[string]string
+	uri        *url.URL
+	tags       map[string]string
+	apiVersion APIVersion
 
 	pointsChan chan Points
 	points     Points
 
+	nbDroppedPoints    int64
+	nbOverflowedPoints int64
+	nbBufferedPoints   int64
+
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 }
@@ -97,7 +191,24 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 		return nil, fmt.Errorf("invalid uri: %w", err)
 	}
 
+	if cfg.APIVersion == "" {
+		// A database without bucket or organization is a 1.x setup
+		if cfg.Database != "" && cfg.Bucket == "" && cfg.Org == "" {
+			cfg.APIVersion = APIVersion1
+		} else {
+			cfg.APIVersion = APIVersion2
+		}
+	}
+
+	if cfg.Database == "" {
+		cfg.Database = cfg.Bucket
+	}
+
 	if cfg.Bucket == "" {
+		cfg.Bucket = cfg.Database
+	}
+
+	if cfg.Bucket == "" && cfg.Database == "" {
 		return nil, fmt.Errorf("missing or empty bucket")
 	}
 
@@ -105,6 +216,22 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 		cfg.BatchSize = 10_000
 	}
 
+	if cfg.InvalidPointPolicy == "" {
+		cfg.InvalidPointPolicy = InvalidPointPolicyLog
+	}
+
+	if cfg.MaxTagLength == 0 {
+		cfg.MaxTagLength = 1024
+	}
+
+	if cfg.MaxBufferedPoints == 0 {
+		cfg.MaxBufferedPoints = 10 * cfg.BatchSize
+	}
+
+	if cfg.OverflowPolicy == "" {
+		cfg.OverflowPolicy = OverflowPolicyDropOldest
+	}
+
 	tags := make(map[string]string)
 	if cfg.Hostname != "" {
 		tags["host"] = cfg.Hostname
@@ -121,6 +248,8 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 		uri:  uri,
 		tags: tags,
 
+		apiVersion: cfg.APIVersion,
+
 		pointsChan: make(chan Points),
 
 		stopChan: make(chan struct{}),
@@ -153,12 +282,20 @@ func (c *Client) main() {
 	defer timer.Stop()
 
 	for {
+		// When the buffer is full, stop reading points so that producers
+		// block.
+		pointsChan := c.pointsChan
+		if c.Cfg.OverflowPolicy == OverflowPolicyBlock &&
+			len(c.points) >= c.Cfg.MaxBufferedPoints {
+			pointsChan = nil
+		}
+
 		select {
 		case <-c.stopChan:
 			c.flush()
 			return
 
-		case ps := <-c.pointsChan:
+		case ps := <-pointsChan:
 			c.enqueuePoints(ps)
 
 		case <-timer.C:
@@ -171,7 +308,52 @@ func (c *Client) EnqueuePoint(p *Point) {
 	c.EnqueuePoints(Points{p})
 }
 
+// EnqueuePoints queues points to be sent. Invalid points are dropped
+// according to the invalid point policy.
 func (c *Client) EnqueuePoints(points Points) {
+	validPoints := make(Points, 0, len(points))
+
+	for _, p := range points {
+		if err := ValidatePoint(p, c.Cfg.MaxTagLength); err != nil {
+			atomic.AddInt64(&c.nbDroppedPoints, 1)
+
+			if c.Cfg.InvalidPointPolicy == InvalidPointPolicyLog {
+				c.Log.Error("dropping invalid point %q: %v",
+					p.Measurement, err)
+			}
+
+			continue
+		}
+
+		validPoints = append(validPoints, p)
+	}
+
+	if len(validPoints) > 0 {
+		c.enqueueValidPoints(validPoints)
+	}
+}
+
+// TryEnqueuePoints queues points to be sent only if they are all valid;
+// otherwise it returns an error and does not queue any point.
+func (c *Client) TryEnqueuePoints(points Points) error {
+	for i, p := range points {
+		if err := ValidatePoint(p, c.Cfg.MaxTagLength); err != nil {
+			return fmt.Errorf("invalid point %d (%q): %w",
+				i, p.Measurement, err)
+		}
+	}
+
+	c.enqueueValidPoints(points)
+	return nil
+}
+
+// NbDroppedPoints returns the number of invalid points dropped since the
+// client was created.
+func (c *Client) NbDroppedPoints() int64 {
+	return atomic.LoadInt64(&c.nbDroppedPoints)
+}
+
+func (c *Client) enqueueValidPoints(points Points) {
 	// We do not want to be stuck writing on c.pointsChan if the server is
 	// stopping, so we check the stop chan.
 
@@ -190,9 +372,39 @@ func (c *Client) enqueuePoints(points Points) {
 
 	c.points = append(c.points, points...)
 
-	if len(c.points) >= c.Cfg.BatchSize {
+	if len(c.points) >= c.Cfg.BatchSize ||
+		len(c.points) >= c.Cfg.MaxBufferedPoints {
 		c.flush()
 	}
+
+	if n := len(c.points) - c.Cfg.MaxBufferedPoints; n > 0 {
+		switch c.Cfg.OverflowPolicy {
+		case OverflowPolicyDropOldest:
+			c.points = append(Points(nil), c.points[n:]...)
+			atomic.AddInt64(&c.nbOverflowedPoints, int64(n))
+
+		case OverflowPolicyDropNewest:
+			c.points = c.points[:c.Cfg.MaxBufferedPoints]
+			atomic.AddInt64(&c.nbOverflowedPoints, int64(n))
+		}
+	}
+
+	c.updateNbBufferedPoints()
+}
+
+func (c *Client) updateNbBufferedPoints() {
+	atomic.StoreInt64(&c.nbBufferedPoints, int64(len(c.points)))
+}
+
+// NbOverflowedPoints returns the number of points dropped because the
+// buffer was full since the client was created.
+func (c *Client) NbOverflowedPoints() int64 {
+	return atomic.LoadInt64(&c.nbOverflowedPoints)
+}
+
+// NbBufferedPoints returns the number of points waiting to be sent.
+func (c *Client) NbBufferedPoints() int64 {
+	return atomic.LoadInt64(&c.nbBufferedPoints)
 }
 
 func (c *Client) finalizePoint(point *Point) {
@@ -218,28 +430,156 @@ func (c *Client) flush() {
 		return
 	}
 
-	if err := c.sendPoints(c.points); err != nil {
-		c.Log.Error("cannot send points: %v", err)
-		return
+	// Points are sent in one request per bucket; points whose request
+	// failed with a retryable error are kept for the next flush.
+	var buckets []string
+	bucketPoints := make(map[string]Points)
+
+	for _, p := range c.points {
+		if _, found := bucketPoints[p.Bucket]; !found {
+			buckets = append(buckets, p.Bucket)
+		}
+
+		bucketPoints[p.Bucket] = append(bucketPoints[p.Bucket], p)
+	}
+
+	var remainingPoints Points
+
+	for _, bucket := range buckets {
+		points := bucketPoints[bucket]
+
+		if err := c.sendPoints(bucket, points); err != nil {
+			c.Log.Error("cannot send points: %v", err)
+
+			if derr.IsRetryable(err) {
+				remainingPoints = append(remainingPoints, points...)
+				continue
+			}
+
+			// Sending the same points again would fail the same way
+			atomic.AddInt64(&c.nbDroppedPoints, int64(len(points)))
+		}
 	}
 
-	c.points = nil
+	c.points = remainingPoints
+	c.updateNbBufferedPoints()
 }
 
-func (c *Client) sendPoints(points Points) error {
-	uri := *c.uri
-	uri.Path = path.Join(uri.Path, "/api/v2/write")
+func (c *Client) writeURI(bucket string) (*url.URL, error) {
+	if c.apiVersion == APIVersionAuto {
+		version, err := c.detectAPIVersion()
+		if err != nil {
+			return nil, derr.Wrap(err, derr.CodeUnavailable,
+				"cannot detect api version").WithRetryable(true)
+		}
+
+		c.Log.Info("using influx api %s", version)
+		c.apiVersion = version
+	}
 
+	uri := *c.uri
 	query := url.Values{}
-	query.Set("bucket", c.Cfg.Bucket)
-	if c.Cfg.Org != "" {
-		query.Set("org", c.Cfg.Org)
+
+	switch c.apiVersion {
+	case APIVersion1:
+		uri.Path = path.Join(uri.Path, "/write")
+
+		database := c.Cfg.Database
+		if bucket != "" {
+			database = bucket
+		}
+
+		query.Set("db", database)
+		if c.Cfg.RetentionPolicy != "" {
+			query.Set("rp", c.Cfg.RetentionPolicy)
+		}
+
+		// InfluxDB 1.x uses "n" and "u" instead of "ns" and "us"
+		switch precision := c.Cfg.Precision; precision {
+		case "":
+		case PrecisionNanosecond:
+			query.Set("precision", "n")
+		case PrecisionMicrosecond:
+			query.Set("precision", "u")
+		default:
+			query.Set("precision", string(precision))
+		}
+
+	default:
+		uri.Path = path.Join(uri.Path, "/api/v2/write")
+
+		if bucket == "" {
+			bucket = c.Cfg.Bucket
+		}
+
+		query.Set("bucket", bucket)
+		if c.Cfg.Org != "" {
+			query.Set("org", c.Cfg.Org)
+		}
+
+		if c.Cfg.Precision != "" {
+			query.Set("precision", string(c.Cfg.Precision))
+		}
 	}
 
 	uri.RawQuery = query.Encode()
 
+	return &uri, nil
+}
+
+// detectAPIVersion uses the /health endpoint: InfluxDB 2.x reports its
+// version; anything else, including InfluxDB 1.8 and backends which do not
+// return a JSON document, is assumed to support the 1.x write endpoint.
+func (c *Client) detectAPIVersion() (APIVersion, error) {
+	uri := *c.uri
+	uri.Path = path.Join(uri.Path, "/health")
+
+	req, err := http.NewRequest("GET", uri.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request: %w", err)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode == 404 {
+		return APIVersion1, nil
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", fmt.Errorf("request failed with status %d",
+			res.StatusCode)
+	}
+
+	var health struct {
+		Version string `json:"version"`
+	}
+
+	if err := json.Unmarshal(body, &health); err != nil {
+		return APIVersion1, nil
+	}
+
+	if strings.HasPrefix(strings.TrimPrefix(health.Version, "v"), "2.") {
+		return APIVersion2, nil
+	}
+
+	return APIVersion1, nil
+}
+
+func (c *Client) sendPoints(bucket string, points Points) error {
+	uri, err := c.writeURI(bucket)
+	if err != nil {
+		return err
+	}
+
 	var buf bytes.Buffer
-	EncodePoints(points, &buf)
+	EncodePointsWithPrecision(points, c.Cfg.Precision, &buf)
 
 	req, err := http.NewRequest("POST", uri.String(), &buf)
 	if err != nil {
@@ -248,7 +588,8 @@ func (c *Client) sendPoints(points Points) error {
 
 	res, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("cannot send request: %w", err)
+		return derr.Wrap(err, derr.CodeUnavailable, "cannot send request").
+			WithRetryable(true)
 	}
 	defer res.Body.Close()
 
@@ -271,8 +612,25 @@ func (c *Client) sendPoints(points Points) error {
 			bodyString = " (" + string(bodyData) + ")"
 		}
 
-		return fmt.Errorf("request failed with status %d%s",
-			res.StatusCode, bodyString)
+		// Client errors indicate that the points were rejected, except
+		// for rate limiting and authentication errors which may be
+		// temporary.
+		code := derr.CodeUnavailable
+		retryable := true
+
+		switch {
+		case res.StatusCode == 401:
+			code = derr.CodeUnauthorized
+		case res.StatusCode == 403:
+			code = derr.CodeForbidden
+		case res.StatusCode == 429:
+		case res.StatusCode >= 400 && res.StatusCode < 500:
+			code = derr.CodeInvalidInput
+			retryable = false
+		}
+
+		return derr.New(code, "request failed with status %d%s",
+			res.StatusCode, bodyString).WithRetryable(retryable)
 	}
 
 	return nil
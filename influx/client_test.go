@@ -0,0 +1,227 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package influx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAPIVersions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var health string
+	var writeURIs []string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/health":
+				w.Write([]byte(health))
+			default:
+				writeURIs = append(writeURIs, r.URL.RequestURI())
+				w.WriteHeader(204)
+			}
+		}))
+	defer server.Close()
+
+	httpClient, err := dhttp.NewClient(dhttp.ClientCfg{})
+	require.NoError(err)
+
+	points := Points{NewPoint("test", nil, Fields{"value": 1})}
+
+	newClient := func(cfg ClientCfg) *Client {
+		cfg.HTTPClient = httpClient
+		cfg.URI = server.URL
+
+		client, err := NewClient(cfg)
+		require.NoError(err)
+
+		return client
+	}
+
+	client := newClient(ClientCfg{Bucket: "metrics", Org: "exograd"})
+	require.NoError(client.sendPoints("", points))
+
+	client = newClient(ClientCfg{
+		APIVersion:      APIVersion1,
+		Database:        "metrics",
+		RetentionPolicy: "one_week",
+	})
+	require.NoError(client.sendPoints("", points))
+
+	client = newClient(ClientCfg{Database: "legacy"})
+	require.NoError(client.sendPoints("", points))
+
+	health = `{"name":"influxdb","status":"pass","version":"v2.6.1"}`
+	client = newClient(ClientCfg{APIVersion: APIVersionAuto, Bucket: "a"})
+	require.NoError(client.sendPoints("", points))
+
+	health = `OK`
+	client = newClient(ClientCfg{APIVersion: APIVersionAuto, Bucket: "b"})
+	require.NoError(client.sendPoints("", points))
+
+	assert.Equal([]string{
+		"/api/v2/write?bucket=metrics&org=exograd",
+		"/write?db=metrics&rp=one_week",
+		"/write?db=legacy",
+		"/api/v2/write?bucket=a",
+		"/write?db=b",
+	}, writeURIs)
+
+	c := check.NewChecker()
+	cfg := ClientCfg{APIVersion: APIVersion2, Database: "metrics"}
+	cfg.Check(c)
+	assert.Error(c.Error())
+}
+
+func TestClientOverflow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(503)
+		}))
+	defer server.Close()
+
+	httpClient, err := dhttp.NewClient(dhttp.ClientCfg{})
+	require.NoError(err)
+
+	newPoints := func(names ...string) Points {
+		var points Points
+		for _, name := range names {
+			points = append(points, NewPoint(name, nil, Fields{"a": 1}))
+		}
+		return points
+	}
+
+	measurements := func(points Points) []string {
+		var names []string
+		for _, p := range points {
+			names = append(names, p.Measurement)
+		}
+		return names
+	}
+
+	for _, policy := range []OverflowPolicy{OverflowPolicyDropOldest, OverflowPolicyDropNewest} {
+		client, err := NewClient(ClientCfg{
+			HTTPClient:        httpClient,
+			URI:               server.URL,
+			Bucket:            "metrics",
+			BatchSize:         2,
+			MaxBufferedPoints: 3,
+			OverflowPolicy:    policy,
+		})
+		require.NoError(err)
+
+		client.enqueuePoints(newPoints("a", "b"))
+		client.enqueuePoints(newPoints("c", "d"))
+
+		assert.Equal(int64(1), client.NbOverflowedPoints())
+		assert.Equal(int64(3), client.NbBufferedPoints())
+
+		if policy == OverflowPolicyDropOldest {
+			assert.Equal([]string{"b", "c", "d"}, measurements(client.points))
+		} else {
+			assert.Equal([]string{"a", "b", "c"}, measurements(client.points))
+		}
+	}
+}
+
+func TestClientBuckets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var writeURIs []string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			writeURIs = append(writeURIs, r.URL.RequestURI())
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	httpClient, err := dhttp.NewClient(dhttp.ClientCfg{})
+	require.NoError(err)
+
+	client, err := NewClient(ClientCfg{
+		HTTPClient: httpClient,
+		URI:        server.URL,
+		Bucket:     "metrics",
+	})
+	require.NoError(err)
+
+	event := NewPoint("event", nil, Fields{"a": 1})
+	event.Bucket = "events"
+
+	client.enqueuePoints(Points{
+		NewPoint("a", nil, Fields{"a": 1}),
+		event,
+		NewPoint("b", nil, Fields{"a": 1}),
+	})
+	client.flush()
+
+	assert.Equal([]string{
+		"/api/v2/write?bucket=metrics",
+		"/api/v2/write?bucket=events",
+	}, writeURIs)
+	assert.Equal(int64(0), client.NbBufferedPoints())
+}
+
+func TestClientSmallBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var nbWrites int
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			nbWrites++
+			w.WriteHeader(204)
+		}))
+	defer server.Close()
+
+	httpClient, err := dhttp.NewClient(dhttp.ClientCfg{})
+	require.NoError(err)
+
+	client, err := NewClient(ClientCfg{
+		HTTPClient:        httpClient,
+		URI:               server.URL,
+		Bucket:            "metrics",
+		MaxBufferedPoints: 3,
+	})
+	require.NoError(err)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		client.enqueuePoints(Points{NewPoint(name, nil, Fields{"a": 1})})
+	}
+
+	assert.Equal(1, nbWrites)
+	assert.Equal(int64(0), client.NbOverflowedPoints())
+	assert.Equal(int64(1), client.NbBufferedPoints())
+
+	c := check.NewChecker()
+	cfg := ClientCfg{Bucket: "metrics", BatchSize: 10, MaxBufferedPoints: 5}
+	cfg.Check(c)
+	assert.Error(c.Error())
+}
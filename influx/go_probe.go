@@ -36,6 +36,7 @@ func (c *Client) goProbeMain() {
 			points := Points{
 				goProbeGoroutinePoint(now),
 				goProbeMemPoint(now),
+				c.clientPoint(now),
 			}
 
 			c.EnqueuePoints(points)
@@ -71,3 +72,13 @@ func goProbeMemPoint(now time.Time) *Point {
 
 	return NewPointWithTimestamp("go_memory", Tags{}, fields, now)
 }
+
+func (c *Client) clientPoint(now time.Time) *Point {
+	fields := Fields{
+		"nb_dropped_points":    c.NbDroppedPoints(),
+		"nb_overflowed_points": c.NbOverflowedPoints(),
+		"nb_buffered_points":   c.NbBufferedPoints(),
+	}
+
+	return NewPointWithTimestamp("influx_client", Tags{}, fields, now)
+}
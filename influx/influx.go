@@ -21,6 +21,10 @@ type Point struct {
 	Tags        Tags
 	Fields      Fields
 	Timestamp   *time.Time
+
+	// The bucket (or database for InfluxDB 1.x) the point is written to;
+	// the bucket of the client if empty.
+	Bucket string
 }
 
 type Points []*Point
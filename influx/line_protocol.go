@@ -35,7 +35,29 @@ func init() {
 	stringFieldReplacer = strings.NewReplacer(`"`, `\"`)
 }
 
+type Precision string
+
+const (
+	PrecisionNanosecond  Precision = "ns"
+	PrecisionMicrosecond Precision = "us"
+	PrecisionMillisecond Precision = "ms"
+	PrecisionSecond      Precision = "s"
+)
+
+var PrecisionValues = []Precision{
+	PrecisionNanosecond,
+	PrecisionMicrosecond,
+	PrecisionMillisecond,
+	PrecisionSecond,
+}
+
 func EncodePoint(p *Point, buf *bytes.Buffer) {
+	EncodePointWithPrecision(p, PrecisionNanosecond, buf)
+}
+
+// EncodePointWithPrecision encodes a point, truncating its timestamp to the
+// precision.
+func EncodePointWithPrecision(p *Point, precision Precision, buf *bytes.Buffer) {
 	encodeMeasurement(p.Measurement, buf)
 	if len(p.Tags) > 0 {
 		encodeTags(p.Tags, buf)
@@ -46,13 +68,17 @@ func EncodePoint(p *Point, buf *bytes.Buffer) {
 
 	if p.Timestamp != nil {
 		buf.WriteByte(' ')
-		encodeTimestamp(p.Timestamp, buf)
+		encodeTimestamp(p.Timestamp, precision, buf)
 	}
 }
 
 func EncodePoints(ps Points, buf *bytes.Buffer) {
+	EncodePointsWithPrecision(ps, PrecisionNanosecond, buf)
+}
+
+func EncodePointsWithPrecision(ps Points, precision Precision, buf *bytes.Buffer) {
 	for _, p := range ps {
-		EncodePoint(p, buf)
+		EncodePointWithPrecision(p, precision, buf)
 		buf.WriteByte('\n')
 	}
 }
@@ -135,7 +161,19 @@ func encodeFieldValue(value interface{}, buf *bytes.Buffer) {
 	}
 }
 
-func encodeTimestamp(timestamp *time.Time, buf *bytes.Buffer) {
-	ns := timestamp.UnixNano()
-	fmt.Fprintf(buf, "%d", ns)
+func encodeTimestamp(timestamp *time.Time, precision Precision, buf *bytes.Buffer) {
+	var n int64
+
+	switch precision {
+	case PrecisionMicrosecond:
+		n = timestamp.UnixMicro()
+	case PrecisionMillisecond:
+		n = timestamp.UnixMilli()
+	case PrecisionSecond:
+		n = timestamp.Unix()
+	default:
+		n = timestamp.UnixNano()
+	}
+
+	buf.WriteString(strconv.FormatInt(n, 10))
 }
@@ -53,6 +53,29 @@ func TestEncodePoint(t *testing.T) {
 	}
 }
 
+func TestEncodePointWithPrecision(t *testing.T) {
+	assert := assert.New(t)
+
+	timestamp := time.Date(2022, 1, 1, 0, 0, 1, 234567891, time.UTC)
+	p := NewPointWithTimestamp("m", Tags{}, Fields{"a": 1}, timestamp)
+
+	tests := []struct {
+		precision Precision
+		line      string
+	}{
+		{PrecisionNanosecond, `m a=1i 1640995201234567891`},
+		{PrecisionMicrosecond, `m a=1i 1640995201234567`},
+		{PrecisionMillisecond, `m a=1i 1640995201234`},
+		{PrecisionSecond, `m a=1i 1640995201`},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		EncodePointWithPrecision(p, test.precision, &buf)
+		assert.Equal(test.line, buf.String(), test.precision)
+	}
+}
+
 func TestEncodePoints(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+type InvalidPointPolicy string
+
+const (
+	// Invalid points are dropped and counted
+	InvalidPointPolicyDrop InvalidPointPolicy = "drop"
+
+	// Invalid points are dropped, counted and logged
+	InvalidPointPolicyLog InvalidPointPolicy = "log"
+)
+
+var InvalidPointPolicyValues = []InvalidPointPolicy{
+	InvalidPointPolicyDrop,
+	InvalidPointPolicyLog,
+}
+
+// ValidatePoint checks that a point can be accepted by the server. Tag keys
+// and values longer than maxTagLength bytes are rejected.
+func ValidatePoint(p *Point, maxTagLength int) error {
+	if p.Measurement == "" {
+		return errors.New("empty measurement")
+	}
+
+	for key, value := range p.Tags {
+		if key == "" {
+			return errors.New("empty tag key")
+		}
+
+		if len(key) > maxTagLength {
+			return fmt.Errorf("tag key %.32q... too long", key)
+		}
+
+		if len(value) > maxTagLength {
+			return fmt.Errorf("value of tag %q too long", key)
+		}
+	}
+
+	if len(p.Fields) == 0 {
+		return errors.New("no fields")
+	}
+
+	for key, value := range p.Fields {
+		if key == "" {
+			return errors.New("empty field key")
+		}
+
+		var f float64
+
+		switch v := value.(type) {
+		case float32:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			continue
+		}
+
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("invalid value %v for field %q", f, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package influx
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePoint(t *testing.T) {
+	assert := assert.New(t)
+
+	longString := strings.Repeat("a", 20)
+
+	assert.NoError(ValidatePoint(NewPoint("m", Tags{"a": "b"},
+		Fields{"a": 1.0, "b": "foo"}), 16))
+
+	invalidPoints := []*Point{
+		NewPoint("", Tags{}, Fields{"a": 1}),
+		NewPoint("m", Tags{}, Fields{}),
+		NewPoint("m", Tags{}, Fields{"": 1}),
+		NewPoint("m", Tags{}, Fields{"a": math.NaN()}),
+		NewPoint("m", Tags{}, Fields{"a": float32(math.Inf(1))}),
+		NewPoint("m", Tags{"": "a"}, Fields{"a": 1}),
+		NewPoint("m", Tags{longString: "a"}, Fields{"a": 1}),
+		NewPoint("m", Tags{"a": longString}, Fields{"a": 1}),
+	}
+
+	for _, p := range invalidPoints {
+		assert.Error(ValidatePoint(p, 16), "%#v", p)
+	}
+}
@@ -53,6 +53,26 @@ func GenerateWithTimestamp(timestamp uint32) KSUID {
 	return id
 }
 
+func Parse(s string) (KSUID, error) {
+	var id KSUID
+	err := id.Parse(s)
+	return id, err
+}
+
+func MustParse(s string) KSUID {
+	id, err := Parse(s)
+	if err != nil {
+		panic(fmt.Sprintf("invalid ksuid %q: %v", s, err))
+	}
+
+	return id
+}
+
+func Validate(s string) error {
+	_, err := Parse(s)
+	return err
+}
+
 func (id *KSUID) Parse(s string) error {
 	if len(s) != 27 {
 		return ErrInvalidFormat
@@ -109,6 +129,15 @@ func (id *KSUID) UnmarshalJSON(data []byte) error {
 	return id.Parse(s)
 }
 
+// encoding.TextMarshaler interface
+func (id KSUID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *KSUID) UnmarshalText(data []byte) error {
+	return id.Parse(string(data))
+}
+
 // sql.Scanner interface
 func (id *KSUID) Scan(src interface{}) error {
 	if src == nil {
@@ -120,6 +149,9 @@ func (id *KSUID) Scan(src interface{}) error {
 	case string:
 		return id.Parse(v)
 
+	case []byte:
+		return id.Parse(string(v))
+
 	default:
 		return fmt.Errorf("invalid value of type %T", v)
 	}
@@ -1,6 +1,7 @@
 package ksuid
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -53,3 +54,59 @@ func TestKSUIDIsZero(t *testing.T) {
 	assert.True(Zero.IsZero())
 	assert.False(Generate().IsZero())
 }
+
+func TestKSUIDParseFunctions(t *testing.T) {
+	assert := assert.New(t)
+
+	id, err := Parse("1l12i5euax5i7oGDn5DFULPYdCM")
+	if assert.NoError(err) {
+		assert.Equal("1l12i5euax5i7oGDn5DFULPYdCM", id.String())
+	}
+
+	assert.NoError(Validate("1l12i5euax5i7oGDn5DFULPYdCM"))
+	assert.ErrorIs(Validate("foo"), ErrInvalidFormat)
+
+	assert.Panics(func() { MustParse("") })
+}
+
+func TestKSUIDJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	id := Generate()
+
+	data, err := json.Marshal(id)
+	if assert.NoError(err) {
+		assert.Equal(`"`+id.String()+`"`, string(data))
+
+		var id2 KSUID
+		if assert.NoError(json.Unmarshal(data, &id2)) {
+			assert.Equal(id, id2)
+		}
+	}
+
+	var id3 KSUID
+	assert.Error(json.Unmarshal([]byte(`42`), &id3))
+}
+
+func TestKSUIDScan(t *testing.T) {
+	assert := assert.New(t)
+
+	id := Generate()
+
+	var id2 KSUID
+	if assert.NoError(id2.Scan(id.String())) {
+		assert.Equal(id, id2)
+	}
+
+	var id3 KSUID
+	if assert.NoError(id3.Scan([]byte(id.String()))) {
+		assert.Equal(id, id3)
+	}
+
+	var id4 KSUID = Generate()
+	if assert.NoError(id4.Scan(nil)) {
+		assert.True(id4.IsZero())
+	}
+
+	assert.Error(id4.Scan(42))
+}
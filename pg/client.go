@@ -16,11 +16,20 @@ package pg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/exograd/go-daemon/check"
 	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -40,6 +49,30 @@ type ClientCfg struct {
 
 	SchemaDirectory string   `json:"schema_directory"`
 	SchemaNames     []string `json:"schema_names"`
+
+	// Do not apply pending migrations when connecting, e.g. when another
+	// program is in charge of migrations.
+	SkipSchemaUpdates bool `json:"skip_schema_updates,omitempty"`
+
+	ReplicaURIs          []string       `json:"replica_uris,omitempty"`
+	ReplicaCheckInterval dtime.Duration `json:"replica_check_interval,omitempty"`
+
+	// Default timeouts applied to all connections, including replica
+	// connections. They can be overridden for a specific transaction with
+	// SET LOCAL.
+	StatementTimeout                dtime.Duration `json:"statement_timeout,omitempty"`
+	IdleInTransactionSessionTimeout dtime.Duration `json:"idle_in_transaction_session_timeout,omitempty"`
+
+	// Pool settings; they take precedence over pool_* URI parameters.
+	// Settings set in neither place default to 10 connections, a 1h
+	// lifetime, a 10m idle time and a 1m health check period.
+	MaxConns          int32          `json:"max_conns,omitempty"`
+	MinConns          int32          `json:"min_conns,omitempty"`
+	MaxConnLifetime   dtime.Duration `json:"max_conn_lifetime,omitempty"`
+	MaxConnIdleTime   dtime.Duration `json:"max_conn_idle_time,omitempty"`
+	HealthCheckPeriod dtime.Duration `json:"health_check_period,omitempty"`
+
+	Startup *StartupCfg `json:"startup,omitempty"`
 }
 
 func (cfg *ClientCfg) Check(c *check.Checker) {
@@ -52,6 +85,55 @@ func (cfg *ClientCfg) Check(c *check.Checker) {
 			c.CheckStringNotEmpty(i, name)
 		}
 	})
+
+	c.WithChild("replica_uris", func() {
+		for i, uri := range cfg.ReplicaURIs {
+			c.CheckStringURI(i, uri)
+		}
+	})
+
+	if cfg.ReplicaCheckInterval != 0 {
+		c.CheckDurationMin("replica_check_interval",
+			cfg.ReplicaCheckInterval.Duration(), time.Second)
+	}
+
+	if cfg.StatementTimeout != 0 {
+		c.CheckDurationMin("statement_timeout",
+			cfg.StatementTimeout.Duration(), time.Millisecond)
+	}
+
+	if cfg.IdleInTransactionSessionTimeout != 0 {
+		c.CheckDurationMin("idle_in_transaction_session_timeout",
+			cfg.IdleInTransactionSessionTimeout.Duration(), time.Millisecond)
+	}
+
+	c.CheckOptionalObject("startup", cfg.Startup)
+
+	if cfg.MaxConns != 0 {
+		c.CheckIntMin("max_conns", int(cfg.MaxConns), 1)
+	}
+
+	c.CheckIntMin("min_conns", int(cfg.MinConns), 0)
+
+	if cfg.MaxConns != 0 && cfg.MinConns > cfg.MaxConns {
+		c.AddError("min_conns", "invalid_value",
+			"min_conns must be lower or equal to max_conns")
+	}
+
+	if cfg.MaxConnLifetime != 0 {
+		c.CheckDurationMin("max_conn_lifetime",
+			cfg.MaxConnLifetime.Duration(), time.Second)
+	}
+
+	if cfg.MaxConnIdleTime != 0 {
+		c.CheckDurationMin("max_conn_idle_time",
+			cfg.MaxConnIdleTime.Duration(), time.Second)
+	}
+
+	if cfg.HealthCheckPeriod != 0 {
+		c.CheckDurationMin("health_check_period",
+			cfg.HealthCheckPeriod.Duration(), time.Second)
+	}
 }
 
 type Client struct {
@@ -59,6 +141,17 @@ type Client struct {
 	Log *dlog.Logger
 
 	Pool *pgxpool.Pool
+
+	replicas     []*replica
+	replicaIndex uint32
+
+	connected int32
+
+	lockStats lockStatsSet
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 func NewClient(cfg ClientCfg) (*Client, error) {
@@ -70,33 +163,53 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 		return nil, fmt.Errorf("missing or empty url")
 	}
 
+	if cfg.ReplicaCheckInterval == 0 {
+		cfg.ReplicaCheckInterval = dtime.Duration(10 * time.Second)
+	}
+
+	var startupCfg StartupCfg
+	if cfg.Startup != nil {
+		startupCfg = *cfg.Startup
+	}
+	startupCfg.setDefaults()
+	cfg.Startup = &startupCfg
+
+	c := &Client{
+		Cfg: cfg,
+		Log: cfg.Log,
+
+		stopChan: make(chan struct{}),
+	}
+
 	cfg.Log.Info("connecting to %q", cfg.URI)
 
-	poolCfg, err := pgxpool.ParseConfig(cfg.URI)
+	poolCfg, err := c.poolCfg(cfg.URI)
 	if err != nil {
 		return nil, fmt.Errorf("invalid url: %w", err)
 	}
 
-	if cfg.ApplicationName != "" {
-		runtimeParams := poolCfg.ConnConfig.RuntimeParams
-		runtimeParams["application_name"] = cfg.ApplicationName
-	}
-
-	ctx := context.Background()
-	pool, err := pgxpool.ConnectConfig(ctx, poolCfg)
+	pool, err := c.connect(poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to database at %q: %w",
 			cfg.URI, err)
 	}
 
-	c := &Client{
-		Cfg: cfg,
-		Log: cfg.Log,
+	c.Pool = pool
+
+	if err := c.connectReplicas(); err != nil {
+		c.Close()
+		return nil, err
+	}
 
-		Pool: pool,
+	if len(c.replicas) > 0 {
+		c.wg.Add(1)
+		go c.replicaCheckMain()
 	}
 
-	if c.Cfg.SchemaDirectory != "" {
+	if !c.Connected() {
+		c.wg.Add(1)
+		go c.connectMain()
+	} else if c.schemaUpdatesEnabled() {
 		if err := c.updateSchemas(); err != nil {
 			c.Close()
 			return nil, err
@@ -106,6 +219,95 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 	return c, nil
 }
 
+func (c *Client) poolCfg(uri string) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// Default values only apply to settings set neither in the
+	// configuration nor with a pool_* URI parameter.
+	uriParams := uriParameters(uri)
+
+	if c.Cfg.MaxConns != 0 {
+		poolCfg.MaxConns = c.Cfg.MaxConns
+	} else if !uriParams["pool_max_conns"] {
+		poolCfg.MaxConns = 10
+	}
+
+	if c.Cfg.MinConns != 0 {
+		poolCfg.MinConns = c.Cfg.MinConns
+	}
+
+	if c.Cfg.MaxConnLifetime != 0 {
+		poolCfg.MaxConnLifetime = c.Cfg.MaxConnLifetime.Duration()
+	} else if !uriParams["pool_max_conn_lifetime"] {
+		poolCfg.MaxConnLifetime = time.Hour
+	}
+
+	if c.Cfg.MaxConnIdleTime != 0 {
+		poolCfg.MaxConnIdleTime = c.Cfg.MaxConnIdleTime.Duration()
+	} else if !uriParams["pool_max_conn_idle_time"] {
+		poolCfg.MaxConnIdleTime = 10 * time.Minute
+	}
+
+	if c.Cfg.HealthCheckPeriod != 0 {
+		poolCfg.HealthCheckPeriod = c.Cfg.HealthCheckPeriod.Duration()
+	} else if !uriParams["pool_health_check_period"] {
+		poolCfg.HealthCheckPeriod = time.Minute
+	}
+
+	runtimeParams := poolCfg.ConnConfig.RuntimeParams
+
+	if c.Cfg.ApplicationName != "" {
+		runtimeParams["application_name"] = c.Cfg.ApplicationName
+	}
+
+	if timeout := c.Cfg.StatementTimeout; timeout != 0 {
+		runtimeParams["statement_timeout"] =
+			strconv.FormatInt(timeout.Duration().Milliseconds(), 10)
+	}
+
+	if timeout := c.Cfg.IdleInTransactionSessionTimeout; timeout != 0 {
+		runtimeParams["idle_in_transaction_session_timeout"] =
+			strconv.FormatInt(timeout.Duration().Milliseconds(), 10)
+	}
+
+	return poolCfg, nil
+}
+
+// Return the set of parameters of a connection string, either a URL or a
+// keyword/value DSN.
+func uriParameters(uri string) map[string]bool {
+	params := make(map[string]bool)
+
+	if strings.HasPrefix(uri, "postgres://") ||
+		strings.HasPrefix(uri, "postgresql://") {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return params
+		}
+
+		for name := range u.Query() {
+			params[name] = true
+		}
+
+		return params
+	}
+
+	for _, field := range strings.Fields(uri) {
+		if i := strings.IndexByte(field, '='); i > 0 {
+			params[field[:i]] = true
+		}
+	}
+
+	return params
+}
+
+func (c *Client) schemaUpdatesEnabled() bool {
+	return c.Cfg.SchemaDirectory != "" && !c.Cfg.SkipSchemaUpdates
+}
+
 func (c *Client) updateSchemas() error {
 	for _, name := range c.Cfg.SchemaNames {
 		dirPath := path.Join(c.Cfg.SchemaDirectory, name)
@@ -119,7 +321,15 @@ func (c *Client) updateSchemas() error {
 }
 
 func (c *Client) Close() {
-	c.Pool.Close()
+	// The client may already have been closed by NewClient after a failure
+	c.closeOnce.Do(func() {
+		close(c.stopChan)
+		c.wg.Wait()
+
+		c.closeReplicas()
+
+		c.Pool.Close()
+	})
 }
 
 func (c *Client) WithConn(fn func(Conn) error) error {
@@ -176,6 +386,17 @@ func (c *Client) WithTx(fn func(Conn) error) (err error) {
 func (c *Client) UpdateSchema(schema, dirPath string) error {
 	c.Log.Info("updating schema %q using migrations from %q", schema, dirPath)
 
+	return c.updateSchema(schema, dirPath, "")
+}
+
+// updateSchema applies pending migrations; if searchPath is not empty, it is
+// used for all transactions, including the one used to store schema
+// versions.
+func (c *Client) updateSchema(schema, dirPath, searchPath string) error {
+	withTx := func(fn func(Conn) error) error {
+		return c.withSearchPathTx(searchPath, fn)
+	}
+
 	var migrations Migrations
 	if err := migrations.LoadDirectory(schema, dirPath); err != nil {
 		return fmt.Errorf("cannot load migrations: %w", err)
@@ -186,7 +407,7 @@ func (c *Client) UpdateSchema(schema, dirPath string) error {
 		return nil
 	}
 
-	err := c.WithTx(func(conn Conn) error {
+	err := withTx(func(conn Conn) error {
 		// Take a lock to make sure only one application tries to update the
 		// schema at the same time.
 		err := TakeAdvisoryLock(conn,
@@ -199,26 +420,19 @@ func (c *Client) UpdateSchema(schema, dirPath string) error {
 		// current connection because we need each migration, which will be
 		// executed in its own transaction (i.e. before the the end of the
 		// main transaction), to see it.
-		if err := c.WithConn(createSchemaVersionTable); err != nil {
+		if err := withTx(createSchemaVersionTable); err != nil {
 			return fmt.Errorf("cannot create schema version table: %w", err)
 		}
 
-		// Load currently applied versions and remove them from the set of
-		// migrations.
-		appliedVersions, err := loadSchemaVersions(conn, schema)
+		pendingMigrations, err := PendingMigrations(conn, schema, migrations)
 		if err != nil {
-			return fmt.Errorf("cannot load schema versions: %w", err)
+			return err
 		}
 
-		migrations.RejectVersions(appliedVersions)
-
-		// Apply migrations in order
-		migrations.Sort()
-
-		for _, m := range migrations {
+		for _, m := range pendingMigrations {
 			c.Log.Info("applying migration %v", m)
 
-			if err := c.WithTx(m.Apply); err != nil {
+			if err := withTx(m.Apply); err != nil {
 				return fmt.Errorf("cannot apply migration %v: %w", m, err)
 			}
 		}
@@ -242,6 +456,121 @@ func (c *Client) UpdateSchema(schema, dirPath string) error {
 	return nil
 }
 
+// SchemaStatus returns the status of all migrations of a schema, either
+// applied or available in the directory, ordered by version.
+func (c *Client) SchemaStatus(schema, dirPath string) ([]MigrationStatus, error) {
+	return c.SchemaStatusContext(context.Background(), schema, dirPath)
+}
+
+// SchemaStatusContext is a variant of SchemaStatus using a context. The
+// database is not modified: if the schema version table does not exist, no
+// migration is considered applied.
+func (c *Client) SchemaStatusContext(ctx context.Context, schema, dirPath string) ([]MigrationStatus, error) {
+	var migrations Migrations
+	if err := migrations.LoadDirectory(schema, dirPath); err != nil {
+		return nil, fmt.Errorf("cannot load migrations: %w", err)
+	}
+
+	conn, err := c.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	dates, err := loadSchemaVersionDates(ctx, conn, schema)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != CodeUndefinedTable {
+			return nil, fmt.Errorf("cannot load schema versions: %w", err)
+		}
+
+		dates = make(map[string]time.Time)
+	}
+
+	var statuses []MigrationStatus
+
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version}
+
+		if date, found := dates[m.Version]; found {
+			status.Applied = true
+			status.MigrationDate = &date
+			delete(dates, m.Version)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	// Migrations may have been applied and then removed from the directory
+	for version, date := range dates {
+		date := date
+
+		statuses = append(statuses, MigrationStatus{
+			Version:       version,
+			Applied:       true,
+			MigrationDate: &date,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// RollbackSchema reverts the last migration applied to a schema and returns
+// it. The migration must have a down file. If no migration has been applied,
+// RollbackSchema returns nil.
+func (c *Client) RollbackSchema(schema, dirPath string) (*Migration, error) {
+	var migrations Migrations
+	if err := migrations.LoadDirectory(schema, dirPath); err != nil {
+		return nil, fmt.Errorf("cannot load migrations: %w", err)
+	}
+
+	var migration *Migration
+
+	err := c.WithTx(func(conn Conn) error {
+		err := TakeAdvisoryLock(conn,
+			AdvisoryLockId1, AdvisoryLockId2Migrations)
+		if err != nil {
+			return fmt.Errorf("cannot take advisory lock: %w", err)
+		}
+
+		dates, err := loadSchemaVersionDates(context.Background(), conn,
+			schema)
+		if err != nil {
+			return fmt.Errorf("cannot load schema versions: %w", err)
+		}
+
+		var lastVersion string
+		for version := range dates {
+			if version > lastVersion {
+				lastVersion = version
+			}
+		}
+
+		if lastVersion == "" {
+			return nil
+		}
+
+		migration = migrations.Migration(lastVersion)
+		if migration == nil {
+			return fmt.Errorf("migration %s-%s not found in %q",
+				schema, lastVersion, dirPath)
+		}
+
+		c.Log.Info("reverting migration %v", migration)
+
+		return migration.Revert(conn)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return migration, nil
+}
+
 func TakeAdvisoryLock(conn Conn, id1, id2 uint32) error {
 	ctx := context.Background()
 
@@ -294,3 +623,35 @@ func loadSchemaVersions(conn Conn, schema string) (map[string]struct{}, error) {
 
 	return versions, nil
 }
+
+func loadSchemaVersionDates(ctx context.Context, conn Conn, schema string) (map[string]time.Time, error) {
+	query := `
+SELECT version, migration_date
+  FROM schema_versions
+  WHERE schema = $1
+`
+	rows, err := conn.Query(ctx, query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make(map[string]time.Time)
+
+	for rows.Next() {
+		var version string
+		var date time.Time
+
+		if err := rows.Scan(&version, &date); err != nil {
+			return nil, err
+		}
+
+		dates[version] = date
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return dates, nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/djson"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPoolCfg(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := &Client{
+		Cfg: ClientCfg{
+			StatementTimeout:                dtime.Duration(30 * time.Second),
+			IdleInTransactionSessionTimeout: dtime.Duration(time.Minute),
+
+			MaxConns:        20,
+			MaxConnIdleTime: dtime.Duration(time.Minute),
+		},
+	}
+
+	poolCfg, err := c.poolCfg("postgres://localhost/test?pool_max_conns=5")
+	require.NoError(err)
+
+	assert.Equal(int32(20), poolCfg.MaxConns)
+	assert.Equal(time.Minute, poolCfg.MaxConnIdleTime)
+
+	runtimeParams := poolCfg.ConnConfig.RuntimeParams
+	assert.Equal("30000", runtimeParams["statement_timeout"])
+	assert.Equal("60000", runtimeParams["idle_in_transaction_session_timeout"])
+	assert.NotContains(runtimeParams, "application_name")
+}
+
+func TestClientPoolCfgURIParameters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := &Client{}
+
+	poolCfg, err := c.poolCfg("postgres://localhost/test?pool_max_conns=5" +
+		"&pool_health_check_period=30s")
+	require.NoError(err)
+
+	assert.Equal(int32(5), poolCfg.MaxConns)
+	assert.Equal(30*time.Second, poolCfg.HealthCheckPeriod)
+	assert.Equal(time.Hour, poolCfg.MaxConnLifetime)
+	assert.Equal(10*time.Minute, poolCfg.MaxConnIdleTime)
+
+	poolCfg, err = c.poolCfg("host=localhost dbname=test pool_max_conns=5")
+	require.NoError(err)
+
+	assert.Equal(int32(5), poolCfg.MaxConns)
+
+	poolCfg, err = c.poolCfg("postgres://localhost/test")
+	require.NoError(err)
+
+	assert.Equal(int32(10), poolCfg.MaxConns)
+}
+
+func TestClientStartDegraded(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cfg := ClientCfg{
+		URI: "postgres://localhost:1/test?connect_timeout=1",
+
+		Startup: &StartupCfg{
+			MaxAttempts:   2,
+			InitialDelay:  dtime.Duration(10 * time.Millisecond),
+			StartDegraded: false,
+		},
+	}
+
+	_, err := NewClient(cfg)
+	assert.Error(err)
+
+	cfg.Startup.StartDegraded = true
+
+	c, err := NewClient(cfg)
+	require.NoError(err)
+	defer c.Close()
+
+	assert.False(c.Connected())
+}
+
+func TestClientSchemaUpdates(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &Client{Cfg: ClientCfg{SchemaDirectory: "schemas"}}
+	assert.True(c.schemaUpdatesEnabled())
+
+	c.Cfg.SkipSchemaUpdates = true
+	assert.False(c.schemaUpdatesEnabled())
+
+	c = &Client{Cfg: ClientCfg{}}
+	assert.False(c.schemaUpdatesEnabled())
+}
+
+func TestStartupCfgCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	checkCfg := func(cfg StartupCfg) []djson.Pointer {
+		c := check.NewChecker()
+		cfg.Check(c)
+
+		var pointers []djson.Pointer
+		for _, err := range c.Errors {
+			pointers = append(pointers, err.Pointer)
+		}
+
+		return pointers
+	}
+
+	assert.Empty(checkCfg(StartupCfg{}))
+	assert.Empty(checkCfg(StartupCfg{
+		InitialDelay: dtime.Duration(time.Second),
+		MaxDelay:     dtime.Duration(time.Minute),
+	}))
+
+	// The default initial delay is 500ms
+	assert.Equal([]djson.Pointer{{"max_delay"}}, checkCfg(StartupCfg{
+		MaxDelay: dtime.Duration(100 * time.Millisecond),
+	}))
+
+	// The default maximum delay is 10s
+	assert.Equal([]djson.Pointer{{"initial_delay"}}, checkCfg(StartupCfg{
+		InitialDelay: dtime.Duration(time.Minute),
+	}))
+}
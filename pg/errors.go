@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"errors"
+
+	"github.com/exograd/go-daemon/derr"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	CodeUniqueViolation      = "23505"
+	CodeForeignKeyViolation  = "23503"
+	CodeCheckViolation       = "23514"
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+	CodeQueryCanceled        = "57014"
+	CodeUndefinedTable       = "42P01"
+)
+
+// ErrorMessages contains the public message used by ClassifyError for each
+// error code.
+var ErrorMessages = map[string]string{
+	derr.CodeInternal:     "internal database error",
+	derr.CodeInvalidInput: "invalid data",
+	derr.CodeNotFound:     "resource not found",
+	derr.CodeConflict:     "conflict",
+	derr.CodeUnavailable:  "database unavailable",
+	derr.CodeTimeout:      "database timeout",
+}
+
+// ClassifyError wraps an error returned by pgx in a derr.Error whose code
+// and retryable flag reflect the cause of the failure. The message of the
+// derr.Error is a fixed public message associated with the code; it never
+// contains details from the database. The original error is still available
+// with errors.As or errors.Is.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := derr.As(err); ok {
+		return err
+	}
+
+	classify := func(code string, retryable bool) error {
+		return derr.Wrap(err, code, "%s", ErrorMessages[code]).
+			WithRetryable(retryable)
+	}
+
+	var pgErr *pgconn.PgError
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return classify(derr.CodeNotFound, false)
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return classify(derr.CodeTimeout, true)
+
+	case errors.As(err, &pgErr):
+		switch pgErr.Code {
+		case CodeUniqueViolation, CodeForeignKeyViolation:
+			return classify(derr.CodeConflict, false)
+		case CodeCheckViolation:
+			return classify(derr.CodeInvalidInput, false)
+		case CodeSerializationFailure, CodeDeadlockDetected:
+			return classify(derr.CodeConflict, true)
+		case CodeQueryCanceled:
+			return classify(derr.CodeTimeout, true)
+		}
+
+		return classify(derr.CodeInternal, false)
+
+	case pgconn.SafeToRetry(err):
+		return classify(derr.CodeUnavailable, true)
+	}
+
+	return err
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+package pg
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/exograd/go-daemon/derr"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.NoError(ClassifyError(nil))
+
+	err := ClassifyError(fmt.Errorf("cannot load user: %w", pgx.ErrNoRows))
+	assert.True(errors.Is(err, pgx.ErrNoRows))
+
+	codedErr, ok := derr.As(err)
+	require.True(ok)
+	assert.Equal(derr.CodeNotFound, codedErr.Code)
+	assert.Equal("resource not found", codedErr.Message)
+
+	pgErr := &pgconn.PgError{
+		Code:   CodeUniqueViolation,
+		Detail: "Key (email)=(bob@example.com) already exists.",
+	}
+
+	err = ClassifyError(pgErr)
+	assert.True(errors.Is(err, pgErr))
+
+	codedErr, ok = derr.As(err)
+	require.True(ok)
+	assert.Equal(derr.CodeConflict, codedErr.Code)
+	assert.Equal("conflict", codedErr.Message)
+	assert.False(codedErr.Retryable)
+
+	codedErr, ok = derr.As(ClassifyError(&pgconn.PgError{
+		Code: CodeSerializationFailure,
+	}))
+	require.True(ok)
+	assert.Equal(derr.CodeConflict, codedErr.Code)
+	assert.True(codedErr.Retryable)
+
+	otherErr := errors.New("other error")
+	assert.Equal(otherErr, ClassifyError(otherErr))
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// RowScanner is the constraint used by generic query functions: a pointer
+// to a value which can be loaded from a row.
+type RowScanner[T any] interface {
+	*T
+	Object
+}
+
+// QueryOne executes a query and returns the value loaded from the first row.
+// The error returned by FromRow when there is no row is returned unmodified,
+// i.e. pgx.ErrNoRows.
+func QueryOne[T any, PT RowScanner[T]](conn Conn, query string, args ...interface{}) (*T, error) {
+	ctx := context.Background()
+	return QueryOneContext[T, PT](ctx, conn, query, args...)
+}
+
+func QueryOneContext[T any, PT RowScanner[T]](ctx context.Context, conn Conn, query string, args ...interface{}) (*T, error) {
+	var value T
+
+	row := conn.QueryRow(ctx, query, args...)
+	if err := PT(&value).FromRow(row); err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+// QueryMany executes a query and returns the values loaded from all rows.
+func QueryMany[T any, PT RowScanner[T]](conn Conn, query string, args ...interface{}) ([]*T, error) {
+	ctx := context.Background()
+	return QueryManyContext[T, PT](ctx, conn, query, args...)
+}
+
+func QueryManyContext[T any, PT RowScanner[T]](ctx context.Context, conn Conn, query string, args ...interface{}) ([]*T, error) {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []*T
+
+	for rows.Next() {
+		var value T
+
+		if err := PT(&value).FromRow(rows); err != nil {
+			return nil, fmt.Errorf("cannot read row: %w", err)
+		}
+
+		values = append(values, &value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read query response: %w", err)
+	}
+
+	return values, nil
+}
@@ -3,6 +3,7 @@ package pg
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 )
@@ -15,6 +16,10 @@ type Objects interface {
 	AddFromRow(pgx.Row) error
 }
 
+// Errors returned by query functions are classified with ClassifyError:
+// they are wrapped in a derr.Error and can no longer be compared directly
+// with pgx errors. Use errors.Is, e.g. errors.Is(err, pgx.ErrNoRows).
+
 func Exec(conn Conn, query string, args ...interface{}) error {
 	ctx := context.Background()
 	return ExecContext(ctx, conn, query, args...)
@@ -22,7 +27,7 @@ func Exec(conn Conn, query string, args ...interface{}) error {
 
 func ExecContext(ctx context.Context, conn Conn, query string, args ...interface{}) error {
 	_, err := conn.Exec(ctx, query, args...)
-	return err
+	return ClassifyError(err)
 }
 
 func Exec2(conn Conn, query string, args ...interface{}) (int64, error) {
@@ -33,7 +38,7 @@ func Exec2(conn Conn, query string, args ...interface{}) (int64, error) {
 func Exec2Context(ctx context.Context, conn Conn, query string, args ...interface{}) (int64, error) {
 	tag, err := conn.Exec(ctx, query, args...)
 	if err != nil {
-		return -1, err
+		return -1, ClassifyError(err)
 	}
 
 	return tag.RowsAffected(), nil
@@ -46,7 +51,7 @@ func QueryObject(conn Conn, obj Object, query string, args ...interface{}) error
 
 func QueryObjectContext(ctx context.Context, conn Conn, obj Object, query string, args ...interface{}) error {
 	row := conn.QueryRow(ctx, query, args...)
-	return obj.FromRow(row)
+	return ClassifyError(obj.FromRow(row))
 }
 
 func QueryObjects(conn Conn, objs Objects, query string, args ...interface{}) error {
@@ -57,7 +62,7 @@ func QueryObjects(conn Conn, objs Objects, query string, args ...interface{}) er
 func QueryObjectsContext(ctx context.Context, conn Conn, objs Objects, query string, args ...interface{}) error {
 	rows, err := conn.Query(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("cannot execute query: %w", err)
+		return fmt.Errorf("cannot execute query: %w", ClassifyError(err))
 	}
 	defer rows.Close()
 
@@ -68,8 +73,39 @@ func QueryObjectsContext(ctx context.Context, conn Conn, objs Objects, query str
 	}
 
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("cannot read query response: %w", err)
+		return fmt.Errorf("cannot read query response: %w", ClassifyError(err))
 	}
 
 	return nil
 }
+
+// The Timeout variants of query functions cancel the query if it has not
+// completed after the timeout.
+
+func ExecTimeout(conn Conn, timeout time.Duration, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return ExecContext(ctx, conn, query, args...)
+}
+
+func Exec2Timeout(conn Conn, timeout time.Duration, query string, args ...interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return Exec2Context(ctx, conn, query, args...)
+}
+
+func QueryObjectTimeout(conn Conn, timeout time.Duration, obj Object, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return QueryObjectContext(ctx, conn, obj, query, args...)
+}
+
+func QueryObjectsTimeout(conn Conn, timeout time.Duration, objs Objects, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return QueryObjectsContext(ctx, conn, objs, query, args...)
+}
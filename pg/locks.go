@@ -0,0 +1,207 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Named locks are advisory locks whose second key is a hash of their name.
+// They use a first key distinct from AdvisoryLockId1 so that they never
+// conflict with locks taken by go-daemon itself.
+const NamedLockId1 uint32 = 0x0100
+
+type LockStats struct {
+	NbAcquisitions int64         `json:"nb_acquisitions"`
+	NbFailures     int64         `json:"nb_failures"`
+	TotalWaitTime  time.Duration `json:"total_wait_time"`
+	MaxWaitTime    time.Duration `json:"max_wait_time"`
+}
+
+type lockStatsSet struct {
+	stats map[string]*LockStats
+	mutex sync.Mutex
+}
+
+func (s *lockStatsSet) update(name string, waitTime time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stats == nil {
+		s.stats = make(map[string]*LockStats)
+	}
+
+	stats, found := s.stats[name]
+	if !found {
+		stats = &LockStats{}
+		s.stats[name] = stats
+	}
+
+	if err != nil {
+		stats.NbFailures++
+		return
+	}
+
+	stats.NbAcquisitions++
+	stats.TotalWaitTime += waitTime
+
+	if waitTime > stats.MaxWaitTime {
+		stats.MaxWaitTime = waitTime
+	}
+}
+
+func (s *lockStatsSet) copy() map[string]LockStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make(map[string]LockStats, len(s.stats))
+	for name, s := range s.stats {
+		stats[name] = *s
+	}
+
+	return stats
+}
+
+func NamedLockId2(name string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	return hash.Sum32()
+}
+
+func namedLockArgs(name string) []interface{} {
+	// The pg functions take signed 32 bit integers
+	return []interface{}{int32(NamedLockId1), int32(NamedLockId2(name))}
+}
+
+// TakeNamedLock takes a transaction-scoped lock, waiting until it is
+// available. It is released at the end of the transaction.
+func TakeNamedLock(ctx context.Context, conn Conn, name string) error {
+	query := `SELECT pg_advisory_xact_lock($1, $2)`
+	return ExecContext(ctx, conn, query, namedLockArgs(name)...)
+}
+
+// TryTakeNamedLock takes a transaction-scoped lock if it is available.
+func TryTakeNamedLock(ctx context.Context, conn Conn, name string) (bool, error) {
+	var locked bool
+
+	query := `SELECT pg_try_advisory_xact_lock($1, $2)`
+	err := conn.QueryRow(ctx, query, namedLockArgs(name)...).Scan(&locked)
+	return locked, err
+}
+
+// Lock is a session-scoped lock; it holds a connection until it is
+// released.
+type Lock struct {
+	Name string
+
+	conn *pgxpool.Conn
+}
+
+func (l *Lock) Release() error {
+	defer l.conn.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var unlocked bool
+
+	query := `SELECT pg_advisory_unlock($1, $2)`
+	err := l.conn.QueryRow(ctx, query, namedLockArgs(l.Name)...).
+		Scan(&unlocked)
+	if err != nil {
+		// We do not know the state of the session: close the connection
+		// so that the lock is released by the server.
+		l.conn.Conn().Close(ctx)
+		return fmt.Errorf("cannot release lock %q: %w", l.Name, err)
+	}
+
+	if !unlocked {
+		return fmt.Errorf("lock %q was not held", l.Name)
+	}
+
+	return nil
+}
+
+// Lock takes a session-scoped lock, waiting until it is available or until
+// the context is canceled.
+func (c *Client) Lock(ctx context.Context, name string) (*Lock, error) {
+	start := time.Now()
+
+	lock, err := c.lock(ctx, name, `SELECT pg_advisory_lock($1, $2), TRUE`)
+
+	c.lockStats.update(name, time.Since(start), err)
+
+	return lock, err
+}
+
+// TryLock takes a session-scoped lock if it is available; it returns nil if
+// the lock is held by another session.
+func (c *Client) TryLock(ctx context.Context, name string) (*Lock, error) {
+	return c.lock(ctx, name, `SELECT NULL, pg_try_advisory_lock($1, $2)`)
+}
+
+func (c *Client) lock(ctx context.Context, name, query string) (*Lock, error) {
+	conn, err := c.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot acquire connection: %w", err)
+	}
+
+	var locked bool
+
+	err = conn.QueryRow(ctx, query, namedLockArgs(name)...).
+		Scan(nil, &locked)
+	if err != nil {
+		// If the context was canceled while waiting, the lock may have been
+		// taken anyway; closing the connection guarantees it is released.
+		conn.Conn().Close(context.Background())
+		conn.Release()
+		return nil, fmt.Errorf("cannot take lock %q: %w", name, err)
+	}
+
+	if !locked {
+		conn.Release()
+		return nil, nil
+	}
+
+	return &Lock{Name: name, conn: conn}, nil
+}
+
+// WithLock executes a function while holding a session-scoped lock.
+func (c *Client) WithLock(ctx context.Context, name string, fn func() error) error {
+	lock, err := c.Lock(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := lock.Release(); err != nil {
+			c.Log.Error("%v", err)
+		}
+	}()
+
+	return fn()
+}
+
+// LockStats returns statistics about the waiting time of session-scoped
+// locks taken with Lock or WithLock.
+func (c *Client) LockStats() map[string]LockStats {
+	return c.lockStats.copy()
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -29,6 +30,16 @@ type Migration struct {
 	Schema  string
 	Version string
 	Code    []byte
+
+	// The code used to revert the migration, loaded from an optional
+	// <version>.down.sql file.
+	DownCode []byte
+}
+
+type MigrationStatus struct {
+	Version       string     `json:"version"`
+	Applied       bool       `json:"applied"`
+	MigrationDate *time.Time `json:"migration_date,omitempty"`
 }
 
 type Migrations []*Migration
@@ -76,8 +87,48 @@ INSERT INTO schema_versions (schema, version)
 	return nil
 }
 
+func (m *Migration) Revert(conn Conn) error {
+	ctx := context.Background()
+
+	if m.DownCode == nil {
+		return fmt.Errorf("migration %v cannot be reverted", m)
+	}
+
+	if _, err := conn.Exec(ctx, string(m.DownCode)); err != nil {
+		return fmt.Errorf("cannot execute migration: %w", err)
+	}
+
+	query := `
+DELETE FROM schema_versions
+  WHERE schema = $1 AND version = $2
+`
+	if _, err := conn.Exec(ctx, query, m.Schema, m.Version); err != nil {
+		return fmt.Errorf("cannot delete schema version: %w", err)
+	}
+
+	return nil
+}
+
+// PendingMigrations returns migrations which have not been applied yet, in
+// the order they must be applied.
+func PendingMigrations(conn Conn, schema string, ms Migrations) (Migrations, error) {
+	appliedVersions, err := loadSchemaVersions(conn, schema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load schema versions: %w", err)
+	}
+
+	pendingMigrations := make(Migrations, len(ms))
+	copy(pendingMigrations, ms)
+
+	pendingMigrations.RejectVersions(appliedVersions)
+	pendingMigrations.Sort()
+
+	return pendingMigrations, nil
+}
+
 func (pms *Migrations) LoadDirectory(schema, dirPath string) error {
 	var ms Migrations
+	downFilePaths := make(map[string]string)
 
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -94,6 +145,11 @@ func (pms *Migrations) LoadDirectory(schema, dirPath string) error {
 
 		filePath := path.Join(dirPath, name)
 
+		if version := strings.TrimSuffix(name, ".down.sql"); version != name {
+			downFilePaths[version] = filePath
+			continue
+		}
+
 		var m Migration
 		if err := m.LoadFile(filePath); err != nil {
 			return fmt.Errorf("cannot load migration from %q: %w",
@@ -105,10 +161,34 @@ func (pms *Migrations) LoadDirectory(schema, dirPath string) error {
 		ms = append(ms, &m)
 	}
 
+	for version, filePath := range downFilePaths {
+		m := ms.Migration(version)
+		if m == nil {
+			return fmt.Errorf("no migration found for %q", filePath)
+		}
+
+		code, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("cannot read %q: %w", filePath, err)
+		}
+
+		m.DownCode = code
+	}
+
 	*pms = ms
 	return nil
 }
 
+func (ms Migrations) Migration(version string) *Migration {
+	for _, m := range ms {
+		if m.Version == version {
+			return m
+		}
+	}
+
+	return nil
+}
+
 func (ms Migrations) Sort() {
 	sort.Slice(ms, func(i, j int) bool {
 		return ms[i].Version < ms[j].Version
@@ -128,6 +208,26 @@ func (pms *Migrations) RejectVersions(versions map[string]struct{}) {
 	*pms = ms2
 }
 
+// CreateMigrationFile creates an empty migration file whose version is the
+// current time, and returns its path.
+func CreateMigrationFile(dirPath string) (string, error) {
+	version := time.Now().UTC().Format(MigrationVersionLayout)
+	filePath := path.Join(dirPath, version+".sql")
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+
+	file, err := os.OpenFile(filePath, flags, 0644)
+	if err != nil {
+		return "", fmt.Errorf("cannot create %q: %w", filePath, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("cannot close %q: %w", filePath, err)
+	}
+
+	return filePath, nil
+}
+
 func ValidateMigrationVersion(s string) (err error) {
 	_, err = time.Parse(MigrationVersionLayout, s)
 	return
@@ -15,9 +15,12 @@
 package pg
 
 import (
+	"os"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCheckMigrationVersion(t *testing.T) {
@@ -30,3 +33,44 @@ func TestCheckMigrationVersion(t *testing.T) {
 	assert.Error(ValidateMigrationVersion("20220430T002403"))
 	assert.Error(ValidateMigrationVersion("20220430002403Z"))
 }
+
+func TestMigrationsLoadDirectory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dirPath := t.TempDir()
+
+	files := map[string]string{
+		"20220101T000000Z.sql":      "CREATE TABLE a ();",
+		"20220101T000000Z.down.sql": "DROP TABLE a;",
+		"20220102T000000Z.sql":      "CREATE TABLE b ();",
+	}
+
+	for name, content := range files {
+		filePath := path.Join(dirPath, name)
+		require.NoError(os.WriteFile(filePath, []byte(content), 0644))
+	}
+
+	var ms Migrations
+	require.NoError(ms.LoadDirectory("test", dirPath))
+	ms.Sort()
+
+	require.Len(ms, 2)
+
+	assert.Equal("20220101T000000Z", ms[0].Version)
+	assert.Equal("DROP TABLE a;", string(ms[0].DownCode))
+
+	assert.Equal("20220102T000000Z", ms[1].Version)
+	assert.Nil(ms[1].DownCode)
+
+	filePath, err := CreateMigrationFile(dirPath)
+	require.NoError(err)
+	require.NoError(ms.LoadDirectory("test", dirPath))
+	assert.Len(ms, 3)
+
+	orphanPath := path.Join(dirPath, "20220103T000000Z.down.sql")
+	require.NoError(os.WriteFile(orphanPath, nil, 0644))
+	assert.Error(ms.LoadDirectory("test", dirPath))
+
+	assert.NoError(os.Remove(filePath))
+}
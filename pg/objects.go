@@ -0,0 +1,218 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/exograd/go-daemon/derr"
+	"github.com/jackc/pgx/v4"
+)
+
+// Tables managed with InsertObject, UpdateObject and SoftDeleteObject are
+// expected to have the following columns:
+//
+//	created_at TIMESTAMP NOT NULL
+//	updated_at TIMESTAMP NOT NULL
+//	deleted_at TIMESTAMP
+//
+// Timestamps are stored in UTC. Soft deleted rows are never returned or
+// modified by these helpers; LiveRowCondition can be used in other queries
+// to filter them out.
+const (
+	CreationTimeColumn = "created_at"
+	UpdateTimeColumn   = "updated_at"
+	DeletionTimeColumn = "deleted_at"
+)
+
+const LiveRowCondition = DeletionTimeColumn + " IS NULL"
+
+const currentTimestamp = "(CURRENT_TIMESTAMP AT TIME ZONE 'UTC')"
+
+var ErrObjectNotFound = derr.New(derr.CodeNotFound, "object not found")
+
+// Table describes how objects are stored. Columns are the columns returned by
+// the helpers and read by Object.FromRow, in order.
+type Table struct {
+	Name      string
+	KeyColumn string // default: "id"
+	Columns   []string
+}
+
+// ColumnValues associates column names with the values to write.
+type ColumnValues map[string]interface{}
+
+func (cv ColumnValues) sortedColumns() []string {
+	columns := make([]string, 0, len(cv))
+	for column := range cv {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	return columns
+}
+
+func (t *Table) keyColumn() string {
+	if t.KeyColumn == "" {
+		return "id"
+	}
+
+	return t.KeyColumn
+}
+
+func (t *Table) returningClause() string {
+	if len(t.Columns) == 0 {
+		return ""
+	}
+
+	return " RETURNING " + quoteIdentifiers(t.Columns)
+}
+
+func (t *Table) insertQuery(values ColumnValues) (string, []interface{}) {
+	columns := values.sortedColumns()
+
+	args := make([]interface{}, len(columns))
+	placeholders := make([]string, len(columns))
+
+	for i, column := range columns {
+		args[i] = values[column]
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	columns = append(columns, CreationTimeColumn, UpdateTimeColumn)
+	placeholders = append(placeholders, currentTimestamp, currentTimestamp)
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)%s",
+		QuoteIdentifier(t.Name), quoteIdentifiers(columns),
+		strings.Join(placeholders, ", "), t.returningClause())
+
+	return query, args
+}
+
+func (t *Table) updateQuery(key interface{}, values ColumnValues) (string, []interface{}) {
+	columns := values.sortedColumns()
+
+	args := make([]interface{}, len(columns), len(columns)+1)
+	assignments := make([]string, len(columns), len(columns)+1)
+
+	for i, column := range columns {
+		args[i] = values[column]
+		assignments[i] = fmt.Sprintf("%s = $%d", QuoteIdentifier(column), i+1)
+	}
+
+	assignments = append(assignments,
+		UpdateTimeColumn+" = "+currentTimestamp)
+
+	args = append(args, key)
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = $%d AND %s%s",
+		QuoteIdentifier(t.Name), strings.Join(assignments, ", "),
+		QuoteIdentifier(t.keyColumn()), len(args), LiveRowCondition,
+		t.returningClause())
+
+	return query, args
+}
+
+func (t *Table) softDeleteQuery(key interface{}) (string, []interface{}) {
+	query := fmt.Sprintf("UPDATE %s SET %s = %s, %s = %s WHERE %s = $1 AND %s",
+		QuoteIdentifier(t.Name),
+		DeletionTimeColumn, currentTimestamp,
+		UpdateTimeColumn, currentTimestamp,
+		QuoteIdentifier(t.keyColumn()), LiveRowCondition)
+
+	return query, []interface{}{key}
+}
+
+// InsertObject inserts a row, setting creation and update times. If obj is
+// not nil, it is loaded from the inserted row.
+func InsertObject(conn Conn, t *Table, values ColumnValues, obj Object) error {
+	ctx := context.Background()
+	return InsertObjectContext(ctx, conn, t, values, obj)
+}
+
+func InsertObjectContext(ctx context.Context, conn Conn, t *Table, values ColumnValues, obj Object) error {
+	query, args := t.insertQuery(values)
+	return writeObject(ctx, conn, t, query, args, obj)
+}
+
+// UpdateObject updates a row which has not been soft deleted and sets its
+// update time. ErrObjectNotFound is returned if there is no such row.
+func UpdateObject(conn Conn, t *Table, key interface{}, values ColumnValues, obj Object) error {
+	ctx := context.Background()
+	return UpdateObjectContext(ctx, conn, t, key, values, obj)
+}
+
+func UpdateObjectContext(ctx context.Context, conn Conn, t *Table, key interface{}, values ColumnValues, obj Object) error {
+	query, args := t.updateQuery(key, values)
+	return writeObject(ctx, conn, t, query, args, obj)
+}
+
+// SoftDeleteObject sets the deletion time of a row. ErrObjectNotFound is
+// returned if there is no such row or if it has already been deleted.
+func SoftDeleteObject(conn Conn, t *Table, key interface{}) error {
+	ctx := context.Background()
+	return SoftDeleteObjectContext(ctx, conn, t, key)
+}
+
+func SoftDeleteObjectContext(ctx context.Context, conn Conn, t *Table, key interface{}) error {
+	query, args := t.softDeleteQuery(key)
+
+	n, err := Exec2Context(ctx, conn, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrObjectNotFound
+	}
+
+	return nil
+}
+
+func writeObject(ctx context.Context, conn Conn, t *Table, query string, args []interface{}, obj Object) error {
+	if obj == nil || len(t.Columns) == 0 {
+		n, err := Exec2Context(ctx, conn, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return ErrObjectNotFound
+		}
+
+		return nil
+	}
+
+	err := QueryObjectContext(ctx, conn, obj, query, args...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrObjectNotFound
+	}
+
+	return err
+}
+
+func quoteIdentifiers(names []string) string {
+	quotedNames := make([]string, len(names))
+	for i, name := range names {
+		quotedNames[i] = QuoteIdentifier(name)
+	}
+
+	return strings.Join(quotedNames, ", ")
+}
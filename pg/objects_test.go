@@ -0,0 +1,53 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	table := Table{
+		Name:    "users",
+		Columns: []string{"id", "name", "email"},
+	}
+
+	values := ColumnValues{"name": "bob", "email": "bob@example.com"}
+
+	query, args := table.insertQuery(values)
+	assert.Equal(`INSERT INTO users (email, name, created_at, updated_at) `+
+		`VALUES ($1, $2, (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'), `+
+		`(CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) `+
+		`RETURNING id, name, email`, query)
+	assert.Equal([]interface{}{"bob@example.com", "bob"}, args)
+
+	query, args = table.updateQuery(42, values)
+	assert.Equal(`UPDATE users SET email = $1, name = $2, `+
+		`updated_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') `+
+		`WHERE id = $3 AND deleted_at IS NULL `+
+		`RETURNING id, name, email`, query)
+	assert.Equal([]interface{}{"bob@example.com", "bob", 42}, args)
+
+	query, args = table.softDeleteQuery(42)
+	assert.Equal(`UPDATE users `+
+		`SET deleted_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'), `+
+		`updated_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') `+
+		`WHERE id = $1 AND deleted_at IS NULL`, query)
+	assert.Equal([]interface{}{42}, args)
+}
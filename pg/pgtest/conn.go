@@ -0,0 +1,264 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var whitespaceRE = regexp.MustCompile(`\s+`)
+
+// Conn is a scripted implementation of pg.Conn. Each query must match the
+// next expectation, except for queries used to manage schema versions and
+// advisory locks which are handled in memory.
+type Conn struct {
+	SchemaVersions map[string][]string
+
+	expectations []*Expectation
+	lock         sync.Mutex
+}
+
+type Expectation struct {
+	Query string
+	Args  []interface{}
+
+	checkArgs bool
+	columns   []string
+	rows      [][]interface{}
+	tag       string
+	err       error
+}
+
+func NewConn() *Conn {
+	return &Conn{
+		SchemaVersions: make(map[string][]string),
+	}
+}
+
+func (c *Conn) Expect(query string) *Expectation {
+	e := &Expectation{
+		Query: normalizeQuery(query),
+	}
+
+	c.lock.Lock()
+	c.expectations = append(c.expectations, e)
+	c.lock.Unlock()
+
+	return e
+}
+
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	e.Args = args
+	e.checkArgs = true
+	return e
+}
+
+func (e *Expectation) ReturnRows(columns []string, rows ...[]interface{}) *Expectation {
+	e.columns = columns
+	e.rows = rows
+	return e
+}
+
+func (e *Expectation) ReturnCommandTag(tag string) *Expectation {
+	e.tag = tag
+	return e
+}
+
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// ExpectationsWereMet returns an error if some expected queries were not
+// executed.
+func (c *Conn) ExpectationsWereMet() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.expectations) > 0 {
+		return fmt.Errorf("%d expected queries were not executed, next "+
+			"query: %q", len(c.expectations), c.expectations[0].Query)
+	}
+
+	return nil
+}
+
+func (c *Conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &Tx{conn: c}, nil
+}
+
+func (c *Conn) BeginFunc(ctx context.Context, fn func(pgx.Tx) error) error {
+	tx, err := c.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (c *Conn) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	e, err := c.execute(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgconn.CommandTag(e.tag), e.err
+}
+
+func (c *Conn) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	e, err := c.execute(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return newRows(e), nil
+}
+
+func (c *Conn) QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	e, err := c.execute(query, args)
+	if err != nil {
+		return &Row{err: err}
+	}
+
+	if e.err != nil {
+		return &Row{err: e.err}
+	}
+
+	return &Row{rows: newRows(e)}
+}
+
+func (c *Conn) QueryFunc(ctx context.Context, query string, args []interface{}, scans []interface{}, fn func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	rows, err := c.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(scans...); err != nil {
+			return nil, err
+		}
+
+		if err := fn(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	return rows.CommandTag(), rows.Err()
+}
+
+func (c *Conn) execute(query string, args []interface{}) (*Expectation, error) {
+	query = normalizeQuery(query)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.expectations) > 0 && c.expectations[0].Query == query {
+		e := c.expectations[0]
+		c.expectations = c.expectations[1:]
+
+		if e.checkArgs && !reflect.DeepEqual(e.Args, args) {
+			return nil, fmt.Errorf("unexpected arguments for query %q: "+
+				"got %v, expected %v", query, args, e.Args)
+		}
+
+		return e, nil
+	}
+
+	if e, handled := c.executeBuiltinQuery(query, args); handled {
+		return e, nil
+	}
+
+	if len(c.expectations) == 0 {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+
+	return nil, fmt.Errorf("unexpected query %q, expected %q",
+		query, c.expectations[0].Query)
+}
+
+func (c *Conn) executeBuiltinQuery(query string, args []interface{}) (*Expectation, bool) {
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_xact_lock("):
+		return &Expectation{tag: "SELECT 1"}, true
+
+	case strings.HasPrefix(query, "SELECT pg_try_advisory_xact_lock("):
+		return &Expectation{
+			columns: []string{"pg_try_advisory_xact_lock"},
+			rows:    [][]interface{}{{true}},
+			tag:     "SELECT 1",
+		}, true
+
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_versions"):
+		return &Expectation{tag: "CREATE TABLE"}, true
+
+	case strings.HasPrefix(query, "SELECT version FROM schema_versions"):
+		if len(args) != 1 {
+			break
+		}
+
+		schema, _ := args[0].(string)
+
+		e := Expectation{columns: []string{"version"}}
+		for _, version := range c.SchemaVersions[schema] {
+			e.rows = append(e.rows, []interface{}{version})
+		}
+
+		return &e, true
+
+	case strings.HasPrefix(query, "INSERT INTO schema_versions"):
+		if len(args) != 2 {
+			break
+		}
+
+		schema, _ := args[0].(string)
+		version, _ := args[1].(string)
+
+		for _, v := range c.SchemaVersions[schema] {
+			if v == version {
+				err := errors.New("duplicate schema version")
+				return &Expectation{err: err}, true
+			}
+		}
+
+		c.SchemaVersions[schema] = append(c.SchemaVersions[schema], version)
+
+		return &Expectation{tag: "INSERT 0 1"}, true
+	}
+
+	return nil, false
+}
+
+func normalizeQuery(query string) string {
+	return strings.TrimSpace(whitespaceRE.ReplaceAllString(query, " "))
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/exograd/go-daemon/pg"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ pg.Conn = (*Conn)(nil)
+
+func TestConn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	conn := NewConn()
+
+	conn.Expect(`SELECT id, name FROM users WHERE id = $1`).
+		WithArgs(42).
+		ReturnRows([]string{"id", "name"}, []interface{}{42, "bob"})
+
+	var id int
+	var name string
+	err := conn.QueryRow(ctx, `
+SELECT id, name
+  FROM users
+  WHERE id = $1`, 42).Scan(&id, &name)
+	require.NoError(err)
+	assert.Equal(42, id)
+	assert.Equal("bob", name)
+
+	_, err = conn.Exec(ctx, `DELETE FROM users`)
+	assert.Error(err)
+
+	assert.NoError(conn.ExpectationsWereMet())
+}
+
+type testUser struct {
+	Id   int
+	Name string
+}
+
+func (u *testUser) FromRow(row pgx.Row) error {
+	return row.Scan(&u.Id, &u.Name)
+}
+
+func TestConnGenericQueries(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn := NewConn()
+
+	columns := []string{"id", "name"}
+
+	conn.Expect(`SELECT id, name FROM users WHERE id = $1`).
+		WithArgs(1).
+		ReturnRows(columns, []interface{}{1, "bob"})
+
+	conn.Expect(`SELECT id, name FROM users`).
+		ReturnRows(columns,
+			[]interface{}{1, "bob"}, []interface{}{2, "alice"})
+
+	user, err := pg.QueryOne[testUser](conn,
+		`SELECT id, name FROM users WHERE id = $1`, 1)
+	require.NoError(err)
+	assert.Equal(&testUser{Id: 1, Name: "bob"}, user)
+
+	users, err := pg.QueryMany[testUser](conn, `SELECT id, name FROM users`)
+	require.NoError(err)
+	assert.Equal([]*testUser{{1, "bob"}, {2, "alice"}}, users)
+
+	assert.NoError(conn.ExpectationsWereMet())
+}
+
+func TestConnSavepoints(t *testing.T) {
+	assert := assert.New(t)
+
+	conn := NewConn()
+
+	conn.Expect(`SAVEPOINT a`)
+	conn.Expect(`INSERT INTO users (name) VALUES ('bob')`)
+	conn.Expect(`RELEASE SAVEPOINT a`)
+
+	conn.Expect(`SAVEPOINT b`)
+	conn.Expect(`INSERT INTO users (name) VALUES ('bob')`).
+		ReturnError(errors.New("duplicate user"))
+	conn.Expect(`ROLLBACK TO SAVEPOINT b`)
+	conn.Expect(`RELEASE SAVEPOINT b`)
+
+	insert := func(conn pg.Conn) error {
+		return pg.Exec(conn, `INSERT INTO users (name) VALUES ('bob')`)
+	}
+
+	assert.NoError(pg.WithSavepoint(conn, "a", insert))
+	assert.EqualError(pg.WithSavepoint(conn, "b", insert), "duplicate user")
+
+	assert.NoError(conn.ExpectationsWereMet())
+}
+
+func TestConnNamedLocks(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	conn := NewConn()
+
+	assert.NoError(pg.TakeNamedLock(ctx, conn, "foo"))
+
+	locked, err := pg.TryTakeNamedLock(ctx, conn, "foo")
+	if assert.NoError(err) {
+		assert.True(locked)
+	}
+
+	assert.NoError(conn.ExpectationsWereMet())
+}
+
+func TestConnMigrations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn := NewConn()
+	conn.SchemaVersions["main"] = []string{"20220101T000000Z"}
+
+	migrations := pg.Migrations{
+		{Schema: "main", Version: "20220301T000000Z", Code: []byte("m3")},
+		{Schema: "main", Version: "20220101T000000Z", Code: []byte("m1")},
+		{Schema: "main", Version: "20220201T000000Z", Code: []byte("m2")},
+	}
+
+	pending, err := pg.PendingMigrations(conn, "main", migrations)
+	require.NoError(err)
+	require.Len(pending, 2)
+	assert.Equal("20220201T000000Z", pending[0].Version)
+	assert.Equal("20220301T000000Z", pending[1].Version)
+
+	conn.Expect("m2")
+	require.NoError(pending[0].Apply(conn))
+
+	assert.Equal([]string{"20220101T000000Z", "20220201T000000Z"},
+		conn.SchemaVersions["main"])
+	assert.NoError(conn.ExpectationsWereMet())
+}
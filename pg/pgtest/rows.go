@@ -0,0 +1,197 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pgtest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+type Rows struct {
+	columns []string
+	rows    [][]interface{}
+	tag     string
+
+	index  int
+	closed bool
+	err    error
+}
+
+func newRows(e *Expectation) *Rows {
+	return &Rows{
+		columns: e.columns,
+		rows:    e.rows,
+		tag:     e.tag,
+
+		index: -1,
+	}
+}
+
+func (r *Rows) Close() {
+	r.closed = true
+}
+
+func (r *Rows) Err() error {
+	return r.err
+}
+
+func (r *Rows) CommandTag() pgconn.CommandTag {
+	if r.tag == "" {
+		return pgconn.CommandTag(fmt.Sprintf("SELECT %d", len(r.rows)))
+	}
+
+	return pgconn.CommandTag(r.tag)
+}
+
+func (r *Rows) FieldDescriptions() []pgproto3.FieldDescription {
+	fields := make([]pgproto3.FieldDescription, len(r.columns))
+	for i, column := range r.columns {
+		fields[i].Name = []byte(column)
+	}
+
+	return fields
+}
+
+func (r *Rows) Next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+
+	r.index++
+
+	if r.index >= len(r.rows) {
+		r.Close()
+		return false
+	}
+
+	return true
+}
+
+func (r *Rows) Scan(dests ...interface{}) error {
+	if r.index < 0 || r.index >= len(r.rows) {
+		return fmt.Errorf("no current row")
+	}
+
+	row := r.rows[r.index]
+
+	if len(dests) != len(row) {
+		return fmt.Errorf("cannot scan %d values into %d destinations",
+			len(row), len(dests))
+	}
+
+	for i, dest := range dests {
+		if err := scanValue(row[i], dest); err != nil {
+			r.err = fmt.Errorf("cannot scan column %d: %w", i, err)
+			return r.err
+		}
+	}
+
+	return nil
+}
+
+func (r *Rows) Values() ([]interface{}, error) {
+	if r.index < 0 || r.index >= len(r.rows) {
+		return nil, fmt.Errorf("no current row")
+	}
+
+	return r.rows[r.index], nil
+}
+
+func (r *Rows) RawValues() [][]byte {
+	if r.index < 0 || r.index >= len(r.rows) {
+		return nil
+	}
+
+	row := r.rows[r.index]
+
+	values := make([][]byte, len(row))
+	for i, value := range row {
+		if value != nil {
+			values[i] = []byte(fmt.Sprintf("%v", value))
+		}
+	}
+
+	return values
+}
+
+type Row struct {
+	rows *Rows
+	err  error
+}
+
+func (r *Row) Scan(dests ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+
+		return pgx.ErrNoRows
+	}
+
+	return r.rows.Scan(dests...)
+}
+
+func scanValue(value, dest interface{}) error {
+	if dest == nil {
+		return nil
+	}
+
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+		return fmt.Errorf("destination is not a non-nil pointer")
+	}
+
+	elem := destValue.Elem()
+
+	if value == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+
+	switch {
+	case v.Type().AssignableTo(elem.Type()):
+		elem.Set(v)
+
+	case elem.Kind() == reflect.Ptr && v.Type().AssignableTo(elem.Type().Elem()):
+		ptr := reflect.New(elem.Type().Elem())
+		ptr.Elem().Set(v)
+		elem.Set(ptr)
+
+	case v.Type().ConvertibleTo(elem.Type()) && v.Kind() == elem.Kind():
+		elem.Set(v.Convert(elem.Type()))
+
+	default:
+		return fmt.Errorf("cannot assign value of type %T to %T", value, dest)
+	}
+
+	return nil
+}
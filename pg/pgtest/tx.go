@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pgtest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrNotSupported = errors.New("operation not supported by pgtest")
+
+// Tx is a transaction on a mock connection. Queries are forwarded to the
+// connection; commits and rollbacks have no effect.
+type Tx struct {
+	conn   *Conn
+	closed bool
+}
+
+func (tx *Tx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &Tx{conn: tx.conn}, nil
+}
+
+func (tx *Tx) BeginFunc(ctx context.Context, fn func(pgx.Tx) error) error {
+	return tx.conn.BeginFunc(ctx, fn)
+}
+
+func (tx *Tx) Commit(ctx context.Context) error {
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+
+	tx.closed = true
+	return nil
+}
+
+func (tx *Tx) Rollback(ctx context.Context) error {
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+
+	tx.closed = true
+	return nil
+}
+
+func (tx *Tx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+func (tx *Tx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	panic(ErrNotSupported)
+}
+
+func (tx *Tx) LargeObjects() pgx.LargeObjects {
+	panic(ErrNotSupported)
+}
+
+func (tx *Tx) Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	return nil, ErrNotSupported
+}
+
+func (tx *Tx) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tx.conn.Exec(ctx, query, args...)
+}
+
+func (tx *Tx) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	return tx.conn.Query(ctx, query, args...)
+}
+
+func (tx *Tx) QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	return tx.conn.QueryRow(ctx, query, args...)
+}
+
+func (tx *Tx) QueryFunc(ctx context.Context, query string, args []interface{}, scans []interface{}, fn func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	return tx.conn.QueryFunc(ctx, query, args, scans, fn)
+}
+
+func (tx *Tx) Conn() *pgx.Conn {
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// The state of a replica is unknown until it has been checked, so that
+// the result of the first check is always logged.
+const (
+	replicaStateUnknown int32 = iota
+	replicaStateHealthy
+	replicaStateUnhealthy
+)
+
+type replica struct {
+	uri  string
+	pool *pgxpool.Pool
+	ping func(context.Context) error
+
+	state int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.state) == replicaStateHealthy
+}
+
+// setHealthy updates the state of the replica and returns true if it has
+// changed.
+func (r *replica) setHealthy(healthy bool) bool {
+	state := replicaStateUnhealthy
+	if healthy {
+		state = replicaStateHealthy
+	}
+
+	return atomic.SwapInt32(&r.state, state) != state
+}
+
+func (c *Client) connectReplicas() error {
+	for _, uri := range c.Cfg.ReplicaURIs {
+		c.Log.Info("connecting to replica %q", uri)
+
+		poolCfg, err := c.poolCfg(uri)
+		if err != nil {
+			return fmt.Errorf("invalid replica uri %q: %w", uri, err)
+		}
+
+		// Replicas are optional: if one of them is not available at startup,
+		// we still want the client to be usable and to fall back to the
+		// primary database until the health check marks it as available.
+		poolCfg.LazyConnect = true
+
+		ctx := context.Background()
+		pool, err := pgxpool.ConnectConfig(ctx, poolCfg)
+		if err != nil {
+			return fmt.Errorf("cannot connect to replica at %q: %w", uri, err)
+		}
+
+		r := &replica{
+			uri:  uri,
+			pool: pool,
+			ping: pool.Ping,
+		}
+
+		c.replicas = append(c.replicas, r)
+
+		c.checkReplica(r)
+	}
+
+	return nil
+}
+
+func (c *Client) closeReplicas() {
+	for _, r := range c.replicas {
+		r.pool.Close()
+	}
+}
+
+func (c *Client) replicaCheckMain() {
+	defer c.wg.Done()
+
+	timer := time.NewTicker(c.Cfg.ReplicaCheckInterval.Duration())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+
+		case <-timer.C:
+			for _, r := range c.replicas {
+				c.checkReplica(r)
+			}
+		}
+	}
+}
+
+func (c *Client) checkReplica(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := r.ping(ctx)
+
+	if r.setHealthy(err == nil) {
+		if err == nil {
+			c.Log.Info("replica %q available", r.uri)
+		} else {
+			c.Log.Error("replica %q unavailable: %v", r.uri, err)
+		}
+	}
+}
+
+func (c *Client) nextReplica() *replica {
+	n := uint32(len(c.replicas))
+	if n == 0 {
+		return nil
+	}
+
+	start := atomic.AddUint32(&c.replicaIndex, 1)
+
+	for i := uint32(0); i < n; i++ {
+		r := c.replicas[(start+i)%n]
+		if r.isHealthy() {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// ReadConn returns a connection pool which can be used for a single read
+// query, e.g. with QueryObject, without calling WithReadConn. The pool of a
+// healthy replica is returned if there is one, or the pool of the primary
+// database if there is not. Contrary to WithReadConn, there is no fallback
+// to the primary database if the replica cannot be reached: the query
+// fails, and the replica is only skipped once the next health check has
+// marked it as unavailable.
+func (c *Client) ReadConn() Conn {
+	if r := c.nextReplica(); r != nil {
+		return r.pool
+	}
+
+	return c.Pool
+}
+
+func (c *Client) WithReadConn(fn func(Conn) error) error {
+	// Read connections are acquired from a healthy replica if there is one,
+	// or from the primary database if there is not. Note that replication
+	// being asynchronous, there is no guarantee that data written on the
+	// primary database are immediately visible.
+
+	r := c.nextReplica()
+	if r == nil {
+		return c.WithConn(fn)
+	}
+
+	ctx := context.Background()
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		if r.setHealthy(false) {
+			c.Log.Error("replica %q unavailable: %v", r.uri, err)
+		}
+
+		return c.WithConn(fn)
+	}
+	defer conn.Release()
+
+	return fn(conn)
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testReplicaHealth struct {
+	err error
+}
+
+func (h *testReplicaHealth) ping(ctx context.Context) error {
+	return h.err
+}
+
+func TestClientReplicaHealthChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	health1 := &testReplicaHealth{}
+	health2 := &testReplicaHealth{}
+
+	r1 := &replica{uri: "replica1", ping: health1.ping}
+	r2 := &replica{uri: "replica2", ping: health2.ping}
+
+	c := &Client{
+		Log: dlog.DefaultLogger("test"),
+
+		replicas: []*replica{r1, r2},
+	}
+
+	checkReplicas := func() {
+		for _, r := range c.replicas {
+			c.checkReplica(r)
+		}
+	}
+
+	// Replicas are not used before being checked
+	assert.Nil(c.nextReplica())
+
+	// Healthy replicas are used in turn
+	checkReplicas()
+
+	used := make(map[*replica]bool)
+	for i := 0; i < 2; i++ {
+		used[c.nextReplica()] = true
+	}
+	assert.Equal(map[*replica]bool{r1: true, r2: true}, used)
+
+	// Unhealthy replicas are skipped
+	health1.err = errors.New("connection refused")
+	checkReplicas()
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(r2, c.nextReplica())
+	}
+
+	// Without any healthy replica, the primary database is used
+	health2.err = errors.New("connection refused")
+	checkReplicas()
+
+	assert.Nil(c.nextReplica())
+
+	// Replicas are used again once they are back
+	health1.err = nil
+	checkReplicas()
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(r1, c.nextReplica())
+	}
+}
+
+func TestClientWithReadConnFallback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newPool := func() *pgxpool.Pool {
+		poolCfg, err := pgxpool.ParseConfig(
+			"postgres://localhost:1/test?connect_timeout=1")
+		require.NoError(err)
+
+		poolCfg.LazyConnect = true
+
+		pool, err := pgxpool.ConnectConfig(context.Background(), poolCfg)
+		require.NoError(err)
+
+		t.Cleanup(pool.Close)
+
+		return pool
+	}
+
+	r := &replica{
+		uri:  "replica",
+		pool: newPool(),
+		ping: (&testReplicaHealth{}).ping,
+	}
+
+	c := &Client{
+		Log: dlog.DefaultLogger("test"),
+
+		Pool: newPool(),
+
+		replicas: []*replica{r},
+	}
+
+	c.checkReplica(r)
+	require.True(r.isHealthy())
+
+	// The replica cannot be reached: it is marked as unavailable and the
+	// primary database is used instead.
+	called := false
+	err := c.WithReadConn(func(conn Conn) error {
+		called = true
+		return nil
+	})
+
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "cannot acquire connection")
+	}
+
+	assert.False(called)
+	assert.False(r.isHealthy())
+}
+
+func TestReplicaInitialState(t *testing.T) {
+	assert := assert.New(t)
+
+	// The first check always changes the state of the replica, so that a
+	// replica unavailable at startup is reported.
+	r := &replica{uri: "replica"}
+	assert.False(r.isHealthy())
+	assert.True(r.setHealthy(false))
+	assert.False(r.setHealthy(false))
+
+	r = &replica{uri: "replica"}
+	assert.True(r.setHealthy(true))
+	assert.True(r.isHealthy())
+}
+
+func TestClientReadConn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newPool := func() *pgxpool.Pool {
+		poolCfg, err := pgxpool.ParseConfig(
+			"postgres://localhost:1/test?connect_timeout=1")
+		require.NoError(err)
+
+		poolCfg.LazyConnect = true
+
+		pool, err := pgxpool.ConnectConfig(context.Background(), poolCfg)
+		require.NoError(err)
+
+		t.Cleanup(pool.Close)
+
+		return pool
+	}
+
+	health := &testReplicaHealth{}
+
+	r := &replica{uri: "replica", pool: newPool(), ping: health.ping}
+
+	c := &Client{
+		Log: dlog.DefaultLogger("test"),
+
+		Pool: newPool(),
+
+		replicas: []*replica{r},
+	}
+
+	c.checkReplica(r)
+	assert.Equal(r.pool, c.ReadConn())
+
+	health.err = errors.New("connection refused")
+	c.checkReplica(r)
+	assert.Equal(c.Pool, c.ReadConn())
+}
+
+func TestClientCloseTwice(t *testing.T) {
+	require := require.New(t)
+
+	c, err := NewClient(ClientCfg{
+		URI: "postgres://localhost:1/test?connect_timeout=1",
+
+		ReplicaURIs: []string{"postgres://localhost:1/replica"},
+
+		Startup: &StartupCfg{
+			MaxAttempts:   1,
+			InitialDelay:  dtime.Duration(10 * time.Millisecond),
+			StartDegraded: true,
+		},
+	})
+	require.NoError(err)
+
+	c.Close()
+	c.Close()
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithSavepoint executes a function in a savepoint of the current
+// transaction. If the function fails, the transaction is rolled back to the
+// savepoint, discarding the changes made by the function but leaving the
+// transaction usable, and the error of the function is returned. Savepoints
+// can be nested.
+func WithSavepoint(conn Conn, name string, fn func(Conn) error) error {
+	ctx := context.Background()
+	return WithSavepointContext(ctx, conn, name, fn)
+}
+
+func WithSavepointContext(ctx context.Context, conn Conn, name string, fn func(Conn) error) error {
+	id := QuoteIdentifier(name)
+
+	if _, err := conn.Exec(ctx, "SAVEPOINT "+id); err != nil {
+		return fmt.Errorf("cannot create savepoint: %w", err)
+	}
+
+	if err := fn(conn); err != nil {
+		if _, rollbackErr := conn.Exec(ctx, "ROLLBACK TO SAVEPOINT "+id); rollbackErr != nil {
+			return fmt.Errorf("cannot rollback to savepoint: %v (original "+
+				"error: %w)", rollbackErr, err)
+		}
+
+		// ROLLBACK TO does not destroy the savepoint
+		if _, releaseErr := conn.Exec(ctx, "RELEASE SAVEPOINT "+id); releaseErr != nil {
+			return fmt.Errorf("cannot release savepoint: %v (original "+
+				"error: %w)", releaseErr, err)
+		}
+
+		return err
+	}
+
+	if _, err := conn.Exec(ctx, "RELEASE SAVEPOINT "+id); err != nil {
+		return fmt.Errorf("cannot release savepoint: %w", err)
+	}
+
+	return nil
+}
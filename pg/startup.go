@@ -0,0 +1,201 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dtime"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// StartupCfg controls how the client behaves when the database is not
+// available when it is created.
+type StartupCfg struct {
+	MaxAttempts  int            `json:"max_attempts,omitempty"`
+	InitialDelay dtime.Duration `json:"initial_delay,omitempty"`
+	MaxDelay     dtime.Duration `json:"max_delay,omitempty"`
+	Timeout      dtime.Duration `json:"timeout,omitempty"`
+
+	// If the database is still unavailable once all attempts have failed,
+	// create the client anyway and keep trying to connect in the background;
+	// schemas are updated as soon as the connection is established, with at
+	// most MaxAttempts attempts.
+	StartDegraded bool `json:"start_degraded,omitempty"`
+}
+
+func (cfg *StartupCfg) Check(c *check.Checker) {
+	c.CheckIntMin("max_attempts", cfg.MaxAttempts, 0)
+
+	if cfg.InitialDelay != 0 {
+		c.CheckDurationMin("initial_delay", cfg.InitialDelay.Duration(),
+			10*time.Millisecond)
+	}
+
+	// Delays which are not set are replaced by default values; they must
+	// be taken into account when comparing delays.
+	effectiveCfg := *cfg
+	effectiveCfg.setDefaults()
+
+	if cfg.MaxDelay != 0 {
+		c.CheckDurationMin("max_delay", cfg.MaxDelay.Duration(),
+			effectiveCfg.InitialDelay.Duration())
+	} else if cfg.InitialDelay != 0 {
+		c.CheckDurationMax("initial_delay", cfg.InitialDelay.Duration(),
+			effectiveCfg.MaxDelay.Duration())
+	}
+
+	if cfg.Timeout != 0 {
+		c.CheckDurationMin("timeout", cfg.Timeout.Duration(), time.Second)
+	}
+}
+
+func (cfg *StartupCfg) setDefaults() {
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	if cfg.InitialDelay == 0 {
+		cfg.InitialDelay = dtime.Duration(500 * time.Millisecond)
+	}
+
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = dtime.Duration(10 * time.Second)
+	}
+}
+
+// Connected returns true if a connection to the primary database has been
+// established. It is always true unless the client was started degraded.
+func (c *Client) Connected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+func (c *Client) connect(poolCfg *pgxpool.Config) (*pgxpool.Pool, error) {
+	cfg := c.Cfg.Startup
+
+	ctx := context.Background()
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout.Duration())
+		defer cancel()
+	}
+
+	delay := cfg.InitialDelay.Duration()
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		var pool *pgxpool.Pool
+
+		pool, err = pgxpool.ConnectConfig(ctx, poolCfg)
+		if err == nil {
+			atomic.StoreInt32(&c.connected, 1)
+			return pool, nil
+		}
+
+		if attempt >= cfg.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		c.Log.Error("cannot connect to database (attempt %d/%d), retrying "+
+			"in %v: %v", attempt, cfg.MaxAttempts, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+
+		delay *= 2
+		if max := cfg.MaxDelay.Duration(); delay > max {
+			delay = max
+		}
+	}
+
+	if !cfg.StartDegraded {
+		return nil, err
+	}
+
+	c.Log.Error("cannot connect to database, starting degraded: %v", err)
+
+	poolCfg.LazyConnect = true
+
+	return pgxpool.ConnectConfig(context.Background(), poolCfg)
+}
+
+// connectMain waits for the database to be available, then updates
+// schemas. Schema updates are attempted at most MaxAttempts times; if they
+// keep failing, the client gives up and is never marked as connected.
+func (c *Client) connectMain() {
+	defer c.wg.Done()
+
+	cfg := c.Cfg.Startup
+
+	delay := cfg.InitialDelay.Duration()
+	connected := false
+	nbSchemaUpdateAttempts := 0
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-time.After(delay):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := c.Pool.Ping(ctx)
+		cancel()
+
+		if err != nil {
+			c.Log.Error("cannot connect to database: %v", err)
+		} else {
+			if !connected {
+				c.Log.Info("connected to database")
+				connected = true
+			}
+
+			if !c.schemaUpdatesEnabled() {
+				atomic.StoreInt32(&c.connected, 1)
+				return
+			}
+
+			err = c.updateSchemas()
+			if err == nil {
+				atomic.StoreInt32(&c.connected, 1)
+				return
+			}
+
+			nbSchemaUpdateAttempts++
+
+			if nbSchemaUpdateAttempts >= cfg.MaxAttempts {
+				c.Log.Error("cannot update schemas (attempt %d/%d), "+
+					"giving up: %v", nbSchemaUpdateAttempts,
+					cfg.MaxAttempts, err)
+				return
+			}
+
+			c.Log.Error("cannot update schemas (attempt %d/%d), retrying "+
+				"in %v: %v", nbSchemaUpdateAttempts, cfg.MaxAttempts, delay,
+				err)
+		}
+
+		delay *= 2
+		if max := cfg.MaxDelay.Duration(); delay > max {
+			delay = max
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tenant schemas are Postgres schemas sharing the same set of migrations.
+// Each tenant schema has its own schema_versions table, and tenant queries
+// are executed with a search path containing the tenant schema followed by
+// the public schema.
+
+type TenantMigrationProgress struct {
+	TenantSchema string
+	Index        int // starting at 1
+	Count        int
+	Err          error
+}
+
+// TenantSchemas returns the names of all schemas starting with a prefix.
+func TenantSchemas(conn Conn, prefix string) ([]string, error) {
+	ctx := context.Background()
+
+	query := `
+SELECT schema_name
+  FROM information_schema.schemata
+  WHERE starts_with(schema_name, $1)
+  ORDER BY schema_name
+`
+	rows, err := conn.Query(ctx, query, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func CreateTenantSchema(conn Conn, name string) error {
+	return Exec(conn, "CREATE SCHEMA IF NOT EXISTS "+QuoteIdentifier(name))
+}
+
+func DropTenantSchema(conn Conn, name string) error {
+	return Exec(conn, "DROP SCHEMA IF EXISTS "+QuoteIdentifier(name)+
+		" CASCADE")
+}
+
+// SetTenantSearchPath sets the search path for the current transaction.
+func SetTenantSearchPath(conn Conn, name string) error {
+	query := "SET LOCAL search_path TO " + QuoteIdentifier(name) + ", public"
+	return Exec(conn, query)
+}
+
+// WithTenantTx executes a function in a transaction using the search path
+// of a tenant schema.
+func (c *Client) WithTenantTx(name string, fn func(Conn) error) error {
+	return c.withSearchPathTx(name, fn)
+}
+
+func (c *Client) withSearchPathTx(name string, fn func(Conn) error) error {
+	if name == "" {
+		return c.WithTx(fn)
+	}
+
+	return c.WithTx(func(conn Conn) error {
+		if err := SetTenantSearchPath(conn, name); err != nil {
+			return fmt.Errorf("cannot set search path: %w", err)
+		}
+
+		return fn(conn)
+	})
+}
+
+// UpdateTenantSchema creates a tenant schema if it does not exist and
+// applies pending migrations.
+func (c *Client) UpdateTenantSchema(name, schema, dirPath string) error {
+	c.Log.Info("updating tenant schema %q using migrations from %q",
+		name, dirPath)
+
+	if err := c.WithConn(func(conn Conn) error {
+		return CreateTenantSchema(conn, name)
+	}); err != nil {
+		return fmt.Errorf("cannot create schema %q: %w", name, err)
+	}
+
+	return c.updateSchema(schema, dirPath, name)
+}
+
+// UpdateTenantSchemas applies pending migrations to each tenant schema. If
+// progressFunc is not nil, it is called after each tenant schema. Migration
+// continues after a failure, and the first error is returned.
+func (c *Client) UpdateTenantSchemas(names []string, schema, dirPath string, progressFunc func(TenantMigrationProgress)) error {
+	var firstErr error
+
+	for i, name := range names {
+		err := c.UpdateTenantSchema(name, schema, dirPath)
+		if err != nil {
+			err = fmt.Errorf("cannot update tenant schema %q: %w", name, err)
+
+			c.Log.Error("%v", err)
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if progressFunc != nil {
+			progressFunc(TenantMigrationProgress{
+				TenantSchema: name,
+				Index:        i + 1,
+				Count:        len(names),
+				Err:          err,
+			})
+		}
+	}
+
+	return firstErr
+}
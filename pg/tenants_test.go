@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package pg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/exograd/go-daemon/dlog"
+	"github.com/exograd/go-daemon/pg/pgtest"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantSchemaQueries(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn := pgtest.NewConn()
+
+	conn.Expect(`
+SELECT schema_name
+  FROM information_schema.schemata
+  WHERE starts_with(schema_name, $1)
+  ORDER BY schema_name`).
+		WithArgs("tenant_").
+		ReturnRows([]string{"schema_name"},
+			[]interface{}{"tenant_a"}, []interface{}{"tenant_b"})
+
+	conn.Expect(`CREATE SCHEMA IF NOT EXISTS tenant_c`)
+	conn.Expect(`CREATE SCHEMA IF NOT EXISTS "tenant-D"`)
+	conn.Expect(`SET LOCAL search_path TO "tenant-D", public`)
+	conn.Expect(`DROP SCHEMA IF EXISTS tenant_c CASCADE`)
+
+	names, err := TenantSchemas(conn, "tenant_")
+	require.NoError(err)
+	assert.Equal([]string{"tenant_a", "tenant_b"}, names)
+
+	require.NoError(CreateTenantSchema(conn, "tenant_c"))
+	require.NoError(CreateTenantSchema(conn, "tenant-D"))
+	require.NoError(SetTenantSearchPath(conn, "tenant-D"))
+	require.NoError(DropTenantSchema(conn, "tenant_c"))
+
+	assert.NoError(conn.ExpectationsWereMet())
+}
+
+func TestUpdateTenantSchemasProgress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	poolCfg, err := pgxpool.ParseConfig(
+		"postgres://localhost:1/test?connect_timeout=1")
+	require.NoError(err)
+
+	poolCfg.LazyConnect = true
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolCfg)
+	require.NoError(err)
+	defer pool.Close()
+
+	c := &Client{
+		Log:  dlog.DefaultLogger("test"),
+		Pool: pool,
+	}
+
+	var progress []TenantMigrationProgress
+
+	// Migration continues after a failure and the first error is returned
+	err = c.UpdateTenantSchemas([]string{"tenant_a", "tenant_b"}, "test",
+		t.TempDir(), func(p TenantMigrationProgress) {
+			progress = append(progress, p)
+		})
+	require.Error(err)
+	assert.Contains(err.Error(), `"tenant_a"`)
+
+	require.Len(progress, 2)
+
+	assert.Equal("tenant_a", progress[0].TenantSchema)
+	assert.Equal(1, progress[0].Index)
+	assert.Equal(2, progress[0].Count)
+	assert.Equal(err, progress[0].Err)
+
+	assert.Equal("tenant_b", progress[1].TenantSchema)
+	assert.Equal(2, progress[1].Index)
+	assert.Equal(2, progress[1].Count)
+	assert.Error(progress[1].Err)
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package sentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-daemon/check"
+	"github.com/exograd/go-daemon/dcrypto"
+	"github.com/exograd/go-daemon/dhttp"
+	"github.com/exograd/go-daemon/dlog"
+)
+
+type ClientCfg struct {
+	Log        *dlog.Logger  `json:"-"`
+	HTTPClient *dhttp.Client `json:"-"`
+	Hostname   string        `json:"-"`
+
+	DSN         string `json:"dsn"`
+	Environment string `json:"environment,omitempty"`
+	Release     string `json:"release,omitempty"`
+	QueueSize   int    `json:"queue_size,omitempty"`
+}
+
+func (cfg *ClientCfg) Check(c *check.Checker) {
+	c.CheckStringHTTPURI("dsn", cfg.DSN)
+
+	if cfg.QueueSize != 0 {
+		c.CheckIntMin("queue_size", cfg.QueueSize, 1)
+	}
+}
+
+func HTTPClientCfg(cfg *ClientCfg) dhttp.ClientCfg {
+	return dhttp.ClientCfg{}
+}
+
+type Client struct {
+	Cfg        ClientCfg
+	Log        *dlog.Logger
+	HTTPClient *dhttp.Client
+
+	storeURI  *url.URL
+	publicKey string
+
+	eventChan chan *Event
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+type Event struct {
+	EventId     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Logger      string                 `json:"logger,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Message     EventMessage           `json:"message"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+type EventMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+// Data entries sent as event tags instead of extra data
+var TagNames = []string{"request_id", "route_id", "server", "client"}
+
+func NewClient(cfg ClientCfg) (*Client, error) {
+	if cfg.Log == nil {
+		cfg.Log = dlog.DefaultLogger("sentry")
+	}
+
+	if cfg.HTTPClient == nil {
+		return nil, fmt.Errorf("missing http client")
+	}
+
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 100
+	}
+
+	storeURI, publicKey, err := parseDSN(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsn: %w", err)
+	}
+
+	c := &Client{
+		Cfg:        cfg,
+		Log:        cfg.Log,
+		HTTPClient: cfg.HTTPClient,
+
+		storeURI:  storeURI,
+		publicKey: publicKey,
+
+		eventChan: make(chan *Event, cfg.QueueSize),
+
+		stopChan: make(chan struct{}),
+	}
+
+	return c, nil
+}
+
+func parseDSN(dsn string) (*url.URL, string, error) {
+	// DSN format: <scheme>://<public-key>@<host>[/<path>]/<project-id>
+
+	uri, err := url.Parse(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if uri.User == nil || uri.User.Username() == "" {
+		return nil, "", fmt.Errorf("missing public key")
+	}
+
+	publicKey := uri.User.Username()
+
+	uriPath := strings.TrimSuffix(uri.Path, "/")
+
+	idx := strings.LastIndexByte(uriPath, '/')
+	if idx == -1 || idx == len(uriPath)-1 {
+		return nil, "", fmt.Errorf("missing project id")
+	}
+
+	projectId := uriPath[idx+1:]
+
+	storeURI := url.URL{
+		Scheme: uri.Scheme,
+		Host:   uri.Host,
+		Path:   path.Join(uriPath[:idx], "/api", projectId, "store") + "/",
+	}
+
+	return &storeURI, publicKey, nil
+}
+
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.main()
+}
+
+func (c *Client) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *Client) main() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.stopChan:
+			// Try to send events which were already queued before leaving
+			for {
+				select {
+				case event := <-c.eventChan:
+					c.sendEvent(event)
+				default:
+					return
+				}
+			}
+
+		case event := <-c.eventChan:
+			c.sendEvent(event)
+		}
+	}
+}
+
+func (c *Client) ReportError(msg string, data dlog.Data) {
+	event := c.newEvent("error", msg, data)
+
+	// Reporting errors must never block the caller; if the queue is full,
+	// the event is dropped.
+	select {
+	case c.eventChan <- event:
+	default:
+		c.Log.Error("cannot queue event: queue full")
+	}
+}
+
+func (c *Client) newEvent(level, msg string, data dlog.Data) *Event {
+	event := Event{
+		EventId:     dcrypto.RandomHexString(16),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       level,
+		Platform:    "go",
+		ServerName:  c.Cfg.Hostname,
+		Environment: c.Cfg.Environment,
+		Release:     c.Cfg.Release,
+		Message:     EventMessage{Formatted: msg},
+		Tags:        make(map[string]string),
+		Extra:       make(map[string]interface{}),
+	}
+
+	for key, value := range data {
+		isTag := false
+		for _, name := range TagNames {
+			if key == name {
+				isTag = true
+				break
+			}
+		}
+
+		if isTag {
+			event.Tags[key] = fmt.Sprintf("%v", value)
+		} else {
+			event.Extra[key] = value
+		}
+	}
+
+	return &event
+}
+
+func (c *Client) sendEvent(event *Event) {
+	if err := c.doSendEvent(event); err != nil {
+		c.Log.Error("cannot send event: %v", err)
+	}
+}
+
+func (c *Client) doSendEvent(event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot encode event: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.storeURI.String(),
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=go-daemon, "+
+		"sentry_key=%s", c.publicKey)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", auth)
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if !(res.StatusCode >= 200 && res.StatusCode < 300) {
+		bodyData, _ := ioutil.ReadAll(res.Body)
+		if len(bodyData) > 200 {
+			bodyData = append(bodyData[:200], []byte(" [truncated]")...)
+		}
+
+		return fmt.Errorf("request failed with status %d (%s)",
+			res.StatusCode, string(bodyData))
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package sentry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDSN(t *testing.T) {
+	assert := assert.New(t)
+
+	uri, key, err := parseDSN("https://abc123@o1.ingest.sentry.io/42")
+	if assert.NoError(err) {
+		assert.Equal("https://o1.ingest.sentry.io/api/42/store/", uri.String())
+		assert.Equal("abc123", key)
+	}
+
+	uri, key, err = parseDSN("http://key@localhost:9000/sentry/7")
+	if assert.NoError(err) {
+		assert.Equal("http://localhost:9000/sentry/api/7/store/",
+			uri.String())
+		assert.Equal("key", key)
+	}
+
+	_, _, err = parseDSN("https://o1.ingest.sentry.io/42")
+	assert.Error(err)
+
+	_, _, err = parseDSN("https://abc123@o1.ingest.sentry.io/")
+	assert.Error(err)
+}